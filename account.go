@@ -1,22 +1,19 @@
 package try6
 
 import (
-	"regexp"
 	"time"
 
 	"gopkg.in/mgutz/dat.v1"
 
 	"github.com/jllopis/try6/tryerr"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
-	// GravatarURI is the URI of the gravatar service to show the user gravatar
+	// GravatarURI is the URI of the gravatar service to show the user gravatar. It
+	// takes the MD5 hash of the email and the image size.
 	GravatarURI = "https://gravatar.com/avatar/%s?s=%v"
-	// RegexpEmail check that the email is compatible with an email address
-	// TODO(jllopis): in go v1.5 ckeck if is of use net/mail.AddressParser.Parse()
-	RegexpEmail = regexp.MustCompile(`^[^@]+@[^@.]+\.[^@.]+`)
+	// GravatarSize is the size in pixels of the gravatar images
+	GravatarSize = 80
 )
 
 /*
@@ -38,10 +35,10 @@ func NewAccount(email, name, password string) (*Account, error) {
 }
 
 // SetPassword add the given password to the account. First it validates that
-// the password length is correct and then hash it with bcrypt.
+// the password length is correct and then hash it with the DefaultHasher.
 func (account *Account) SetPassword(password string) error {
-	if len(password) < 8 || len(password) > 256 {
-		return tryerr.ErrInvalidPassword
+	if err := validatePassword(password); err != nil {
+		return err
 	}
 	err := account.hashPassword([]byte(password))
 	if err != nil {
@@ -50,31 +47,63 @@ func (account *Account) SetPassword(password string) error {
 	return nil
 }
 
-// hashPassword do the bcrypt hashing and store it to the account
+// validatePassword checks that the password length is between 8 and 256
+func validatePassword(password string) error {
+	if len(password) < 8 || len(password) > 256 {
+		return tryerr.ErrInvalidPassword
+	}
+	return nil
+}
+
+// hashPassword do the hashing and store it to the account
 func (account *Account) hashPassword(password []byte) error {
-	pass, err := bcrypt.GenerateFromPassword(password, 0)
+	pass, err := hashSecret(password)
 	if err != nil {
 		return err
 	}
-	if account.Password == "" {
-		s := string(pass)
-		account.Password = s
-		return nil
-	}
-	account.Password = string(pass)
+	account.PasswordChanged = dat.NullTimeFrom(time.Now().UTC())
+	account.Password = pass
 	return nil
 }
 
 // MatchPassword check if the given password match with the hash stored in the account.
 func (account *Account) MatchPassword(password string) error {
-	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password)); err != nil {
+	if err := compareSecret(account.Password, []byte(password)); err != nil {
 		return err
 	}
 	return nil
 }
 
+// RehashPassword replaces the account password hash with a new one made by the
+// DefaultHasher if the stored one uses another algorithm or weaker parameters.
+// password must be the one that matched the stored hash. It reports whether the
+// hash was replaced. The password change date is kept.
+func (account *Account) RehashPassword(password string) (bool, error) {
+	if account.Password == "" || !NeedsRehash(account.Password) {
+		return false, nil
+	}
+	pass, err := hashSecret([]byte(password))
+	if err != nil {
+		return false, err
+	}
+	account.Password = pass
+	return true, nil
+}
+
 // UpdatePassword updates the hashed password in the account with the new string.
-func (account *Account) UpdatePassword(newPassword string) error {
+//
+// history holds the hashes of the previous passwords of the account, as
+// returned by the store for the directory password policy. If newPassword matches
+// any of them tryerr.ErrPasswordReused is returned and the account is left untouched.
+func (account *Account) UpdatePassword(newPassword string, history ...string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+	for _, h := range history {
+		if compareSecret(h, []byte(newPassword)) == nil {
+			return tryerr.ErrPasswordReused
+		}
+	}
 	err := account.hashPassword([]byte(newPassword))
 	if err != nil {
 		return err
@@ -83,6 +112,20 @@ func (account *Account) UpdatePassword(newPassword string) error {
 	return nil
 }
 
+// PasswordExpired reports whether the account password is older than the maximum
+// age allowed by the policy. If the account has no password change date, its
+// creation date is used instead.
+func (account *Account) PasswordExpired(policy *PasswordPolicy) bool {
+	if policy == nil || policy.MaxAgeDays <= 0 {
+		return false
+	}
+	changed := account.Created
+	if account.PasswordChanged.Valid {
+		changed = account.PasswordChanged.Time
+	}
+	return time.Now().UTC().After(changed.Add(policy.MaxAge()))
+}
+
 // DeletePassword erase the hash from the account. Afterwards the account will
 // have no password so it can not authenticate.
 func (account *Account) DeletePassword() error {
@@ -90,6 +133,21 @@ func (account *Account) DeletePassword() error {
 	return nil
 }
 
+// Verify marks the email of the account as verified, activating it, and returns
+// the record of the status change. Accounts that are not pending verification are
+// left untouched and no change is returned.
+func (account *Account) Verify() (*StatusChange, error) {
+	if account.Status != StatusUnverified {
+		return nil, nil
+	}
+	c, err := NewStatusChange(EntityAccount, account.ID, account.Status, StatusActive, ActorSystem, "email verified")
+	if err != nil {
+		return nil, err
+	}
+	account.Status = StatusActive
+	return c, nil
+}
+
 // Delete marks the account as deleted so it can not be used.
 func (account *Account) Delete() error {
 	account.Deleted = dat.NullTimeFrom(time.Now().UTC())
@@ -103,8 +161,9 @@ The checks performed are:
 
 - Name: must exist and be of length between 1 and 256
 
-- Email: must exist and be a valid email address. Valid email should match regexp:
-  `^[^@]+@[^@.]+\.[^@.]+`
+- Email: must exist and be a valid email address as for ParseEmail
+
+- Profile: the optional profile fields must be valid as for Profile.Validate
 */
 func (account *Account) ValidateFields() error {
 	switch {
@@ -114,9 +173,9 @@ func (account *Account) ValidateFields() error {
 		return tryerr.ErrInvalidEmail
 	case len(account.Name) == 0 || len(account.Name) > 256:
 		return tryerr.ErrInvalidName
-	case len(account.Email) == 0 || len(account.Email) > 256 || RegexpEmail.MatchString(account.Email) == false:
-		return tryerr.ErrInvalidEmail
-	default:
-		return nil
 	}
+	if _, err := ParseEmail(account.Email); err != nil {
+		return err
+	}
+	return account.Profile().Validate()
 }
@@ -0,0 +1,89 @@
+package try6
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestUpdatePasswordHistory(t *testing.T) {
+	a, err := NewAccount("user@example.com", "User", "firstpassword")
+	if err != nil {
+		t.Fatalf("NewAccount: %v", err)
+	}
+	history := []string{a.Password}
+	if err := a.UpdatePassword(""); err != tryerr.ErrInvalidPassword {
+		t.Errorf("empty password: got %v, want %v", err, tryerr.ErrInvalidPassword)
+	}
+	if err := a.UpdatePassword("firstpassword", history...); err != tryerr.ErrPasswordReused {
+		t.Errorf("reused password: got %v, want %v", err, tryerr.ErrPasswordReused)
+	}
+	if err := a.UpdatePassword("secondpassword", history...); err != nil {
+		t.Fatalf("new password: %v", err)
+	}
+	if err := a.MatchPassword("secondpassword"); err != nil {
+		t.Errorf("MatchPassword: %v", err)
+	}
+}
+
+func TestPasswordExpired(t *testing.T) {
+	policy := &PasswordPolicy{MaxAgeDays: 30}
+	a := &Account{Created: time.Now().UTC().Add(-60 * 24 * time.Hour)}
+	if !a.PasswordExpired(policy) {
+		t.Error("password without change date older than policy should be expired")
+	}
+	a.PasswordChanged = dat.NullTimeFrom(time.Now().UTC().Add(-24 * time.Hour))
+	if a.PasswordExpired(policy) {
+		t.Error("recently changed password should not be expired")
+	}
+	if a.PasswordExpired(&PasswordPolicy{}) {
+		t.Error("policy without max age should never expire passwords")
+	}
+}
+
+func TestLockout(t *testing.T) {
+	policy := &PasswordPolicy{LockoutThreshold: 3, LockoutMinutes: 10}
+	a := &Account{Status: StatusActive, FailedLogins: 3}
+	if !a.LockoutReached(policy) {
+		t.Fatal("lockout threshold should be reached")
+	}
+	a.Lock(policy)
+	if !a.Locked() || a.Status != StatusLocked || a.FailedLogins != 0 {
+		t.Fatalf("account not locked: %+v", a)
+	}
+	if d := policy.LockoutDuration(3); d != 40*time.Minute {
+		t.Errorf("third lockout lasts %v, want %v", d, 40*time.Minute)
+	}
+	if d := policy.LockoutDuration(20); d != MaxLockoutDuration {
+		t.Errorf("lockout duration %v exceeds maximum", d)
+	}
+	if !a.RegisterLogin() || a.Locked() || a.Status != StatusActive || a.LockCount != 0 {
+		t.Errorf("account not reset after login: %+v", a)
+	}
+	a.FailedLogins = 3
+	a.Lock(&PasswordPolicy{LockoutThreshold: 3})
+	if !a.Locked() || a.LockedUntil.Valid || a.Status != StatusLocked {
+		t.Fatalf("account not locked until unlocked: %+v", a)
+	}
+	a.Unlock()
+	if a.Locked() || a.Status != StatusActive {
+		t.Errorf("account not unlocked: %+v", a)
+	}
+	u := &Account{Status: StatusUnverified, FailedLogins: 3}
+	u.Lock(policy)
+	u.Unlock()
+	if u.Status != StatusUnverified {
+		t.Errorf("unlock changed status of unverified account to %q", u.Status)
+	}
+	u.Lock(&PasswordPolicy{LockoutThreshold: 3})
+	if !u.Locked() || u.Status != StatusUnverified {
+		t.Fatalf("unverified account not locked until unlocked: %+v", u)
+	}
+	u.Unlock()
+	if u.Locked() {
+		t.Errorf("unverified account not unlocked: %+v", u)
+	}
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/mailer"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+	"github.com/labstack/echo"
+)
+
+// passwordChange holds the data needed to change the password of an account
+type passwordChange struct {
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"`
+}
+
+// CreateAccount handler creates a new account in the directory with the data
+// provided in the body. The account is created unverified and an email
+// verification token is issued. The email is normalized and must be unique as for
+// the case sensitivity of the directory.
+//
+// With the query parameter hashed=true the password is taken as a hash imported
+// from another system (see try6.Account.SetPasswordHash). It is replaced by a
+// hash of the configured algorithm on the first successful login.
+func CreateAccount(sm store.Storer, m *mailer.Mailer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var directoryID string
+		if directoryID = ctx.Param("id"); directoryID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "CreateAccount", Info: "directory id cannot be nil"})
+		}
+		var a try6.Account
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&a); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "accounts"})
+		}
+		if a.ID != "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "create", Info: tryerr.ErrIDNotNull.Error(), Table: "accounts"})
+		}
+		if err := a.ValidateFields(); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "accounts"})
+		}
+		dir, err := sm.GetDirectoryByID(directoryID)
+		if err != nil {
+			if err == tryerr.ErrDirectoryNotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "directories", UID: directoryID})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "directories"})
+		}
+		if err := a.NormalizeEmail(dir.CaseSensitiveEmail); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "accounts"})
+		}
+		inUse, err := sm.EmailInUse(a.EmailKey, dir.CaseSensitiveEmail)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "accounts"})
+		}
+		if inUse {
+			return ctx.JSON(http.StatusConflict, &logMessage{Status: "error", Action: "create", Info: tryerr.ErrDupEmail.Error(), Table: "accounts"})
+		}
+		setPassword := a.SetPassword
+		if ctx.Query("hashed") == "true" {
+			setPassword = a.SetPasswordHash
+		} else {
+			policy, err := sm.GetPasswordPolicy(directoryID)
+			if err != nil {
+				return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "password_creation_policies"})
+			}
+			if err := policy.CheckPassword(a.Password); err != nil {
+				return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "accounts"})
+			}
+		}
+		if err := setPassword(a.Password); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "accounts"})
+		}
+		a.Status = ""
+		if err := sm.SaveAccount(directoryID, &a); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "accounts"})
+		}
+		if err := issueVerificationToken(sm, m, &a, ctx.Request().Header.Get("Accept-Language")); err != nil {
+			log.LogE("error issuing verification token", "pkg", "api", "func", "CreateAccount(store.Storer, *mailer.Mailer)", "account", a.ID, "error", err.Error())
+		}
+		a.Password = ""
+		return ctx.JSON(http.StatusCreated, a)
+	}
+}
+
+// ListAccounts handler returns a page of the accounts that match the query
+// parameters described in listQuery and sets the Link header to the next page.
+// When routed under a directory only its accounts are listed.
+func ListAccounts(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		q, err := listQuery(ctx)
+		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ListAccounts", Info: err.Error(), Table: "accounts"})
+		}
+		if id := ctx.Param("id"); id != "" {
+			q.DirectoryID = id
+		}
+		accounts, next, err := sm.ListAccounts(q)
+		if err != nil {
+			if isListQueryError(err) {
+				return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ListAccounts", Info: err.Error(), Table: "accounts"})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ListAccounts", Info: err.Error(), Table: "accounts"})
+		}
+		for _, a := range accounts {
+			a.Password = ""
+		}
+		if accounts == nil {
+			accounts = []*try6.Account{}
+		}
+		setLinkHeader(ctx, next)
+		return ctx.JSON(http.StatusOK, accounts)
+	}
+}
+
+// UpdateAccountPassword handler changes the password of the account. The current
+// password must be provided and the new one must not be in the account password
+// history as for the directory policy.
+func UpdateAccountPassword(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var accountID string
+		if accountID = ctx.Param("id"); accountID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: "account id cannot be nil"})
+		}
+		var pc passwordChange
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&pc); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error(), Table: "accounts"})
+		}
+		account, err := sm.GetAccountByID(accountID)
+		if err != nil {
+			if err == tryerr.ErrAccountNotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error(), Table: "accounts", UID: accountID})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error(), Table: "accounts"})
+		}
+		policy, err := sm.GetPasswordPolicyByAccountID(account.ID)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error(), Table: "password_creation_policies"})
+		}
+		if err := verifyPassword(sm, account, policy, pc.Password, clientIP(ctx.Request())); err != nil {
+			switch err {
+			case tryerr.ErrAccountLocked:
+				return ctx.JSON(http.StatusForbidden, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error(), Code: "account_locked", UID: account.ID})
+			case tryerr.ErrInvalidCredentials:
+				return ctx.JSON(http.StatusUnauthorized, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error()})
+			default:
+				return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error(), Table: "accounts"})
+			}
+		}
+		history, err := sm.GetPasswordHistory(account.ID, policy.HistoryCount)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error(), Table: "password_history"})
+		}
+		if err := account.UpdatePassword(pc.NewPassword, history...); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error(), Table: "accounts", UID: account.ID})
+		}
+		if err := sm.SaveAccountPassword(account, policy.HistoryCount); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdateAccountPassword", Info: err.Error(), Table: "accounts"})
+		}
+		return ctx.JSON(http.StatusOK, &logMessage{Status: "ok", Action: "UpdateAccountPassword", Table: "accounts", UID: account.ID})
+	}
+}
+
+// GetAccount handler returns the account with its profile and the URL of its gravatar
+func GetAccount(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		account, err := profileAccount(sm, ctx)
+		if err != nil {
+			return profileError(ctx, "GetAccount", err)
+		}
+		account.Password = ""
+		return ctx.JSON(http.StatusOK, &accountResponse{Account: account, Gravatar: account.GravatarURL()})
+	}
+}
+
+// GetAccountProfile handler returns the profile of the account
+func GetAccountProfile(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		account, err := profileAccount(sm, ctx)
+		if err != nil {
+			return profileError(ctx, "GetAccountProfile", err)
+		}
+		return ctx.JSON(http.StatusOK, account.Profile())
+	}
+}
+
+// UpdateAccountProfile handler replaces the profile of the account with the one
+// provided in the body
+func UpdateAccountProfile(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		account, err := profileAccount(sm, ctx)
+		if err != nil {
+			return profileError(ctx, "UpdateAccountProfile", err)
+		}
+		var p try6.Profile
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&p); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdateAccountProfile", Info: err.Error(), Table: "accounts"})
+		}
+		if err := account.SetProfile(&p); err != nil {
+			return profileError(ctx, "UpdateAccountProfile", err)
+		}
+		if err := sm.SaveAccountProfile(account); err != nil {
+			return profileError(ctx, "UpdateAccountProfile", err)
+		}
+		return ctx.JSON(http.StatusOK, account.Profile())
+	}
+}
+
+// accountResponse is an account with its computed fields
+type accountResponse struct {
+	*try6.Account
+	Gravatar string `json:"gravatar"`
+}
+
+// profileAccount returns the account in the request once checked the request is
+// made by the account itself or by an administrator of its tenant
+func profileAccount(sm store.Storer, ctx *echo.Context) (*try6.Account, error) {
+	accountID := ctx.Param("id")
+	if accountID == "" {
+		return nil, tryerr.ErrAccountNotProvided
+	}
+	if _, err := authorizeAccount(sm, ctx.Request(), accountID, true); err != nil {
+		return nil, err
+	}
+	return sm.GetAccountByID(accountID)
+}
+
+// profileError writes the response for an error of the profile handlers
+func profileError(ctx *echo.Context, action string, err error) error {
+	status := http.StatusInternalServerError
+	switch err {
+	case tryerr.ErrAccountNotProvided, tryerr.ErrInvalidName, tryerr.ErrInvalidUsername, tryerr.ErrInvalidPhone,
+		tryerr.ErrInvalidLocale, tryerr.ErrInvalidTimezone, tryerr.ErrInvalidPicture:
+		status = http.StatusBadRequest
+	case tryerr.ErrAccountNotFound:
+		status = http.StatusNotFound
+	case tryerr.ErrInvalidToken, tryerr.ErrAccountAccessDenied:
+		return accessError(ctx, action, err)
+	}
+	return ctx.JSON(status, &logMessage{Status: "error", Action: action, Info: err.Error(), Table: "accounts"})
+}
+
+// UnlockAccount handler removes the lock of an account locked after too many
+// failed logins. Only the administrators of the tenant of the account can unlock it.
+func UnlockAccount(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var accountID string
+		if accountID = ctx.Param("id"); accountID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UnlockAccount", Info: "account id cannot be nil"})
+		}
+		admin, err := authorizeAccount(sm, ctx.Request(), accountID, false)
+		if err != nil {
+			return accessError(ctx, "UnlockAccount", err)
+		}
+		account, err := sm.GetAccountByID(accountID)
+		if err != nil {
+			if err == tryerr.ErrAccountNotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "UnlockAccount", Info: err.Error(), Table: "accounts", UID: accountID})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UnlockAccount", Info: err.Error(), Table: "accounts"})
+		}
+		from := account.Status
+		account.Unlock()
+		if err := sm.SaveAccountLockout(account, from); err != nil {
+			if err == tryerr.ErrInvalidTransition {
+				return ctx.JSON(http.StatusConflict, &logMessage{Status: "error", Action: "UnlockAccount", Info: err.Error(), Table: "accounts", UID: accountID})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UnlockAccount", Info: err.Error(), Table: "accounts"})
+		}
+		recordStatusChange(sm, try6.EntityAccount, account.ID, from, account.Status, accountActor(admin.ID), "unlocked")
+		log.LogI("account unlocked", "pkg", "api", "func", "UnlockAccount(store.Storer)", "account", account.ID)
+		account.Password = ""
+		return ctx.JSON(http.StatusOK, account)
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+)
+
+// newTestAdmin returns an API key of a new account of the admin directory of the
+// tenant
+func newTestAdmin(t *testing.T, sm *memStore, id, tenant string) string {
+	a, err := try6.NewAccount(id+"@example.com", "Admin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.ID, a.Status = id, try6.StatusActive
+	sm.addAccount(&try6.Directory{ID: "admin-" + tenant, TenantUID: tenant, Admin: true}, a)
+	return sm.bearerFor(a.ID)
+}
+
+func TestUnlockAccount(t *testing.T) {
+	sm := newMemStore()
+	a, _ := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	a.Status = try6.StatusActive
+	a.Lock(&try6.PasswordPolicy{LockoutThreshold: 3})
+	sm.SaveAccountLockout(a, try6.StatusUnverified)
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	other := newTestAdmin(t, sm, "other", "other-tenant")
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"account itself", sm.bearerFor(a.ID), http.StatusForbidden},
+		{"admin of another tenant", other, http.StatusForbidden},
+	} {
+		if rec := serveAs(c.bearer, "POST", "/accounts/account/unlock", "/accounts/:id/unlock", UnlockAccount(sm), ""); rec.Code != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+	if got, _ := sm.GetAccountByID(a.ID); !got.Locked() {
+		t.Fatal("account unlocked without authorization")
+	}
+	if rec := serveAs(admin, "POST", "/accounts/account/unlock", "/accounts/:id/unlock", UnlockAccount(sm), ""); rec.Code != http.StatusOK {
+		t.Fatalf("admin unlock: got %d %s", rec.Code, rec.Body)
+	}
+	if got, _ := sm.GetAccountByID(a.ID); got.Locked() || got.Status != try6.StatusActive {
+		t.Errorf("account not unlocked: %+v", got)
+	}
+	if len(sm.changes) != 1 || sm.changes[0].Actor != "account:admin" {
+		t.Errorf("unlock not recorded with the admin as actor: %+v", sm.changes)
+	}
+}
+
+func TestAccountProfileAccess(t *testing.T) {
+	sm := newMemStore()
+	a, _ := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	other := newTestAdmin(t, sm, "other", "other-tenant")
+	profile := `{"name":"New Name"}`
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"admin of another tenant", other, http.StatusForbidden},
+		{"account itself", sm.bearerFor(a.ID), http.StatusOK},
+		{"admin", admin, http.StatusOK},
+	} {
+		if rec := serveAs(c.bearer, "GET", "/accounts/account", "/accounts/:id", GetAccount(sm), ""); rec.Code != c.want {
+			t.Errorf("%s get: got %d, want %d", c.name, rec.Code, c.want)
+		}
+		if rec := serveAs(c.bearer, "GET", "/accounts/account/profile", "/accounts/:id/profile", GetAccountProfile(sm), ""); rec.Code != c.want {
+			t.Errorf("%s get profile: got %d, want %d", c.name, rec.Code, c.want)
+		}
+		if c.want != http.StatusOK {
+			if rec := serveAs(c.bearer, "PUT", "/accounts/account/profile", "/accounts/:id/profile", UpdateAccountProfile(sm), profile); rec.Code != c.want {
+				t.Errorf("%s update profile: got %d, want %d", c.name, rec.Code, c.want)
+			}
+		}
+	}
+	if got, _ := sm.GetAccountByID(a.ID); got.Name == "New Name" {
+		t.Fatal("profile updated without authorization")
+	}
+	if rec := serveAs(sm.bearerFor(a.ID), "PUT", "/accounts/account/profile", "/accounts/:id/profile", UpdateAccountProfile(sm), profile); rec.Code != http.StatusOK {
+		t.Fatalf("update own profile: got %d %s", rec.Code, rec.Body)
+	}
+	if got, _ := sm.GetAccountByID(a.ID); got.Name != "New Name" {
+		t.Errorf("profile not updated: %+v", got.Profile())
+	}
+}
+
+func TestRequestActor(t *testing.T) {
+	sm := newMemStore()
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	for _, c := range []struct {
+		bearer string
+		want   string
+	}{
+		{"", "anonymous"},
+		{"not-a-token", "anonymous"},
+		{admin, "account:admin"},
+	} {
+		var got string
+		h := func(ctx *echo.Context) error {
+			got = requestActor(sm, ctx)
+			return nil
+		}
+		e := echo.New()
+		e.Post("/", h)
+		req, _ := http.NewRequest("POST", "/", nil)
+		req.Header.Set("X-Try6-Actor", "account:someone-else")
+		if c.bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+c.bearer)
+		}
+		req.RemoteAddr = "192.0.2.1:1234"
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		if got != c.want {
+			t.Errorf("bearer %q: got actor %q, want %q", c.bearer, got, c.want)
+		}
+	}
+}
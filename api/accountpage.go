@@ -0,0 +1,174 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Paths of the pages the links mailed to the accounts open. They are served under
+// the /api/v1 prefix and post their form back to the same path.
+const (
+	VerifyEmailPath   = "/api/v1/accounts/verify"
+	PasswordResetPath = "/api/v1/accounts/password/reset/confirm"
+)
+
+// accountPage holds the data rendered in the pages the mailed links open. The page
+// shows a form with the token of the link, asking for a new password if
+// AskPassword is set, or only the Success message once Done.
+type accountPage struct {
+	Title       string
+	Info        string
+	Success     string
+	Error       string
+	Token       string
+	Submit      string
+	AskPassword bool
+	Done        bool
+}
+
+// accountTemplate renders the pages the mailed links open
+var accountTemplate = template.Must(template.New("account").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; font-family: -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; background: #f5f5f5; color: #212121; }
+main { max-width: 360px; margin: 10vh auto; padding: 32px; background: #fff; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,.15); }
+h1 { font-size: 20px; margin: 0 0 16px; text-align: center; }
+p { margin: 0 0 24px; text-align: center; color: #616161; }
+label { display: block; margin: 16px 0 4px; font-size: 14px; }
+input[type=password] { box-sizing: border-box; width: 100%; padding: 10px; border: 1px solid #bdbdbd; border-radius: 4px; font-size: 16px; }
+button { width: 100%; margin-top: 24px; padding: 12px; border: 0; border-radius: 4px; background: #1976d2; color: #fff; font-size: 16px; cursor: pointer; }
+.error { margin: 0 0 16px; padding: 10px; border-radius: 4px; background: #ffebee; color: #b71c1c; font-size: 14px; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+{{if .Error}}<div class="error" role="alert">{{.Error}}</div>{{end}}
+{{if .Done}}<p>{{.Success}}</p>{{else if .Info}}<p>{{.Info}}</p>{{end}}
+{{if and .Token (not .Done)}}<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+{{if .AskPassword}}<label for="password">New password</label>
+<input id="password" name="password" type="password" autocomplete="new-password" required autofocus>
+{{end}}<button type="submit">{{.Submit}}</button>
+</form>{{end}}
+</main>
+</body>
+</html>
+`))
+
+// VerifyEmailPage handler is the page the email verification links open. It asks
+// the account to confirm, so the token is not used up by mail scanners that
+// follow links.
+func VerifyEmailPage(ctx *echo.Context) error {
+	return renderAccountPage(ctx, http.StatusOK, verifyEmailPage(ctx.Query("token")))
+}
+
+// PasswordResetPage handler is the page the password reset links open. It asks for
+// the new password of the account.
+func PasswordResetPage(ctx *echo.Context) error {
+	return renderAccountPage(ctx, http.StatusOK, passwordResetPage(ctx.Query("token")))
+}
+
+// verifyEmailPage returns the email verification page for the token
+func verifyEmailPage(token string) *accountPage {
+	p := &accountPage{
+		Title:   "Verify your email",
+		Info:    "Confirm the email address of your account.",
+		Success: "Your email has been verified. You can close this window.",
+		Token:   token,
+		Submit:  "Verify email",
+	}
+	if token == "" {
+		p.Info, p.Error = "", accountMessage(tryerr.ErrInvalidToken.Error())
+	}
+	return p
+}
+
+// passwordResetPage returns the password reset page for the token
+func passwordResetPage(token string) *accountPage {
+	p := &accountPage{
+		Title:       "Reset your password",
+		Success:     "Your password has been changed. You can close this window.",
+		Token:       token,
+		Submit:      "Change password",
+		AskPassword: true,
+	}
+	if token == "" {
+		p.Error = accountMessage(tryerr.ErrInvalidToken.Error())
+	}
+	return p
+}
+
+// isFormPost tells if the request is a form posted by one of the account pages
+func isFormPost(r *http.Request) bool {
+	return r.Method == "POST" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+}
+
+// accountReply returns the function that writes the responses of a handler the
+// account pages post to. Forms get the page back with the outcome, the rest JSON.
+func accountReply(ctx *echo.Context, page *accountPage) func(int, *logMessage) error {
+	if !isFormPost(ctx.Request()) {
+		return func(status int, m *logMessage) error { return ctx.JSON(status, m) }
+	}
+	return func(status int, m *logMessage) error {
+		if status < http.StatusBadRequest {
+			page.Done, page.Error = true, ""
+		} else {
+			page.Error = accountMessage(m.Info)
+			if status >= http.StatusInternalServerError {
+				log.LogE("account page error", "pkg", "api", "func", m.Action, "error", m.Info)
+				page.Error = accountMessage("")
+			}
+		}
+		return renderAccountPage(ctx, status, page)
+	}
+}
+
+// accountMessages holds the messages shown in the account pages for the errors of
+// the handlers
+var accountMessages = map[string]string{
+	tryerr.ErrInvalidToken.Error():    "This link is not valid or has expired.",
+	"token not provided":              "This link is not valid or has expired.",
+	tryerr.ErrInvalidPassword.Error(): "The password must have between 8 and 256 characters.",
+	tryerr.ErrPasswordReused.Error():  "You have used this password recently. Please choose another one.",
+}
+
+// accountMessage returns the message shown in the account pages for the error.
+// Errors without a message of their own are shown as they are, or as a generic
+// message if empty.
+func accountMessage(info string) string {
+	if m, ok := accountMessages[info]; ok {
+		return m
+	}
+	if info == "" {
+		return "Something went wrong. Please try again later."
+	}
+	return strings.ToUpper(info[:1]) + info[1:] + "."
+}
+
+// renderAccountPage writes the account page. The page can not be framed nor cached.
+func renderAccountPage(ctx *echo.Context, status int, page *accountPage) error {
+	h := ctx.Response().Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("Pragma", "no-cache")
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	h.Set("Referrer-Policy", "no-referrer")
+	ctx.Response().WriteHeader(status)
+	if err := accountTemplate.Execute(ctx.Response(), page); err != nil {
+		log.LogE("error rendering account page", "pkg", "api", "func", "renderAccountPage(*echo.Context, int, *accountPage)", "error", err.Error())
+		return err
+	}
+	return nil
+}
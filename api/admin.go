@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// accountPrincipal returns the account that makes the request with a bearer token.
+// Client credentials tokens do not act for an account and get
+// tryerr.ErrAccountAccessDenied.
+func accountPrincipal(sm store.Storer, r *http.Request) (*try6.Account, error) {
+	b, err := authenticateBearer(sm, r)
+	if err != nil {
+		return nil, err
+	}
+	if b.apiKey == nil && b.subject == b.clientID {
+		return nil, tryerr.ErrAccountAccessDenied
+	}
+	account, err := grantAccount(sm, b.subject)
+	if err != nil {
+		switch err {
+		case tryerr.ErrAccountNotFound, tryerr.ErrDisabled, tryerr.ErrDeleted:
+			return nil, tryerr.ErrInvalidToken
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+// authorizeAccount checks the request is made by an administrator of the tenant of
+// the account or, when self is true, by the account itself. It returns the account
+// that makes the request.
+func authorizeAccount(sm store.Storer, r *http.Request, accountID string, self bool) (*try6.Account, error) {
+	principal, err := accountPrincipal(sm, r)
+	if err != nil {
+		return nil, err
+	}
+	if self && principal.ID == accountID {
+		return principal, nil
+	}
+	admin, err := administers(sm, principal.ID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if !admin {
+		return nil, tryerr.ErrAccountAccessDenied
+	}
+	return principal, nil
+}
+
+// authorizeSelf checks the request is made by the account itself and returns it
+func authorizeSelf(sm store.Storer, r *http.Request, accountID string) (*try6.Account, error) {
+	principal, err := accountPrincipal(sm, r)
+	if err != nil {
+		return nil, err
+	}
+	if principal.ID != accountID {
+		return nil, tryerr.ErrAccountAccessDenied
+	}
+	return principal, nil
+}
+
+// authorizeTenant checks the request is made by an administrator of the tenant and
+// returns the account that makes the request
+func authorizeTenant(sm store.Storer, r *http.Request, tenantID string) (*try6.Account, error) {
+	principal, err := accountPrincipal(sm, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := tenantAdmin(sm, principal.ID, tenantID); err != nil {
+		return nil, err
+	}
+	return principal, nil
+}
+
+// authorizeEntity checks the request is made by an administrator of the tenant of
+// the item of the entity and returns the account that makes the request. The tenant
+// of an account is any tenant of its directories.
+func authorizeEntity(sm store.Storer, r *http.Request, entity, id string) (*try6.Account, error) {
+	if entity == try6.EntityAccount {
+		return authorizeAccount(sm, r, id, false)
+	}
+	principal, err := accountPrincipal(sm, r)
+	if err != nil {
+		return nil, err
+	}
+	tenantID, err := entityTenant(sm, entity, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tenantAdmin(sm, principal.ID, tenantID); err != nil {
+		return nil, err
+	}
+	return principal, nil
+}
+
+// entityTenant returns the tenant the item of the entity belongs to. Accounts are
+// not supported as they can belong to several tenants.
+func entityTenant(sm store.Storer, entity, id string) (string, error) {
+	switch entity {
+	case try6.EntityTenant:
+		return id, nil
+	case try6.EntityDirectory:
+		d, err := sm.GetDirectoryByID(id)
+		if err != nil {
+			return "", err
+		}
+		return d.TenantUID, nil
+	case try6.EntityScope:
+		s, err := sm.GetScopeByID(id)
+		if err != nil {
+			return "", err
+		}
+		return s.TenantID, nil
+	case try6.EntityKey:
+		k, err := sm.GetKeyByID(id)
+		if err != nil {
+			return "", err
+		}
+		return k.TenantID, nil
+	case try6.EntityClient:
+		c, err := sm.GetClientByID(id)
+		if err != nil {
+			return "", err
+		}
+		return entityTenant(sm, try6.EntityScope, c.ScopeID)
+	}
+	return "", tryerr.ErrInvalidEntity
+}
+
+// tenantAdmin checks the account belongs to a usable admin directory of the tenant.
+// It returns tryerr.ErrAccountAccessDenied otherwise.
+func tenantAdmin(sm store.Storer, accountID, tenantID string) error {
+	tenants, err := adminTenants(sm, accountID)
+	if err != nil {
+		return err
+	}
+	if tenantID == "" || !tenants[tenantID] {
+		return tryerr.ErrAccountAccessDenied
+	}
+	return nil
+}
+
+// adminTenants returns the tenants of the usable admin directories of the account
+func adminTenants(sm store.Storer, accountID string) (map[string]bool, error) {
+	dirs, err := sm.GetDirectoriesByAccountID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	tenants := map[string]bool{}
+	for _, d := range dirs {
+		if d.Admin && d.TenantUID != "" && try6.Usable(d.Status) == nil {
+			tenants[d.TenantUID] = true
+		}
+	}
+	return tenants, nil
+}
+
+// administers tells if the admin account belongs to a usable admin directory of a
+// tenant the account belongs to
+func administers(sm store.Storer, adminID, accountID string) (bool, error) {
+	tenants, err := adminTenants(sm, adminID)
+	if err != nil {
+		return false, err
+	}
+	if len(tenants) == 0 {
+		return false, nil
+	}
+	dirs, err := sm.GetDirectoriesByAccountID(accountID)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range dirs {
+		if tenants[d.TenantUID] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// accessError writes the response for a request that could not be authorized
+func accessError(ctx *echo.Context, action string, err error) error {
+	switch err {
+	case tryerr.ErrInvalidToken:
+		return bearerFail(ctx, http.StatusUnauthorized, errInvalidToken, err.Error())
+	case tryerr.ErrAccountAccessDenied:
+		return bearerFail(ctx, http.StatusForbidden, errInsufficientScope, err.Error())
+	}
+	return oauthServerError(ctx, action, err)
+}
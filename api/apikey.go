@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// apiKeyRequest holds the name of a new API key, the scopes it is restricted to,
+// none if empty, and when it expires, never if not set
+type apiKeyRequest struct {
+	Name    string    `json:"name"`
+	Scope   string    `json:"scope"`
+	Expires time.Time `json:"expires"`
+}
+
+// apiKeyResponse is an API key along with the key to send as a bearer token,
+// returned only when it is created
+type apiKeyResponse struct {
+	*try6.APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKey handler creates an API key of the account. The key is returned only
+// in this response and authenticates as the account wherever an access token is
+// accepted, with the Authorization: Bearer header. The API key handlers can only be
+// used by the account itself or an administrator of its tenant.
+func CreateAPIKey(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		principal, err := authorizeAccount(sm, ctx.Request(), ctx.Param("id"), true)
+		if err != nil {
+			return accessError(ctx, "CreateAPIKey", err)
+		}
+		account, err := sm.GetAccountByID(ctx.Param("id"))
+		if err != nil {
+			return apiKeyError(ctx, "CreateAPIKey", err)
+		}
+		var r apiKeyRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "CreateAPIKey", Info: err.Error(), Table: "api_keys"})
+		}
+		k, key, err := try6.NewAPIKey(account.ID, r.Name, r.Scope, r.Expires)
+		if err == nil {
+			err = sm.SaveAPIKey(k)
+		}
+		if err != nil {
+			return apiKeyError(ctx, "CreateAPIKey", err)
+		}
+		log.LogI("api key created", "pkg", "api", "func", "CreateAPIKey(store.Storer)", "id", k.ID, "account", account.ID, "actor", accountActor(principal.ID))
+		return ctx.JSON(http.StatusCreated, &apiKeyResponse{APIKey: k, Key: key})
+	}
+}
+
+// GetAPIKeys handler returns the API keys of the account, without their secrets
+func GetAPIKeys(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		if _, err := authorizeAccount(sm, ctx.Request(), ctx.Param("id"), true); err != nil {
+			return accessError(ctx, "GetAPIKeys", err)
+		}
+		account, err := sm.GetAccountByID(ctx.Param("id"))
+		if err != nil {
+			return apiKeyError(ctx, "GetAPIKeys", err)
+		}
+		ks, err := sm.GetAPIKeysByAccountID(account.ID)
+		if err != nil {
+			return apiKeyError(ctx, "GetAPIKeys", err)
+		}
+		if ks == nil {
+			ks = []*try6.APIKey{}
+		}
+		return ctx.JSON(http.StatusOK, ks)
+	}
+}
+
+// DeleteAPIKey handler deletes the API key of the account, that stops
+// authenticating at once
+func DeleteAPIKey(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		accountID, id := ctx.Param("id"), ctx.Param("key")
+		principal, err := authorizeAccount(sm, ctx.Request(), accountID, true)
+		if err != nil {
+			return accessError(ctx, "DeleteAPIKey", err)
+		}
+		if err := sm.DeleteAPIKey(accountID, id); err != nil {
+			return apiKeyError(ctx, "DeleteAPIKey", err)
+		}
+		log.LogI("api key deleted", "pkg", "api", "func", "DeleteAPIKey(store.Storer)", "id", id, "account", accountID, "actor", accountActor(principal.ID))
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+// apiKeyError writes the response for an error of the API key handlers
+func apiKeyError(ctx *echo.Context, action string, err error) error {
+	status := http.StatusInternalServerError
+	switch err {
+	case tryerr.ErrInvalidName, tryerr.ErrInvalidExpiration, tryerr.ErrNilUID:
+		status = http.StatusBadRequest
+	case tryerr.ErrAccountNotFound, tryerr.ErrAPIKeyNotFound:
+		status = http.StatusNotFound
+	}
+	return ctx.JSON(status, &logMessage{Status: "error", Action: action, Info: err.Error(), Table: "api_keys"})
+}
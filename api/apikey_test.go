@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jllopis/try6"
+)
+
+func TestAPIKeyAccess(t *testing.T) {
+	sm := newMemStore()
+	a, _ := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	a.Status = try6.StatusActive
+	sm.SaveAccountLockout(a, try6.StatusUnverified)
+	self := sm.bearerFor(a.ID)
+	other, _ := newTestAccount(t, sm, "other", "other@example.com", "password1")
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	foreign := newTestAdmin(t, sm, "foreign", "other-tenant")
+	const path, route = "/accounts/account/api_keys", "/accounts/:id/api_keys"
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"another account", sm.bearerFor(other.ID), http.StatusForbidden},
+		{"admin of another tenant", foreign, http.StatusForbidden},
+		{"account itself", self, http.StatusCreated},
+		{"tenant admin", admin, http.StatusCreated},
+	} {
+		if rec := serveAs(c.bearer, "POST", path, route, CreateAPIKey(sm), `{"name":"ci"}`); rec.Code != c.want {
+			t.Errorf("create by %s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+	if rec := serveAs(sm.bearerFor(other.ID), "GET", path, route, GetAPIKeys(sm), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("list by another account: got %d", rec.Code)
+	}
+	rec := serveAs(self, "GET", path, route, GetAPIKeys(sm), "")
+	var ks []*try6.APIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &ks); err != nil || rec.Code != http.StatusOK || len(ks) != 3 {
+		t.Fatalf("list: got %d %s", rec.Code, rec.Body)
+	}
+	del := path + "/" + ks[0].ID
+	if rec := serveAs(foreign, "DELETE", del, route+"/:key", DeleteAPIKey(sm), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("delete by admin of another tenant: got %d", rec.Code)
+	}
+	if rec := serveAs(admin, "DELETE", del, route+"/:key", DeleteAPIKey(sm), ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete by tenant admin: got %d %s", rec.Code, rec.Body)
+	}
+}
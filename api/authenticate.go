@@ -0,0 +1,261 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+	"github.com/labstack/echo"
+)
+
+// credentials holds the data sent by a client to authenticate an account
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Authenticate handler checks the email and password provided in the body against
+// the stored account. If the password has expired as for the directory policy, the
+// account is not authenticated and a password change is required. Unverified
+// accounts are only authenticated if one of their directories allows it. Disabled
+// accounts, or accounts whose directories or tenants are all disabled, are
+// rejected.
+//
+// Failed logins are recorded. Accounts are locked when they reach the threshold of
+// the directory policy and addresses with too many failures are rejected.
+//
+// Accounts with a second factor enrolled receive an MFA challenge token that must
+// be sent to AuthenticateMFA along with a code to complete the authentication.
+// Accounts that must enroll one first are rejected with an MFA enrollment token
+// that authorizes EnrollTOTP and ConfirmTOTP.
+func Authenticate(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var c credentials
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&c); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Table: "accounts"})
+		}
+		account, mfa, err := login(sm, c.Email, c.Password, clientIP(ctx.Request()), nil)
+		if err == tryerr.ErrMFARequired {
+			return mfaEnrollment(ctx, sm, account)
+		}
+		if err != nil {
+			return loginError(ctx, account, err)
+		}
+		if mfa {
+			return mfaChallenge(ctx, sm, account)
+		}
+		return authenticated(ctx, account)
+	}
+}
+
+/*
+login checks the email and password of an account as described in Authenticate. If
+dirs is not nil, only the accounts of those directories can authenticate.
+
+It returns the account authenticated and whether it must complete the
+authentication with a second factor. The errors returned for the account rejected
+are tryerr.ErrTooManyAttempts, ErrInvalidCredentials, ErrAccountLocked,
+ErrDisabled, ErrDeleted, ErrEmailUnverified, ErrPasswordExpired and
+ErrMFARequired. The account is returned along with them when it is known.
+*/
+func login(sm store.Storer, email, password, ip string, dirs []*try6.Directory) (*try6.Account, bool, error) {
+	if try6.LoginIPThreshold > 0 {
+		n, err := sm.CountLoginFailuresByIP(ip, time.Now().UTC().Add(-try6.LoginIPWindow))
+		if err != nil {
+			return nil, false, err
+		}
+		if n >= try6.LoginIPThreshold {
+			return nil, false, tryerr.ErrTooManyAttempts
+		}
+	}
+	account, err := sm.GetAccountByEmail(email)
+	if err == nil && dirs != nil {
+		var member bool
+		if member, err = inDirectories(sm, account.ID, dirs); err == nil && !member {
+			err = tryerr.ErrEmailNotFound
+		}
+	}
+	if err != nil {
+		if err == tryerr.ErrEmailNotFound {
+			recordLoginFailure(sm, &try6.LoginFailure{Email: email, IP: ip, Reason: try6.FailureUnknownEmail})
+			return nil, false, tryerr.ErrInvalidCredentials
+		}
+		return nil, false, err
+	}
+	policy, err := sm.GetPasswordPolicyByAccountID(account.ID)
+	if err != nil {
+		return account, false, err
+	}
+	if err := verifyPassword(sm, account, policy, password, ip); err != nil {
+		return account, false, err
+	}
+	if err := usableAccount(sm, account); err != nil {
+		return account, false, err
+	}
+	if account.Status == try6.StatusUnverified {
+		allowed, err := allowUnverifiedLogin(sm, account.ID)
+		if err != nil {
+			return account, false, err
+		}
+		if !allowed {
+			return account, false, tryerr.ErrEmailUnverified
+		}
+	}
+	if account.PasswordExpired(policy) {
+		return account, false, tryerr.ErrPasswordExpired
+	}
+	mfa, err := sm.GetAccountMFA(account.ID, try6.MFATotp)
+	if err != nil && err != tryerr.ErrMFANotFound {
+		return account, false, err
+	}
+	required, err := requireMFA(sm, account.ID)
+	if err != nil {
+		return account, false, err
+	}
+	if mfa != nil && mfa.Active() {
+		return account, true, nil
+	}
+	if required {
+		return account, false, tryerr.ErrMFARequired
+	}
+	return account, false, nil
+}
+
+// inDirectories reports whether the account belongs to any of the directories
+func inDirectories(sm store.Storer, accountID string, dirs []*try6.Directory) (bool, error) {
+	own, err := sm.GetDirectoriesByAccountID(accountID)
+	if err != nil {
+		return false, err
+	}
+	for _, o := range own {
+		for _, d := range dirs {
+			if o.ID == d.ID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// loginError writes the response for an account rejected by login or loginMFA
+func loginError(ctx *echo.Context, account *try6.Account, err error) error {
+	var uid string
+	if account != nil {
+		uid = account.ID
+	}
+	switch err {
+	case tryerr.ErrTooManyAttempts:
+		return ctx.JSON(http.StatusTooManyRequests, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Code: "too_many_attempts"})
+	case tryerr.ErrInvalidTransition:
+		return ctx.JSON(http.StatusConflict, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Code: "status_changed", UID: uid})
+	case tryerr.ErrInvalidCredentials, tryerr.ErrInvalidToken, tryerr.ErrInvalidMFACode, tryerr.ErrMFANotFound:
+		return ctx.JSON(http.StatusUnauthorized, &logMessage{Status: "error", Action: "authenticate", Info: err.Error()})
+	case tryerr.ErrAccountLocked:
+		return ctx.JSON(http.StatusForbidden, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Code: "account_locked", UID: uid})
+	case tryerr.ErrDisabled, tryerr.ErrDeleted:
+		return ctx.JSON(http.StatusForbidden, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Code: "account_disabled", UID: uid})
+	case tryerr.ErrEmailUnverified:
+		return ctx.JSON(http.StatusForbidden, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Code: "email_unverified", UID: uid})
+	case tryerr.ErrPasswordExpired:
+		return ctx.JSON(http.StatusForbidden, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Code: "password_change_required", UID: uid})
+	case tryerr.ErrMFARequired:
+		return ctx.JSON(http.StatusForbidden, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Code: "mfa_enrollment_required", UID: uid})
+	}
+	return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Table: "accounts"})
+}
+
+// authenticated writes the response of a successful authentication
+func authenticated(ctx *echo.Context, account *try6.Account) error {
+	account.Password = ""
+	return ctx.JSON(http.StatusOK, account)
+}
+
+// verifyPassword checks the password of the account applying the lockout rules of
+// the policy. Locked accounts are rejected without checking the password. Every
+// failure is recorded and the account is locked when it reaches the threshold.
+func verifyPassword(sm store.Storer, account *try6.Account, policy *try6.PasswordPolicy, password, ip string) error {
+	failure := &try6.LoginFailure{AccountID: dat.NullStringFrom(account.ID), Email: account.Email, IP: ip}
+	if account.Locked() {
+		failure.Reason = try6.FailureLocked
+		recordLoginFailure(sm, failure)
+		return tryerr.ErrAccountLocked
+	}
+	if err := account.MatchPassword(password); err != nil {
+		failure.Reason = try6.FailureBadPassword
+		if err := registerFailure(sm, account, policy, failure); err != nil {
+			return err
+		}
+		return tryerr.ErrInvalidCredentials
+	}
+	rehashPassword(sm, account, password)
+	from := account.Status
+	if account.RegisterLogin() {
+		if err := sm.SaveAccountLockout(account, from); err != nil {
+			return err
+		}
+		recordStatusChange(sm, try6.EntityAccount, account.ID, from, account.Status, try6.ActorSystem, "successful login after lockout")
+	}
+	return nil
+}
+
+// rehashPassword upgrades the stored password hash of the account if it was made
+// with another algorithm or weaker parameters than the configured ones. Errors are
+// logged but do not fail the authentication.
+func rehashPassword(sm store.Storer, account *try6.Account, password string) {
+	rehashed, err := account.RehashPassword(password)
+	if err == nil && rehashed {
+		err = sm.SaveAccountPasswordHash(account)
+	}
+	if err != nil {
+		log.LogE("error rehashing password", "pkg", "api", "func", "rehashPassword(store.Storer, *try6.Account, string)", "account", account.ID, "error", err.Error())
+	}
+}
+
+// registerFailure records the failed login and increments the failed logins of the
+// account, locking it if it reaches the threshold of the policy
+func registerFailure(sm store.Storer, account *try6.Account, policy *try6.PasswordPolicy, failure *try6.LoginFailure) error {
+	recordLoginFailure(sm, failure)
+	n, err := sm.IncFailedLogins(account.ID)
+	if err != nil {
+		return err
+	}
+	account.FailedLogins = n
+	if account.LockoutReached(policy) {
+		from := account.Status
+		account.Lock(policy)
+		if err := sm.SaveAccountLockout(account, from); err != nil {
+			if err == tryerr.ErrInvalidTransition {
+				// the status changed meanwhile. The failure is counted anyway.
+				return nil
+			}
+			return err
+		}
+		recordStatusChange(sm, try6.EntityAccount, account.ID, from, account.Status, try6.ActorSystem, "too many failed logins")
+		log.LogW("account locked", "pkg", "api", "func", "registerFailure(store.Storer, *try6.Account, *try6.PasswordPolicy, *try6.LoginFailure)", "account", account.ID, "until", account.LockedUntil.Time)
+	}
+	return nil
+}
+
+// recordLoginFailure saves the failed login. Errors are logged but not returned so
+// they do not change the response to the client.
+func recordLoginFailure(sm store.Storer, f *try6.LoginFailure) {
+	if err := sm.SaveLoginFailure(f); err != nil {
+		log.LogE("error recording login failure", "pkg", "api", "func", "recordLoginFailure(store.Storer, *try6.LoginFailure)", "error", err.Error())
+	}
+}
+
+// clientIP returns the address of the client that made the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// csrfCookie is the cookie that protects the login form against cross site
+// request forgery. Its value must be sent back in the csrf_token field.
+const csrfCookie = "try6_csrf"
+
+// Error codes of the authorization endpoint
+const (
+	errUnsupportedResponseType = "unsupported_response_type"
+	errAccessDenied            = "access_denied"
+)
+
+// authorizeRequest holds the parameters of an authorization request
+type authorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// authorization is an authorization request validated for its client
+type authorization struct {
+	req      *authorizeRequest
+	client   *try6.Client
+	scope    *try6.Scope
+	branding *try6.Branding
+	redirect string
+}
+
+// authorizeError is an error of an authorization request. It is sent back to the
+// client in the redirect URI, or shown in the login page if the request has no
+// valid redirect URI.
+type authorizeError struct {
+	code        string
+	description string
+}
+
+// Authorize handler is the OAuth 2.0 authorization endpoint. It validates the
+// authorization request and shows the login page of the tenant of the client.
+//
+// Only the code response type is supported and the client must send a S256 PKCE
+// code challenge. The redirect URI must be one of the client ones, and can be
+// omitted if the client has only one. The state and nonce are kept and returned to
+// the client with the code and in the ID token.
+func Authorize(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		if err := ctx.Request().ParseForm(); err != nil {
+			return loginErrorPage(ctx, http.StatusBadRequest, nil, "The authorization request is not valid.")
+		}
+		a, aerr := authorize(sm, parseAuthorizeRequest(ctx.Request().Form))
+		if aerr != nil {
+			return authorizeFail(ctx, a, aerr)
+		}
+		csrf, err := csrfToken(ctx)
+		if err != nil {
+			return authorizeServerError(ctx, a, "Authorize", err)
+		}
+		return renderLogin(ctx, http.StatusOK, a.page(csrf))
+	}
+}
+
+// AuthorizeLogin handler authenticates the account with the login page form,
+// against the directories mapped to the scope of the client. Accounts with a
+// second factor enrolled are asked for a code, and the account is asked for its
+// consent to third party clients. Once authenticated, the account is redirected to
+// the client with an authorization code, or with an access_denied error if it
+// does not consent.
+func AuthorizeLogin(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		r := ctx.Request()
+		if err := r.ParseForm(); err != nil {
+			return loginErrorPage(ctx, http.StatusBadRequest, nil, "The authorization request is not valid.")
+		}
+		a, aerr := authorize(sm, parseAuthorizeRequest(r.PostForm))
+		if aerr != nil {
+			return authorizeFail(ctx, a, aerr)
+		}
+		csrf, err := csrfToken(ctx)
+		if err != nil {
+			return authorizeServerError(ctx, a, "AuthorizeLogin", err)
+		}
+		page := a.page(csrf)
+		account, amr, status, err := loginForm(sm, ctx, page, a.scope)
+		if err != nil {
+			return authorizeServerError(ctx, a, "AuthorizeLogin", err)
+		}
+		if account == nil {
+			return renderLogin(ctx, status, page)
+		}
+		ok, err := askConsent(sm, ctx, page, a.client, account, amr, a.req.Scope)
+		if err != nil {
+			if err == tryerr.ErrConsentDenied {
+				return authorizeFail(ctx, a, &authorizeError{errAccessDenied, err.Error()})
+			}
+			return authorizeServerError(ctx, a, "AuthorizeLogin", err)
+		}
+		if !ok {
+			return renderLogin(ctx, http.StatusOK, page)
+		}
+		code, secret, err := try6.NewAuthCode(a.client.ID, account.ID, a.req.RedirectURI, a.req.Scope, a.req.Nonce, a.req.CodeChallenge, amr, time.Now())
+		if err == nil {
+			err = sm.SaveAuthCode(code)
+		}
+		if err != nil {
+			return authorizeServerError(ctx, a, "AuthorizeLogin", err)
+		}
+		log.LogI("authorization code issued", "pkg", "api", "func", "AuthorizeLogin(store.Storer)", "client", a.client.ID, "account", account.ID)
+		return ctx.Redirect(http.StatusFound, redirectURL(a.redirect, url.Values{"code": {secret}, "state": {a.req.State}}))
+	}
+}
+
+// loginForm authenticates the account with the login page form, against the
+// directories mapped to the scope, and returns it along with the methods it
+// authenticated with. Accounts with a second factor enrolled are asked for a code.
+// Accounts that come back from the consent page are recovered from their consent
+// token. If the login fails or needs another step no account is returned and the
+// page is ready to be rendered with the status returned. Only unexpected errors
+// are returned.
+func loginForm(sm store.Storer, ctx *echo.Context, page *loginPage, scope *try6.Scope) (*try6.Account, []string, int, error) {
+	r := ctx.Request()
+	page.Email = r.PostFormValue("email")
+	if c, err := r.Cookie(csrfCookie); err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.PostFormValue("csrf_token"))) != 1 {
+		page.Error = loginMessage(tryerr.ErrInvalidContext)
+		return nil, nil, http.StatusForbidden, nil
+	}
+	ip := clientIP(r)
+	amr := []string{try6.AMRPassword}
+	var account *try6.Account
+	var err error
+	if token := r.PostFormValue("consent_token"); token != "" {
+		account, amr, err = loginConsent(sm, token)
+	} else if token := r.PostFormValue("mfa_token"); token != "" {
+		account, err = loginMFA(sm, &mfaAuthentication{Token: token, Code: r.PostFormValue("code"), RecoveryCode: r.PostFormValue("recovery_code")}, ip)
+		if err == tryerr.ErrInvalidMFACode || err == tryerr.ErrMFANotFound {
+			page.MFAToken = token
+			page.Email = account.Email
+		}
+		amr = append(amr, try6.AMROTP, try6.AMRMFA)
+	} else {
+		dirs, derr := sm.GetDirectoriesByScopeID(scope.ID)
+		if derr != nil {
+			return nil, nil, 0, derr
+		}
+		if dirs == nil {
+			dirs = []*try6.Directory{}
+		}
+		var mfa bool
+		account, mfa, err = login(sm, page.Email, r.PostFormValue("password"), ip, dirs)
+		if err == nil && mfa {
+			_, secret, err := newMFAChallenge(sm, account)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			page.MFAToken = secret
+			page.Email = account.Email
+			return nil, nil, http.StatusOK, nil
+		}
+	}
+	if err != nil {
+		if _, ok := loginMessages[err]; !ok {
+			return nil, nil, 0, err
+		}
+		page.Error = loginMessage(err)
+		return nil, nil, http.StatusUnauthorized, nil
+	}
+	return account, amr, 0, nil
+}
+
+// parseAuthorizeRequest returns the authorization request with the parameters
+func parseAuthorizeRequest(v url.Values) *authorizeRequest {
+	return &authorizeRequest{
+		ResponseType:        v.Get("response_type"),
+		ClientID:            v.Get("client_id"),
+		RedirectURI:         v.Get("redirect_uri"),
+		Scope:               v.Get("scope"),
+		State:               v.Get("state"),
+		Nonce:               v.Get("nonce"),
+		CodeChallenge:       v.Get("code_challenge"),
+		CodeChallengeMethod: v.Get("code_challenge_method"),
+	}
+}
+
+// params returns the parameters of the request that are set
+func (ar *authorizeRequest) params() map[string]string {
+	p := map[string]string{}
+	for k, v := range map[string]string{
+		"response_type":         ar.ResponseType,
+		"client_id":             ar.ClientID,
+		"redirect_uri":          ar.RedirectURI,
+		"scope":                 ar.Scope,
+		"state":                 ar.State,
+		"nonce":                 ar.Nonce,
+		"code_challenge":        ar.CodeChallenge,
+		"code_challenge_method": ar.CodeChallengeMethod,
+	} {
+		if v != "" {
+			p[k] = v
+		}
+	}
+	return p
+}
+
+// authorize validates the authorization request. The authorization returned with
+// an error has no redirect URI if the error can not be sent back to the client.
+func authorize(sm store.Storer, ar *authorizeRequest) (*authorization, *authorizeError) {
+	a := &authorization{req: ar}
+	if !try6.ValidUUID(ar.ClientID) {
+		return a, &authorizeError{errInvalidClient, "The application is not registered."}
+	}
+	client, err := sm.GetClientByID(ar.ClientID)
+	if err != nil {
+		if err == tryerr.ErrClientNotFound {
+			return a, &authorizeError{errInvalidClient, "The application is not registered."}
+		}
+		return a, &authorizeError{errServerError, err.Error()}
+	}
+	if try6.Usable(client.Status) != nil {
+		return a, &authorizeError{errInvalidClient, "The application is disabled."}
+	}
+	a.client = client
+	if a.redirect, err = client.RedirectURI(ar.RedirectURI); err != nil {
+		return a, &authorizeError{errInvalidRequest, "The application redirect URI is not registered."}
+	}
+	if a.scope, err = sm.GetScopeByID(client.ScopeID); err == nil {
+		a.branding, err = sm.GetBranding(a.scope.TenantID)
+	}
+	if err != nil && err != tryerr.ErrScopeNotFound {
+		return a, &authorizeError{errServerError, err.Error()}
+	}
+	switch {
+	case ar.ResponseType != "code":
+		return a, &authorizeError{errUnsupportedResponseType, "only the code response type is supported"}
+	case !client.AllowsGrant(try6.GrantAuthorizationCode):
+		return a, &authorizeError{errUnauthorizedClient, tryerr.ErrUnsupportedGrant.Error()}
+	case ar.CodeChallengeMethod != try6.CodeChallengeS256 || !try6.RegexpCodeVerifier.MatchString(ar.CodeChallenge):
+		return a, &authorizeError{errInvalidRequest, "a S256 code challenge is required"}
+	}
+	if a.scope == nil {
+		return a, &authorizeError{errAccessDenied, tryerr.ErrDeleted.Error()}
+	}
+	if err := try6.Usable(a.scope.Status); err != nil {
+		return a, &authorizeError{errAccessDenied, err.Error()}
+	}
+	status, err := sm.GetStatus(try6.EntityTenant, a.scope.TenantID)
+	if err == nil {
+		err = try6.Usable(status)
+	}
+	switch err {
+	case nil:
+	case tryerr.ErrTenantNotFound, tryerr.ErrDisabled, tryerr.ErrDeleted:
+		return a, &authorizeError{errAccessDenied, err.Error()}
+	default:
+		return a, &authorizeError{errServerError, err.Error()}
+	}
+	return a, nil
+}
+
+// page returns the login page of the authorization
+func (a *authorization) page(csrf string) *loginPage {
+	return &loginPage{Branding: a.branding, Client: a.client.Name, CSRF: csrf, Params: a.req.params()}
+}
+
+// authorizeFail sends the error back to the client, or shows it in the login page
+// if the redirect URI is not known
+func authorizeFail(ctx *echo.Context, a *authorization, aerr *authorizeError) error {
+	if aerr.code == errServerError && aerr.description != "" {
+		log.LogE("authorization error", "pkg", "api", "func", "authorizeFail(*echo.Context, *authorization, *authorizeError)", "error", aerr.description)
+		aerr.description = ""
+	}
+	if a.redirect == "" {
+		status := http.StatusBadRequest
+		if aerr.code == errServerError {
+			status = http.StatusInternalServerError
+		}
+		return loginErrorPage(ctx, status, a.branding, aerr.description)
+	}
+	v := url.Values{"error": {aerr.code}, "state": {a.req.State}}
+	if aerr.description != "" {
+		v.Set("error_description", aerr.description)
+	}
+	return ctx.Redirect(http.StatusFound, redirectURL(a.redirect, v))
+}
+
+// authorizeServerError logs an unexpected error and sends it back to the client
+func authorizeServerError(ctx *echo.Context, a *authorization, action string, err error) error {
+	log.LogE("authorization error", "pkg", "api", "func", action, "error", err.Error())
+	return authorizeFail(ctx, a, &authorizeError{code: errServerError})
+}
+
+// redirectURL returns the redirect URI with the parameters added to its query.
+// Empty parameters are not added.
+func redirectURL(redirect string, params url.Values) string {
+	u, err := url.Parse(redirect)
+	if err != nil {
+		return redirect
+	}
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q.Set(k, v[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// csrfToken returns the value of the CSRF cookie of the request, setting a new one
+// if it has none
+func csrfToken(ctx *echo.Context) (string, error) {
+	if c, err := ctx.Request().Cookie(csrfCookie); err == nil && c.Value != "" {
+		return c.Value, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(ctx.Response(), &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/oauth2",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
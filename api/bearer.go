@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Error codes of the resources protected with bearer tokens (RFC 6750 section 3.1)
+const (
+	errInvalidToken      = "invalid_token"
+	errInsufficientScope = "insufficient_scope"
+)
+
+// bearerAuth is who makes a request authenticated with a bearer token: an access
+// token or the API key of an account
+type bearerAuth struct {
+	// subject is the account or, for client credentials tokens, the client
+	subject string
+	// clientID is the client the access token was issued to, empty for API keys
+	clientID string
+	// scope holds the scopes granted to the access token
+	scope string
+	// claims are the claims of the access token, nil for API keys
+	claims jwt.MapClaims
+	// apiKey is the API key of the request, nil for access tokens
+	apiKey *try6.APIKey
+}
+
+// hasScope tells if the request can use the scope. API keys with no scope
+// restriction can use any scope.
+func (b *bearerAuth) hasScope(scope string) bool {
+	if b.apiKey != nil {
+		return b.apiKey.Allows(scope)
+	}
+	return try6.HasScope(b.scope, scope)
+}
+
+// authenticateBearer returns who makes the request after checking the bearer token
+// it carries in the Authorization header or, for form requests, in the access_token
+// parameter. The token is either an access token signed by one of our keys that has
+// not been revoked or an API key that has not expired nor been deleted. Otherwise
+// tryerr.ErrInvalidToken is returned.
+func authenticateBearer(sm store.Storer, r *http.Request) (*bearerAuth, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, tryerr.ErrInvalidToken
+	}
+	if try6.IsAPIKey(token) {
+		return authenticateAPIKey(sm, token)
+	}
+	claims, _, err := activeToken(sm, token)
+	if err != nil {
+		return nil, err
+	}
+	b := &bearerAuth{claims: claims}
+	b.subject, _ = claims["sub"].(string)
+	b.clientID, _ = claims["client_id"].(string)
+	b.scope, _ = claims["scope"].(string)
+	return b, nil
+}
+
+// authenticateAPIKey returns the account of the API key and records its use
+func authenticateAPIKey(sm store.Storer, token string) (*bearerAuth, error) {
+	id, secret, err := try6.ParseAPIKey(token)
+	if err != nil {
+		return nil, err
+	}
+	k, err := sm.GetAPIKey(id)
+	if err != nil {
+		if err == tryerr.ErrAPIKeyNotFound {
+			return nil, tryerr.ErrInvalidToken
+		}
+		return nil, err
+	}
+	if err := k.Authenticate(secret); err != nil {
+		return nil, err
+	}
+	if err := sm.TouchAPIKey(k.ID); err != nil {
+		log.LogW("api key last use not recorded", "pkg", "api", "func", "authenticateAPIKey(store.Storer, string)", "id", k.ID, "error", err.Error())
+	}
+	return &bearerAuth{subject: k.AccountID, scope: k.Scope, apiKey: k}, nil
+}
+
+// activeToken returns the claims and the record of an access token signed by one
+// of our keys that has not been revoked, or tryerr.ErrInvalidToken
+func activeToken(sm store.Storer, token string) (jwt.MapClaims, *try6.JWT, error) {
+	claims, err := try6.ParseToken(token, sm.GetKeyByID)
+	if err != nil {
+		return nil, nil, err
+	}
+	jti, _ := claims["jti"].(string)
+	rec, err := sm.GetJWT(jti)
+	if err != nil {
+		if err == tryerr.ErrTokenNotFound {
+			return nil, nil, tryerr.ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	if rec.Status != try6.StatusActive {
+		return nil, nil, tryerr.ErrInvalidToken
+	}
+	return claims, rec, nil
+}
+
+// bearerToken returns the bearer token of the request or an empty string
+func bearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+			return strings.TrimSpace(h[7:])
+		}
+		return ""
+	}
+	if r.Method == "POST" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return r.PostFormValue("access_token")
+	}
+	return ""
+}
+
+// bearerFail writes the error response of a resource protected with bearer tokens,
+// with the error in the WWW-Authenticate header
+func bearerFail(ctx *echo.Context, status int, code, description string) error {
+	ctx.Response().Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="try6", error=%q, error_description=%q`, code, description))
+	return oauthFail(ctx, status, code, description)
+}
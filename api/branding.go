@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// GetBranding handler returns the look of the login page of the tenant
+func GetBranding(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		tenantID, err := brandingTenant(sm, ctx)
+		if err != nil {
+			return brandingError(ctx, "GetBranding", err)
+		}
+		b, err := sm.GetBranding(tenantID)
+		if err != nil {
+			return brandingError(ctx, "GetBranding", err)
+		}
+		return ctx.JSON(http.StatusOK, b)
+	}
+}
+
+// PutBranding handler replaces the look of the login page of the tenant with the
+// one in the body
+func PutBranding(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		tenantID, err := brandingTenant(sm, ctx)
+		if err != nil {
+			return brandingError(ctx, "PutBranding", err)
+		}
+		var b try6.Branding
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&b); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "PutBranding", Info: err.Error(), Table: "tenant_branding"})
+		}
+		b.TenantID = tenantID
+		if err := b.Validate(); err != nil {
+			return brandingError(ctx, "PutBranding", err)
+		}
+		if err := sm.SaveBranding(&b); err != nil {
+			return brandingError(ctx, "PutBranding", err)
+		}
+		return ctx.JSON(http.StatusOK, &b)
+	}
+}
+
+// brandingTenant returns the id of the tenant in the request after checking that
+// it exists
+func brandingTenant(sm store.Storer, ctx *echo.Context) (string, error) {
+	tenantID := ctx.Param("id")
+	if !try6.ValidUUID(tenantID) {
+		return "", tryerr.ErrTenantNotFound
+	}
+	if _, err := sm.GetStatus(try6.EntityTenant, tenantID); err != nil {
+		return "", err
+	}
+	return tenantID, nil
+}
+
+// brandingError writes the response for an error of the branding handlers
+func brandingError(ctx *echo.Context, action string, err error) error {
+	status := http.StatusInternalServerError
+	switch err {
+	case tryerr.ErrInvalidName, tryerr.ErrInvalidColor, tryerr.ErrInvalidPicture:
+		status = http.StatusBadRequest
+	case tryerr.ErrTenantNotFound:
+		status = http.StatusNotFound
+	}
+	return ctx.JSON(status, &logMessage{Status: "error", Action: action, Info: err.Error(), Table: "tenant_branding"})
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/bulk"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// MaxImportSize is the maximum size in bytes of an imported file
+var MaxImportSize int64 = 64 << 20
+
+// AccountsAction handler serves the custom methods of the accounts collection of
+// a directory: POST /directories/:id/accounts:import and
+// GET /directories/:id/accounts:export. The router takes ":import" and ":export"
+// as the action parameter.
+func AccountsAction(sm store.Storer) echo.HandlerFunc {
+	importAccounts, exportAccounts := ImportAccounts(sm), ExportAccounts(sm)
+	return func(ctx *echo.Context) error {
+		switch {
+		case ctx.Param("action") == ":import" && ctx.Request().Method == "POST":
+			return importAccounts(ctx)
+		case ctx.Param("action") == ":export" && ctx.Request().Method == "GET":
+			return exportAccounts(ctx)
+		}
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+}
+
+// ImportAccounts handler starts the import of the accounts in the body into the
+// directory. The body format is taken from the format query parameter (csv or
+// jsonl) or the Content-Type header. Only administrators of the tenant of the
+// directory can import. The import runs in the background; the returned job
+// reports its progress and the rows that failed.
+func ImportAccounts(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var directoryID string
+		if directoryID = ctx.Param("id"); directoryID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ImportAccounts", Info: "directory id cannot be nil"})
+		}
+		if _, err := authorizeEntity(sm, ctx.Request(), try6.EntityDirectory, directoryID); err != nil {
+			if err == tryerr.ErrDirectoryNotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "ImportAccounts", Info: err.Error(), Table: "directories", UID: directoryID})
+			}
+			return accessError(ctx, "ImportAccounts", err)
+		}
+		format := ctx.Query("format")
+		if format == "" {
+			format = bulk.FormatFromContentType(ctx.Request().Header.Get("Content-Type"))
+		}
+		if format != bulk.FormatCSV && format != bulk.FormatJSONL {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ImportAccounts", Info: tryerr.ErrInvalidFormat.Error()})
+		}
+		// the body is spooled to disk as the import goes on after the response
+		f, err := ioutil.TempFile("", "try6-import-")
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ImportAccounts", Info: err.Error()})
+		}
+		n, err := io.Copy(f, io.LimitReader(ctx.Request().Body, MaxImportSize+1))
+		if err == nil {
+			_, err = f.Seek(0, 0)
+		}
+		if err != nil || n > MaxImportSize {
+			f.Close()
+			os.Remove(f.Name())
+			if err == nil {
+				return ctx.JSON(http.StatusRequestEntityTooLarge, &logMessage{Status: "error", Action: "ImportAccounts", Info: "import file too large"})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ImportAccounts", Info: err.Error()})
+		}
+		job := try6.NewImportJob(directoryID, format)
+		if err := sm.SaveImportJob(job); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ImportAccounts", Info: err.Error(), Table: "import_jobs"})
+		}
+		go func(job try6.ImportJob) {
+			defer os.Remove(f.Name())
+			defer f.Close()
+			if err := bulk.Import(sm, &job, f); err != nil {
+				log.LogE("error importing accounts", "pkg", "api", "func", "ImportAccounts(store.Storer)", "job", job.ID, "error", err.Error())
+			}
+		}(*job)
+		ctx.Response().Header().Set("Location", "/api/v1/imports/"+job.ID)
+		return ctx.JSON(http.StatusAccepted, job)
+	}
+}
+
+// GetImportJob handler returns the progress and failed rows of an import to an
+// administrator of the tenant of its directory
+func GetImportJob(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var jobID string
+		if jobID = ctx.Param("id"); jobID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "GetImportJob", Info: "job id cannot be nil"})
+		}
+		principal, err := accountPrincipal(sm, ctx.Request())
+		if err != nil {
+			return accessError(ctx, "GetImportJob", err)
+		}
+		job, err := sm.GetImportJob(jobID)
+		if err != nil {
+			if err == tryerr.ErrImportJobNotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "GetImportJob", Info: err.Error(), Table: "import_jobs", UID: jobID})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "GetImportJob", Info: err.Error(), Table: "import_jobs"})
+		}
+		tenantID, err := entityTenant(sm, try6.EntityDirectory, job.DirectoryID)
+		if err == nil {
+			err = tenantAdmin(sm, principal.ID, tenantID)
+		}
+		if err != nil {
+			if err == tryerr.ErrDirectoryNotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "GetImportJob", Info: err.Error(), Table: "directories", UID: job.DirectoryID})
+			}
+			return accessError(ctx, "GetImportJob", err)
+		}
+		return ctx.JSON(http.StatusOK, job)
+	}
+}
+
+// ExportAccounts handler streams every account of the directory in the format
+// given by the format query parameter (csv or jsonl, the default) to an
+// administrator of the tenant of the directory. Password hashes are not exported.
+func ExportAccounts(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var directoryID string
+		if directoryID = ctx.Param("id"); directoryID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ExportAccounts", Info: "directory id cannot be nil"})
+		}
+		if _, err := authorizeEntity(sm, ctx.Request(), try6.EntityDirectory, directoryID); err != nil {
+			if err == tryerr.ErrDirectoryNotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "ExportAccounts", Info: err.Error(), Table: "directories", UID: directoryID})
+			}
+			return accessError(ctx, "ExportAccounts", err)
+		}
+		format := ctx.Query("format")
+		if format == "" {
+			format = bulk.FormatJSONL
+		}
+		if format != bulk.FormatCSV && format != bulk.FormatJSONL {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ExportAccounts", Info: tryerr.ErrInvalidFormat.Error()})
+		}
+		w := ctx.Response()
+		w.Header().Set("Content-Type", bulk.ContentType(format))
+		w.Header().Set("Content-Disposition", "attachment; filename=accounts."+format)
+		w.WriteHeader(http.StatusOK)
+		if _, err := bulk.Export(sm, directoryID, w, format); err != nil {
+			// the status is already sent, the truncated body is the only signal left
+			log.LogE("error exporting accounts", "pkg", "api", "func", "ExportAccounts(store.Storer)", "directory", directoryID, "error", err.Error())
+		}
+		return nil
+	}
+}
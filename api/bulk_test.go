@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jllopis/try6"
+)
+
+func TestImportAccounts(t *testing.T) {
+	defer func(h try6.Hasher) { try6.DefaultHasher = h }(try6.DefaultHasher)
+	try6.DefaultHasher = &try6.BcryptHasher{Cost: 4}
+	sm := newMemStore()
+	a, dir := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	other := newTestAdmin(t, sm, "other", "other-tenant")
+	route := "/directories/:id/accounts:action"
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		method string
+		path   string
+		want   int
+	}{
+		{"anonymous", "", "POST", "/directories/" + dir.ID + "/accounts:import?format=csv", http.StatusUnauthorized},
+		{"account itself", sm.bearerFor(a.ID), "POST", "/directories/" + dir.ID + "/accounts:import?format=csv", http.StatusForbidden},
+		{"admin of another tenant", other, "POST", "/directories/" + dir.ID + "/accounts:import?format=csv", http.StatusForbidden},
+		{"unknown format", admin, "POST", "/directories/" + dir.ID + "/accounts:import?format=xml", http.StatusBadRequest},
+		{"unknown directory", admin, "POST", "/directories/missing/accounts:import?format=csv", http.StatusNotFound},
+		{"export anonymous", "", "GET", "/directories/" + dir.ID + "/accounts:export", http.StatusUnauthorized},
+		{"export admin of another tenant", other, "GET", "/directories/" + dir.ID + "/accounts:export", http.StatusForbidden},
+	} {
+		if rec := serveAs(c.bearer, c.method, c.path, route, AccountsAction(sm), ""); rec.Code != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+
+	body := "email,name,password\n" +
+		"ana@example.com,Ana,firstpassword\n" +
+		"USER@example.com,Dup,firstpassword\n" +
+		"not-an-email,Bad,firstpassword\n" +
+		"short@example.com,Short,short\n"
+	rec := serveAs(admin, "POST", "/directories/"+dir.ID+"/accounts:import?format=csv", route, AccountsAction(sm), body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("import: got %d %s", rec.Code, rec.Body.String())
+	}
+	var started try6.ImportJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &started); err != nil {
+		t.Fatal(err)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/api/v1/imports/"+started.ID {
+		t.Errorf("Location = %q", loc)
+	}
+
+	var job try6.ImportJob
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		rec := serveAs(admin, "GET", "/imports/"+started.ID, "/imports/:id", GetImportJob(sm), "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("get job: got %d", rec.Code)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+		if job.Finished.Valid {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("import not finished: %+v", job)
+		}
+	}
+	if job.Status != try6.ImportDone || job.Total != 4 || job.Imported != 1 || job.Failed != 3 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if len(job.Errors) != 3 || job.Errors[0].Line != 3 || job.Errors[1].Line != 4 || job.Errors[2].Line != 5 {
+		t.Errorf("unexpected errors %+v", job.Errors)
+	}
+	for _, bearer := range []string{"", other} {
+		if rec := serveAs(bearer, "GET", "/imports/"+started.ID, "/imports/:id", GetImportJob(sm), ""); rec.Code == http.StatusOK {
+			t.Errorf("job read with bearer %q", bearer)
+		}
+	}
+
+	var imported *try6.Account
+	for _, a := range sm.accounts {
+		if a.Email == "ana@example.com" {
+			imported = a
+		}
+	}
+	if imported == nil {
+		t.Fatal("account not imported")
+	}
+	if err := imported.MatchPassword("firstpassword"); err != nil {
+		t.Errorf("imported password: %v", err)
+	}
+	if dirs := sm.members[imported.ID]; len(dirs) != 1 || dirs[0] != dir.ID {
+		t.Errorf("imported into %v", dirs)
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// clientRequest holds the fields of a client that can be set by its owner. Public
+// can only be set when the client is created. FirstParty clients, the applications
+// of the tenant itself, do not ask the accounts for their consent.
+type clientRequest struct {
+	Name         string   `json:"name"`
+	Public       bool     `json:"public"`
+	FirstParty   bool     `json:"first_party"`
+	GrantTypes   []string `json:"grant_types"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Audiences    []string `json:"audiences"`
+}
+
+// clientResponse is a client along with its secret, returned only when the secret
+// is created
+type clientResponse struct {
+	*try6.Client
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// CreateClient handler creates a new client of the scope. The secret of the client
+// is returned only in this response. Public clients have no secret.
+func CreateClient(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		s, err := sm.GetScopeByID(ctx.Param("id"))
+		if err != nil {
+			return clientError(ctx, "CreateClient", err)
+		}
+		var r clientRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "CreateClient", Info: err.Error(), Table: "clients"})
+		}
+		var c *try6.Client
+		var secret string
+		if r.Public {
+			c, err = try6.NewPublicClient(s.ID, r.Name, r.GrantTypes, r.RedirectURIs, r.Audiences)
+		} else {
+			c, secret, err = try6.NewClient(s.ID, r.Name, r.GrantTypes, r.RedirectURIs, r.Audiences)
+		}
+		if err != nil {
+			return clientError(ctx, "CreateClient", err)
+		}
+		c.FirstParty = r.FirstParty
+		if err := sm.SaveClient(c); err != nil {
+			return clientError(ctx, "CreateClient", err)
+		}
+		log.LogI("client created", "pkg", "api", "func", "CreateClient(store.Storer)", "id", c.ID, "scope", s.ID)
+		return ctx.JSON(http.StatusCreated, &clientResponse{Client: c, ClientSecret: secret})
+	}
+}
+
+// GetClientsByScopeID handler returns the clients of the scope
+func GetClientsByScopeID(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		s, err := sm.GetScopeByID(ctx.Param("id"))
+		if err != nil {
+			return clientError(ctx, "GetClientsByScopeID", err)
+		}
+		clients, err := sm.GetClientsByScopeID(s.ID)
+		if err != nil {
+			return clientError(ctx, "GetClientsByScopeID", err)
+		}
+		if clients == nil {
+			clients = []*try6.Client{}
+		}
+		return ctx.JSON(http.StatusOK, clients)
+	}
+}
+
+// GetClient handler returns the client with the id provided
+func GetClient(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		c, err := sm.GetClientByID(ctx.Param("id"))
+		if err != nil {
+			return clientError(ctx, "GetClient", err)
+		}
+		return ctx.JSON(http.StatusOK, c)
+	}
+}
+
+// UpdateClient handler replaces the name, grants, redirect URIs and audiences of
+// the client with the ones in the body
+func UpdateClient(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		c, err := sm.GetClientByID(ctx.Param("id"))
+		if err != nil {
+			return clientError(ctx, "UpdateClient", err)
+		}
+		var r clientRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdateClient", Info: err.Error(), Table: "clients"})
+		}
+		c.Name, c.Grants, c.RedirectURIs, c.Audiences, c.FirstParty = r.Name, r.GrantTypes, r.RedirectURIs, r.Audiences, r.FirstParty
+		if err := c.Validate(); err != nil {
+			return clientError(ctx, "UpdateClient", err)
+		}
+		if err := sm.SaveClient(c); err != nil {
+			return clientError(ctx, "UpdateClient", err)
+		}
+		return ctx.JSON(http.StatusOK, c)
+	}
+}
+
+// RotateClientSecret handler replaces the secret of the client with a new one and
+// returns it. The previous secret stops working.
+func RotateClientSecret(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		c, err := sm.GetClientByID(ctx.Param("id"))
+		if err != nil {
+			return clientError(ctx, "RotateClientSecret", err)
+		}
+		secret, err := c.NewSecret()
+		if err != nil {
+			return clientError(ctx, "RotateClientSecret", err)
+		}
+		if err := sm.SaveClient(c); err != nil {
+			return clientError(ctx, "RotateClientSecret", err)
+		}
+		log.LogI("client secret rotated", "pkg", "api", "func", "RotateClientSecret(store.Storer)", "id", c.ID, "actor", requestActor(sm, ctx))
+		return ctx.JSON(http.StatusOK, &clientResponse{Client: c, ClientSecret: secret})
+	}
+}
+
+// clientError writes the response for an error of the client handlers
+func clientError(ctx *echo.Context, action string, err error) error {
+	status := http.StatusInternalServerError
+	switch err {
+	case tryerr.ErrInvalidName, tryerr.ErrUnsupportedGrant, tryerr.ErrInvalidRedirectURI:
+		status = http.StatusBadRequest
+	case tryerr.ErrPublicClient:
+		status = http.StatusConflict
+	case tryerr.ErrScopeNotFound, tryerr.ErrClientNotFound:
+		status = http.StatusNotFound
+	}
+	return ctx.JSON(status, &logMessage{Status: "error", Action: action, Info: err.Error(), Table: "clients"})
+}
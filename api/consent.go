@@ -0,0 +1,256 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Decisions of the account in the consent page
+const (
+	consentAllow = "allow"
+	consentDeny  = "deny"
+)
+
+// scopeDescriptions holds how the scopes requested are shown in the consent page.
+// Other scopes are shown by their name.
+var scopeDescriptions = map[string]string{
+	try6.ScopeOpenID:  "Know who you are",
+	try6.ScopeProfile: "See your name and profile",
+	try6.ScopeEmail:   "See your email address",
+	try6.ScopePhone:   "See your phone number",
+	try6.ScopeGroups:  "See the groups you belong to",
+}
+
+// askConsent tells if the account consents to the client acting on its behalf with
+// the scopes requested. First party clients need no consent, nor the clients the
+// account already granted the scopes to. Otherwise, unless the account has just
+// decided in the consent page, the page is set up to ask for its consent and false
+// is returned. The scopes allowed are saved and tryerr.ErrConsentDenied is
+// returned if the account denies them.
+func askConsent(sm store.Storer, ctx *echo.Context, page *loginPage, client *try6.Client, account *try6.Account, amr []string, scope string) (bool, error) {
+	if client.FirstParty {
+		return true, nil
+	}
+	c, err := sm.GetConsent(account.ID, client.ID)
+	if err != nil && err != tryerr.ErrConsentNotFound {
+		return false, err
+	}
+	r := ctx.Request()
+	if r.PostFormValue("consent_token") != "" {
+		switch r.PostFormValue("consent") {
+		case consentAllow:
+			if c == nil {
+				c = try6.NewConsent(account.ID, client.ID, scope)
+			} else {
+				c.Grant(scope)
+			}
+			if err := sm.SaveConsent(c); err != nil {
+				return false, err
+			}
+			log.LogI("consent granted", "pkg", "api", "func", "askConsent(store.Storer, *echo.Context, *loginPage, *try6.Client, *try6.Account, []string, string)", "client", client.ID, "account", account.ID, "scope", c.Scope)
+			return true, nil
+		case consentDeny:
+			log.LogI("consent denied", "pkg", "api", "func", "askConsent(store.Storer, *echo.Context, *loginPage, *try6.Client, *try6.Account, []string, string)", "client", client.ID, "account", account.ID)
+			return false, tryerr.ErrConsentDenied
+		}
+	}
+	if c != nil && c.Covers(scope) {
+		return true, nil
+	}
+	kind := try6.ConsentTokenKind(amr)
+	if err := sm.RevokeAccountTokens(account.ID, kind); err != nil {
+		return false, err
+	}
+	t, secret, err := try6.NewAccountToken(account.ID, kind, try6.ConsentTTL)
+	if err == nil {
+		err = sm.SaveAccountToken(t)
+	}
+	if err != nil {
+		return false, err
+	}
+	page.ConsentToken = secret
+	page.Email = account.Email
+	page.Scopes = nil
+	for _, s := range strings.Fields(try6.NormalizeScope(scope)) {
+		if d, ok := scopeDescriptions[s]; ok {
+			s = d
+		}
+		page.Scopes = append(page.Scopes, s)
+	}
+	return false, nil
+}
+
+// loginConsent returns the account the consent token was issued to, along with the
+// methods it authenticated with. The token can only be used once.
+func loginConsent(sm store.Storer, token string) (*try6.Account, []string, error) {
+	hash := try6.HashToken(token)
+	t, err := sm.GetAccountToken(try6.TokenConsent, hash)
+	if err == tryerr.ErrTokenNotFound {
+		t, err = sm.GetAccountToken(try6.TokenConsentMFA, hash)
+	}
+	if err == nil {
+		err = t.Valid()
+	}
+	if err == nil {
+		err = sm.UseAccountToken(t)
+	}
+	if err != nil {
+		if err == tryerr.ErrTokenNotFound || err == tryerr.ErrTokenExpired {
+			return nil, nil, tryerr.ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	account, err := grantAccount(sm, t.AccountID)
+	if err != nil {
+		if err == tryerr.ErrAccountNotFound {
+			return nil, nil, tryerr.ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	return account, try6.ConsentAMR(t.Kind), nil
+}
+
+// GetConsents handler returns the consents the account has granted to third party
+// clients and not revoked. The request must be made by the account itself or an
+// administrator of its tenant.
+func GetConsents(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		if _, err := authorizeAccount(sm, ctx.Request(), ctx.Param("id"), true); err != nil {
+			return accessError(ctx, "GetConsents", err)
+		}
+		account, err := sm.GetAccountByID(ctx.Param("id"))
+		if err != nil {
+			return consentError(ctx, "GetConsents", err)
+		}
+		cs, err := sm.GetConsentsByAccountID(account.ID)
+		if err != nil {
+			return consentError(ctx, "GetConsents", err)
+		}
+		if cs == nil {
+			cs = []*try6.Consent{}
+		}
+		return ctx.JSON(http.StatusOK, cs)
+	}
+}
+
+// RevokeConsent handler revokes the consent of the account to the client. The
+// access and refresh tokens the client holds on behalf of the account are revoked
+// too, and the account is asked for its consent again the next time it logs in.
+// The request must be made by the account itself or an administrator of its tenant.
+func RevokeConsent(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		accountID, clientID := ctx.Param("id"), ctx.Param("client")
+		principal, err := authorizeAccount(sm, ctx.Request(), accountID, true)
+		if err != nil {
+			return accessError(ctx, "RevokeConsent", err)
+		}
+		if err := sm.RevokeConsent(accountID, clientID); err != nil {
+			return consentError(ctx, "RevokeConsent", err)
+		}
+		log.LogI("consent revoked", "pkg", "api", "func", "RevokeConsent(store.Storer)", "client", clientID, "account", accountID, "actor", accountActor(principal.ID))
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+// AccountConsents handler returns the consents of the account of the bearer access
+// token, or API key, as GetConsents does
+func AccountConsents(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		ctx.Response().Header().Set("Cache-Control", "no-store")
+		account, err := consentAccount(sm, ctx)
+		if err != nil {
+			return consentBearerError(ctx, "AccountConsents", err)
+		}
+		cs, err := sm.GetConsentsByAccountID(account.ID)
+		if err != nil {
+			return oauthServerError(ctx, "AccountConsents", err)
+		}
+		if cs == nil {
+			cs = []*try6.Consent{}
+		}
+		return ctx.JSON(http.StatusOK, cs)
+	}
+}
+
+// RevokeAccountConsent handler revokes the consent of the account of the bearer
+// access token, or API key, to the client, as RevokeConsent does
+func RevokeAccountConsent(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		account, err := consentAccount(sm, ctx)
+		if err != nil {
+			return consentBearerError(ctx, "RevokeAccountConsent", err)
+		}
+		clientID := ctx.Param("client")
+		if err := sm.RevokeConsent(account.ID, clientID); err != nil {
+			if err == tryerr.ErrConsentNotFound {
+				return oauthFail(ctx, http.StatusNotFound, errInvalidRequest, err.Error())
+			}
+			return oauthServerError(ctx, "RevokeAccountConsent", err)
+		}
+		log.LogI("consent revoked", "pkg", "api", "func", "RevokeAccountConsent(store.Storer)", "client", clientID, "account", account.ID, "actor", "account:"+account.ID)
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+// consentAccount returns the account that manages its consents with the bearer
+// token of the request. Only API keys and the access tokens issued to accounts by
+// first party clients can, otherwise tryerr.ErrFirstPartyRequired is returned.
+func consentAccount(sm store.Storer, ctx *echo.Context) (*try6.Account, error) {
+	b, err := authenticateBearer(sm, ctx.Request())
+	if err != nil {
+		return nil, err
+	}
+	if b.apiKey == nil {
+		if b.clientID == "" || b.subject == b.clientID {
+			return nil, tryerr.ErrFirstPartyRequired
+		}
+		client, err := sm.GetClientByID(b.clientID)
+		if err != nil {
+			if err == tryerr.ErrClientNotFound {
+				return nil, tryerr.ErrInvalidToken
+			}
+			return nil, err
+		}
+		if !client.FirstParty {
+			return nil, tryerr.ErrFirstPartyRequired
+		}
+	}
+	account, err := grantAccount(sm, b.subject)
+	if err != nil {
+		switch err {
+		case tryerr.ErrAccountNotFound, tryerr.ErrDisabled, tryerr.ErrDeleted:
+			return nil, tryerr.ErrInvalidToken
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+// consentBearerError writes the response for an error authenticating the account
+// that manages its consents
+func consentBearerError(ctx *echo.Context, action string, err error) error {
+	switch err {
+	case tryerr.ErrInvalidToken:
+		return bearerFail(ctx, http.StatusUnauthorized, errInvalidToken, err.Error())
+	case tryerr.ErrFirstPartyRequired:
+		return bearerFail(ctx, http.StatusForbidden, errInsufficientScope, err.Error())
+	}
+	return oauthServerError(ctx, action, err)
+}
+
+// consentError writes the response for an error of the consent handlers
+func consentError(ctx *echo.Context, action string, err error) error {
+	status := http.StatusInternalServerError
+	switch err {
+	case tryerr.ErrAccountNotFound, tryerr.ErrConsentNotFound:
+		status = http.StatusNotFound
+	}
+	return ctx.JSON(status, &logMessage{Status: "error", Action: action, Info: err.Error(), Table: "consents"})
+}
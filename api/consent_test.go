@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestConsentAccess(t *testing.T) {
+	sm := newMemStore()
+	a, _ := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	other, _ := newTestAccount(t, sm, "other", "other@example.com", "password1")
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	otherAdmin := newTestAdmin(t, sm, "other-admin", "other-tenant")
+	const path, route = "/accounts/account/consents", "/accounts/:id/consents"
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"another account", sm.bearerFor(other.ID), http.StatusForbidden},
+		{"admin of another tenant", otherAdmin, http.StatusForbidden},
+		{"account itself", sm.bearerFor(a.ID), http.StatusOK},
+		{"admin", admin, http.StatusOK},
+	} {
+		if rec := serveAs(c.bearer, "GET", path, route, GetConsents(sm), ""); rec.Code != c.want {
+			t.Errorf("list by %s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+		want := c.want
+		if want == http.StatusOK {
+			want = http.StatusNoContent
+		}
+		if rec := serveAs(c.bearer, "DELETE", path+"/client", route+"/:client", RevokeConsent(sm), ""); rec.Code != want {
+			t.Errorf("revoke by %s: got %d, want %d", c.name, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// customDataValue holds the value of a single custom data key
+type customDataValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// GetCustomData handler returns the custom data document of the account to the
+// account itself or an administrator of its tenant
+func GetCustomData(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		accountID, err := customDataAccount(sm, ctx, true)
+		if err != nil {
+			return customDataError(ctx, "GetCustomData", err)
+		}
+		data, err := sm.GetAccountCustomData(accountID)
+		if err != nil {
+			return customDataError(ctx, "GetCustomData", err)
+		}
+		return ctx.JSON(http.StatusOK, data)
+	}
+}
+
+// PutCustomData handler replaces the custom data document of the account with the
+// JSON object in the body. Values must be strings.
+func PutCustomData(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		accountID, err := customDataAccount(sm, ctx, false)
+		if err != nil {
+			return customDataError(ctx, "PutCustomData", err)
+		}
+		var data try6.CustomData
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&data); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "PutCustomData", Info: err.Error(), Table: "account_custom_data"})
+		}
+		if data == nil {
+			data = try6.CustomData{}
+		}
+		if err := sm.SaveAccountCustomData(accountID, data); err != nil {
+			return customDataError(ctx, "PutCustomData", err)
+		}
+		return ctx.JSON(http.StatusOK, data)
+	}
+}
+
+// PatchCustomData handler applies the JSON object in the body to the custom data
+// document of the account. Keys with a null value are removed, the rest are set.
+func PatchCustomData(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		accountID, err := customDataAccount(sm, ctx, false)
+		if err != nil {
+			return customDataError(ctx, "PatchCustomData", err)
+		}
+		var changes map[string]*string
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&changes); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "PatchCustomData", Info: err.Error(), Table: "account_custom_data"})
+		}
+		data, err := sm.PatchAccountCustomData(accountID, changes)
+		if err != nil {
+			return customDataError(ctx, "PatchCustomData", err)
+		}
+		return ctx.JSON(http.StatusOK, data)
+	}
+}
+
+// GetCustomDataKey handler returns the value of a key of the custom data of the account
+func GetCustomDataKey(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		accountID, err := customDataAccount(sm, ctx, true)
+		if err != nil {
+			return customDataError(ctx, "GetCustomDataKey", err)
+		}
+		data, err := sm.GetAccountCustomData(accountID)
+		if err != nil {
+			return customDataError(ctx, "GetCustomDataKey", err)
+		}
+		key := ctx.Param("key")
+		v, ok := data[key]
+		if !ok {
+			return customDataError(ctx, "GetCustomDataKey", tryerr.ErrCustomDataKeyNotFound)
+		}
+		return ctx.JSON(http.StatusOK, &customDataValue{Key: key, Value: v})
+	}
+}
+
+// PutCustomDataKey handler sets the value of a key of the custom data of the
+// account. The body is a JSON object with the value.
+func PutCustomDataKey(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		accountID, err := customDataAccount(sm, ctx, false)
+		if err != nil {
+			return customDataError(ctx, "PutCustomDataKey", err)
+		}
+		var v customDataValue
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&v); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "PutCustomDataKey", Info: err.Error(), Table: "account_custom_data"})
+		}
+		v.Key = ctx.Param("key")
+		if _, err := sm.PatchAccountCustomData(accountID, map[string]*string{v.Key: &v.Value}); err != nil {
+			return customDataError(ctx, "PutCustomDataKey", err)
+		}
+		return ctx.JSON(http.StatusOK, &v)
+	}
+}
+
+// DeleteCustomDataKey handler removes a key from the custom data of the account
+func DeleteCustomDataKey(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		accountID, err := customDataAccount(sm, ctx, false)
+		if err != nil {
+			return customDataError(ctx, "DeleteCustomDataKey", err)
+		}
+		if _, err := sm.PatchAccountCustomData(accountID, map[string]*string{ctx.Param("key"): nil}); err != nil {
+			return customDataError(ctx, "DeleteCustomDataKey", err)
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+// GetScopeClaims handler returns the mapping of custom data keys to token claims of
+// the scope to an administrator of its tenant
+func GetScopeClaims(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		if _, err := authorizeEntity(sm, ctx.Request(), try6.EntityScope, ctx.Param("id")); err != nil {
+			return customDataError(ctx, "GetScopeClaims", err)
+		}
+		s, err := sm.GetScopeByID(ctx.Param("id"))
+		if err != nil {
+			return customDataError(ctx, "GetScopeClaims", err)
+		}
+		if s.Claims == nil {
+			s.Claims = try6.CustomData{}
+		}
+		return ctx.JSON(http.StatusOK, s.Claims)
+	}
+}
+
+// PutScopeClaims handler replaces the mapping of custom data keys to token claims
+// of the scope. The body is a JSON object whose keys are custom data keys and
+// values the claim names they are exposed as in the tokens of the scope. Only
+// administrators of the tenant of the scope can change it.
+func PutScopeClaims(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		if _, err := authorizeEntity(sm, ctx.Request(), try6.EntityScope, ctx.Param("id")); err != nil {
+			return customDataError(ctx, "PutScopeClaims", err)
+		}
+		s, err := sm.GetScopeByID(ctx.Param("id"))
+		if err != nil {
+			return customDataError(ctx, "PutScopeClaims", err)
+		}
+		var claims try6.CustomData
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&claims); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "PutScopeClaims", Info: err.Error(), Table: "scopes"})
+		}
+		if err := claims.ValidateClaims(); err != nil {
+			return customDataError(ctx, "PutScopeClaims", err)
+		}
+		s.Claims = claims
+		if err := sm.SaveScope(s); err != nil {
+			return customDataError(ctx, "PutScopeClaims", err)
+		}
+		return ctx.JSON(http.StatusOK, s.Claims)
+	}
+}
+
+// customDataAccount returns the id of the account in the request after checking
+// that it exists and that the request is made by an administrator of its tenant
+// or, when self is true, by the account itself. Custom data can be exposed as
+// token claims, so only administrators can change it.
+func customDataAccount(sm store.Storer, ctx *echo.Context, self bool) (string, error) {
+	accountID := ctx.Param("id")
+	if accountID == "" {
+		return "", tryerr.ErrAccountNotProvided
+	}
+	if _, err := authorizeAccount(sm, ctx.Request(), accountID, self); err != nil {
+		return "", err
+	}
+	if _, err := sm.GetAccountByID(accountID); err != nil {
+		return "", err
+	}
+	return accountID, nil
+}
+
+// customDataError writes the response for an error of the custom data handlers
+func customDataError(ctx *echo.Context, action string, err error) error {
+	status := http.StatusInternalServerError
+	switch err {
+	case tryerr.ErrAccountNotProvided, tryerr.ErrCustomDataTooLarge, tryerr.ErrInvalidCustomDataKey, tryerr.ErrReservedClaim:
+		status = http.StatusBadRequest
+	case tryerr.ErrAccountNotFound, tryerr.ErrCustomDataKeyNotFound, tryerr.ErrScopeNotFound:
+		status = http.StatusNotFound
+	case tryerr.ErrInvalidToken, tryerr.ErrAccountAccessDenied:
+		return accessError(ctx, action, err)
+	}
+	return ctx.JSON(status, &logMessage{Status: "error", Action: action, Info: err.Error(), Table: "account_custom_data"})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCustomDataAccess(t *testing.T) {
+	sm := newMemStore()
+	a, _ := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	other := newTestAdmin(t, sm, "other", "other-tenant")
+	self := sm.bearerFor(a.ID)
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		read   int
+		write  int
+	}{
+		{"anonymous", "", http.StatusUnauthorized, http.StatusUnauthorized},
+		{"admin of another tenant", other, http.StatusForbidden, http.StatusForbidden},
+		{"account itself", self, http.StatusOK, http.StatusForbidden},
+	} {
+		if rec := serveAs(c.bearer, "GET", "/accounts/account/customdata", "/accounts/:id/customdata", GetCustomData(sm), ""); rec.Code != c.read {
+			t.Errorf("%s get: got %d, want %d", c.name, rec.Code, c.read)
+		}
+		if rec := serveAs(c.bearer, "PUT", "/accounts/account/customdata", "/accounts/:id/customdata", PutCustomData(sm), `{"role":"admin"}`); rec.Code != c.write {
+			t.Errorf("%s put: got %d, want %d", c.name, rec.Code, c.write)
+		}
+		if rec := serveAs(c.bearer, "PATCH", "/accounts/account/customdata", "/accounts/:id/customdata", PatchCustomData(sm), `{"role":"admin"}`); rec.Code != c.write {
+			t.Errorf("%s patch: got %d, want %d", c.name, rec.Code, c.write)
+		}
+		if rec := serveAs(c.bearer, "PUT", "/accounts/account/customdata/role", "/accounts/:id/customdata/:key", PutCustomDataKey(sm), `{"value":"admin"}`); rec.Code != c.write {
+			t.Errorf("%s put key: got %d, want %d", c.name, rec.Code, c.write)
+		}
+	}
+	if data, _ := sm.GetAccountCustomData(a.ID); len(data) != 0 {
+		t.Fatalf("custom data changed without authorization: %v", data)
+	}
+
+	if rec := serveAs(admin, "PUT", "/accounts/account/customdata/plan", "/accounts/:id/customdata/:key", PutCustomDataKey(sm), `{"value":"pro"}`); rec.Code != http.StatusOK {
+		t.Fatalf("admin put key: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(self, "GET", "/accounts/account/customdata/plan", "/accounts/:id/customdata/:key", GetCustomDataKey(sm), ""); rec.Code != http.StatusOK {
+		t.Errorf("get own key: got %d", rec.Code)
+	}
+	if rec := serveAs(self, "DELETE", "/accounts/account/customdata/plan", "/accounts/:id/customdata/:key", DeleteCustomDataKey(sm), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("delete own key: got %d", rec.Code)
+	}
+	if data, _ := sm.GetAccountCustomData(a.ID); data["plan"] != "pro" {
+		t.Errorf("unexpected custom data %v", data)
+	}
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Error codes of the device authorization grant (RFC 8628 section 3.5)
+const (
+	errAuthorizationPending = "authorization_pending"
+	errSlowDown             = "slow_down"
+	errExpiredToken         = "expired_token"
+)
+
+// deviceAuthorizationResponse is the response of the device authorization endpoint
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// deviceVerification is a pending device code entered in the verification page,
+// with the client it was issued to
+type deviceVerification struct {
+	code     *try6.DeviceCode
+	client   *try6.Client
+	scope    *try6.Scope
+	branding *try6.Branding
+}
+
+// DeviceAuthorization handler is the device authorization endpoint of RFC 8628. The
+// client authenticates as in the token endpoint and gets a device code to poll the
+// token endpoint with and a user code the account enters in the verification page.
+func DeviceAuthorization(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		ctx.Response().Header().Set("Cache-Control", "no-store")
+		r := ctx.Request()
+		if err := r.ParseForm(); err != nil {
+			return oauthFail(ctx, http.StatusBadRequest, errInvalidRequest, err.Error())
+		}
+		client, err := authenticateClient(sm, r)
+		if err != nil {
+			if err == tryerr.ErrInvalidClient {
+				ctx.Response().Header().Set("WWW-Authenticate", `Basic realm="try6"`)
+				return oauthFail(ctx, http.StatusUnauthorized, errInvalidClient, err.Error())
+			}
+			return oauthServerError(ctx, "DeviceAuthorization", err)
+		}
+		if !client.AllowsGrant(try6.GrantDeviceCode) {
+			return oauthFail(ctx, http.StatusBadRequest, errUnauthorizedClient, tryerr.ErrUnsupportedGrant.Error())
+		}
+		code, secret, err := try6.NewDeviceCode(client.ID, r.PostFormValue("scope"))
+		if err == nil {
+			err = sm.SaveDeviceCode(code)
+		}
+		if err != nil {
+			return oauthServerError(ctx, "DeviceAuthorization", err)
+		}
+		log.LogI("device code issued", "pkg", "api", "func", "DeviceAuthorization(store.Storer)", "client", client.ID, "id", code.ID)
+		uri := endpointURL("/oauth2/device")
+		userCode := try6.FormatUserCode(code.UserCode)
+		return ctx.JSON(http.StatusOK, &deviceAuthorizationResponse{
+			DeviceCode:              secret,
+			UserCode:                userCode,
+			VerificationURI:         uri,
+			VerificationURIComplete: uri + "?user_code=" + userCode,
+			ExpiresIn:               int64(try6.DeviceCodeTTL.Seconds()),
+			Interval:                code.Interval,
+		})
+	}
+}
+
+// Device handler is the verification page of the device authorization grant. It
+// asks for the user code shown on the device and then shows the login page of the
+// tenant of the client the code was issued to.
+func Device(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		if err := ctx.Request().ParseForm(); err != nil {
+			return askUserCode(ctx, http.StatusBadRequest, "")
+		}
+		userCode := ctx.Request().Form.Get("user_code")
+		if userCode == "" {
+			return askUserCode(ctx, http.StatusOK, "")
+		}
+		v, err := verifyDevice(sm, userCode)
+		if err != nil {
+			return deviceFail(ctx, v, "Device", err)
+		}
+		csrf, err := csrfToken(ctx)
+		if err != nil {
+			return deviceFail(ctx, v, "Device", err)
+		}
+		return renderLogin(ctx, http.StatusOK, v.page(csrf))
+	}
+}
+
+// DeviceLogin handler authenticates the account with the login page form of the
+// verification page, as AuthorizeLogin does, and approves the device code so the
+// device gets the tokens of the account the next time it polls. The account is
+// asked for its consent to third party clients, and the code is denied if it does
+// not give it.
+func DeviceLogin(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		r := ctx.Request()
+		if err := r.ParseForm(); err != nil {
+			return askUserCode(ctx, http.StatusBadRequest, "")
+		}
+		v, err := verifyDevice(sm, r.PostFormValue("user_code"))
+		if err != nil {
+			return deviceFail(ctx, v, "DeviceLogin", err)
+		}
+		csrf, err := csrfToken(ctx)
+		if err != nil {
+			return deviceFail(ctx, v, "DeviceLogin", err)
+		}
+		page := v.page(csrf)
+		account, amr, status, err := loginForm(sm, ctx, page, v.scope)
+		if err != nil {
+			return deviceFail(ctx, v, "DeviceLogin", err)
+		}
+		if account == nil {
+			return renderLogin(ctx, status, page)
+		}
+		ok, err := askConsent(sm, ctx, page, v.client, account, amr, v.code.Scope)
+		if err == tryerr.ErrConsentDenied {
+			return denyDevice(sm, ctx, v, account)
+		}
+		if err != nil {
+			return deviceFail(ctx, v, "DeviceLogin", err)
+		}
+		if !ok {
+			return renderLogin(ctx, http.StatusOK, page)
+		}
+		err = v.code.Approve(account.ID, amr, time.Now())
+		if err == tryerr.ErrInvalidGrant {
+			err = tryerr.ErrInvalidUserCode
+		}
+		if err == nil {
+			err = sm.ApproveDeviceCode(v.code)
+		}
+		if err != nil {
+			return deviceFail(ctx, v, "DeviceLogin", err)
+		}
+		log.LogI("device code approved", "pkg", "api", "func", "DeviceLogin(store.Storer)", "client", v.client.ID, "account", account.ID, "id", v.code.ID)
+		return renderLogin(ctx, http.StatusOK, &loginPage{Branding: v.branding, Client: v.client.Name, Info: "Your device is signed in. You can close this window and return to it."})
+	}
+}
+
+// denyDevice marks the device code as denied by the account, so the device gets an
+// access_denied error the next time it polls
+func denyDevice(sm store.Storer, ctx *echo.Context, v *deviceVerification, account *try6.Account) error {
+	err := v.code.Deny(account.ID)
+	if err == tryerr.ErrInvalidGrant {
+		err = tryerr.ErrInvalidUserCode
+	}
+	if err == nil {
+		err = sm.ApproveDeviceCode(v.code)
+	}
+	if err != nil {
+		return deviceFail(ctx, v, "DeviceLogin", err)
+	}
+	log.LogI("device code denied", "pkg", "api", "func", "denyDevice(store.Storer, *echo.Context, *deviceVerification, *try6.Account)", "client", v.client.ID, "account", account.ID, "id", v.code.ID)
+	return renderLogin(ctx, http.StatusOK, &loginPage{Branding: v.branding, Client: v.client.Name, Info: "Your device has not been signed in. You can close this window."})
+}
+
+// verifyDevice returns the pending device code with the user code, along with its
+// client and the scope and branding of the client. The client and its scope must
+// be usable. The verification is returned with the branding found on errors.
+func verifyDevice(sm store.Storer, userCode string) (*deviceVerification, error) {
+	v := &deviceVerification{}
+	code, err := sm.GetDeviceCodeByUserCode(try6.NormalizeUserCode(userCode))
+	if err != nil {
+		return v, err
+	}
+	v.code = code
+	if v.client, err = sm.GetClientByID(code.ClientID); err != nil {
+		if err == tryerr.ErrClientNotFound {
+			return v, tryerr.ErrInvalidUserCode
+		}
+		return v, err
+	}
+	if try6.Usable(v.client.Status) != nil {
+		return v, tryerr.ErrDisabled
+	}
+	if v.scope, _, err = clientScope(sm, v.client); err != nil {
+		return v, err
+	}
+	v.branding, err = sm.GetBranding(v.scope.TenantID)
+	return v, err
+}
+
+// page returns the login page of the device verification
+func (v *deviceVerification) page(csrf string) *loginPage {
+	userCode := try6.FormatUserCode(v.code.UserCode)
+	return &loginPage{
+		Branding: v.branding,
+		Client:   v.client.Name,
+		CSRF:     csrf,
+		Info:     "Check that " + userCode + " is the code shown on your device.",
+		Params:   map[string]string{"user_code": userCode},
+	}
+}
+
+// askUserCode writes the verification page that asks for the user code of the
+// device, with an error message if not empty
+func askUserCode(ctx *echo.Context, status int, message string) error {
+	return renderLogin(ctx, status, &loginPage{Branding: try6.DefaultBranding(""), Error: message, AskCode: true})
+}
+
+// deviceFail writes the verification page for an error of the device verification
+func deviceFail(ctx *echo.Context, v *deviceVerification, action string, err error) error {
+	switch err {
+	case tryerr.ErrInvalidUserCode:
+		return askUserCode(ctx, http.StatusBadRequest, loginMessage(err))
+	case tryerr.ErrDisabled, tryerr.ErrDeleted:
+		return loginErrorPage(ctx, http.StatusBadRequest, v.branding, "The application is disabled.")
+	}
+	log.LogE("device verification error", "pkg", "api", "func", action, "error", err.Error())
+	return loginErrorPage(ctx, http.StatusInternalServerError, v.branding, loginMessage(err))
+}
+
+// deviceCode issues an access token to the client for the account that approved
+// the device code. Devices that poll before their interval are asked to slow down.
+// Clients allowed to use the refresh_token grant get a refresh token too.
+func deviceCode(sm store.Storer, ctx *echo.Context, client *try6.Client) error {
+	code, err := sm.GetDeviceCode(try6.HashToken(ctx.Request().PostFormValue("device_code")))
+	if err != nil {
+		return grantError(ctx, "deviceCode", err)
+	}
+	perr := code.Poll(client.ID, time.Now().UTC())
+	if perr == nil || perr == tryerr.ErrAuthorizationPending || perr == tryerr.ErrSlowDown {
+		if err := sm.SaveDevicePoll(code); err != nil {
+			return oauthServerError(ctx, "deviceCode", err)
+		}
+	}
+	switch perr {
+	case nil:
+	case tryerr.ErrAuthorizationPending:
+		return oauthFail(ctx, http.StatusBadRequest, errAuthorizationPending, perr.Error())
+	case tryerr.ErrSlowDown:
+		return oauthFail(ctx, http.StatusBadRequest, errSlowDown, perr.Error())
+	case tryerr.ErrExpiredToken:
+		return oauthFail(ctx, http.StatusBadRequest, errExpiredToken, perr.Error())
+	case tryerr.ErrConsentDenied:
+		return oauthFail(ctx, http.StatusBadRequest, errAccessDenied, perr.Error())
+	default:
+		return grantError(ctx, "deviceCode", perr)
+	}
+	err = sm.UseDeviceCode(code.ID)
+	var account *try6.Account
+	if err == nil {
+		account, err = grantAccount(sm, code.AccountID.String)
+	}
+	if err != nil {
+		return grantError(ctx, "deviceCode", err)
+	}
+	scope, key, err := clientScope(sm, client)
+	if err != nil {
+		return grantError(ctx, "deviceCode", err)
+	}
+	g := &accountGrant{account: account, scope: code.Scope, amr: code.AMR, authTime: code.AuthTime.Time}
+	if err := startRefreshFamily(sm, client, g); err != nil {
+		return oauthServerError(ctx, "deviceCode", err)
+	}
+	return issueAccountTokens(sm, ctx, client, scope, key, g)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+	"github.com/labstack/echo"
+)
+
+// directoryRequest holds the fields of a directory that can be updated. The status
+// is changed with ChangeStatus and CaseSensitiveEmail only while the directory has
+// no accounts, as their email keys depend on it.
+type directoryRequest struct {
+	Label                *string `json:"label"`
+	Description          *string `json:"description"`
+	AllowUnverifiedLogin *bool   `json:"allow_unverified_login"`
+	RequireMFA           *bool   `json:"require_mfa"`
+	CaseSensitiveEmail   *bool   `json:"case_sensitive_email"`
+}
+
+// UpdateDirectory handler updates the directory with the data provided in the body.
+// Fields not present in the body keep their current value.
+func UpdateDirectory(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var directoryID string
+		if directoryID = ctx.Param("id"); directoryID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdateDirectory", Info: "directory id cannot be nil"})
+		}
+		dir, err := sm.GetDirectoryByID(directoryID)
+		if err != nil {
+			if err == tryerr.ErrDirectoryNotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "UpdateDirectory", Info: err.Error(), Table: "directories", UID: directoryID})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdateDirectory", Info: err.Error(), Table: "directories"})
+		}
+		var r directoryRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdateDirectory", Info: err.Error(), Table: "directories"})
+		}
+		if r.CaseSensitiveEmail != nil && *r.CaseSensitiveEmail != dir.CaseSensitiveEmail {
+			n, err := sm.CountDirectoryAccounts(dir.ID)
+			if err != nil {
+				return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdateDirectory", Info: err.Error(), Table: "directories"})
+			}
+			if n > 0 {
+				return ctx.JSON(http.StatusConflict, &logMessage{Status: "error", Action: "UpdateDirectory", Info: tryerr.ErrDirectoryNotEmpty.Error(), Table: "directories", UID: dir.ID})
+			}
+		}
+		if r.RequireMFA != nil && *r.RequireMFA && !dir.RequireMFA && !try6.SecretKeyConfigured() {
+			// its accounts could not enroll the second factor required to log in
+			return ctx.JSON(http.StatusConflict, &logMessage{Status: "error", Action: "UpdateDirectory", Info: tryerr.ErrNoSecretKey.Error(), Table: "directories", UID: dir.ID})
+		}
+		r.apply(dir)
+		if err := sm.SaveDirectory(dir); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdateDirectory", Info: err.Error(), Table: "directories"})
+		}
+		return ctx.JSON(http.StatusOK, dir)
+	}
+}
+
+// apply sets the fields present in the request on the directory
+func (r *directoryRequest) apply(dir *try6.Directory) {
+	if r.Label != nil {
+		dir.Label = *r.Label
+	}
+	if r.Description != nil {
+		dir.Description = *r.Description
+	}
+	if r.AllowUnverifiedLogin != nil {
+		dir.AllowUnverifiedLogin = *r.AllowUnverifiedLogin
+	}
+	if r.RequireMFA != nil {
+		dir.RequireMFA = *r.RequireMFA
+	}
+	if r.CaseSensitiveEmail != nil {
+		dir.CaseSensitiveEmail = *r.CaseSensitiveEmail
+	}
+}
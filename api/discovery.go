@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+)
+
+// providerMetadata is the OpenID Connect discovery document as defined in OpenID
+// Connect Discovery 1.0 section 3, with the endpoints of RFC 8414 too
+type providerMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RegistrationEndpoint              string   `json:"registration_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ACRValuesSupported                []string `json:"acr_values_supported"`
+}
+
+// OpenIDConfiguration handler returns the OpenID Connect discovery document of the
+// server, served from /.well-known/openid-configuration under the issuer URL. The
+// endpoints are built from try6.Issuer, the PublicURL of the configuration.
+func OpenIDConfiguration(ctx *echo.Context) error {
+	return ctx.JSON(http.StatusOK, &providerMetadata{
+		Issuer:                            try6.Issuer,
+		AuthorizationEndpoint:             endpointURL("/oauth2/authorize"),
+		TokenEndpoint:                     endpointURL("/oauth2/token"),
+		UserInfoEndpoint:                  endpointURL("/oauth2/userinfo"),
+		JWKSURI:                           endpointURL("/oauth2/jwks"),
+		RegistrationEndpoint:              endpointURL("/oauth2/register"),
+		RevocationEndpoint:                endpointURL("/oauth2/revoke"),
+		DeviceAuthorizationEndpoint:       endpointURL("/oauth2/device_authorization"),
+		ScopesSupported:                   strings.Fields(userInfoScopes),
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               try6.SupportedGrants,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{authMethodSecretBasic, authMethodSecretPost, authMethodNone},
+		CodeChallengeMethodsSupported:     []string{try6.CodeChallengeS256},
+		ACRValuesSupported:                []string{try6.ACRSingleFactor, try6.ACRMultiFactor},
+	})
+}
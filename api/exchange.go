@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// tokenExchange issues to the client an access token for the audience requested on
+// behalf of the account of the subject token, an active access token of the same
+// tenant. The scope parameter can narrow the scopes of the subject token. The
+// exchange must be allowed by the rules of the scope the subject token was issued
+// in, that list the clients allowed, and the token issued records the client in its
+// act claim.
+func tokenExchange(sm store.Storer, ctx *echo.Context, client *try6.Client) error {
+	r := ctx.Request()
+	switch {
+	case r.PostFormValue("subject_token") == "":
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidRequest, "subject_token is required")
+	case r.PostFormValue("subject_token_type") != try6.TokenTypeAccessToken && r.PostFormValue("subject_token_type") != try6.TokenTypeJWT:
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidRequest, "subject_token_type must be an access token")
+	case r.PostFormValue("actor_token") != "":
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidRequest, "actor tokens are not supported, the client is the actor")
+	case r.PostFormValue("requested_token_type") != "" && r.PostFormValue("requested_token_type") != try6.TokenTypeAccessToken:
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidRequest, "only access tokens can be requested")
+	case len(r.PostForm["audience"]) != 1 || r.PostFormValue("audience") == "":
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidTarget, "one audience is required")
+	}
+	audience := r.PostFormValue("audience")
+	subject, subjectRec, err := activeToken(sm, r.PostFormValue("subject_token"))
+	if err != nil {
+		if err == tryerr.ErrInvalidToken {
+			return oauthFail(ctx, http.StatusBadRequest, errInvalidGrant, err.Error())
+		}
+		return oauthServerError(ctx, "tokenExchange", err)
+	}
+	scope, key, err := clientScope(sm, client)
+	if err != nil {
+		return grantError(ctx, "tokenExchange", err)
+	}
+	if !subjectRec.AccountID.Valid || subjectRec.TenantID != key.TenantID {
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidGrant, tryerr.ErrInvalidGrant.Error())
+	}
+	account, err := grantAccount(sm, subjectRec.AccountID.String)
+	if err != nil {
+		return grantError(ctx, "tokenExchange", err)
+	}
+	// the scope that issued the subject token decides who can exchange it
+	rules, err := subjectExchanges(sm, subjectRec)
+	if err != nil {
+		return grantError(ctx, "tokenExchange", err)
+	}
+	subjectScope, _ := subject["scope"].(string)
+	granted, err := try6.NarrowScope(subjectScope, r.PostFormValue("scope"))
+	if err == nil {
+		err = rules.Allow(client.ID, audience, granted)
+	}
+	switch err {
+	case nil:
+	case tryerr.ErrInvalidAudience:
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidTarget, err.Error())
+	case tryerr.ErrInvalidClient:
+		return oauthFail(ctx, http.StatusBadRequest, errUnauthorizedClient, "the client can not exchange tokens for the audience")
+	default:
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidScope, err.Error())
+	}
+	claims, err := accountClaims(sm, account, scope, granted)
+	if err != nil {
+		return oauthServerError(ctx, "tokenExchange", err)
+	}
+	token, rec, err := try6.NewExchangedToken(key, client, subject, audience, claims)
+	if err != nil {
+		return oauthServerError(ctx, "tokenExchange", err)
+	}
+	// revoking the family of the subject token revokes the exchanged ones too
+	rec.FamilyID = subjectRec.FamilyID
+	if err := sm.SaveJWT(rec); err != nil {
+		return oauthServerError(ctx, "tokenExchange", err)
+	}
+	log.LogI("token exchanged", "pkg", "api", "func", "tokenExchange(store.Storer, *echo.Context, *try6.Client)", "client", client.ID, "account", account.ID, "audience", audience, "subject", subjectRec.ID, "jti", rec.ID)
+	return ctx.JSON(http.StatusOK, &tokenResponse{
+		AccessToken:     token,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(time.Until(rec.Expires.Time).Seconds()),
+		Scope:           granted,
+		IssuedTokenType: try6.TokenTypeAccessToken,
+	})
+}
+
+// subjectExchanges returns the exchange rules of the scope of the client the subject
+// token was issued to. It returns tryerr.ErrInvalidGrant if the token has no client
+// or its client is gone, and tryerr.ErrDisabled or tryerr.ErrDeleted if the client
+// or its scope are not usable.
+func subjectExchanges(sm store.Storer, rec *try6.JWT) (try6.ExchangeRules, error) {
+	if !rec.ClientID.Valid {
+		return nil, tryerr.ErrInvalidGrant
+	}
+	c, err := sm.GetClientByID(rec.ClientID.String)
+	if err != nil {
+		if err == tryerr.ErrClientNotFound {
+			return nil, tryerr.ErrInvalidGrant
+		}
+		return nil, err
+	}
+	if err := try6.Usable(c.Status); err != nil {
+		return nil, err
+	}
+	s, err := usableScope(sm, c.ScopeID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Exchanges, nil
+}
+
+// GetScopeExchanges handler returns the token exchanges allowed for the access
+// tokens issued in the scope
+func GetScopeExchanges(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		s, err := sm.GetScopeByID(ctx.Param("id"))
+		if err != nil {
+			return exchangeError(ctx, "GetScopeExchanges", err)
+		}
+		if s.Exchanges == nil {
+			s.Exchanges = try6.ExchangeRules{}
+		}
+		return ctx.JSON(http.StatusOK, s.Exchanges)
+	}
+}
+
+// PutScopeExchanges handler replaces the token exchanges allowed for the access
+// tokens issued in the scope. The body is a JSON array of rules with the audience
+// the tokens can be exchanged for, the clients allowed to exchange them, of any
+// scope of the tenant, and, optionally, the only scopes allowed:
+//
+//	[{"audience": "billing", "clients": ["<client id>"], "scopes": ["invoices:read"]}]
+func PutScopeExchanges(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		s, err := sm.GetScopeByID(ctx.Param("id"))
+		if err != nil {
+			return exchangeError(ctx, "PutScopeExchanges", err)
+		}
+		var rules try6.ExchangeRules
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&rules); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "PutScopeExchanges", Info: err.Error(), Table: "scopes"})
+		}
+		if err := rules.Validate(); err != nil {
+			return exchangeError(ctx, "PutScopeExchanges", err)
+		}
+		s.Exchanges = rules
+		if err := sm.SaveScope(s); err != nil {
+			return exchangeError(ctx, "PutScopeExchanges", err)
+		}
+		if s.Exchanges == nil {
+			s.Exchanges = try6.ExchangeRules{}
+		}
+		return ctx.JSON(http.StatusOK, s.Exchanges)
+	}
+}
+
+// exchangeError writes the response for an error of the token exchange rules handlers
+func exchangeError(ctx *echo.Context, action string, err error) error {
+	status := http.StatusInternalServerError
+	switch err {
+	case tryerr.ErrInvalidAudience, tryerr.ErrInvalidClient, tryerr.ErrInvalidScope:
+		status = http.StatusBadRequest
+	case tryerr.ErrScopeNotFound:
+		status = http.StatusNotFound
+	}
+	return ctx.JSON(status, &logMessage{Status: "error", Action: action, Info: err.Error(), Table: "scopes"})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// customDataFilterPrefix is the prefix of the query parameters that filter
+// accounts by custom data
+const customDataFilterPrefix = "data."
+
+/*
+listQuery returns the list query of the request. The query parameters are:
+
+- status: items with the given status
+
+- email: accounts whose email starts with the value
+
+- created_after, created_before: items created in the range, in RFC 3339 format
+
+- directory: accounts of the directory
+
+- data.<key>: accounts whose custom data key has the value, or just exists if
+the value is empty
+
+- sort: field to sort by, prefixed with - for descending order
+
+- cursor: the cursor of the page, as found in the Link header of the previous one
+
+- limit: the page size
+*/
+func listQuery(ctx *echo.Context) (*store.ListQuery, error) {
+	params := ctx.Request().URL.Query()
+	q := &store.ListQuery{
+		Status:      params.Get("status"),
+		EmailPrefix: params.Get("email"),
+		DirectoryID: params.Get("directory"),
+		Sort:        params.Get("sort"),
+		Cursor:      params.Get("cursor"),
+	}
+	var err error
+	if v := params.Get("created_after"); v != "" {
+		if q.CreatedAfter, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, err
+		}
+	}
+	if v := params.Get("created_before"); v != "" {
+		if q.CreatedBefore, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, err
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range params {
+		if strings.HasPrefix(k, customDataFilterPrefix) {
+			if q.CustomData == nil {
+				q.CustomData = try6.CustomData{}
+			}
+			q.CustomData[strings.TrimPrefix(k, customDataFilterPrefix)] = v[0]
+		}
+	}
+	if err := q.CustomData.Validate(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// setLinkHeader adds the Link header with the first and next pages of a list to
+// the response. There is no next page if next is empty.
+func setLinkHeader(ctx *echo.Context, next string) {
+	u := *ctx.Request().URL
+	params := u.Query()
+	link := func(cursor, rel string) string {
+		params.Del("cursor")
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		u.RawQuery = params.Encode()
+		return "<" + u.RequestURI() + `>; rel="` + rel + `"`
+	}
+	links := []string{link("", "first")}
+	if next != "" {
+		links = append(links, link(next, "next"))
+	}
+	ctx.Response().Header().Set("Link", strings.Join(links, ", "))
+}
+
+// isListQueryError reports whether err is caused by a wrong list query
+func isListQueryError(err error) bool {
+	switch err {
+	case tryerr.ErrInvalidSort, tryerr.ErrInvalidCursor, tryerr.ErrCustomDataTooLarge, tryerr.ErrInvalidCustomDataKey:
+		return true
+	}
+	switch err.(type) {
+	case *time.ParseError, *strconv.NumError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"html/template"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// loginPage holds the data rendered in the hosted login page. The page asks for
+// the email and password or, if MFAToken is set, for the code of the second
+// factor. Params are the parameters of the authorization request, sent back as
+// hidden fields. If AskCode is set the page asks for the user code of a device
+// instead, and if ConsentToken is set it asks the account to allow the client the
+// Scopes listed. Info is a message shown above the form.
+type loginPage struct {
+	Branding     *try6.Branding
+	Client       string
+	Error        string
+	Info         string
+	Email        string
+	MFAToken     string
+	CSRF         string
+	ConsentToken string
+	Scopes       []string
+	AskCode      bool
+	Params       map[string]string
+}
+
+// loginTemplate renders the hosted login page. It has no external resources but
+// the logo of the tenant.
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Branding.DisplayName}}</title>
+<style>
+body { margin: 0; font-family: -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; background: {{.Branding.BackgroundColor}}; color: #212121; }
+main { max-width: 360px; margin: 10vh auto; padding: 32px; background: #fff; border-radius: 8px; box-shadow: 0 1px 4px rgba(0,0,0,.15); }
+h1 { font-size: 20px; margin: 0 0 8px; text-align: center; }
+p { margin: 0 0 24px; text-align: center; color: #616161; }
+img { display: block; max-width: 160px; max-height: 64px; margin: 0 auto 16px; }
+label { display: block; margin: 16px 0 4px; font-size: 14px; }
+input[type=email], input[type=password], input[type=text] { box-sizing: border-box; width: 100%; padding: 10px; border: 1px solid #bdbdbd; border-radius: 4px; font-size: 16px; }
+button { width: 100%; margin-top: 24px; padding: 12px; border: 0; border-radius: 4px; background: {{.Branding.PrimaryColor}}; color: #fff; font-size: 16px; cursor: pointer; }
+button.secondary { margin-top: 12px; background: #fff; color: #424242; border: 1px solid #bdbdbd; }
+ul { margin: 0; padding-left: 20px; font-size: 14px; line-height: 1.8; }
+.error { margin: 0 0 16px; padding: 10px; border-radius: 4px; background: #ffebee; color: #b71c1c; font-size: 14px; }
+</style>
+</head>
+<body>
+<main>
+{{if .Branding.LogoURL}}<img src="{{.Branding.LogoURL}}" alt="{{.Branding.DisplayName}}">{{end}}
+<h1>{{.Branding.DisplayName}}</h1>
+{{if .Client}}<p>Sign in to continue to {{.Client}}</p>{{end}}
+{{if .Error}}<div class="error" role="alert">{{.Error}}</div>{{end}}
+{{if .Info}}<p>{{.Info}}</p>{{end}}
+{{if .AskCode}}<form method="get">
+<label for="user_code">Enter the code shown on your device</label>
+<input id="user_code" name="user_code" type="text" autocomplete="off" autocapitalize="characters" required autofocus>
+<button type="submit">Continue</button>
+</form>{{else if .Params}}<form method="post" autocomplete="on">
+<input type="hidden" name="csrf_token" value="{{.CSRF}}">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{$v}}">
+{{end}}{{if .ConsentToken}}<input type="hidden" name="consent_token" value="{{.ConsentToken}}">
+<label>{{.Client}} wants to access your account {{.Email}} to:</label>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<button type="submit" name="consent" value="allow" autofocus>Allow</button>
+<button type="submit" name="consent" value="deny" class="secondary">Deny</button>
+{{else if .MFAToken}}<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label for="code">Authentication code for {{.Email}}</label>
+<input id="code" name="code" type="text" inputmode="numeric" autocomplete="one-time-code" autofocus>
+<label for="recovery_code">Or a recovery code</label>
+<input id="recovery_code" name="recovery_code" type="text" autocomplete="off">
+<button type="submit">Verify</button>
+{{else}}<label for="email">Email</label>
+<input id="email" name="email" type="email" value="{{.Email}}" autocomplete="username" required autofocus>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<button type="submit">Sign in</button>
+{{end}}</form>{{end}}
+</main>
+</body>
+</html>
+`))
+
+// renderLogin writes the hosted login page. The page can not be framed nor cached.
+func renderLogin(ctx *echo.Context, status int, page *loginPage) error {
+	h := ctx.Response().Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("Pragma", "no-cache")
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src https:; frame-ancestors 'none'")
+	h.Set("Referrer-Policy", "no-referrer")
+	ctx.Response().WriteHeader(status)
+	if err := loginTemplate.Execute(ctx.Response(), page); err != nil {
+		log.LogE("error rendering login page", "pkg", "api", "func", "renderLogin(*echo.Context, int, *loginPage)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// loginErrorPage writes a login page with only the error message, for the
+// authorization requests that can not be redirected back to the client
+func loginErrorPage(ctx *echo.Context, status int, branding *try6.Branding, message string) error {
+	if branding == nil {
+		branding = try6.DefaultBranding("")
+	}
+	return renderLogin(ctx, status, &loginPage{Branding: branding, Error: message})
+}
+
+// loginMessages holds the message shown in the login page for the errors of the
+// authentication
+var loginMessages = map[error]string{
+	tryerr.ErrInvalidCredentials: "Invalid email or password.",
+	tryerr.ErrTooManyAttempts:    "Too many failed attempts. Please try again later.",
+	tryerr.ErrAccountLocked:      "Your account is locked after too many failed attempts. Please try again later.",
+	tryerr.ErrDisabled:           "Your account is disabled.",
+	tryerr.ErrDeleted:            "Your account is disabled.",
+	tryerr.ErrEmailUnverified:    "Please verify your email address before signing in.",
+	tryerr.ErrPasswordExpired:    "Your password has expired. Please change it before signing in.",
+	tryerr.ErrMFARequired:        "Your account must enroll a second factor before signing in.",
+	tryerr.ErrInvalidMFACode:     "Invalid code.",
+	tryerr.ErrMFANotFound:        "Invalid code.",
+	tryerr.ErrInvalidToken:       "Your session has expired. Please sign in again.",
+	tryerr.ErrInvalidContext:     "Your session has expired. Please sign in again.",
+	tryerr.ErrInvalidUserCode:    "The code is not valid or has expired. Check the code shown on your device.",
+	tryerr.ErrConsentDenied:      "You denied access to the application.",
+}
+
+// loginMessage returns the message shown in the login page for the error
+func loginMessage(err error) string {
+	if m, ok := loginMessages[err]; ok {
+		return m
+	}
+	return "Something went wrong. Please try again later."
+}
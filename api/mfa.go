@@ -0,0 +1,471 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+	"github.com/labstack/echo"
+)
+
+// mfaCode holds a second factor code: a code of the authenticator or, when
+// accepted, one of the recovery codes
+type mfaCode struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// mfaAuthentication holds the second step of an authentication. Either a code of
+// the authenticator or a recovery code must be provided.
+type mfaAuthentication struct {
+	Token        string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// totpConfirmation is returned when a TOTP authenticator is confirmed
+type totpConfirmation struct {
+	MFA           *try6.AccountMFA `json:"mfa"`
+	RecoveryCodes []string         `json:"recovery_codes"`
+}
+
+// recoveryCodes is returned when the recovery codes of an account are listed or regenerated
+type recoveryCodes struct {
+	Codes     []string `json:"recovery_codes,omitempty"`
+	Remaining int      `json:"remaining"`
+}
+
+// totpEnrollment is returned when a TOTP authenticator is enrolled
+type totpEnrollment struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// mfaChallengeResponse is returned when the password is correct and the account
+// must complete the authentication with a second factor
+type mfaChallengeResponse struct {
+	Status  string    `json:"status"`
+	Token   string    `json:"mfa_token"`
+	Expires time.Time `json:"expires"`
+}
+
+// mfaEnrollmentResponse is returned when the password is correct but the account
+// must enroll a second factor before it can log in. The token authorizes the
+// enrollment.
+type mfaEnrollmentResponse struct {
+	Status    string    `json:"status"`
+	Code      string    `json:"code"`
+	AccountID string    `json:"account_id"`
+	Token     string    `json:"mfa_enrollment_token"`
+	Expires   time.Time `json:"expires"`
+}
+
+// EnrollTOTP handler generates a new TOTP secret for the account. The response
+// holds the secret and the otpauth:// URI to show as a QR code. The authenticator
+// is not used until confirmed with ConfirmTOTP. Only the account itself can enroll
+// an authenticator, with a bearer token or the MFA enrollment token returned by
+// Authenticate, and it must provide a code of its active one to replace it.
+func EnrollTOTP(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var accountID string
+		if accountID = ctx.Param("id"); accountID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "EnrollTOTP", Info: "account id cannot be nil"})
+		}
+		account, _, err := authorizeEnrollment(sm, ctx.Request(), accountID)
+		if err != nil {
+			return accessError(ctx, "EnrollTOTP", err)
+		}
+		if err := proveMFA(sm, ctx, account); err != nil {
+			return mfaProofError(ctx, "EnrollTOTP", account, err)
+		}
+		m, secret, uri, err := try6.NewTOTP(account)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "EnrollTOTP", Info: err.Error(), Table: "account_mfa"})
+		}
+		if err := sm.SaveAccountMFA(m); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "EnrollTOTP", Info: err.Error(), Table: "account_mfa"})
+		}
+		return ctx.JSON(http.StatusCreated, &totpEnrollment{ID: m.ID, Secret: secret, URI: uri})
+	}
+}
+
+// ConfirmTOTP handler activates the TOTP authenticator of the account with the
+// first code it generates. A new set of recovery codes is returned along with it.
+// It is authorized as EnrollTOTP and the MFA enrollment token can not be used again
+// once the authenticator is confirmed.
+func ConfirmTOTP(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var accountID string
+		if accountID = ctx.Param("id"); accountID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ConfirmTOTP", Info: "account id cannot be nil"})
+		}
+		_, enrollment, err := authorizeEnrollment(sm, ctx.Request(), accountID)
+		if err != nil {
+			return accessError(ctx, "ConfirmTOTP", err)
+		}
+		var c mfaCode
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&c); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ConfirmTOTP", Info: err.Error(), Table: "account_mfa"})
+		}
+		m, err := sm.GetAccountMFA(accountID, try6.MFATotp)
+		if err != nil {
+			if err == tryerr.ErrMFANotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "ConfirmTOTP", Info: err.Error(), Table: "account_mfa", UID: accountID})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ConfirmTOTP", Info: err.Error(), Table: "account_mfa"})
+		}
+		if m.Active() {
+			return ctx.JSON(http.StatusConflict, &logMessage{Status: "error", Action: "ConfirmTOTP", Info: "mfa already confirmed", Table: "account_mfa", UID: m.ID})
+		}
+		if err := m.Confirm(c.Code); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ConfirmTOTP", Info: err.Error(), Table: "account_mfa"})
+		}
+		if enrollment != nil {
+			if err := sm.UseAccountToken(enrollment); err != nil {
+				return accessError(ctx, "ConfirmTOTP", err)
+			}
+		}
+		if err := sm.UseMFAStep(m); err != nil {
+			if err == tryerr.ErrInvalidMFACode {
+				return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ConfirmTOTP", Info: err.Error(), Table: "account_mfa"})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ConfirmTOTP", Info: err.Error(), Table: "account_mfa"})
+		}
+		codes, err := replaceRecoveryCodes(sm, accountID)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ConfirmTOTP", Info: err.Error(), Table: "recovery_codes"})
+		}
+		return ctx.JSON(http.StatusOK, &totpConfirmation{MFA: m, RecoveryCodes: codes})
+	}
+}
+
+// DeleteTOTP handler removes the TOTP authenticator and the recovery codes of the
+// account. Only the account itself can remove it, providing a code of the
+// authenticator or one of its recovery codes if it is active.
+func DeleteTOTP(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var accountID string
+		if accountID = ctx.Param("id"); accountID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "DeleteTOTP", Info: "account id cannot be nil"})
+		}
+		account, err := authorizeSelf(sm, ctx.Request(), accountID)
+		if err != nil {
+			return accessError(ctx, "DeleteTOTP", err)
+		}
+		if err := proveMFA(sm, ctx, account); err != nil {
+			return mfaProofError(ctx, "DeleteTOTP", account, err)
+		}
+		if err := sm.DeleteAccountMFA(accountID, try6.MFATotp); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "DeleteTOTP", Info: err.Error(), Table: "account_mfa"})
+		}
+		if err := sm.DeleteRecoveryCodes(accountID); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "DeleteTOTP", Info: err.Error(), Table: "recovery_codes"})
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+// AuthenticateMFA handler completes an authentication with the MFA challenge token
+// returned by Authenticate and a code of the account authenticator or one of its
+// recovery codes. Failed codes count as failed logins of the account.
+func AuthenticateMFA(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var r mfaAuthentication
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil || r.Token == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "authenticate", Info: "mfa token not provided"})
+		}
+		account, err := loginMFA(sm, &r, clientIP(ctx.Request()))
+		if err != nil {
+			return loginError(ctx, account, err)
+		}
+		return authenticated(ctx, account)
+	}
+}
+
+// loginMFA completes an authentication with the MFA challenge token and a code of
+// the account authenticator or one of its recovery codes. It returns the account
+// authenticated or one of tryerr.ErrInvalidToken, ErrAccountLocked, ErrDisabled,
+// ErrDeleted, ErrInvalidMFACode and ErrMFANotFound. The account is returned along
+// with them when it is known.
+func loginMFA(sm store.Storer, r *mfaAuthentication, ip string) (*try6.Account, error) {
+	t, err := sm.GetAccountToken(try6.TokenMFAChallenge, try6.HashToken(r.Token))
+	if err == nil {
+		err = t.Valid()
+	}
+	if err != nil {
+		if err == tryerr.ErrTokenNotFound || err == tryerr.ErrTokenExpired {
+			return nil, tryerr.ErrInvalidToken
+		}
+		return nil, err
+	}
+	account, err := sm.GetAccountByID(t.AccountID)
+	if err != nil {
+		if err == tryerr.ErrAccountNotFound {
+			return nil, tryerr.ErrInvalidToken
+		}
+		return nil, err
+	}
+	if account.Locked() {
+		return account, tryerr.ErrAccountLocked
+	}
+	if err := usableAccount(sm, account); err != nil {
+		return account, err
+	}
+	if err := checkSecondFactor(sm, account, r.Code, r.RecoveryCode, ip); err != nil {
+		return account, err
+	}
+	if err := sm.UseAccountToken(t); err != nil {
+		return account, err
+	}
+	return account, nil
+}
+
+// GetRecoveryCodes handler returns the number of unused recovery codes of the account
+func GetRecoveryCodes(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var accountID string
+		if accountID = ctx.Param("id"); accountID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "GetRecoveryCodes", Info: "account id cannot be nil"})
+		}
+		if _, err := authorizeSelf(sm, ctx.Request(), accountID); err != nil {
+			return accessError(ctx, "GetRecoveryCodes", err)
+		}
+		codes, err := sm.GetRecoveryCodes(accountID)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "GetRecoveryCodes", Info: err.Error(), Table: "recovery_codes"})
+		}
+		return ctx.JSON(http.StatusOK, &recoveryCodes{Remaining: len(codes)})
+	}
+}
+
+// RegenerateRecoveryCodes handler replaces the recovery codes of the account with
+// a new set. The account must have a confirmed authenticator.
+func RegenerateRecoveryCodes(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var accountID string
+		if accountID = ctx.Param("id"); accountID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "RegenerateRecoveryCodes", Info: "account id cannot be nil"})
+		}
+		if _, err := authorizeSelf(sm, ctx.Request(), accountID); err != nil {
+			return accessError(ctx, "RegenerateRecoveryCodes", err)
+		}
+		m, err := sm.GetAccountMFA(accountID, try6.MFATotp)
+		if err != nil && err != tryerr.ErrMFANotFound {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "RegenerateRecoveryCodes", Info: err.Error(), Table: "account_mfa"})
+		}
+		if m == nil || !m.Active() {
+			return ctx.JSON(http.StatusConflict, &logMessage{Status: "error", Action: "RegenerateRecoveryCodes", Info: tryerr.ErrMFANotFound.Error(), Table: "account_mfa", UID: accountID})
+		}
+		codes, err := replaceRecoveryCodes(sm, accountID)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "RegenerateRecoveryCodes", Info: err.Error(), Table: "recovery_codes"})
+		}
+		return ctx.JSON(http.StatusCreated, &recoveryCodes{Codes: codes, Remaining: len(codes)})
+	}
+}
+
+// checkSecondFactor verifies the code of the authenticator of the account or, if
+// recoveryCode is set, consumes the matching recovery code. Wrong codes count as
+// failed logins of the account.
+func checkSecondFactor(sm store.Storer, account *try6.Account, code, recoveryCode, ip string) error {
+	var err error
+	reason := try6.FailureBadMFACode
+	if recoveryCode != "" {
+		reason = try6.FailureBadRecoveryCode
+		err = useRecoveryCode(sm, account, recoveryCode, ip)
+	} else {
+		err = verifyTOTP(sm, account.ID, code)
+	}
+	if err != tryerr.ErrInvalidMFACode && err != tryerr.ErrMFANotFound {
+		return err
+	}
+	policy, perr := sm.GetPasswordPolicyByAccountID(account.ID)
+	if perr == nil {
+		perr = registerFailure(sm, account, policy, &try6.LoginFailure{AccountID: dat.NullStringFrom(account.ID), Email: account.Email, IP: ip, Reason: reason})
+	}
+	if perr != nil {
+		return perr
+	}
+	return err
+}
+
+// proveMFA checks the body of the request holds a code of the active authenticator
+// of the account, or one of its recovery codes, before it is replaced or removed.
+// Accounts with no active authenticator need none.
+func proveMFA(sm store.Storer, ctx *echo.Context, account *try6.Account) error {
+	m, err := sm.GetAccountMFA(account.ID, try6.MFATotp)
+	if err == tryerr.ErrMFANotFound || err == nil && !m.Active() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var c mfaCode
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&c); err != nil || c.Code == "" && c.RecoveryCode == "" {
+		return tryerr.ErrMFACodeRequired
+	}
+	if account.Locked() {
+		return tryerr.ErrAccountLocked
+	}
+	return checkSecondFactor(sm, account, c.Code, c.RecoveryCode, clientIP(ctx.Request()))
+}
+
+// mfaProofError writes the response for a request that did not prove the second
+// factor of the account
+func mfaProofError(ctx *echo.Context, action string, account *try6.Account, err error) error {
+	switch err {
+	case tryerr.ErrMFACodeRequired:
+		return ctx.JSON(http.StatusForbidden, &logMessage{Status: "error", Action: action, Info: err.Error(), Code: "mfa_code_required", UID: account.ID})
+	case tryerr.ErrInvalidMFACode, tryerr.ErrMFANotFound:
+		return ctx.JSON(http.StatusForbidden, &logMessage{Status: "error", Action: action, Info: err.Error(), Code: "invalid_mfa_code", UID: account.ID})
+	case tryerr.ErrAccountLocked:
+		return ctx.JSON(http.StatusForbidden, &logMessage{Status: "error", Action: action, Info: err.Error(), Code: "account_locked", UID: account.ID})
+	}
+	return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: action, Info: err.Error(), Table: "account_mfa"})
+}
+
+// verifyTOTP checks the code against the confirmed TOTP authenticator of the account
+func verifyTOTP(sm store.Storer, accountID, code string) error {
+	m, err := sm.GetAccountMFA(accountID, try6.MFATotp)
+	if err != nil {
+		return err
+	}
+	if !m.Active() {
+		return tryerr.ErrMFANotFound
+	}
+	if err := m.Verify(code); err != nil {
+		return err
+	}
+	return sm.UseMFAStep(m)
+}
+
+// useRecoveryCode consumes the recovery code of the account that matches code.
+// Every use is recorded for audit.
+func useRecoveryCode(sm store.Storer, account *try6.Account, code, ip string) error {
+	codes, err := sm.GetRecoveryCodes(account.ID)
+	if err != nil {
+		return err
+	}
+	c, err := try6.MatchRecoveryCode(codes, code)
+	if err != nil {
+		return err
+	}
+	if err := sm.UseRecoveryCode(c, ip); err != nil {
+		return err
+	}
+	log.LogW("recovery code used", "pkg", "api", "func", "useRecoveryCode(store.Storer, *try6.Account, string, string)", "account", account.ID, "code", c.ID, "ip", ip, "remaining", len(codes)-1)
+	return nil
+}
+
+// replaceRecoveryCodes generates and stores a new set of recovery codes for the
+// account and returns them in clear
+func replaceRecoveryCodes(sm store.Storer, accountID string) ([]string, error) {
+	hashed, codes, err := try6.NewRecoveryCodes(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := sm.ReplaceRecoveryCodes(accountID, hashed); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// mfaChallenge issues a challenge token for the account to complete the
+// authentication with a second factor
+func mfaChallenge(ctx *echo.Context, sm store.Storer, account *try6.Account) error {
+	t, secret, err := newMFAChallenge(sm, account)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Table: "account_tokens"})
+	}
+	return ctx.JSON(http.StatusOK, &mfaChallengeResponse{Status: "mfa_required", Token: secret, Expires: t.Expires})
+}
+
+// newMFAChallenge revokes the previous challenge tokens of the account and saves a
+// new one. It returns the token and its secret.
+func newMFAChallenge(sm store.Storer, account *try6.Account) (*try6.AccountToken, string, error) {
+	if err := sm.RevokeAccountTokens(account.ID, try6.TokenMFAChallenge); err != nil {
+		return nil, "", err
+	}
+	t, secret, err := try6.NewAccountToken(account.ID, try6.TokenMFAChallenge, try6.MFAChallengeTTL)
+	if err == nil {
+		err = sm.SaveAccountToken(t)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return t, secret, nil
+}
+
+// mfaEnrollment issues an enrollment token for the account to enroll the second
+// factor its directory requires and writes the response that rejects the login
+func mfaEnrollment(ctx *echo.Context, sm store.Storer, account *try6.Account) error {
+	err := sm.RevokeAccountTokens(account.ID, try6.TokenMFAEnrollment)
+	var t *try6.AccountToken
+	var secret string
+	if err == nil {
+		t, secret, err = try6.NewAccountToken(account.ID, try6.TokenMFAEnrollment, try6.MFAEnrollmentTTL)
+	}
+	if err == nil {
+		err = sm.SaveAccountToken(t)
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "authenticate", Info: err.Error(), Table: "account_tokens"})
+	}
+	return ctx.JSON(http.StatusForbidden, &mfaEnrollmentResponse{Status: "error", Code: "mfa_enrollment_required", AccountID: account.ID, Token: secret, Expires: t.Expires})
+}
+
+// authorizeEnrollment checks the request is made by the account itself, with a
+// bearer token or with its MFA enrollment token. The enrollment token is returned
+// when used, so that it is spent once the authenticator is confirmed.
+func authorizeEnrollment(sm store.Storer, r *http.Request, accountID string) (*try6.Account, *try6.AccountToken, error) {
+	if token := bearerToken(r); token != "" {
+		t, err := sm.GetAccountToken(try6.TokenMFAEnrollment, try6.HashToken(token))
+		switch err {
+		case nil:
+			if err := t.Valid(); err != nil {
+				return nil, nil, tryerr.ErrInvalidToken
+			}
+			if t.AccountID != accountID {
+				return nil, nil, tryerr.ErrAccountAccessDenied
+			}
+			account, err := sm.GetAccountByID(accountID)
+			if err == nil {
+				err = usableAccount(sm, account)
+			}
+			switch err {
+			case nil:
+				return account, t, nil
+			case tryerr.ErrAccountNotFound, tryerr.ErrDisabled, tryerr.ErrDeleted:
+				return nil, nil, tryerr.ErrInvalidToken
+			}
+			return nil, nil, err
+		case tryerr.ErrTokenNotFound:
+		default:
+			return nil, nil, err
+		}
+	}
+	account, err := authorizeSelf(sm, r, accountID)
+	return account, nil, err
+}
+
+// requireMFA reports whether any of the directories of the account requires a
+// second factor
+func requireMFA(sm store.Storer, accountID string) (bool, error) {
+	dirs, err := sm.GetDirectoriesByAccountID(accountID)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range dirs {
+		if d.RequireMFA {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/totp"
+)
+
+func TestManageTOTP(t *testing.T) {
+	defer func(k []byte) { try6.SecretKey = k }(try6.SecretKey)
+	try6.SecretKey = make([]byte, 32)
+	sm := newMemStore()
+	a, _ := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	a.Status = try6.StatusActive
+	sm.SaveAccountLockout(a, try6.StatusUnverified)
+	self := sm.bearerFor(a.ID)
+	other, _ := newTestAccount(t, sm, "other", "other@example.com", "password1")
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	const path, route = "/accounts/account/mfa/totp", "/accounts/:id/mfa/totp"
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"another account", sm.bearerFor(other.ID), http.StatusForbidden},
+		{"tenant admin", admin, http.StatusForbidden},
+	} {
+		if rec := serveAs(c.bearer, "POST", path, route, EnrollTOTP(sm), ""); rec.Code != c.want {
+			t.Errorf("enroll by %s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+		if rec := serveAs(c.bearer, "DELETE", path, route, DeleteTOTP(sm), ""); rec.Code != c.want {
+			t.Errorf("delete by %s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+
+	rec := serveAs(self, "POST", path, route, EnrollTOTP(sm), "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("enroll: got %d %s", rec.Code, rec.Body)
+	}
+	var e totpEnrollment
+	json.Unmarshal(rec.Body.Bytes(), &e)
+	code, _ := totp.Code(e.Secret, totp.Step(time.Now().UTC()))
+	rec = serveAs(self, "POST", path+"/confirm", route+"/confirm", ConfirmTOTP(sm), `{"code":"`+code+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm: got %d %s", rec.Code, rec.Body)
+	}
+	var confirmed totpConfirmation
+	json.Unmarshal(rec.Body.Bytes(), &confirmed)
+
+	if rec := serveAs(self, "POST", path, route, EnrollTOTP(sm), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("enroll over an active authenticator without code: got %d", rec.Code)
+	}
+	if rec := serveAs(self, "DELETE", path, route, DeleteTOTP(sm), `{"recovery_code":"wrong-code"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("delete with a wrong recovery code: got %d", rec.Code)
+	}
+	if got, _ := sm.GetAccountByID(a.ID); got.FailedLogins != 1 {
+		t.Errorf("wrong code not counted as a failed login: %d", got.FailedLogins)
+	}
+	if m, err := sm.GetAccountMFA(a.ID, try6.MFATotp); err != nil || !m.Active() {
+		t.Fatalf("active authenticator changed without code: %v %v", m, err)
+	}
+	body := `{"recovery_code":"` + confirmed.RecoveryCodes[0] + `"}`
+	if rec := serveAs(self, "DELETE", path, route, DeleteTOTP(sm), body); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete with a recovery code: got %d %s", rec.Code, rec.Body)
+	}
+	if _, err := sm.GetAccountMFA(a.ID, try6.MFATotp); err == nil {
+		t.Error("authenticator not deleted")
+	}
+	if len(sm.recoveryIPs) != 1 || sm.recoveryIPs[0] != "192.0.2.1" {
+		t.Errorf("recovery code use not recorded: %v", sm.recoveryIPs)
+	}
+}
+
+func TestMFAEnrollmentToken(t *testing.T) {
+	defer func(k []byte) { try6.SecretKey = k }(try6.SecretKey)
+	try6.SecretKey = make([]byte, 32)
+	sm := newMemStore()
+	a, dir := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	a.Status = try6.StatusActive
+	sm.SaveAccountLockout(a, try6.StatusUnverified)
+	dir.RequireMFA = true
+	sm.SaveDirectory(dir)
+	other, _ := newTestAccount(t, sm, "other", "other@example.com", "password1")
+	const path, route = "/accounts/account/mfa/totp", "/accounts/:id/mfa/totp"
+	credentials := `{"email":"user@example.com","password":"password1"}`
+
+	rec := serve("POST", "/authenticate", "/authenticate", Authenticate(sm), credentials)
+	var e mfaEnrollmentResponse
+	if rec.Code != http.StatusForbidden || json.Unmarshal(rec.Body.Bytes(), &e) != nil || e.Token == "" || e.AccountID != a.ID {
+		t.Fatalf("login without the required factor: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(e.Token, "POST", "/accounts/other/mfa/totp", route, EnrollTOTP(sm), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("enroll another account: got %d", rec.Code)
+	}
+	if _, err := sm.GetAccountMFA(other.ID, try6.MFATotp); err == nil {
+		t.Error("authenticator enrolled for another account")
+	}
+
+	rec = serveAs(e.Token, "POST", path, route, EnrollTOTP(sm), "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("enroll: got %d %s", rec.Code, rec.Body)
+	}
+	var enrolled totpEnrollment
+	json.Unmarshal(rec.Body.Bytes(), &enrolled)
+	code, _ := totp.Code(enrolled.Secret, totp.Step(time.Now().UTC()))
+	if rec := serveAs(e.Token, "POST", path+"/confirm", route+"/confirm", ConfirmTOTP(sm), `{"code":"`+code+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("confirm: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(e.Token, "POST", path, route, EnrollTOTP(sm), ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("enrollment token used again: got %d", rec.Code)
+	}
+
+	rec = serve("POST", "/authenticate", "/authenticate", Authenticate(sm), credentials)
+	var challenge mfaChallengeResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &challenge) != nil || challenge.Status != "mfa_required" {
+		t.Errorf("login after enrollment: got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,453 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Error codes of the OAuth 2.0 endpoints
+const (
+	errInvalidRequest       = "invalid_request"
+	errInvalidClient        = "invalid_client"
+	errInvalidGrant         = "invalid_grant"
+	errUnauthorizedClient   = "unauthorized_client"
+	errUnsupportedGrantType = "unsupported_grant_type"
+	errInvalidScope         = "invalid_scope"
+	errInvalidTarget        = "invalid_target"
+	errServerError          = "server_error"
+)
+
+// oauthError is the error response of the OAuth 2.0 endpoints as defined in RFC
+// 6749 section 5.2
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// tokenResponse is the successful response of the token endpoint
+type tokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	IDToken         string `json:"id_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// Token handler is the OAuth 2.0 token endpoint. The client authenticates with
+// HTTP Basic or with the client_id and client_secret form parameters and the token
+// issued depends on the grant_type requested.
+//
+// With the client_credentials grant the client gets an access token for itself. The
+// audience parameter, that can be repeated, restricts the audiences of the token to
+// some of the ones allowed to the client.
+//
+// With the authorization_code grant the client exchanges the code issued by
+// AuthorizeLogin, along with the PKCE code verifier and the redirect_uri of the
+// authorization request, for an access token for the account. Public clients
+// authenticate only with their client_id.
+//
+// With the refresh_token grant the client exchanges a refresh token for a new
+// access token and a new refresh token. Every refresh token can be used once.
+//
+// With the device_code grant a device without a browser polls for the tokens of the
+// account that approves its device code in the verification page.
+//
+// With the token exchange grant a client that holds an access token of an account
+// gets a token for another audience on its behalf, as allowed by the exchange rules
+// of the scope the token was issued in.
+//
+// Account grants with the openid scope get an OpenID Connect ID token along with
+// the access token.
+func Token(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		ctx.Response().Header().Set("Cache-Control", "no-store")
+		ctx.Response().Header().Set("Pragma", "no-cache")
+		r := ctx.Request()
+		if err := r.ParseForm(); err != nil {
+			return oauthFail(ctx, http.StatusBadRequest, errInvalidRequest, err.Error())
+		}
+		client, err := authenticateClient(sm, r)
+		if err != nil {
+			if err == tryerr.ErrInvalidClient {
+				ctx.Response().Header().Set("WWW-Authenticate", `Basic realm="try6"`)
+				return oauthFail(ctx, http.StatusUnauthorized, errInvalidClient, err.Error())
+			}
+			return oauthServerError(ctx, "Token", err)
+		}
+		grant := r.PostFormValue("grant_type")
+		if !try6.StringList(try6.SupportedGrants).Contains(grant) {
+			return oauthFail(ctx, http.StatusBadRequest, errUnsupportedGrantType, tryerr.ErrUnsupportedGrant.Error())
+		}
+		if !client.AllowsGrant(grant) {
+			return oauthFail(ctx, http.StatusBadRequest, errUnauthorizedClient, tryerr.ErrUnsupportedGrant.Error())
+		}
+		switch grant {
+		case try6.GrantClientCredentials:
+			return clientCredentials(sm, ctx, client)
+		case try6.GrantAuthorizationCode:
+			return authorizationCode(sm, ctx, client)
+		case try6.GrantRefreshToken:
+			return refreshToken(sm, ctx, client)
+		case try6.GrantDeviceCode:
+			return deviceCode(sm, ctx, client)
+		case try6.GrantTokenExchange:
+			return tokenExchange(sm, ctx, client)
+		}
+		return oauthFail(ctx, http.StatusBadRequest, errUnsupportedGrantType, tryerr.ErrUnsupportedGrant.Error())
+	}
+}
+
+// JWKS handler returns the public keys of the tenant in JSON Web Key Set format, so
+// the resource servers can verify the tokens issued for its scopes
+func JWKS(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		tenantID := ctx.Param("id")
+		if !try6.ValidUUID(tenantID) {
+			return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "JWKS", Info: tryerr.ErrTenantNotFound.Error(), Table: "keys"})
+		}
+		keys, err := sm.GetKeysByTenantID(tenantID)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "JWKS", Info: err.Error(), Table: "keys"})
+		}
+		return ctx.JSON(http.StatusOK, keySet(keys))
+	}
+}
+
+// AllJWKS handler returns the public keys of all the tenants in JSON Web Key Set
+// format. It is the jwks_uri of the discovery document, as all the tenants issue
+// their tokens with the same issuer.
+func AllJWKS(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		keys, err := sm.GetActiveKeys()
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "AllJWKS", Info: err.Error(), Table: "keys"})
+		}
+		return ctx.JSON(http.StatusOK, keySet(keys))
+	}
+}
+
+// keySet returns the keys as a JSON Web Key Set. Keys that can not be encoded are
+// logged and left out.
+func keySet(keys []*try6.Key) map[string]interface{} {
+	set := []map[string]interface{}{}
+	for _, k := range keys {
+		jwk, err := k.JWK()
+		if err != nil {
+			log.LogE("invalid public key", "pkg", "api", "func", "keySet([]*try6.Key)", "kid", k.ID, "error", err.Error())
+			continue
+		}
+		set = append(set, jwk)
+	}
+	return map[string]interface{}{"keys": set}
+}
+
+// clientCredentials issues an access token to the client for itself
+func clientCredentials(sm store.Storer, ctx *echo.Context, client *try6.Client) error {
+	audiences, err := client.TokenAudiences(ctx.Request().PostForm["audience"])
+	if err != nil {
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidTarget, err.Error())
+	}
+	_, key, err := clientScope(sm, client)
+	if err != nil {
+		if err == tryerr.ErrDisabled || err == tryerr.ErrDeleted {
+			return oauthFail(ctx, http.StatusBadRequest, errUnauthorizedClient, err.Error())
+		}
+		return oauthServerError(ctx, "clientCredentials", err)
+	}
+	token, rec, err := try6.NewAccessToken(key, client, client.ID, audiences, nil)
+	if err != nil {
+		return oauthServerError(ctx, "clientCredentials", err)
+	}
+	if err := sm.SaveJWT(rec); err != nil {
+		return oauthServerError(ctx, "clientCredentials", err)
+	}
+	log.LogI("access token issued", "pkg", "api", "func", "clientCredentials(store.Storer, *echo.Context, *try6.Client)", "client", client.ID, "jti", rec.ID)
+	return ctx.JSON(http.StatusOK, &tokenResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int64(try6.AccessTokenTTL.Seconds())})
+}
+
+// accountGrant holds what an account granted to a client: the scopes and how and
+// when the account authenticated. refresh is the refresh token issued along with
+// the access token, if any, and refreshSecret its secret.
+type accountGrant struct {
+	account       *try6.Account
+	scope         string
+	amr           []string
+	authTime      time.Time
+	nonce         string
+	refresh       *try6.RefreshToken
+	refreshSecret string
+}
+
+// authorizationCode issues an access token to the client for the account of the
+// authorization code. The token holds the scopes requested and the custom data
+// claims of the account mapped by the scope of the client. Clients allowed to use
+// the refresh_token grant get a refresh token of a new family too.
+func authorizationCode(sm store.Storer, ctx *echo.Context, client *try6.Client) error {
+	r := ctx.Request()
+	code, err := sm.UseAuthCode(try6.HashToken(r.PostFormValue("code")))
+	if err == nil {
+		err = code.Exchange(client.ID, r.PostFormValue("redirect_uri"), r.PostFormValue("code_verifier"))
+	}
+	var account *try6.Account
+	if err == nil {
+		account, err = grantAccount(sm, code.AccountID)
+	}
+	if err != nil {
+		return grantError(ctx, "authorizationCode", err)
+	}
+	scope, key, err := clientScope(sm, client)
+	if err != nil {
+		return grantError(ctx, "authorizationCode", err)
+	}
+	g := &accountGrant{account: account, scope: code.Scope, amr: code.AMR, authTime: code.AuthTime, nonce: code.Nonce}
+	if err := startRefreshFamily(sm, client, g); err != nil {
+		return oauthServerError(ctx, "authorizationCode", err)
+	}
+	return issueAccountTokens(sm, ctx, client, scope, key, g)
+}
+
+// startRefreshFamily issues to the client the first refresh token of a new family
+// for the grant, if the client is allowed to use the refresh_token grant
+func startRefreshFamily(sm store.Storer, client *try6.Client, g *accountGrant) error {
+	if !client.AllowsGrant(try6.GrantRefreshToken) {
+		return nil
+	}
+	var err error
+	g.refresh, g.refreshSecret, err = try6.NewRefreshToken(client.ID, g.account.ID, g.scope, g.amr, g.authTime)
+	if err != nil {
+		return err
+	}
+	return sm.SaveRefreshToken(g.refresh)
+}
+
+// refreshToken rotates the refresh token of the client and issues a new access
+// token for its account. The scope parameter can narrow the scopes of the access
+// token. If the refresh token was already rotated it is being reused, so its whole
+// family is revoked.
+func refreshToken(sm store.Storer, ctx *echo.Context, client *try6.Client) error {
+	r := ctx.Request()
+	old, err := sm.GetRefreshToken(try6.HashToken(r.PostFormValue("refresh_token")))
+	if err == nil {
+		err = old.Valid(client.ID)
+	}
+	if err == tryerr.ErrTokenReused {
+		return refreshReused(sm, ctx, old)
+	}
+	var account *try6.Account
+	if err == nil {
+		account, err = grantAccount(sm, old.AccountID)
+	}
+	if err != nil {
+		return grantError(ctx, "refreshToken", err)
+	}
+	granted, err := try6.NarrowScope(old.Scope, r.PostFormValue("scope"))
+	if err != nil {
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidScope, err.Error())
+	}
+	scope, key, err := clientScope(sm, client)
+	if err != nil {
+		return grantError(ctx, "refreshToken", err)
+	}
+	g := &accountGrant{account: account, scope: granted, amr: old.AMR, authTime: old.AuthTime}
+	g.refresh, g.refreshSecret, err = old.Rotate()
+	if err == nil {
+		err = sm.RotateRefreshToken(old, g.refresh)
+	}
+	if err != nil {
+		if err == tryerr.ErrTokenReused {
+			return refreshReused(sm, ctx, old)
+		}
+		return oauthServerError(ctx, "refreshToken", err)
+	}
+	return issueAccountTokens(sm, ctx, client, scope, key, g)
+}
+
+// refreshReused revokes the family of a refresh token used after it was rotated
+func refreshReused(sm store.Storer, ctx *echo.Context, t *try6.RefreshToken) error {
+	log.LogW("refresh token reused, revoking family", "pkg", "api", "func", "refreshReused(store.Storer, *echo.Context, *try6.RefreshToken)", "family", t.FamilyID, "client", t.ClientID, "account", t.AccountID, "ip", clientIP(ctx.Request()))
+	if err := sm.RevokeRefreshFamily(t.FamilyID); err != nil {
+		return oauthServerError(ctx, "refreshReused", err)
+	}
+	return oauthFail(ctx, http.StatusBadRequest, errInvalidGrant, tryerr.ErrTokenReused.Error())
+}
+
+// grantAccount returns the account a grant was issued for, if it can still be
+// issued tokens
+func grantAccount(sm store.Storer, accountID string) (*try6.Account, error) {
+	account, err := sm.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := usableAccount(sm, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// grantError writes the response for an error of a grant
+func grantError(ctx *echo.Context, action string, err error) error {
+	switch err {
+	case tryerr.ErrInvalidGrant, tryerr.ErrInvalidCodeVerifier, tryerr.ErrAccountNotFound, tryerr.ErrDisabled, tryerr.ErrDeleted:
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidGrant, err.Error())
+	}
+	return oauthServerError(ctx, action, err)
+}
+
+// issueAccountTokens issues an access token to the client for the account of the
+// grant, signed with the key, and writes the token response with the refresh token
+// of the grant if any. Grants with the openid scope get an ID token too.
+func issueAccountTokens(sm store.Storer, ctx *echo.Context, client *try6.Client, scope *try6.Scope, key *try6.Key, g *accountGrant) error {
+	claims, err := accountClaims(sm, g.account, scope, g.scope)
+	if err != nil {
+		return oauthServerError(ctx, "issueAccountTokens", err)
+	}
+	token, rec, err := try6.NewAccessToken(key, client, g.account.ID, client.Audiences, claims)
+	if err != nil {
+		return oauthServerError(ctx, "issueAccountTokens", err)
+	}
+	if g.refresh != nil {
+		rec.FamilyID = dat.NullStringFrom(g.refresh.FamilyID)
+	}
+	if err := sm.SaveJWT(rec); err != nil {
+		return oauthServerError(ctx, "issueAccountTokens", err)
+	}
+	var idToken string
+	if try6.HasScope(g.scope, try6.ScopeOpenID) {
+		info, err := userInfo(sm, g.account, scope, g.scope)
+		if err == nil {
+			idToken, err = try6.NewIDToken(key, client, g.account.ID, g.nonce, g.authTime, g.amr, info)
+		}
+		if err != nil {
+			return oauthServerError(ctx, "issueAccountTokens", err)
+		}
+	}
+	log.LogI("access token issued", "pkg", "api", "func", "issueAccountTokens(store.Storer, *echo.Context, *try6.Client, *try6.Scope, *try6.Key, *accountGrant)", "client", client.ID, "account", g.account.ID, "jti", rec.ID)
+	return ctx.JSON(http.StatusOK, &tokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(try6.AccessTokenTTL.Seconds()),
+		RefreshToken: g.refreshSecret,
+		IDToken:      idToken,
+		Scope:        g.scope,
+	})
+}
+
+// accountClaims returns the claims of an access token for the account: the scopes
+// granted and the custom data of the account mapped to claims by the scope
+func accountClaims(sm store.Storer, account *try6.Account, scope *try6.Scope, granted string) (map[string]interface{}, error) {
+	data, err := sm.GetAccountCustomData(account.ID)
+	if err != nil {
+		return nil, err
+	}
+	claims := data.Claims(scope.Claims)
+	if granted != "" {
+		claims["scope"] = granted
+	}
+	return claims, nil
+}
+
+// authenticateClient returns the client of the request after checking its secret.
+// The credentials are read from the Authorization header or, if it is not set, from
+// the form parameters. It returns tryerr.ErrInvalidClient if the client can not be
+// authenticated.
+func authenticateClient(sm store.Storer, r *http.Request) (*try6.Client, error) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		// credentials are form encoded before they are set in the header (RFC 6749 section 2.3.1)
+		var err1, err2 error
+		id, err1 = url.QueryUnescape(id)
+		secret, err2 = url.QueryUnescape(secret)
+		if err1 != nil || err2 != nil {
+			return nil, tryerr.ErrInvalidClient
+		}
+	} else {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if !try6.ValidUUID(id) {
+		return nil, tryerr.ErrInvalidClient
+	}
+	client, err := sm.GetClientByID(id)
+	if err != nil {
+		if err == tryerr.ErrClientNotFound {
+			return nil, tryerr.ErrInvalidClient
+		}
+		return nil, err
+	}
+	if err := client.MatchSecret(secret); err != nil {
+		return nil, err
+	}
+	if try6.Usable(client.Status) != nil {
+		return nil, tryerr.ErrInvalidClient
+	}
+	return client, nil
+}
+
+// clientScope returns the scope of the client and the key that signs its tokens,
+// the one of the tenant of the scope. The scope and the tenant must be usable,
+// otherwise tryerr.ErrDisabled or tryerr.ErrDeleted is returned.
+func clientScope(sm store.Storer, client *try6.Client) (*try6.Scope, *try6.Key, error) {
+	s, err := usableScope(sm, client.ScopeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := sm.GetSigningKey(s.TenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, key, nil
+}
+
+// usableScope returns the scope with the given id if it and its tenant are usable,
+// or tryerr.ErrDisabled or tryerr.ErrDeleted otherwise
+func usableScope(sm store.Storer, id string) (*try6.Scope, error) {
+	s, err := sm.GetScopeByID(id)
+	if err != nil {
+		if err == tryerr.ErrScopeNotFound {
+			return nil, tryerr.ErrDeleted
+		}
+		return nil, err
+	}
+	if err := try6.Usable(s.Status); err != nil {
+		return nil, err
+	}
+	status, err := sm.GetStatus(try6.EntityTenant, s.TenantID)
+	if err != nil {
+		if err == tryerr.ErrTenantNotFound {
+			return nil, tryerr.ErrDeleted
+		}
+		return nil, err
+	}
+	if err := try6.Usable(status); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// endpointURL returns the public URL of the endpoint with the path given
+func endpointURL(path string) string {
+	return strings.TrimRight(try6.Issuer, "/") + path
+}
+
+// oauthFail writes an OAuth 2.0 error response
+func oauthFail(ctx *echo.Context, status int, code, description string) error {
+	return ctx.JSON(status, &oauthError{Error: code, Description: description})
+}
+
+// oauthServerError logs an unexpected error and writes the OAuth 2.0 error response
+// without its details
+func oauthServerError(ctx *echo.Context, action string, err error) error {
+	log.LogE("oauth error", "pkg", "api", "func", action, "error", err.Error())
+	return oauthFail(ctx, http.StatusInternalServerError, errServerError, "")
+}
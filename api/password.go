@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/mailer"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+	"github.com/labstack/echo"
+)
+
+// resetRequest holds the email of the account whose password must be reset
+type resetRequest struct {
+	Email string `json:"email"`
+}
+
+// resetConfirm holds the reset token sent to the account owner and the new password
+type resetConfirm struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// RequestPasswordReset handler issues a password reset token for the account with
+// the email provided. The response is the same whether the email exists or not so
+// it can not be used to find out which accounts are registered. The token is sent
+// to the account email in the language requested in the Accept-Language header.
+func RequestPasswordReset(sm store.Storer, m *mailer.Mailer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var r resetRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil || r.Email == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "RequestPasswordReset", Info: "email not provided"})
+		}
+		accepted := &logMessage{Status: "ok", Action: "RequestPasswordReset", Info: "if the email is registered a reset token has been sent"}
+		account, err := sm.GetAccountByEmail(r.Email)
+		if err != nil {
+			if err != tryerr.ErrEmailNotFound {
+				log.LogE("error loading account", "pkg", "api", "func", "RequestPasswordReset(store.Storer, *mailer.Mailer)", "error", err.Error())
+			}
+			return ctx.JSON(http.StatusAccepted, accepted)
+		}
+		if err := sm.RevokeAccountTokens(account.ID, try6.TokenPasswordReset); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "RequestPasswordReset", Info: err.Error(), Table: "account_tokens"})
+		}
+		t, secret, err := try6.NewAccountToken(account.ID, try6.TokenPasswordReset, try6.PasswordResetTTL)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "RequestPasswordReset", Info: err.Error(), Table: "account_tokens"})
+		}
+		if err := sm.SaveAccountToken(t); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "RequestPasswordReset", Info: err.Error(), Table: "account_tokens"})
+		}
+		if err := sendAccountMail(sm, m, account, ctx.Request().Header.Get("Accept-Language"), mailer.TemplatePasswordReset, map[string]interface{}{
+			"Name":  account.Name,
+			"URL":   m.Link(PasswordResetPath, secret),
+			"Token": secret,
+			"Hours": int(try6.PasswordResetTTL.Hours()),
+		}); err != nil {
+			log.LogE("error sending password reset token", "pkg", "api", "func", "RequestPasswordReset(store.Storer, *mailer.Mailer)", "account", account.ID, "error", err.Error())
+		}
+		return ctx.JSON(http.StatusAccepted, accepted)
+	}
+}
+
+// ConfirmPasswordReset handler sets the new password of the account that owns the
+// reset token. The token can only be used once, and is only used up when the new
+// password is saved. The token and password are sent as JSON or with the form of
+// the page the reset link opens.
+func ConfirmPasswordReset(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var r resetConfirm
+		if isFormPost(ctx.Request()) {
+			r.Token, r.Password = ctx.Request().PostFormValue("token"), ctx.Request().PostFormValue("password")
+		} else if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil {
+			r.Token = ""
+		}
+		reply := accountReply(ctx, passwordResetPage(r.Token))
+		if r.Token == "" {
+			return reply(http.StatusBadRequest, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: "token not provided"})
+		}
+		t, err := sm.GetAccountToken(try6.TokenPasswordReset, try6.HashToken(r.Token))
+		if err == nil {
+			err = t.Valid()
+		}
+		if err != nil {
+			if err == tryerr.ErrTokenNotFound || err == tryerr.ErrTokenExpired || err == tryerr.ErrInvalidToken {
+				return reply(http.StatusBadRequest, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: tryerr.ErrInvalidToken.Error()})
+			}
+			return reply(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: err.Error(), Table: "account_tokens"})
+		}
+		account, err := sm.GetAccountByID(t.AccountID)
+		if err != nil {
+			if err == tryerr.ErrAccountNotFound {
+				return reply(http.StatusBadRequest, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: tryerr.ErrInvalidToken.Error()})
+			}
+			return reply(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: err.Error(), Table: "accounts"})
+		}
+		policy, err := sm.GetPasswordPolicyByAccountID(account.ID)
+		if err != nil {
+			return reply(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: err.Error(), Table: "password_creation_policies"})
+		}
+		history, err := sm.GetPasswordHistory(account.ID, policy.HistoryCount)
+		if err != nil {
+			return reply(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: err.Error(), Table: "password_history"})
+		}
+		if err := account.UpdatePassword(r.Password, history...); err != nil {
+			return reply(http.StatusBadRequest, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: err.Error(), Table: "accounts"})
+		}
+		if err := sm.ResetAccountPassword(t, account, policy.HistoryCount); err != nil {
+			if err == tryerr.ErrInvalidToken {
+				return reply(http.StatusBadRequest, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: err.Error()})
+			}
+			return reply(http.StatusInternalServerError, &logMessage{Status: "error", Action: "ConfirmPasswordReset", Info: err.Error(), Table: "accounts"})
+		}
+		return reply(http.StatusOK, &logMessage{Status: "ok", Action: "ConfirmPasswordReset", Table: "accounts", UID: account.ID})
+	}
+}
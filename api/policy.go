@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jllopis/try6/store"
+	"github.com/labstack/echo"
+)
+
+// GetPasswordPolicy returns the password policy of the directory
+func GetPasswordPolicy(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var directoryID string
+		if directoryID = ctx.Param("id"); directoryID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "GetPasswordPolicy", Info: "directory id cannot be nil"})
+		}
+		p, err := sm.GetPasswordPolicy(directoryID)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "GetPasswordPolicy", Info: err.Error(), Table: "password_creation_policies"})
+		}
+		return ctx.JSON(http.StatusOK, p)
+	}
+}
+
+// UpdatePasswordPolicy handler replaces the password policy of the directory with
+// the one provided in the body
+func UpdatePasswordPolicy(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var directoryID string
+		if directoryID = ctx.Param("id"); directoryID == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdatePasswordPolicy", Info: "directory id cannot be nil"})
+		}
+		p, err := sm.GetPasswordPolicy(directoryID)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdatePasswordPolicy", Info: err.Error(), Table: "password_creation_policies"})
+		}
+		id := p.ID
+		if err := json.NewDecoder(ctx.Request().Body).Decode(p); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdatePasswordPolicy", Info: err.Error(), Table: "password_creation_policies"})
+		}
+		p.ID = id
+		p.DirectoryID = directoryID
+		if p.HistoryCount < 0 || p.MaxAgeDays < 0 {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "UpdatePasswordPolicy", Info: "history_count and max_age_days must not be negative", Table: "password_creation_policies"})
+		}
+		if err := sm.SavePasswordPolicy(p); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "UpdatePasswordPolicy", Info: err.Error(), Table: "password_creation_policies"})
+		}
+		return ctx.JSON(http.StatusOK, p)
+	}
+}
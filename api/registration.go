@@ -0,0 +1,387 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Error codes of the dynamic client registration (RFC 7591 section 3.2.2)
+const (
+	errInvalidClientMetadata = "invalid_client_metadata"
+	errInvalidRedirectURI    = "invalid_redirect_uri"
+)
+
+// Token endpoint authentication methods of the registered clients. Confidential
+// clients can send their secret either way, so they are always reported as
+// client_secret_basic once registered.
+const (
+	authMethodNone        = "none"
+	authMethodSecretBasic = "client_secret_basic"
+	authMethodSecretPost  = "client_secret_post"
+)
+
+// initialAccessTokenRequest holds the scope the clients registered with a new
+// initial access token belong to, the grants they can use besides the ones of any
+// registered client and the seconds the token is valid for
+type initialAccessTokenRequest struct {
+	ScopeID    string   `json:"scope_id"`
+	GrantTypes []string `json:"grant_types"`
+	ExpiresIn  int64    `json:"expires_in"`
+}
+
+// initialAccessTokenResponse is an initial access token along with its secret,
+// returned only when it is created
+type initialAccessTokenResponse struct {
+	*try6.InitialAccessToken
+	Token string `json:"token"`
+}
+
+// clientMetadata holds the metadata of a client in the dynamic client registration
+type clientMetadata struct {
+	ClientID                string   `json:"client_id,omitempty"`
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+}
+
+// registrationResponse is the client information response of RFC 7591 and 7592.
+// The client secret and the registration access token are only returned when they
+// are created.
+type registrationResponse struct {
+	clientMetadata
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+// CreateInitialAccessToken handler creates an initial access token of the tenant
+// that registers clients in the scope given in the body. The clients registered with
+// it can use the authorization_code and refresh_token grants and the grant_types of
+// the body. The token is returned only in this response. The request must be made
+// by an administrator of the tenant.
+func CreateInitialAccessToken(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		tenantID := ctx.Param("id")
+		admin, err := authorizeTenant(sm, ctx.Request(), tenantID)
+		if err != nil {
+			return accessError(ctx, "CreateInitialAccessToken", err)
+		}
+		if _, err := sm.GetStatus(try6.EntityTenant, tenantID); err != nil {
+			return registrationError(ctx, "CreateInitialAccessToken", err)
+		}
+		var r initialAccessTokenRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "CreateInitialAccessToken", Info: err.Error(), Table: "initial_access_tokens"})
+		}
+		if !try6.ValidUUID(r.ScopeID) {
+			return registrationError(ctx, "CreateInitialAccessToken", tryerr.ErrScopeNotFound)
+		}
+		s, err := sm.GetScopeByID(r.ScopeID)
+		if err == nil && s.TenantID != tenantID {
+			err = tryerr.ErrScopeNotFound
+		}
+		if err != nil {
+			return registrationError(ctx, "CreateInitialAccessToken", err)
+		}
+		t, secret, err := try6.NewInitialAccessToken(tenantID, s.ID, r.GrantTypes, time.Duration(r.ExpiresIn)*time.Second)
+		if err == nil {
+			err = sm.SaveInitialAccessToken(t)
+		}
+		if err != nil {
+			return registrationError(ctx, "CreateInitialAccessToken", err)
+		}
+		log.LogI("initial access token created", "pkg", "api", "func", "CreateInitialAccessToken(store.Storer)", "id", t.ID, "tenant", tenantID, "scope", s.ID, "actor", accountActor(admin.ID))
+		return ctx.JSON(http.StatusCreated, &initialAccessTokenResponse{InitialAccessToken: t, Token: secret})
+	}
+}
+
+// GetInitialAccessTokens handler returns the initial access tokens of the tenant
+// that can still be used. The request must be made by an administrator of the
+// tenant.
+func GetInitialAccessTokens(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		if _, err := authorizeTenant(sm, ctx.Request(), ctx.Param("id")); err != nil {
+			return accessError(ctx, "GetInitialAccessTokens", err)
+		}
+		ts, err := sm.GetInitialAccessTokensByTenantID(ctx.Param("id"))
+		if err != nil {
+			return registrationError(ctx, "GetInitialAccessTokens", err)
+		}
+		if ts == nil {
+			ts = []*try6.InitialAccessToken{}
+		}
+		return ctx.JSON(http.StatusOK, ts)
+	}
+}
+
+// RevokeInitialAccessToken handler revokes an initial access token of the tenant.
+// The clients already registered with it are kept. The request must be made by an
+// administrator of the tenant.
+func RevokeInitialAccessToken(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		admin, err := authorizeTenant(sm, ctx.Request(), ctx.Param("id"))
+		if err != nil {
+			return accessError(ctx, "RevokeInitialAccessToken", err)
+		}
+		id := ctx.Param("token")
+		if !try6.ValidUUID(id) {
+			return registrationError(ctx, "RevokeInitialAccessToken", tryerr.ErrTokenNotFound)
+		}
+		if err := sm.RevokeInitialAccessToken(ctx.Param("id"), id); err != nil {
+			return registrationError(ctx, "RevokeInitialAccessToken", err)
+		}
+		log.LogI("initial access token revoked", "pkg", "api", "func", "RevokeInitialAccessToken(store.Storer)", "id", id, "tenant", ctx.Param("id"), "actor", accountActor(admin.ID))
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+// Register handler is the client registration endpoint of RFC 7591. The request
+// carries an initial access token of a tenant as a bearer token and the client is
+// registered in the scope of the token. Only the grants allowed by the token can be
+// requested. The response has the client secret, for confidential clients, and the
+// registration access token to manage the client.
+func Register(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		ctx.Response().Header().Set("Cache-Control", "no-store")
+		t, err := sm.GetInitialAccessToken(try6.HashToken(bearerToken(ctx.Request())))
+		if err == nil {
+			err = t.Valid()
+		}
+		if err != nil {
+			if err == tryerr.ErrInvalidToken {
+				return bearerFail(ctx, http.StatusUnauthorized, errInvalidToken, err.Error())
+			}
+			return oauthServerError(ctx, "Register", err)
+		}
+		if _, err := usableScope(sm, t.ScopeID); err != nil {
+			if err == tryerr.ErrDisabled || err == tryerr.ErrDeleted {
+				return bearerFail(ctx, http.StatusUnauthorized, errInvalidToken, err.Error())
+			}
+			return oauthServerError(ctx, "Register", err)
+		}
+		var m clientMetadata
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&m); err != nil {
+			return oauthFail(ctx, http.StatusBadRequest, errInvalidClientMetadata, err.Error())
+		}
+		if err := m.normalize(t.AllowedGrants()); err != nil {
+			return metadataFail(ctx, err)
+		}
+		var c *try6.Client
+		var secret string
+		if m.TokenEndpointAuthMethod == authMethodNone {
+			c, err = try6.NewPublicClient(t.ScopeID, m.ClientName, m.GrantTypes, m.RedirectURIs, nil)
+		} else {
+			c, secret, err = try6.NewClient(t.ScopeID, m.ClientName, m.GrantTypes, m.RedirectURIs, nil)
+		}
+		if err != nil {
+			return metadataFail(ctx, err)
+		}
+		registration, err := c.NewRegistrationToken()
+		if err == nil {
+			err = sm.SaveClient(c)
+		}
+		if err != nil {
+			return oauthServerError(ctx, "Register", err)
+		}
+		log.LogI("client registered", "pkg", "api", "func", "Register(store.Storer)", "id", c.ID, "scope", c.ScopeID, "initial_access_token", t.ID)
+		res := clientInformation(c)
+		res.TokenEndpointAuthMethod = m.TokenEndpointAuthMethod
+		res.ClientSecret = secret
+		res.RegistrationAccessToken = registration
+		return ctx.JSON(http.StatusCreated, res)
+	}
+}
+
+// GetRegistration handler returns the metadata of the client authenticated with
+// its registration access token (RFC 7592 section 2.1)
+func GetRegistration(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		ctx.Response().Header().Set("Cache-Control", "no-store")
+		c, err := registeredClient(sm, ctx)
+		if err != nil {
+			return registrationAuthFail(ctx, "GetRegistration", err)
+		}
+		return ctx.JSON(http.StatusOK, clientInformation(c))
+	}
+}
+
+// UpdateRegistration handler replaces the metadata of the client authenticated
+// with its registration access token with the one in the body (RFC 7592 section
+// 2.2). A client can not change from public to confidential nor the other way, and
+// can only add grants that any registered client can use.
+func UpdateRegistration(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		ctx.Response().Header().Set("Cache-Control", "no-store")
+		c, err := registeredClient(sm, ctx)
+		if err != nil {
+			return registrationAuthFail(ctx, "UpdateRegistration", err)
+		}
+		var m clientMetadata
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&m); err != nil {
+			return oauthFail(ctx, http.StatusBadRequest, errInvalidClientMetadata, err.Error())
+		}
+		if m.ClientID != c.ID {
+			return oauthFail(ctx, http.StatusBadRequest, errInvalidClientMetadata, "client_id does not match")
+		}
+		if err := m.normalize(try6.RegisteredGrants(c.Grants)); err != nil {
+			return metadataFail(ctx, err)
+		}
+		if (m.TokenEndpointAuthMethod == authMethodNone) != c.Public {
+			return oauthFail(ctx, http.StatusBadRequest, errInvalidClientMetadata, "token_endpoint_auth_method can not be changed")
+		}
+		c.Name, c.Grants, c.RedirectURIs = m.ClientName, m.GrantTypes, m.RedirectURIs
+		if err := c.Validate(); err != nil {
+			return metadataFail(ctx, err)
+		}
+		if err := sm.SaveClient(c); err != nil {
+			return oauthServerError(ctx, "UpdateRegistration", err)
+		}
+		return ctx.JSON(http.StatusOK, clientInformation(c))
+	}
+}
+
+// DeleteRegistration handler deletes the client authenticated with its
+// registration access token and revokes its tokens (RFC 7592 section 2.3)
+func DeleteRegistration(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		c, err := registeredClient(sm, ctx)
+		if err != nil {
+			return registrationAuthFail(ctx, "DeleteRegistration", err)
+		}
+		change, err := try6.NewStatusChange(try6.EntityClient, c.ID, c.Status, try6.StatusDeleted, "client:"+c.ID, "client deregistered")
+		if err == nil {
+			err = sm.ChangeStatus(change)
+		}
+		if err == nil {
+			_, _, err = sm.RevokeTokens(try6.EntityClient, c.ID)
+		}
+		if err != nil {
+			return oauthServerError(ctx, "DeleteRegistration", err)
+		}
+		log.LogI("client deregistered", "pkg", "api", "func", "DeleteRegistration(store.Storer)", "id", c.ID, "scope", c.ScopeID)
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+// normalize sets the defaults of the metadata and checks the values that are not
+// checked by the client validation: the grant types, that must be in allowed, the
+// token endpoint authentication method and the response types, that must match the
+// grant types
+func (m *clientMetadata) normalize(allowed []string) error {
+	if len(m.GrantTypes) == 0 {
+		m.GrantTypes = []string{try6.GrantAuthorizationCode}
+	}
+	for _, g := range m.GrantTypes {
+		if !try6.StringList(allowed).Contains(g) {
+			return tryerr.ErrUnsupportedGrant
+		}
+	}
+	switch m.TokenEndpointAuthMethod {
+	case "":
+		m.TokenEndpointAuthMethod = authMethodSecretBasic
+	case authMethodNone, authMethodSecretBasic, authMethodSecretPost:
+	default:
+		return tryerr.ErrInvalidClient
+	}
+	code := try6.StringList(m.GrantTypes).Contains(try6.GrantAuthorizationCode)
+	if len(m.ResponseTypes) == 0 && code {
+		m.ResponseTypes = []string{"code"}
+	}
+	for _, rt := range m.ResponseTypes {
+		if rt != "code" || !code {
+			return tryerr.ErrUnsupportedGrant
+		}
+	}
+	if code && len(m.RedirectURIs) == 0 {
+		return tryerr.ErrInvalidRedirectURI
+	}
+	return nil
+}
+
+// registeredClient returns the client of the request authenticated with its
+// registration access token, or tryerr.ErrInvalidToken
+func registeredClient(sm store.Storer, ctx *echo.Context) (*try6.Client, error) {
+	id := ctx.Param("id")
+	if !try6.ValidUUID(id) {
+		return nil, tryerr.ErrInvalidToken
+	}
+	c, err := sm.GetClientByID(id)
+	if err != nil {
+		if err == tryerr.ErrClientNotFound {
+			return nil, tryerr.ErrInvalidToken
+		}
+		return nil, err
+	}
+	if err := c.MatchRegistrationToken(bearerToken(ctx.Request())); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// clientInformation returns the registration response of the client, without its
+// secrets
+func clientInformation(c *try6.Client) *registrationResponse {
+	method := authMethodSecretBasic
+	if c.Public {
+		method = authMethodNone
+	}
+	var responseTypes []string
+	if c.AllowsGrant(try6.GrantAuthorizationCode) {
+		responseTypes = []string{"code"}
+	}
+	return &registrationResponse{
+		clientMetadata: clientMetadata{
+			ClientID:                c.ID,
+			ClientName:              c.Name,
+			RedirectURIs:            c.RedirectURIs,
+			GrantTypes:              c.Grants,
+			ResponseTypes:           responseTypes,
+			TokenEndpointAuthMethod: method,
+		},
+		ClientIDIssuedAt:      c.Created.Unix(),
+		RegistrationClientURI: endpointURL("/oauth2/register/" + c.ID),
+	}
+}
+
+// metadataFail writes the error response for client metadata that is not valid
+func metadataFail(ctx *echo.Context, err error) error {
+	if err == tryerr.ErrInvalidRedirectURI {
+		return oauthFail(ctx, http.StatusBadRequest, errInvalidRedirectURI, err.Error())
+	}
+	return oauthFail(ctx, http.StatusBadRequest, errInvalidClientMetadata, err.Error())
+}
+
+// registrationAuthFail writes the response for a request of the registration
+// management protocol that can not be authenticated. Unknown clients are reported
+// the same way, so their ids are not disclosed.
+func registrationAuthFail(ctx *echo.Context, action string, err error) error {
+	if err == tryerr.ErrInvalidToken {
+		return bearerFail(ctx, http.StatusUnauthorized, errInvalidToken, err.Error())
+	}
+	return oauthServerError(ctx, action, err)
+}
+
+// registrationError writes the response for an error of the initial access token
+// handlers
+func registrationError(ctx *echo.Context, action string, err error) error {
+	status := http.StatusInternalServerError
+	switch err {
+	case tryerr.ErrNilUID, tryerr.ErrUnsupportedGrant:
+		status = http.StatusBadRequest
+	case tryerr.ErrTenantNotFound, tryerr.ErrScopeNotFound, tryerr.ErrTokenNotFound:
+		status = http.StatusNotFound
+	}
+	return ctx.JSON(status, &logMessage{Status: "error", Action: action, Info: err.Error(), Table: "initial_access_tokens"})
+}
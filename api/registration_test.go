@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestClientMetadataGrants(t *testing.T) {
+	redirect := []string{"https://app.example.com/callback"}
+	defaults := (&try6.InitialAccessToken{}).AllowedGrants()
+	extra := (&try6.InitialAccessToken{Grants: try6.StringList{try6.GrantClientCredentials}}).AllowedGrants()
+	for _, c := range []struct {
+		name    string
+		grants  []string
+		allowed []string
+		err     error
+	}{
+		{"default", nil, defaults, nil},
+		{"code and refresh", []string{try6.GrantAuthorizationCode, try6.GrantRefreshToken}, defaults, nil},
+		{"client credentials", []string{try6.GrantClientCredentials}, defaults, tryerr.ErrUnsupportedGrant},
+		{"token exchange", []string{try6.GrantAuthorizationCode, try6.GrantTokenExchange}, defaults, tryerr.ErrUnsupportedGrant},
+		{"client credentials allowed", []string{try6.GrantClientCredentials}, extra, nil},
+		{"token exchange not allowed", []string{try6.GrantTokenExchange}, extra, tryerr.ErrUnsupportedGrant},
+	} {
+		m := &clientMetadata{ClientName: "app", GrantTypes: c.grants, RedirectURIs: redirect}
+		if err := m.normalize(c.allowed); err != c.err {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestInitialAccessTokenAccess(t *testing.T) {
+	sm := newMemStore()
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	other := newTestAdmin(t, sm, "other", "other-tenant")
+	const path, route = "/tenants/tenant/registration_tokens", "/tenants/:id/registration_tokens"
+	revoke := path + "/" + try6.NewUUID()
+	body := `{"scope_id":"` + try6.NewUUID() + `","grant_types":["client_credentials"]}`
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"admin of another tenant", other, http.StatusForbidden},
+	} {
+		if rec := serveAs(c.bearer, "POST", path, route, CreateInitialAccessToken(sm), body); rec.Code != c.want {
+			t.Errorf("create by %s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+		if rec := serveAs(c.bearer, "GET", path, route, GetInitialAccessTokens(sm), ""); rec.Code != c.want {
+			t.Errorf("list by %s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+		if rec := serveAs(c.bearer, "DELETE", revoke, route+"/:token", RevokeInitialAccessToken(sm), ""); rec.Code != c.want {
+			t.Errorf("revoke by %s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+	if rec := serveAs(admin, "GET", path, route, GetInitialAccessTokens(sm), ""); rec.Code != http.StatusOK {
+		t.Errorf("list by admin: got %d", rec.Code)
+	}
+	if rec := serveAs(admin, "DELETE", revoke, route+"/:token", RevokeInitialAccessToken(sm), ""); rec.Code != http.StatusNoContent {
+		t.Errorf("revoke by admin: got %d", rec.Code)
+	}
+}
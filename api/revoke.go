@@ -0,0 +1,168 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Revoke handler revokes an access token or a refresh token of the authenticated
+// client as defined in RFC 7009. Revoking a refresh token revokes its whole family
+// and the access tokens issued with it. Revoked access tokens are published in the
+// revocation feed of their tenant.
+//
+// Tokens that are not known, have expired or were already revoked are answered
+// with 200 too, so the client can not learn anything from the response.
+func Revoke(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		ctx.Response().Header().Set("Cache-Control", "no-store")
+		r := ctx.Request()
+		if err := r.ParseForm(); err != nil {
+			return oauthFail(ctx, http.StatusBadRequest, errInvalidRequest, err.Error())
+		}
+		client, err := authenticateClient(sm, r)
+		if err != nil {
+			if err == tryerr.ErrInvalidClient {
+				ctx.Response().Header().Set("WWW-Authenticate", `Basic realm="try6"`)
+				return oauthFail(ctx, http.StatusUnauthorized, errInvalidClient, err.Error())
+			}
+			return oauthServerError(ctx, "Revoke", err)
+		}
+		token := r.PostFormValue("token")
+		if token == "" {
+			return oauthFail(ctx, http.StatusBadRequest, errInvalidRequest, "token is required")
+		}
+		// the token_type_hint only tells which kind of token to look for first
+		if r.PostFormValue("token_type_hint") == "access_token" {
+			err = revokeAccessToken(sm, client, token)
+			if err == tryerr.ErrTokenNotFound {
+				err = revokeRefreshToken(sm, client, token)
+			}
+		} else {
+			err = revokeRefreshToken(sm, client, token)
+			if err == tryerr.ErrTokenNotFound {
+				err = revokeAccessToken(sm, client, token)
+			}
+		}
+		switch err {
+		case nil, tryerr.ErrTokenNotFound:
+			return ctx.NoContent(http.StatusOK)
+		case tryerr.ErrInvalidClient:
+			return oauthFail(ctx, http.StatusBadRequest, errUnauthorizedClient, "token was issued to another client")
+		}
+		return oauthServerError(ctx, "Revoke", err)
+	}
+}
+
+// revokeRefreshToken revokes the family of the refresh token if it was issued to
+// the client. It returns tryerr.ErrTokenNotFound if the token is not a refresh
+// token and tryerr.ErrInvalidClient if it belongs to another client.
+func revokeRefreshToken(sm store.Storer, client *try6.Client, token string) error {
+	t, err := sm.GetRefreshToken(try6.HashToken(token))
+	if err != nil {
+		if err == tryerr.ErrInvalidGrant {
+			return tryerr.ErrTokenNotFound
+		}
+		return err
+	}
+	if t.ClientID != client.ID {
+		return tryerr.ErrInvalidClient
+	}
+	if t.Revoked.Valid {
+		return nil
+	}
+	log.LogI("refresh token revoked", "pkg", "api", "func", "revokeRefreshToken(store.Storer, *try6.Client, string)", "family", t.FamilyID, "client", client.ID)
+	return sm.RevokeRefreshFamily(t.FamilyID)
+}
+
+// revokeAccessToken revokes the access token if it was issued to the client. It
+// returns tryerr.ErrTokenNotFound if the token is not a valid access token and
+// tryerr.ErrInvalidClient if it belongs to another client.
+func revokeAccessToken(sm store.Storer, client *try6.Client, token string) error {
+	claims, err := try6.ParseToken(token, sm.GetKeyByID)
+	if err != nil {
+		return tryerr.ErrTokenNotFound
+	}
+	jti, _ := claims["jti"].(string)
+	if clientID, _ := claims["client_id"].(string); clientID != client.ID {
+		return tryerr.ErrInvalidClient
+	}
+	log.LogI("access token revoked", "pkg", "api", "func", "revokeAccessToken(store.Storer, *try6.Client, string)", "jti", jti, "client", client.ID)
+	return sm.RevokeJWT(jti)
+}
+
+// RevokeTokens handler revokes every access token and refresh token issued for the
+// item of the entity: all the tokens of an account, of the clients of a scope or of
+// the scopes of a tenant. It returns how many tokens were revoked. The request must
+// be made by an administrator of the tenant of the item.
+func RevokeTokens(sm store.Storer, entity string) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		id := ctx.Param("id")
+		if id == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "RevokeTokens", Info: tryerr.ErrNilUID.Error()})
+		}
+		admin, err := authorizeEntity(sm, ctx.Request(), entity, id)
+		if err != nil {
+			return statusError(ctx, "RevokeTokens", id, err)
+		}
+		if _, err := sm.GetStatus(entity, id); err != nil {
+			return statusError(ctx, "RevokeTokens", id, err)
+		}
+		access, refresh, err := sm.RevokeTokens(entity, id)
+		if err != nil {
+			return statusError(ctx, "RevokeTokens", id, err)
+		}
+		log.LogI("tokens revoked", "pkg", "api", "func", "RevokeTokens(store.Storer, string)", "entity", entity, "id", id, "access", access, "refresh", refresh, "actor", accountActor(admin.ID))
+		return ctx.JSON(http.StatusOK, map[string]int64{"access_tokens": access, "refresh_tokens": refresh})
+	}
+}
+
+// RevocationFeed handler returns the access tokens of the tenant revoked after the
+// position given in the since parameter, as a compact JWT signed with the key of the
+// tenant. Resource servers poll it with the next position of the last page to learn
+// about revocations before the tokens expire.
+func RevocationFeed(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		tenantID := ctx.Param("id")
+		if !try6.ValidUUID(tenantID) {
+			return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "RevocationFeed", Info: tryerr.ErrTenantNotFound.Error(), Table: "revocations"})
+		}
+		var since int64
+		if s := ctx.Query("since"); s != "" {
+			var err error
+			if since, err = strconv.ParseInt(s, 10, 64); err != nil || since < 0 {
+				return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "RevocationFeed", Info: tryerr.ErrInvalidCursor.Error(), Table: "revocations"})
+			}
+		}
+		key, err := sm.GetSigningKey(tenantID)
+		if err != nil {
+			if err == tryerr.ErrKeyNotFound {
+				return ctx.JSON(http.StatusNotFound, &logMessage{Status: "error", Action: "RevocationFeed", Info: tryerr.ErrTenantNotFound.Error(), Table: "revocations"})
+			}
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "RevocationFeed", Info: err.Error(), Table: "keys"})
+		}
+		revs, err := sm.GetRevocations(tenantID, since, try6.RevocationFeedLimit+1)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "RevocationFeed", Info: err.Error(), Table: "revocations"})
+		}
+		more := uint64(len(revs)) > try6.RevocationFeedLimit
+		if more {
+			revs = revs[:try6.RevocationFeedLimit]
+		}
+		feed, err := key.Sign(try6.RevocationFeed(tenantID, since, revs, more))
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "RevocationFeed", Info: err.Error(), Table: "keys"})
+		}
+		ctx.Response().Header().Set("Content-Type", "application/jwt")
+		ctx.Response().Header().Set("Cache-Control", "no-store")
+		ctx.Response().WriteHeader(http.StatusOK)
+		_, err = ctx.Response().Write([]byte(feed))
+		return err
+	}
+}
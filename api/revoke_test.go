@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jllopis/try6"
+)
+
+func TestRevokeTokens(t *testing.T) {
+	sm := newMemStore()
+	_, dir := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	other := newTestAdmin(t, sm, "other", "other-tenant")
+	const path, route = "/tenants/tenant/tokens", "/tenants/:id/tokens"
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"admin of another tenant", other, http.StatusForbidden},
+		{"admin", admin, http.StatusOK},
+	} {
+		if rec := serveAs(c.bearer, "DELETE", path, route, RevokeTokens(sm, try6.EntityTenant), ""); rec.Code != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, rec.Code, c.want)
+		}
+	}
+	if rec := serveAs(admin, "DELETE", "/accounts/account/tokens", "/accounts/:id/tokens", RevokeTokens(sm, try6.EntityAccount), ""); rec.Code != http.StatusOK {
+		t.Errorf("account of the tenant: got %d", rec.Code)
+	}
+	// directories have no tokens of their own
+	rec := serveAs(admin, "DELETE", "/directories/"+dir.ID+"/tokens", "/directories/:id/tokens", RevokeTokens(sm, try6.EntityDirectory), "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown entity: got %d %s", rec.Code, rec.Body)
+	}
+}
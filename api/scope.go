@@ -22,6 +22,9 @@ func CreateScope(sm store.Storer) echo.HandlerFunc {
 		if s.TenantID == "" {
 			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "create", Info: "tenant not specified", Table: "scopes"})
 		}
+		if err := s.Exchanges.Validate(); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "scopes"})
+		}
 		err = sm.SaveScope(&s)
 		if err != nil {
 			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "scopes"})
@@ -30,17 +33,30 @@ func CreateScope(sm store.Storer) echo.HandlerFunc {
 	}
 }
 
-// GetScopesByTenantID returns a list of scopes owned by the tenant
+// GetScopesByTenantID returns a page of the scopes owned by the tenant. It accepts
+// the query parameters described in listQuery and sets the Link header to the
+// next page.
 func GetScopesByTenantID(sm store.Storer) echo.HandlerFunc {
 	return func(ctx *echo.Context) error {
 		var tenantID string
 		if tenantID = ctx.Param("id"); tenantID == "" {
 			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "GetScopesByTenantID", Info: "tenant id cannot be nil"})
 		}
-		scopes, err := sm.GetScopesByTenantID(tenantID)
+		q, err := listQuery(ctx)
 		if err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "GetScopesByTenantID", Info: err.Error(), Table: "scopes"})
+		}
+		scopes, next, err := sm.GetScopesByTenantID(tenantID, q)
+		if err != nil {
+			if isListQueryError(err) {
+				return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "GetScopesByTenantID", Info: err.Error(), Table: "scopes"})
+			}
 			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "GetScopesByTenantID", Info: err.Error(), Table: "scopes"})
 		}
+		if scopes == nil {
+			scopes = []*try6.Scope{}
+		}
+		setLinkHeader(ctx, next)
 		return ctx.JSON(http.StatusOK, scopes)
 	}
 }
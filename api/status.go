@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// statusRequest holds the status an item must move to and why
+type statusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// ChangeStatus handler moves the item of the entity to the status provided in the
+// body if the state machine of the entity allows it, and records the change with
+// the administrator that makes the request and the reason given. The request must
+// be made by an administrator of the tenant of the item.
+func ChangeStatus(sm store.Storer, entity string) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		id := ctx.Param("id")
+		if id == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ChangeStatus", Info: tryerr.ErrNilUID.Error()})
+		}
+		admin, err := authorizeEntity(sm, ctx.Request(), entity, id)
+		if err != nil {
+			return statusError(ctx, "ChangeStatus", id, err)
+		}
+		var r statusRequest
+		if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "ChangeStatus", Info: err.Error()})
+		}
+		from, err := sm.GetStatus(entity, id)
+		if err != nil {
+			return statusError(ctx, "ChangeStatus", id, err)
+		}
+		c, err := try6.NewStatusChange(entity, id, from, r.Status, accountActor(admin.ID), r.Reason)
+		if err == nil {
+			err = sm.ChangeStatus(c)
+		}
+		if err != nil {
+			return statusError(ctx, "ChangeStatus", id, err)
+		}
+		log.LogI("status changed", "pkg", "api", "func", "ChangeStatus(store.Storer, string)", "entity", entity, "id", id, "from", c.From, "to", c.To, "actor", c.Actor)
+		return ctx.JSON(http.StatusOK, c)
+	}
+}
+
+// GetStatusChanges handler returns the status changes of the item of the entity,
+// newest first. The request must be made by an administrator of the tenant of the
+// item.
+func GetStatusChanges(sm store.Storer, entity string) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		id := ctx.Param("id")
+		if id == "" {
+			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "GetStatusChanges", Info: tryerr.ErrNilUID.Error()})
+		}
+		if _, err := authorizeEntity(sm, ctx.Request(), entity, id); err != nil {
+			return statusError(ctx, "GetStatusChanges", id, err)
+		}
+		changes, err := sm.GetStatusChanges(entity, id)
+		if err != nil {
+			return statusError(ctx, "GetStatusChanges", id, err)
+		}
+		if changes == nil {
+			changes = []*try6.StatusChange{}
+		}
+		return ctx.JSON(http.StatusOK, changes)
+	}
+}
+
+// requestActor returns who makes the request: the account or client authenticated
+// by its bearer token, or anonymous. It is only logged; the changes recorded are
+// made by authorized accounts, see accountActor.
+func requestActor(sm store.Storer, ctx *echo.Context) string {
+	b, err := authenticateBearer(sm, ctx.Request())
+	switch {
+	case err != nil:
+		return "anonymous"
+	case b.apiKey == nil && b.subject == b.clientID:
+		return "client:" + b.clientID
+	}
+	return accountActor(b.subject)
+}
+
+// accountActor returns the actor of the requests made by the account
+func accountActor(accountID string) string {
+	return "account:" + accountID
+}
+
+// recordStatusChange records a change of the status of an item saved along with
+// the rest of its data. Nothing is recorded if the status did not change. Errors
+// are logged but not returned.
+func recordStatusChange(sm store.Storer, entity, id, from, to, actor, reason string) {
+	if from == to {
+		return
+	}
+	c, err := try6.NewStatusChange(entity, id, from, to, actor, reason)
+	if err == nil {
+		err = sm.RecordStatusChange(c)
+	}
+	if err != nil {
+		log.LogE("error recording status change", "pkg", "api", "func", "recordStatusChange(store.Storer, string, string, string, string, string, string)", "entity", entity, "id", id, "from", from, "to", to, "error", err.Error())
+	}
+}
+
+// usableAccount checks that the account can authenticate or be issued tokens: it
+// must not be disabled and at least one of its directories, and the tenant of the
+// directory, must be usable. It returns tryerr.ErrDisabled or tryerr.ErrDeleted
+// otherwise.
+func usableAccount(sm store.Storer, account *try6.Account) error {
+	if err := try6.Usable(account.Status); err != nil {
+		return err
+	}
+	dirs, err := sm.GetDirectoriesByAccountID(account.ID)
+	if err != nil {
+		return err
+	}
+	reason := tryerr.ErrDisabled
+	for _, d := range dirs {
+		if err := try6.Usable(d.Status); err != nil {
+			continue
+		}
+		if d.TenantUID == "" {
+			return nil
+		}
+		status, err := sm.GetStatus(try6.EntityTenant, d.TenantUID)
+		switch err {
+		case nil:
+		case tryerr.ErrTenantNotFound:
+			reason = tryerr.ErrDeleted
+			continue
+		default:
+			return err
+		}
+		if try6.Usable(status) == nil {
+			return nil
+		}
+	}
+	return reason
+}
+
+// statusError writes the response for an error of the status handlers
+func statusError(ctx *echo.Context, action, id string, err error) error {
+	status := http.StatusInternalServerError
+	switch err {
+	case tryerr.ErrInvalidToken, tryerr.ErrAccountAccessDenied:
+		return accessError(ctx, action, err)
+	case tryerr.ErrInvalidStatus, tryerr.ErrActorNotProvided, tryerr.ErrNilUID, tryerr.ErrInvalidEntity:
+		status = http.StatusBadRequest
+	case tryerr.ErrInvalidTransition:
+		status = http.StatusConflict
+	case tryerr.ErrAccountNotFound, tryerr.ErrDirectoryNotFound, tryerr.ErrScopeNotFound, tryerr.ErrTenantNotFound, tryerr.ErrKeyNotFound, tryerr.ErrClientNotFound:
+		status = http.StatusNotFound
+	}
+	return ctx.JSON(status, &logMessage{Status: "error", Action: action, Info: err.Error(), UID: id})
+}
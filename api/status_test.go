@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jllopis/try6"
+)
+
+func TestChangeStatus(t *testing.T) {
+	sm := newMemStore()
+	a, dir := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	admin := newTestAdmin(t, sm, "admin", "tenant")
+	other := newTestAdmin(t, sm, "other", "other-tenant")
+	route := "/accounts/:id/status"
+	body := `{"status":"active","reason":"verified by phone"}`
+
+	for _, c := range []struct {
+		name   string
+		bearer string
+		want   int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"account itself", sm.bearerFor(a.ID), http.StatusForbidden},
+		{"admin of another tenant", other, http.StatusForbidden},
+		{"admin", admin, http.StatusOK},
+	} {
+		if rec := serveAs(c.bearer, "PUT", "/accounts/"+a.ID+"/status", route, ChangeStatus(sm, try6.EntityAccount), body); rec.Code != c.want {
+			t.Errorf("%s: got %d %s", c.name, rec.Code, rec.Body)
+		}
+	}
+	if a, _ := sm.GetAccountByID(a.ID); a.Status != try6.StatusActive {
+		t.Errorf("status = %q", a.Status)
+	}
+	if len(sm.changes) != 1 || sm.changes[0].Actor != "account:admin" {
+		t.Errorf("unexpected changes %+v", sm.changes)
+	}
+
+	rec := serveAs(other, "GET", "/accounts/"+a.ID+"/status", route, GetStatusChanges(sm, try6.EntityAccount), "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("changes read by another tenant: got %d", rec.Code)
+	}
+
+	// items of other entities are authorized by their tenant
+	route = "/directories/:id/status"
+	if rec := serveAs(other, "GET", "/directories/"+dir.ID+"/status", route, GetStatusChanges(sm, try6.EntityDirectory), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("directory of another tenant: got %d", rec.Code)
+	}
+	if rec := serveAs(admin, "GET", "/directories/missing/status", route, GetStatusChanges(sm, try6.EntityDirectory), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing directory: got %d", rec.Code)
+	}
+	rec = serveAs(admin, "GET", "/tenants/tenant/status", "/tenants/:id/status", GetStatusChanges(sm, try6.EntityTenant), "")
+	var changes []*try6.StatusChange
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &changes) != nil {
+		t.Errorf("tenant changes: got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,483 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// memStore is an in memory store.Storer for the handler tests. It implements only
+// the methods the tests need; calling any other panics.
+type memStore struct {
+	store.Storer
+	mu          sync.Mutex
+	accounts    map[string]*try6.Account
+	directories map[string]*try6.Directory
+	members     map[string][]string
+	tokens      map[string]*try6.AccountToken
+	apiKeys     map[string]*try6.APIKey
+	mfa         map[string]*try6.AccountMFA
+	recovery    map[string][]*try6.RecoveryCode
+	recoveryIPs []string
+	importJobs  map[string]*try6.ImportJob
+	customData  map[string]try6.CustomData
+	changes     []*try6.StatusChange
+	failures    []*try6.LoginFailure
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		accounts:    map[string]*try6.Account{},
+		directories: map[string]*try6.Directory{},
+		members:     map[string][]string{},
+		tokens:      map[string]*try6.AccountToken{},
+		apiKeys:     map[string]*try6.APIKey{},
+		mfa:         map[string]*try6.AccountMFA{},
+		recovery:    map[string][]*try6.RecoveryCode{},
+		importJobs:  map[string]*try6.ImportJob{},
+		customData:  map[string]try6.CustomData{},
+	}
+}
+
+// addAccount adds the account to the directory, creating it if needed
+func (m *memStore) addAccount(dir *try6.Directory, a *try6.Account) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if dir.Status == "" {
+		dir.Status = try6.StatusActive
+	}
+	m.directories[dir.ID] = dir
+	a.EmailKey = try6.EmailKey(a.Email, dir.CaseSensitiveEmail)
+	m.accounts[a.ID] = a
+	m.members[a.ID] = append(m.members[a.ID], dir.ID)
+}
+
+func (m *memStore) GetAccountByID(id string) (*try6.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[id]
+	if !ok {
+		return nil, tryerr.ErrAccountNotFound
+	}
+	c := *a
+	return &c, nil
+}
+
+func (m *memStore) GetAccountByEmail(email string) (*try6.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.accounts {
+		if a.EmailKey == try6.EmailKey(email, false) || a.EmailKey == email {
+			c := *a
+			return &c, nil
+		}
+	}
+	return nil, tryerr.ErrEmailNotFound
+}
+
+func (m *memStore) EmailInUse(key string, caseSensitive bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.accounts {
+		if a.EmailKey == key || !caseSensitive && strings.ToLower(a.EmailKey) == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memStore) SaveAccount(directory string, a *try6.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if a.ID == "" {
+		a.ID = fmt.Sprintf("account-%d", len(m.accounts)+1)
+		m.members[a.ID] = append(m.members[a.ID], directory)
+	}
+	if a.Status == "" {
+		a.Status = try6.StatusUnverified
+	}
+	c := *a
+	m.accounts[a.ID] = &c
+	return nil
+}
+
+func (m *memStore) SaveAccountProfile(a *try6.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *a
+	m.accounts[a.ID] = &c
+	return nil
+}
+
+func (m *memStore) GetAccountCustomData(accountID string) (try6.CustomData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data := try6.CustomData{}
+	for k, v := range m.customData[accountID] {
+		data[k] = v
+	}
+	return data, nil
+}
+
+func (m *memStore) SaveAccountCustomData(accountID string, data try6.CustomData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.customData[accountID] = data
+	return nil
+}
+
+func (m *memStore) PatchAccountCustomData(accountID string, changes map[string]*string) (try6.CustomData, error) {
+	data, _ := m.GetAccountCustomData(accountID)
+	data.Patch(changes)
+	return data, m.SaveAccountCustomData(accountID, data)
+}
+
+func (m *memStore) SaveAccountPasswordHash(a *try6.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accounts[a.ID].Password = a.Password
+	return nil
+}
+
+func (m *memStore) SaveAccountLockout(a *try6.Account, from string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accounts[a.ID].Status != from {
+		return tryerr.ErrInvalidTransition
+	}
+	c := *a
+	m.accounts[a.ID] = &c
+	return nil
+}
+
+func (m *memStore) GetDirectoryByID(id string) (*try6.Directory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.directories[id]
+	if !ok {
+		return nil, tryerr.ErrDirectoryNotFound
+	}
+	c := *d
+	return &c, nil
+}
+
+func (m *memStore) SaveDirectory(d *try6.Directory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *d
+	m.directories[d.ID] = &c
+	return nil
+}
+
+func (m *memStore) GetDirectoriesByAccountID(id string) ([]*try6.Directory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var dirs []*try6.Directory
+	for _, d := range m.members[id] {
+		dirs = append(dirs, m.directories[d])
+	}
+	return dirs, nil
+}
+
+func (m *memStore) CountDirectoryAccounts(id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, dirs := range m.members {
+		for _, d := range dirs {
+			if d == id {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func (m *memStore) SaveAccountToken(t *try6.AccountToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t.ID = t.Hash
+	m.tokens[t.Hash] = t
+	return nil
+}
+
+func (m *memStore) GetAccountToken(kind, hash string) (*try6.AccountToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[hash]
+	if !ok || t.Kind != kind {
+		return nil, tryerr.ErrTokenNotFound
+	}
+	c := *t
+	return &c, nil
+}
+
+func (m *memStore) UseAccountToken(t *try6.AccountToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokens[t.ID].Used.Valid {
+		return tryerr.ErrInvalidToken
+	}
+	m.tokens[t.ID].Used.Time, m.tokens[t.ID].Used.Valid = time.Now().UTC(), true
+	t.Used = m.tokens[t.ID].Used
+	return nil
+}
+
+func (m *memStore) RevokeAccountTokens(accountID, kind string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tokens {
+		if t.AccountID == accountID && t.Kind == kind && !t.Used.Valid {
+			t.Used.Time, t.Used.Valid = time.Now().UTC(), true
+		}
+	}
+	return nil
+}
+
+func (m *memStore) ChangeStatus(c *try6.StatusChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[c.EntityID]
+	if c.Entity != try6.EntityAccount || !ok || a.Status != c.From {
+		return tryerr.ErrInvalidTransition
+	}
+	a.Status = c.To
+	m.changes = append(m.changes, c)
+	return nil
+}
+
+func (m *memStore) RecordStatusChange(c *try6.StatusChange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes = append(m.changes, c)
+	return nil
+}
+
+func (m *memStore) GetStatusChanges(entity, id string) ([]*try6.StatusChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var changes []*try6.StatusChange
+	for _, c := range m.changes {
+		if c.Entity == entity && c.EntityID == id {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+func (m *memStore) GetStatus(entity, id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if a, ok := m.accounts[id]; ok && entity == try6.EntityAccount {
+		return a.Status, nil
+	}
+	return try6.StatusActive, nil
+}
+
+func (m *memStore) GetPasswordPolicy(directoryID string) (*try6.PasswordPolicy, error) {
+	return try6.NewPasswordPolicy(directoryID), nil
+}
+
+func (m *memStore) GetPasswordPolicyByAccountID(accountID string) (*try6.PasswordPolicy, error) {
+	return try6.NewPasswordPolicy(""), nil
+}
+
+func (m *memStore) SaveAccountMFA(a *try6.AccountMFA) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a.ID = a.AccountID
+	c := *a
+	m.mfa[a.AccountID] = &c
+	return nil
+}
+
+func (m *memStore) GetAccountMFA(accountID, kind string) (*try6.AccountMFA, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.mfa[accountID]
+	if !ok || a.Kind != kind {
+		return nil, tryerr.ErrMFANotFound
+	}
+	c := *a
+	return &c, nil
+}
+
+func (m *memStore) DeleteAccountMFA(accountID, kind string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.mfa, accountID)
+	return nil
+}
+
+func (m *memStore) UseMFAStep(a *try6.AccountMFA) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *a
+	m.mfa[a.AccountID] = &c
+	return nil
+}
+
+func (m *memStore) ReplaceRecoveryCodes(accountID string, codes []*try6.RecoveryCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recovery[accountID] = codes
+	return nil
+}
+
+func (m *memStore) GetRecoveryCodes(accountID string) ([]*try6.RecoveryCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var codes []*try6.RecoveryCode
+	for _, c := range m.recovery[accountID] {
+		if !c.Used.Valid {
+			codes = append(codes, c)
+		}
+	}
+	return codes, nil
+}
+
+func (m *memStore) UseRecoveryCode(c *try6.RecoveryCode, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c.Used.Valid {
+		return tryerr.ErrInvalidMFACode
+	}
+	c.Used.Time, c.Used.Valid = time.Now().UTC(), true
+	m.recoveryIPs = append(m.recoveryIPs, ip)
+	return nil
+}
+
+func (m *memStore) DeleteRecoveryCodes(accountID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.recovery, accountID)
+	return nil
+}
+
+func (m *memStore) IncFailedLogins(accountID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accounts[accountID].FailedLogins++
+	return m.accounts[accountID].FailedLogins, nil
+}
+
+func (m *memStore) CountLoginFailuresByIP(ip string, since time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *memStore) SaveLoginFailure(f *try6.LoginFailure) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = append(m.failures, f)
+	return nil
+}
+
+func (m *memStore) GetAPIKey(id string) (*try6.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return nil, tryerr.ErrAPIKeyNotFound
+	}
+	c := *k
+	return &c, nil
+}
+
+func (m *memStore) SaveAPIKey(k *try6.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *k
+	m.apiKeys[k.ID] = &c
+	return nil
+}
+
+func (m *memStore) GetAPIKeysByAccountID(accountID string) ([]*try6.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ks []*try6.APIKey
+	for _, k := range m.apiKeys {
+		if k.AccountID == accountID {
+			c := *k
+			ks = append(ks, &c)
+		}
+	}
+	return ks, nil
+}
+
+func (m *memStore) DeleteAPIKey(accountID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if k, ok := m.apiKeys[id]; !ok || k.AccountID != accountID {
+		return tryerr.ErrAPIKeyNotFound
+	}
+	delete(m.apiKeys, id)
+	return nil
+}
+
+func (m *memStore) TouchAPIKey(id string) error {
+	return nil
+}
+
+// bearerFor returns an API key of the account to authenticate the requests
+func (m *memStore) bearerFor(accountID string) string {
+	k, key, err := try6.NewAPIKey(accountID, "test", "", time.Time{})
+	if err != nil {
+		panic(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.apiKeys[k.ID] = k
+	return key
+}
+
+func (m *memStore) SaveImportJob(j *try6.ImportJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if j.ID == "" {
+		j.ID = fmt.Sprintf("job-%d", len(m.importJobs)+1)
+	}
+	c := *j
+	c.Errors = append(try6.ImportErrors(nil), j.Errors...)
+	m.importJobs[j.ID] = &c
+	return nil
+}
+
+func (m *memStore) GetImportJob(id string) (*try6.ImportJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.importJobs[id]
+	if !ok {
+		return nil, tryerr.ErrImportJobNotFound
+	}
+	c := *j
+	return &c, nil
+}
+
+func (m *memStore) GetInitialAccessTokensByTenantID(tenantID string) ([]*try6.InitialAccessToken, error) {
+	return nil, nil
+}
+
+func (m *memStore) RevokeInitialAccessToken(tenantID, id string) error {
+	return nil
+}
+
+func (m *memStore) RevokeTokens(entity, id string) (int64, int64, error) {
+	switch entity {
+	case try6.EntityAccount, try6.EntityScope, try6.EntityTenant, try6.EntityClient:
+		return 0, 0, nil
+	}
+	return 0, 0, tryerr.ErrInvalidEntity
+}
+
+func (m *memStore) GetConsentsByAccountID(accountID string) ([]*try6.Consent, error) {
+	return nil, nil
+}
+
+func (m *memStore) RevokeConsent(accountID, clientID string) error {
+	return nil
+}
@@ -5,22 +5,33 @@ import (
 	"net/http"
 
 	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/mailer"
 	"github.com/jllopis/try6/store"
 	"github.com/labstack/echo"
 )
 
 // CreateTenant handler creates a new tenant with the data provided in the request body
-func CreateTenant(sm store.Storer) echo.HandlerFunc {
+func CreateTenant(sm store.Storer, m *mailer.Mailer) echo.HandlerFunc {
 	return func(ctx *echo.Context) error {
 		var ctd try6.CreateTenantData
 		err := json.NewDecoder(ctx.Request().Body).Decode(&ctd)
 		if err != nil {
 			return ctx.JSON(http.StatusBadRequest, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "tenants"})
 		}
+		newAccount := ctd.Acc != nil && ctd.Acc.ID == ""
+		if newAccount {
+			ctd.Acc.Status = ""
+		}
 		err = sm.CreateTenant(&ctd)
 		if err != nil {
 			return ctx.JSON(http.StatusInternalServerError, &logMessage{Status: "error", Action: "create", Info: err.Error(), Table: "tenants"})
 		}
+		if newAccount {
+			if err := issueVerificationToken(sm, m, ctd.Acc, ctx.Request().Header.Get("Accept-Language")); err != nil {
+				log.LogE("error issuing verification token", "pkg", "api", "func", "CreateTenant(store.Storer, *mailer.Mailer)", "account", ctd.Acc.ID, "error", err.Error())
+			}
+		}
 		return ctx.JSON(http.StatusCreated, ctd)
 	}
 }
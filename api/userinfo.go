@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// userInfoScopes are all the scopes the userinfo endpoint knows about, granted to
+// the API keys with no scope restriction
+var userInfoScopes = strings.Join([]string{try6.ScopeOpenID, try6.ScopeProfile, try6.ScopeEmail, try6.ScopePhone, try6.ScopeGroups}, " ")
+
+// UserInfo handler is the OpenID Connect userinfo endpoint. It returns the claims of
+// the account of the bearer access token, or API key, that its scopes grant:
+// profile, email, phone and groups. The token must have the openid scope.
+func UserInfo(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		ctx.Response().Header().Set("Cache-Control", "no-store")
+		b, err := authenticateBearer(sm, ctx.Request())
+		if err != nil {
+			if err == tryerr.ErrInvalidToken {
+				return bearerFail(ctx, http.StatusUnauthorized, errInvalidToken, err.Error())
+			}
+			return oauthServerError(ctx, "UserInfo", err)
+		}
+		if !b.hasScope(try6.ScopeOpenID) {
+			return bearerFail(ctx, http.StatusForbidden, errInsufficientScope, "openid scope is required")
+		}
+		granted := b.scope
+		if b.apiKey != nil && granted == "" {
+			granted = userInfoScopes
+		}
+		account, err := grantAccount(sm, b.subject)
+		if err != nil {
+			switch err {
+			case tryerr.ErrAccountNotFound, tryerr.ErrDisabled, tryerr.ErrDeleted:
+				return bearerFail(ctx, http.StatusUnauthorized, errInvalidToken, err.Error())
+			}
+			return oauthServerError(ctx, "UserInfo", err)
+		}
+		var scope *try6.Scope
+		if b.clientID != "" {
+			client, err := sm.GetClientByID(b.clientID)
+			if err == nil {
+				scope, err = sm.GetScopeByID(client.ScopeID)
+			}
+			if err != nil {
+				if err == tryerr.ErrClientNotFound || err == tryerr.ErrScopeNotFound {
+					return bearerFail(ctx, http.StatusUnauthorized, errInvalidToken, err.Error())
+				}
+				return oauthServerError(ctx, "UserInfo", err)
+			}
+		}
+		info, err := userInfo(sm, account, scope, granted)
+		if err != nil {
+			return oauthServerError(ctx, "UserInfo", err)
+		}
+		return ctx.JSON(http.StatusOK, info)
+	}
+}
+
+// userInfo returns the claims of the account granted by the scopes. The groups of
+// the account are the labels of its usable directories mapped to the scope, or of
+// all of them if there is no scope.
+func userInfo(sm store.Storer, account *try6.Account, scope *try6.Scope, granted string) (map[string]interface{}, error) {
+	var groups []string
+	if try6.HasScope(granted, try6.ScopeGroups) {
+		mine, err := sm.GetDirectoriesByAccountID(account.ID)
+		if err != nil {
+			return nil, err
+		}
+		dirs := mine
+		if scope != nil {
+			if dirs, err = sm.GetDirectoriesByScopeID(scope.ID); err != nil {
+				return nil, err
+			}
+		}
+		for _, d := range dirs {
+			if try6.Usable(d.Status) != nil {
+				continue
+			}
+			for _, m := range mine {
+				if m.ID == d.ID {
+					groups = append(groups, d.Label)
+				}
+			}
+		}
+	}
+	log.LogD("user info", "pkg", "api", "func", "userInfo(store.Storer, *try6.Account, *try6.Scope, string)", "account", account.ID, "scope", granted)
+	return account.UserInfoClaims(granted, groups), nil
+}
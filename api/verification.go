@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/mailer"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+	"github.com/labstack/echo"
+)
+
+// verifyRequest holds the verification token sent to the account email
+type verifyRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyAccount handler activates the unverified account that owns the token. The
+// token is sent as JSON or with the form of the page the verification link opens.
+func VerifyAccount(sm store.Storer) echo.HandlerFunc {
+	return func(ctx *echo.Context) error {
+		var r verifyRequest
+		if isFormPost(ctx.Request()) {
+			r.Token = ctx.Request().PostFormValue("token")
+		} else if err := json.NewDecoder(ctx.Request().Body).Decode(&r); err != nil {
+			r.Token = ""
+		}
+		reply := accountReply(ctx, verifyEmailPage(r.Token))
+		if r.Token == "" {
+			return reply(http.StatusBadRequest, &logMessage{Status: "error", Action: "VerifyAccount", Info: "token not provided"})
+		}
+		t, err := sm.GetAccountToken(try6.TokenEmailVerification, try6.HashToken(r.Token))
+		if err == nil {
+			err = t.Valid()
+		}
+		if err == nil {
+			err = sm.UseAccountToken(t)
+		}
+		if err != nil {
+			if err == tryerr.ErrTokenNotFound || err == tryerr.ErrTokenExpired || err == tryerr.ErrInvalidToken {
+				return reply(http.StatusBadRequest, &logMessage{Status: "error", Action: "VerifyAccount", Info: tryerr.ErrInvalidToken.Error()})
+			}
+			return reply(http.StatusInternalServerError, &logMessage{Status: "error", Action: "VerifyAccount", Info: err.Error(), Table: "account_tokens"})
+		}
+		account, err := sm.GetAccountByID(t.AccountID)
+		if err != nil {
+			if err == tryerr.ErrAccountNotFound {
+				return reply(http.StatusBadRequest, &logMessage{Status: "error", Action: "VerifyAccount", Info: tryerr.ErrInvalidToken.Error()})
+			}
+			return reply(http.StatusInternalServerError, &logMessage{Status: "error", Action: "VerifyAccount", Info: err.Error(), Table: "accounts"})
+		}
+		c, err := account.Verify()
+		if err == nil && c != nil {
+			err = sm.ChangeStatus(c)
+		}
+		if err != nil {
+			return reply(http.StatusInternalServerError, &logMessage{Status: "error", Action: "VerifyAccount", Info: err.Error(), Table: "accounts"})
+		}
+		return reply(http.StatusOK, &logMessage{Status: "ok", Action: "VerifyAccount", Table: "accounts", UID: account.ID})
+	}
+}
+
+// issueVerificationToken creates a new email verification token for the account,
+// revoking the previous ones, and sends it to the account email
+func issueVerificationToken(sm store.Storer, m *mailer.Mailer, account *try6.Account, lang string) error {
+	if err := sm.RevokeAccountTokens(account.ID, try6.TokenEmailVerification); err != nil {
+		return err
+	}
+	t, secret, err := try6.NewAccountToken(account.ID, try6.TokenEmailVerification, try6.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	if err := sm.SaveAccountToken(t); err != nil {
+		return err
+	}
+	return sendAccountMail(sm, m, account, lang, mailer.TemplateVerifyEmail, map[string]interface{}{
+		"Name":  account.Name,
+		"URL":   m.Link(VerifyEmailPath, secret),
+		"Token": secret,
+		"Hours": int(try6.EmailVerificationTTL.Hours()),
+	})
+}
+
+// sendAccountMail sends the template to the account email using the templates of
+// the tenant the account belongs to
+func sendAccountMail(sm store.Storer, m *mailer.Mailer, account *try6.Account, lang, name string, data map[string]interface{}) error {
+	var tenantID string
+	dirs, err := sm.GetDirectoriesByAccountID(account.ID)
+	if err != nil {
+		return err
+	}
+	if len(dirs) > 0 {
+		tenantID = dirs[0].TenantUID
+	}
+	if err := m.SendTemplate(account.Email, tenantID, lang, name, data); err != nil {
+		return err
+	}
+	log.LogI("mail sent", "pkg", "api", "func", "sendAccountMail(store.Storer, *mailer.Mailer, *try6.Account, string, string, map[string]interface{})", "account", account.ID, "template", name)
+	return nil
+}
+
+// allowUnverifiedLogin reports whether any of the directories of the account lets
+// unverified accounts authenticate
+func allowUnverifiedLogin(sm store.Storer, accountID string) (bool, error) {
+	dirs, err := sm.GetDirectoriesByAccountID(accountID)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range dirs {
+		if d.AllowUnverifiedLogin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
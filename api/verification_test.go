@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// newTestAccount returns an unverified account with the password in a new directory
+// of the store
+func newTestAccount(t *testing.T, sm *memStore, id, email, password string) (*try6.Account, *try6.Directory) {
+	defer func(h try6.Hasher) { try6.DefaultHasher = h }(try6.DefaultHasher)
+	try6.DefaultHasher = &try6.BcryptHasher{Cost: 4}
+	a, err := try6.NewAccount(email, "Test", password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.ID, a.Status = id, try6.StatusUnverified
+	dir := &try6.Directory{ID: "dir-" + id, TenantUID: "tenant"}
+	sm.addAccount(dir, a)
+	return a, dir
+}
+
+// serve sends the request to the handler registered for the method and path
+func serve(method, path, route string, h echo.HandlerFunc, body string) *httptest.ResponseRecorder {
+	return serveAs("", method, path, route, h, body)
+}
+
+// serveAs sends the request with the bearer token to the handler registered for
+// the method and path
+func serveAs(bearer, method, path, route string, h echo.HandlerFunc, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	map[string]func(string, echo.Handler){"GET": e.Get, "POST": e.Post, "PUT": e.Put, "PATCH": e.Patch, "DELETE": e.Delete}[method](route, h)
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestVerifyAccount(t *testing.T) {
+	sm := newMemStore()
+	a, _ := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	tok, secret, err := try6.NewAccountToken(a.ID, try6.TokenEmailVerification, try6.EmailVerificationTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.SaveAccountToken(tok)
+
+	if rec := serve("POST", "/accounts/verify", "/accounts/verify", VerifyAccount(sm), `{"token":"wrong"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("wrong token: got %d", rec.Code)
+	}
+	if rec := serve("POST", "/accounts/verify", "/accounts/verify", VerifyAccount(sm), `{"token":"`+secret+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("verify: got %d %s", rec.Code, rec.Body)
+	}
+	if got, _ := sm.GetAccountByID(a.ID); got.Status != try6.StatusActive {
+		t.Errorf("verified account has status %q", got.Status)
+	}
+	if len(sm.changes) != 1 || sm.changes[0].Actor != try6.ActorSystem {
+		t.Errorf("status change not recorded: %+v", sm.changes)
+	}
+	if rec := serve("POST", "/accounts/verify", "/accounts/verify", VerifyAccount(sm), `{"token":"`+secret+`"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("token used twice: got %d", rec.Code)
+	}
+}
+
+func TestLoginUnverified(t *testing.T) {
+	sm := newMemStore()
+	a, dir := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	if _, _, err := login(sm, a.Email, "password1", "192.0.2.1", nil); err != tryerr.ErrEmailUnverified {
+		t.Errorf("unverified login: got %v, want %v", err, tryerr.ErrEmailUnverified)
+	}
+	if rec := serve("POST", "/authenticate", "/authenticate", Authenticate(sm), `{"email":"user@example.com","password":"password1"}`); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "email_unverified") {
+		t.Errorf("unverified authenticate: got %d %s", rec.Code, rec.Body)
+	}
+	dir.AllowUnverifiedLogin = true
+	if _, _, err := login(sm, a.Email, "password1", "192.0.2.1", nil); err != nil {
+		t.Errorf("unverified login allowed by the directory: got %v", err)
+	}
+}
+
+func TestUpdateDirectory(t *testing.T) {
+	sm := newMemStore()
+	_, dir := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	body := `{"label":"Staff","status":"deleted","tenant_uid":"other","require_mfa":true}`
+	defer func(k []byte) { try6.SecretKey = k }(try6.SecretKey)
+	try6.SecretKey = nil
+	if rec := serve("PUT", "/directories/"+dir.ID, "/directories/:id", UpdateDirectory(sm), body); rec.Code != http.StatusConflict {
+		t.Errorf("mfa required without secret key: got %d", rec.Code)
+	}
+	try6.SecretKey = make([]byte, 32)
+	rec := serve("PUT", "/directories/"+dir.ID, "/directories/:id", UpdateDirectory(sm), body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: got %d %s", rec.Code, rec.Body)
+	}
+	got, _ := sm.GetDirectoryByID(dir.ID)
+	if got.Label != "Staff" || !got.RequireMFA || got.Status != try6.StatusActive || got.TenantUID != "tenant" {
+		t.Errorf("unexpected directory %+v", got)
+	}
+	rec = serve("PUT", "/directories/"+dir.ID, "/directories/:id", UpdateDirectory(sm), `{"case_sensitive_email":true}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("case sensitivity of a directory with accounts: got %d", rec.Code)
+	}
+}
+
+func TestVerifyAccountForm(t *testing.T) {
+	sm := newMemStore()
+	a, _ := newTestAccount(t, sm, "account", "user@example.com", "password1")
+	tok, secret, err := try6.NewAccountToken(a.ID, try6.TokenEmailVerification, try6.EmailVerificationTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.SaveAccountToken(tok)
+	post := func() *httptest.ResponseRecorder {
+		e := echo.New()
+		e.Post("/accounts/verify", VerifyAccount(sm))
+		req, _ := http.NewRequest("POST", "/accounts/verify", strings.NewReader("token="+secret))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post(); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "has been verified") {
+		t.Fatalf("verify form: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := post(); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not valid or has expired") {
+		t.Errorf("verify form twice: got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,97 @@
+package try6
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// APIKeyPrefix starts the id of every API key, so they can be told apart from
+	// access tokens and found in logs and source code
+	APIKeyPrefix = "try6_"
+	// apiKeySeparator separates the id of an API key from its secret
+	apiKeySeparator = "."
+)
+
+// APIKeyTouchInterval is the minimum time between updates of the last use of an
+// API key
+var APIKeyTouchInterval = time.Minute
+
+// NewAPIKey returns a new API key of the account and the key the owner must send as
+// a bearer token: its id followed by its secret. Only the hash of the secret is
+// kept. scope restricts the scopes of the requests made with the key, none if
+// empty, and the key never expires if expires is the zero time.
+func NewAPIKey(accountID, name, scope string, expires time.Time) (*APIKey, string, error) {
+	if accountID == "" {
+		return nil, "", tryerr.ErrNilUID
+	}
+	if name == "" || len(name) > 200 {
+		return nil, "", tryerr.ErrInvalidName
+	}
+	now := time.Now().UTC()
+	if !expires.IsZero() && !expires.After(now) {
+		return nil, "", tryerr.ErrInvalidExpiration
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	k := &APIKey{
+		ID:        APIKeyPrefix + hex.EncodeToString(id),
+		AccountID: accountID,
+		Name:      name,
+		Hash:      HashToken(secret),
+		Scope:     NormalizeScope(scope),
+		Created:   now,
+	}
+	if !expires.IsZero() {
+		k.Expires = dat.NullTimeFrom(expires.UTC())
+	}
+	return k, k.ID + apiKeySeparator + secret, nil
+}
+
+// IsAPIKey tells if the bearer token looks like an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ParseAPIKey returns the id and the secret of an API key sent as a bearer token,
+// or tryerr.ErrInvalidToken
+func ParseAPIKey(token string) (string, string, error) {
+	i := strings.Index(token, apiKeySeparator)
+	if !IsAPIKey(token) || i < 0 || i == len(token)-1 {
+		return "", "", tryerr.ErrInvalidToken
+	}
+	return token[:i], token[i+1:], nil
+}
+
+// Authenticate checks the secret against the one of the API key and that the key
+// has not expired. It returns tryerr.ErrInvalidToken otherwise.
+func (k *APIKey) Authenticate(secret string) error {
+	if subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(k.Hash)) != 1 {
+		return tryerr.ErrInvalidToken
+	}
+	if k.Expires.Valid && time.Now().UTC().After(k.Expires.Time) {
+		return tryerr.ErrInvalidToken
+	}
+	return nil
+}
+
+// Allows tells if the requests made with the API key can use the scope. Keys with
+// no scope restriction can use any scope.
+func (k *APIKey) Allows(scope string) bool {
+	return k.Scope == "" || HasScope(k.Scope, scope)
+}
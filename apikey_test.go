@@ -0,0 +1,41 @@
+package try6
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestAPIKey(t *testing.T) {
+	if _, _, err := NewAPIKey("account", "ci", "", time.Now().Add(-time.Hour)); err != tryerr.ErrInvalidExpiration {
+		t.Errorf("expired key: got %v", err)
+	}
+	k, key, err := NewAPIKey("account", "ci", "openid  email", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAPIKey(key) || IsAPIKey("eyJhbGciOiJSUzI1NiJ9.e30.x") || k.Scope != "openid email" || k.Expires.Valid {
+		t.Errorf("unexpected key %+v", k)
+	}
+	id, secret, err := ParseAPIKey(key)
+	if err != nil || id != k.ID {
+		t.Fatalf("ParseAPIKey: got %q, %v", id, err)
+	}
+	if err := k.Authenticate(secret); err != nil {
+		t.Errorf("Authenticate: %v", err)
+	}
+	if err := k.Authenticate(secret + "x"); err != tryerr.ErrInvalidToken {
+		t.Errorf("wrong secret: got %v", err)
+	}
+	if _, _, err := ParseAPIKey(k.ID); err != tryerr.ErrInvalidToken {
+		t.Errorf("key without secret: got %v", err)
+	}
+	if !k.Allows(ScopeEmail) || k.Allows(ScopeProfile) {
+		t.Error("Allows should follow the scope restriction")
+	}
+	k.Scope = ""
+	if !k.Allows(ScopeProfile) {
+		t.Error("keys without restriction allow any scope")
+	}
+}
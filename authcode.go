@@ -0,0 +1,135 @@
+package try6
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// GrantAuthorizationCode is the OAuth 2.0 grant of the clients that act on
+	// behalf of an account that logs in with the browser
+	GrantAuthorizationCode = "authorization_code"
+	// CodeChallengeS256 is the only PKCE code challenge method supported
+	CodeChallengeS256 = "S256"
+
+	// AMRPassword is the authentication method of the accounts that logged in with
+	// their password (RFC 8176)
+	AMRPassword = "pwd"
+	// AMROTP is the authentication method of the accounts that entered a one time
+	// code, from their authenticator or a recovery code
+	AMROTP = "otp"
+	// AMRMFA is the authentication method of the accounts that used more than one factor
+	AMRMFA = "mfa"
+)
+
+var (
+	// AuthCodeTTL is the time an authorization code can be exchanged since it is issued
+	AuthCodeTTL = 5 * time.Minute
+	// RegexpCodeVerifier checks that a PKCE code verifier, or a S256 code challenge,
+	// only has unreserved characters and 43 to 128 of them (RFC 7636 section 4.1)
+	RegexpCodeVerifier = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+)
+
+func init() {
+	SupportedGrants = append(SupportedGrants, GrantAuthorizationCode)
+}
+
+/*
+NewAuthCode returns a new authorization code issued to the client for the account
+and its secret. Only the hash of the secret is kept. redirectURI is the one sent in
+the authorization request, empty if none was sent, that must be sent again to
+exchange the code. scope is the space separated list of scopes requested and amr the
+methods the account authenticated with at authTime.
+
+The code challenge must be a S256 PKCE challenge.
+*/
+func NewAuthCode(clientID, accountID, redirectURI, scope, nonce, challenge string, amr []string, authTime time.Time) (*AuthCode, string, error) {
+	if clientID == "" || accountID == "" {
+		return nil, "", tryerr.ErrNilUID
+	}
+	if !RegexpCodeVerifier.MatchString(challenge) {
+		return nil, "", tryerr.ErrInvalidCodeChallenge
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now().UTC()
+	return &AuthCode{
+		Hash:          HashToken(secret),
+		ClientID:      clientID,
+		AccountID:     accountID,
+		RedirectURI:   redirectURI,
+		Scope:         NormalizeScope(scope),
+		Nonce:         nonce,
+		CodeChallenge: challenge,
+		AMR:           amr,
+		AuthTime:      authTime.UTC(),
+		Expires:       now.Add(AuthCodeTTL),
+		Created:       now,
+	}, secret, nil
+}
+
+// Exchange checks that the code can be exchanged for tokens by the client with the
+// redirect URI and PKCE code verifier given. It returns tryerr.ErrInvalidGrant if
+// the code was issued to another client, with another redirect URI or has expired
+// and tryerr.ErrInvalidCodeVerifier if the verifier does not match the challenge.
+func (c *AuthCode) Exchange(clientID, redirectURI, verifier string) error {
+	if c.ClientID != clientID || c.RedirectURI != redirectURI || time.Now().UTC().After(c.Expires) {
+		return tryerr.ErrInvalidGrant
+	}
+	return VerifyCodeChallenge(verifier, c.CodeChallenge)
+}
+
+// VerifyCodeChallenge checks the PKCE code verifier against the S256 challenge
+func VerifyCodeChallenge(verifier, challenge string) error {
+	if !RegexpCodeVerifier.MatchString(verifier) {
+		return tryerr.ErrInvalidCodeVerifier
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) != 1 {
+		return tryerr.ErrInvalidCodeVerifier
+	}
+	return nil
+}
+
+// NormalizeScope returns the space separated list of scopes without repeated or
+// extra spaces
+func NormalizeScope(scope string) string {
+	var scopes []string
+	for _, s := range splitScope(scope) {
+		if !StringList(scopes).Contains(s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// splitScope returns the scopes of a space separated list
+func splitScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// RedirectURI returns the URI the client must be redirected to after an
+// authorization request with the requested one. The requested URI must be one of
+// the client redirect URIs. If none is requested, the client must have only one.
+func (c *Client) RedirectURI(requested string) (string, error) {
+	if requested == "" {
+		if len(c.RedirectURIs) != 1 {
+			return "", tryerr.ErrInvalidRedirectURI
+		}
+		return c.RedirectURIs[0], nil
+	}
+	if !c.RedirectURIs.Contains(requested) {
+		return "", tryerr.ErrInvalidRedirectURI
+	}
+	return requested, nil
+}
@@ -0,0 +1,86 @@
+package try6
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+// challenge is the S256 PKCE challenge of verifier
+const (
+	verifier  = "dBjftJeZ4CVP-mJ92K1s_ZrCTNvQRuj2jAwnQmT5t8w"
+	challenge = "2RNhBMZTBaaO05XUxF2ygFmMeq1vM6SbSnK1LxgRvCM"
+)
+
+func TestAuthCodeExchange(t *testing.T) {
+	if _, _, err := NewAuthCode("client", "account", "", "", "", "short", nil, time.Now()); err != tryerr.ErrInvalidCodeChallenge {
+		t.Errorf("short challenge: got %v", err)
+	}
+	c, secret, err := NewAuthCode("client", "account", "https://app.example.com/cb", "openid  profile openid", "n", challenge, []string{AMRPassword}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Hash != HashToken(secret) || c.Scope != "openid profile" {
+		t.Errorf("unexpected code %+v", c)
+	}
+	if err := c.Exchange("client", "https://app.example.com/cb", verifier); err != nil {
+		t.Errorf("Exchange: %v", err)
+	}
+	if err := c.Exchange("other", "https://app.example.com/cb", verifier); err != tryerr.ErrInvalidGrant {
+		t.Errorf("Exchange by another client: got %v", err)
+	}
+	if err := c.Exchange("client", "", verifier); err != tryerr.ErrInvalidGrant {
+		t.Errorf("Exchange without redirect uri: got %v", err)
+	}
+	if err := c.Exchange("client", "https://app.example.com/cb", verifier[1:]+"x"); err != tryerr.ErrInvalidCodeVerifier {
+		t.Errorf("Exchange with a wrong verifier: got %v", err)
+	}
+	c.Expires = time.Now().Add(-time.Second)
+	if err := c.Exchange("client", "https://app.example.com/cb", verifier); err != tryerr.ErrInvalidGrant {
+		t.Errorf("Exchange of an expired code: got %v", err)
+	}
+}
+
+func TestClientRedirectURI(t *testing.T) {
+	c := &Client{RedirectURIs: StringList{"https://app.example.com/cb"}}
+	if r, err := c.RedirectURI(""); err != nil || r != "https://app.example.com/cb" {
+		t.Errorf("RedirectURI() = %q, %v", r, err)
+	}
+	if _, err := c.RedirectURI("https://app.example.com/cb/other"); err != tryerr.ErrInvalidRedirectURI {
+		t.Errorf("unregistered redirect uri: got %v", err)
+	}
+	c.RedirectURIs = append(c.RedirectURIs, "myapp://cb")
+	if _, err := c.RedirectURI(""); err != tryerr.ErrInvalidRedirectURI {
+		t.Errorf("omitted redirect uri with several registered: got %v", err)
+	}
+	if _, err := NewPublicClient("scope", "spa", []string{GrantClientCredentials}, nil, nil); err != tryerr.ErrUnsupportedGrant {
+		t.Errorf("public client with client credentials: got %v", err)
+	}
+	p, err := NewPublicClient("scope", "spa", []string{GrantAuthorizationCode}, []string{"myapp://cb"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MatchSecret(""); err != nil {
+		t.Errorf("public client MatchSecret: %v", err)
+	}
+	if _, err := p.NewSecret(); err != tryerr.ErrPublicClient {
+		t.Errorf("public client NewSecret: got %v", err)
+	}
+}
+
+func TestBrandingValidate(t *testing.T) {
+	b := DefaultBranding("tenant")
+	if err := b.Validate(); err != nil {
+		t.Errorf("default branding: %v", err)
+	}
+	b.PrimaryColor = "blue"
+	if err := b.Validate(); err != tryerr.ErrInvalidColor {
+		t.Errorf("invalid color: got %v", err)
+	}
+	b.PrimaryColor = "#000000"
+	b.LogoURL = "http://example.com/logo.png"
+	if err := b.Validate(); err != tryerr.ErrInvalidPicture {
+		t.Errorf("http logo: got %v", err)
+	}
+}
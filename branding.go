@@ -0,0 +1,42 @@
+package try6
+
+import (
+	"net/url"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+// RegexpColor checks that a color is in #rrggbb form
+var RegexpColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// DefaultBranding returns the look of the login page of the tenants that have not
+// set their own
+func DefaultBranding(tenantID string) *Branding {
+	return &Branding{
+		TenantID:        tenantID,
+		DisplayName:     "try6",
+		PrimaryColor:    "#2962ff",
+		BackgroundColor: "#f5f5f5",
+	}
+}
+
+// Validate checks that the display name is set and not longer than 100
+// characters, the colors are in #rrggbb form and the logo, if any, is an absolute
+// https URL
+func (b *Branding) Validate() error {
+	if b.DisplayName == "" || utf8.RuneCountInString(b.DisplayName) > 100 {
+		return tryerr.ErrInvalidName
+	}
+	if !RegexpColor.MatchString(b.PrimaryColor) || !RegexpColor.MatchString(b.BackgroundColor) {
+		return tryerr.ErrInvalidColor
+	}
+	if b.LogoURL != "" {
+		u, err := url.Parse(b.LogoURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || len(b.LogoURL) > 2048 {
+			return tryerr.ErrInvalidPicture
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+/*
+Package bulk imports and exports the accounts of a directory in CSV and JSON Lines.
+
+Imported files have one account per row with the fields email, name, password,
+password_hash and status. CSV files must start with a header naming the columns;
+unknown columns are ignored, so an exported file can be imported back. Rows with
+password_hash carry a hash made by another system (see try6.Account.SetPasswordHash).
+Exported files never include password hashes.
+*/
+package bulk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// FormatCSV selects comma separated values with a header row
+	FormatCSV = "csv"
+	// FormatJSONL selects JSON Lines, one JSON object per line
+	FormatJSONL = "jsonl"
+
+	// maxLineSize is the maximum size of a JSON Lines row
+	maxLineSize = 1 << 20
+)
+
+// Record is a row of an imported file
+type Record struct {
+	Line         int64  `json:"-"`
+	Email        string `json:"email"`
+	Name         string `json:"name"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	Status       string `json:"status,omitempty"`
+}
+
+// RowError is returned by Reader.Read when a row can not be parsed. Reading can
+// continue with the next row.
+type RowError struct {
+	Line int64
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Reader reads the records of an imported file. Read returns io.EOF at the end
+// of the file.
+type Reader interface {
+	Read() (*Record, error)
+}
+
+// NewReader returns a Reader of the given format
+func NewReader(r io.Reader, format string) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		return &csvReader{r: cr}, nil
+	case FormatJSONL:
+		s := bufio.NewScanner(r)
+		s.Buffer(make([]byte, 64*1024), maxLineSize)
+		return &jsonlReader{s: s}, nil
+	}
+	return nil, tryerr.ErrInvalidFormat
+}
+
+// FormatFromContentType returns the format matching the media type or "" if
+// there is none
+func FormatFromContentType(contentType string) string {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch mt {
+	case "text/csv":
+		return FormatCSV
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return FormatJSONL
+	}
+	return ""
+}
+
+// ContentType returns the media type of the format
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Account returns a new account with the data of the record after validating it
+func (rec *Record) Account() (*try6.Account, error) {
+	a := &try6.Account{Email: strings.TrimSpace(rec.Email), Name: strings.TrimSpace(rec.Name), Status: rec.Status}
+	if err := a.ValidateFields(); err != nil {
+		return nil, err
+	}
+	switch a.Status {
+	case "", try6.StatusUnverified, try6.StatusActive:
+	default:
+		return nil, tryerr.ErrInvalidStatus
+	}
+	var err error
+	switch {
+	case rec.PasswordHash != "":
+		err = a.SetPasswordHash(rec.PasswordHash)
+	case rec.Password != "":
+		err = a.SetPassword(rec.Password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+	line    int64
+}
+
+func (c *csvReader) Read() (*Record, error) {
+	if c.columns == nil {
+		header, err := c.r.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, fmt.Errorf("reading header: %v", err)
+		}
+		c.line++
+		c.columns = make(map[string]int, len(header))
+		for i, h := range header {
+			c.columns[strings.ToLower(strings.TrimSpace(h))] = i
+		}
+		if _, ok := c.columns["email"]; !ok {
+			return nil, fmt.Errorf("missing email column")
+		}
+	}
+	row, err := c.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	c.line++
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			return nil, &RowError{Line: c.line, Err: err}
+		}
+		return nil, err
+	}
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	return &Record{
+		Line:         c.line,
+		Email:        field("email"),
+		Name:         field("name"),
+		Password:     field("password"),
+		PasswordHash: field("password_hash"),
+		Status:       field("status"),
+	}, nil
+}
+
+type jsonlReader struct {
+	s    *bufio.Scanner
+	line int64
+}
+
+func (j *jsonlReader) Read() (*Record, error) {
+	for j.s.Scan() {
+		j.line++
+		b := j.s.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		rec := &Record{Line: j.line}
+		if err := json.Unmarshal(b, rec); err != nil {
+			return nil, &RowError{Line: j.line, Err: err}
+		}
+		return rec, nil
+	}
+	if err := j.s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
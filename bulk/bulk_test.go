@@ -0,0 +1,105 @@
+package bulk
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jllopis/try6"
+)
+
+func readAll(t *testing.T, format, in string) ([]*Record, []*RowError) {
+	r, err := NewReader(strings.NewReader(in), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recs []*Record
+	var errs []*RowError
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return recs, errs
+		}
+		if err != nil {
+			rerr, ok := err.(*RowError)
+			if !ok {
+				t.Fatalf("Read: %v", err)
+			}
+			errs = append(errs, rerr)
+			continue
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	in := "id,Email,name,password\n" +
+		"1,ana@example.com,Ana,firstpassword\n" +
+		"2,\"bad\"quote@example.com,Bad,firstpassword\n" +
+		"3,joan@example.com\n"
+	recs, errs := readAll(t, FormatCSV, in)
+	if len(recs) != 2 || len(errs) != 1 {
+		t.Fatalf("got %d records and %d errors", len(recs), len(errs))
+	}
+	if recs[0].Email != "ana@example.com" || recs[0].Password != "firstpassword" || recs[0].Line != 2 {
+		t.Errorf("unexpected record %+v", recs[0])
+	}
+	if errs[0].Line != 3 {
+		t.Errorf("error line = %d, want 3", errs[0].Line)
+	}
+	if recs[1].Name != "" || recs[1].Line != 4 {
+		t.Errorf("unexpected record %+v", recs[1])
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	in := `{"email":"ana@example.com","name":"Ana","password_hash":"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/","status":"active"}
+
+{"email":
+{"email":"joan@example.com","name":"Joan"}
+`
+	recs, errs := readAll(t, FormatJSONL, in)
+	if len(recs) != 2 || len(errs) != 1 || errs[0].Line != 3 || recs[1].Line != 4 {
+		t.Fatalf("got %+v records and %+v errors", recs, errs)
+	}
+	a, err := recs[0].Account()
+	if err != nil {
+		t.Fatalf("Account: %v", err)
+	}
+	if a.Status != try6.StatusActive || a.MatchPassword("password") != nil {
+		t.Errorf("unexpected account %+v", a)
+	}
+	if _, err := (&Record{Email: "ana@example.com", Name: "Ana", Status: "root"}).Account(); err == nil {
+		t.Error("Account accepted an invalid status")
+	}
+	if _, err := (&Record{Email: "ana", Name: "Ana"}).Account(); err == nil {
+		t.Error("Account accepted an invalid email")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	accounts := []*try6.Account{{ID: "1", Email: "ana@example.com", Name: "Ana", Password: "$2a$10$secret", Status: try6.StatusActive}}
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range accounts {
+			if err := w.Write(a); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), "secret") {
+			t.Errorf("%s export contains the password hash", format)
+		}
+		recs, errs := readAll(t, format, buf.String())
+		if len(recs) != 1 || len(errs) != 0 || recs[0].Email != "ana@example.com" {
+			t.Errorf("%s export can not be read back: %+v %+v", format, recs, errs)
+		}
+	}
+}
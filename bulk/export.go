@@ -0,0 +1,115 @@
+package bulk
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// ExportPageSize is the number of accounts loaded from the store at a time
+var ExportPageSize = store.MaxListLimit
+
+// exportRecord is the exported data of an account
+type exportRecord struct {
+	ID      string    `json:"id"`
+	Email   string    `json:"email"`
+	Name    string    `json:"name"`
+	Status  string    `json:"status"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+var csvHeader = []string{"id", "email", "name", "status", "created", "updated"}
+
+// Writer writes exported accounts. Flush must be called after the last one.
+type Writer interface {
+	Write(a *try6.Account) error
+	Flush() error
+}
+
+// NewWriter returns a Writer of the given format
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatJSONL:
+		return &jsonlWriter{e: json.NewEncoder(w)}, nil
+	}
+	return nil, tryerr.ErrInvalidFormat
+}
+
+// Export writes every account of the directory to w in the given format and
+// returns the number of accounts written
+func Export(sm store.Storer, directoryID string, w io.Writer, format string) (int64, error) {
+	ew, err := NewWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	q := &store.ListQuery{DirectoryID: directoryID, Limit: ExportPageSize}
+	for {
+		accounts, next, err := sm.ListAccounts(q)
+		if err != nil {
+			return n, err
+		}
+		for _, a := range accounts {
+			if err := ew.Write(a); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+	return n, ew.Flush()
+}
+
+func newExportRecord(a *try6.Account) *exportRecord {
+	return &exportRecord{ID: a.ID, Email: a.Email, Name: a.Name, Status: a.Status, Created: a.Created, Updated: a.Updated}
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (c *csvWriter) Write(a *try6.Account) error {
+	if !c.header {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.header = true
+	}
+	r := newExportRecord(a)
+	return c.w.Write([]string{r.ID, r.Email, r.Name, r.Status, r.Created.Format(time.RFC3339), r.Updated.Format(time.RFC3339)})
+}
+
+func (c *csvWriter) Flush() error {
+	if !c.header {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.header = true
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	e *json.Encoder
+}
+
+func (j *jsonlWriter) Write(a *try6.Account) error {
+	return j.e.Encode(newExportRecord(a))
+}
+
+func (j *jsonlWriter) Flush() error {
+	return nil
+}
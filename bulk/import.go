@@ -0,0 +1,105 @@
+package bulk
+
+import (
+	"io"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/store"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// BatchSize is the number of rows imported between two saves of the job progress
+var BatchSize int64 = 100
+
+// Import reads the accounts from r in the job format and saves them into the job
+// directory. Every row is validated and the ones that fail are recorded in the job
+// with the reason, the rest of the file is still imported. Plain text passwords
+// must comply with the directory password policy. Imported accounts are not sent
+// the email verification.
+//
+// The job must have been saved before. Its progress is saved every BatchSize rows
+// and when the import finishes. An error is returned only if the import could not
+// be finished.
+func Import(sm store.Storer, job *try6.ImportJob, r io.Reader) error {
+	log.LogI("Importing accounts", "pkg", "bulk", "func", "Import(store.Storer, *try6.ImportJob, io.Reader)", "job", job.ID, "directory", job.DirectoryID)
+	dir, err := sm.GetDirectoryByID(job.DirectoryID)
+	if err != nil {
+		return finish(sm, job, err)
+	}
+	policy, err := sm.GetPasswordPolicy(dir.ID)
+	if err != nil {
+		return finish(sm, job, err)
+	}
+	rd, err := NewReader(r, job.Format)
+	if err != nil {
+		return finish(sm, job, err)
+	}
+	job.Status = try6.ImportRunning
+	if err := sm.SaveImportJob(job); err != nil {
+		return err
+	}
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rerr, ok := err.(*RowError)
+			if !ok {
+				return finish(sm, job, err)
+			}
+			job.Total++
+			job.AddError(rerr.Line, "", rerr.Err)
+		} else {
+			job.Total++
+			if err := importRecord(sm, dir, policy, rec); err != nil {
+				job.AddError(rec.Line, rec.Email, err)
+			} else {
+				job.Imported++
+			}
+		}
+		if job.Total%BatchSize == 0 {
+			if err := sm.SaveImportJob(job); err != nil {
+				return err
+			}
+		}
+	}
+	return finish(sm, job, nil)
+}
+
+// importRecord validates the record and saves it as a new account of the directory.
+// Plain text passwords must comply with the directory password policy.
+func importRecord(sm store.Storer, dir *try6.Directory, policy *try6.PasswordPolicy, rec *Record) error {
+	if rec.PasswordHash == "" && rec.Password != "" {
+		if err := policy.CheckPassword(rec.Password); err != nil {
+			return err
+		}
+	}
+	a, err := rec.Account()
+	if err != nil {
+		return err
+	}
+	if err := a.NormalizeEmail(dir.CaseSensitiveEmail); err != nil {
+		return err
+	}
+	inUse, err := sm.EmailInUse(a.EmailKey, dir.CaseSensitiveEmail)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return tryerr.ErrDupEmail
+	}
+	return sm.SaveAccount(dir.ID, a)
+}
+
+// finish marks the job as finished and saves it. It returns the error that
+// stopped the import if any.
+func finish(sm store.Storer, job *try6.ImportJob, err error) error {
+	job.Finish(err)
+	log.LogI("Import finished", "pkg", "bulk", "func", "Import(store.Storer, *try6.ImportJob, io.Reader)", "job", job.ID, "status", job.Status, "total", job.Total, "imported", job.Imported, "failed", job.Failed)
+	if serr := sm.SaveImportJob(job); serr != nil {
+		return serr
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package try6
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// GrantClientCredentials is the OAuth 2.0 grant of the clients that act on
+	// their own behalf
+	GrantClientCredentials = "client_credentials"
+
+	clientSecretLen = 32
+)
+
+// SupportedGrants holds the grant types the token endpoint can issue tokens for
+var SupportedGrants = []string{GrantClientCredentials}
+
+// StringList is a list of strings stored as JSON text
+type StringList []string
+
+// Value implements the driver.Valuer interface
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		l = StringList{}
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (l *StringList) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	}
+	return fmt.Errorf("cannot scan %T into StringList", src)
+}
+
+// Contains reports whether s is in the list
+func (l StringList) Contains(s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+NewClient returns a new active OAuth client of the scope and its secret. Only the
+hash of the secret is kept in the client, so the secret must be handed to the
+client owner as it can not be recovered.
+
+The client is validated before it is returned.
+*/
+func NewClient(scopeID, name string, grants, redirectURIs, audiences []string) (*Client, string, error) {
+	now := time.Now().UTC()
+	c := &Client{
+		ScopeID:      scopeID,
+		Name:         name,
+		Grants:       grants,
+		RedirectURIs: redirectURIs,
+		Audiences:    audiences,
+		Status:       StatusActive,
+		Created:      now,
+		Updated:      now,
+	}
+	if err := c.Validate(); err != nil {
+		return nil, "", err
+	}
+	secret, err := c.NewSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	return c, secret, nil
+}
+
+// NewPublicClient returns a new active public OAuth client of the scope. Public
+// clients have no secret and must use PKCE with the authorization code grant.
+func NewPublicClient(scopeID, name string, grants, redirectURIs, audiences []string) (*Client, error) {
+	now := time.Now().UTC()
+	c := &Client{
+		ScopeID:      scopeID,
+		Name:         name,
+		Public:       true,
+		Grants:       grants,
+		RedirectURIs: redirectURIs,
+		Audiences:    audiences,
+		Status:       StatusActive,
+		Created:      now,
+		Updated:      now,
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewSecret replaces the client secret with a new random one and returns it.
+// Public clients have no secret and get tryerr.ErrPublicClient.
+func (c *Client) NewSecret() (string, error) {
+	if c.Public {
+		return "", tryerr.ErrPublicClient
+	}
+	b := make([]byte, clientSecretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	c.SecretHash = HashToken(secret)
+	return secret, nil
+}
+
+// MatchSecret checks the secret against the one of the client. It returns
+// tryerr.ErrInvalidClient if they do not match. Public clients are authenticated
+// without secret.
+func (c *Client) MatchSecret(secret string) error {
+	if c.Public && secret == "" {
+		return nil
+	}
+	if c.SecretHash == "" || subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(c.SecretHash)) != 1 {
+		return tryerr.ErrInvalidClient
+	}
+	return nil
+}
+
+// Validate checks that the client belongs to a scope, has a name and only uses
+// supported grants, and that its redirect URIs are absolute URIs without fragment.
+// Public clients can not use the client credentials grant.
+func (c *Client) Validate() error {
+	if c.ScopeID == "" {
+		return tryerr.ErrScopeNotFound
+	}
+	if c.Name == "" || len(c.Name) > 200 {
+		return tryerr.ErrInvalidName
+	}
+	for _, g := range c.Grants {
+		if !StringList(SupportedGrants).Contains(g) || (c.Public && g == GrantClientCredentials) {
+			return tryerr.ErrUnsupportedGrant
+		}
+	}
+	for _, r := range c.RedirectURIs {
+		u, err := url.Parse(r)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return tryerr.ErrInvalidRedirectURI
+		}
+	}
+	return nil
+}
+
+// AllowsGrant reports whether the client can use the grant type
+func (c *Client) AllowsGrant(grant string) bool {
+	return c.Grants.Contains(grant)
+}
+
+// TokenAudiences returns the audiences of a token requested by the client. requested
+// must be a subset of the client audiences, or empty to get all of them.
+func (c *Client) TokenAudiences(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return c.Audiences, nil
+	}
+	for _, a := range requested {
+		if !c.Audiences.Contains(a) {
+			return nil, tryerr.ErrInvalidAudience
+		}
+	}
+	return requested, nil
+}
@@ -0,0 +1,77 @@
+package try6
+
+import (
+	"testing"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestNewClient(t *testing.T) {
+	c, secret, err := NewClient("scope", "billing", []string{GrantClientCredentials}, nil, []string{"https://api.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == "" || c.SecretHash == secret {
+		t.Fatalf("secret %q stored as %q", secret, c.SecretHash)
+	}
+	if err := c.MatchSecret(secret); err != nil {
+		t.Errorf("MatchSecret: %v", err)
+	}
+	if err := c.MatchSecret(secret + "x"); err != tryerr.ErrInvalidClient {
+		t.Errorf("MatchSecret with a wrong secret: got %v", err)
+	}
+	if !c.AllowsGrant(GrantClientCredentials) || c.AllowsGrant("password") {
+		t.Errorf("AllowsGrant: unexpected grants %v", c.Grants)
+	}
+	if _, _, err := NewClient("scope", "x", []string{"password"}, nil, nil); err != tryerr.ErrUnsupportedGrant {
+		t.Errorf("unsupported grant: got %v", err)
+	}
+	if _, _, err := NewClient("scope", "x", nil, []string{"/callback"}, nil); err != tryerr.ErrInvalidRedirectURI {
+		t.Errorf("relative redirect uri: got %v", err)
+	}
+}
+
+func TestTokenAudiences(t *testing.T) {
+	c := &Client{Audiences: StringList{"a", "b"}}
+	if aud, err := c.TokenAudiences(nil); err != nil || len(aud) != 2 {
+		t.Errorf("TokenAudiences(nil) = %v, %v", aud, err)
+	}
+	if aud, err := c.TokenAudiences([]string{"b"}); err != nil || len(aud) != 1 || aud[0] != "b" {
+		t.Errorf("TokenAudiences(b) = %v, %v", aud, err)
+	}
+	if _, err := c.TokenAudiences([]string{"c"}); err != tryerr.ErrInvalidAudience {
+		t.Errorf("TokenAudiences(c): got %v", err)
+	}
+}
+
+func TestAccessToken(t *testing.T) {
+	key := NewKey("account")
+	key.ID = NewUUID()
+	key.TenantID = NewUUID()
+	c := &Client{ID: NewUUID()}
+	token, rec, err := NewAccessToken(key, c, c.ID, []string{"api"}, map[string]interface{}{"iss": "other", "plan": "pro"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.AccountID.Valid || rec.ClientID.String != c.ID {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	claims, err := ParseToken(token, func(kid string) (*Key, error) {
+		if kid != key.ID {
+			return nil, tryerr.ErrKeyNotFound
+		}
+		return key, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["jti"] != rec.ID || claims["sub"] != c.ID || claims["aud"] != "api" || claims["tid"] != key.TenantID || claims["plan"] != "pro" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+	if _, err := ParseToken(token+"x", func(string) (*Key, error) { return key, nil }); err != tryerr.ErrInvalidToken {
+		t.Errorf("tampered token: got %v", err)
+	}
+	if !ValidUUID(rec.ID) || ValidUUID("x") {
+		t.Error("ValidUUID")
+	}
+}
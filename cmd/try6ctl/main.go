@@ -0,0 +1,213 @@
+/*
+try6ctl is the command line tool to manage a try6 installation.
+
+Usage:
+
+	try6ctl accounts import --directory <id> [--format csv|jsonl] [file]
+	try6ctl accounts export --directory <id> [--format csv|jsonl] [--output file]
+	try6ctl version
+
+import reads the accounts from file, or the standard input if no file is given,
+and prints the import report. It exits with status 3 if some rows failed.
+export writes the accounts of the directory to the standard output unless an
+output file is given.
+
+The store connection and the password hashing are configured with the same
+environment variables as try6d: TRY6_STORE_HOST, TRY6_STORE_PORT, TRY6_STORE_NAME,
+TRY6_STORE_USER, TRY6_STORE_PASS, TRY6_HASH_ALGO and TRY6_HASH_COST.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/bulk"
+	"github.com/jllopis/try6/store"
+)
+
+var (
+	// BuildDate holds the date the binary was built. It is valued at compile time
+	BuildDate string
+	// Version holds the version number of the build. It is valued at compile time
+	Version string
+	// Revision holds the git revision of the binary. It is valued at compile time
+	Revision string
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "accounts":
+		if len(os.Args) < 3 {
+			usage()
+		}
+		switch os.Args[2] {
+		case "import":
+			os.Exit(importAccounts(os.Args[3:]))
+		case "export":
+			os.Exit(exportAccounts(os.Args[3:]))
+		}
+	case "version":
+		fmt.Printf("try6ctl %s (%s) built %s\n", Version, Revision, BuildDate)
+		return
+	}
+	usage()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  try6ctl accounts import --directory <id> [--format csv|jsonl] [file]
+  try6ctl accounts export --directory <id> [--format csv|jsonl] [--output file]
+  try6ctl version`)
+	os.Exit(2)
+}
+
+// importAccounts runs the accounts import command and returns the exit status
+func importAccounts(args []string) int {
+	fs := flag.NewFlagSet("accounts import", flag.ExitOnError)
+	directory := fs.String("directory", "", "id of the directory the accounts are imported into")
+	format := fs.String("format", "", "format of the file: csv or jsonl. Taken from the file extension if not set")
+	fs.Parse(args)
+	if *directory == "" || fs.NArg() > 1 {
+		usage()
+	}
+	in := os.Stdin
+	if fs.NArg() == 1 && fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return fail(err)
+		}
+		defer f.Close()
+		in = f
+		if *format == "" {
+			*format = formatFromName(f.Name())
+		}
+	}
+	if *format != bulk.FormatCSV && *format != bulk.FormatJSONL {
+		return fail(fmt.Errorf("unknown format %q, use --format csv or --format jsonl", *format))
+	}
+
+	sm, err := dial()
+	if err != nil {
+		return fail(err)
+	}
+	defer sm.Close()
+	if _, err := sm.GetDirectoryByID(*directory); err != nil {
+		return fail(err)
+	}
+	job := try6.NewImportJob(*directory, *format)
+	if err := sm.SaveImportJob(job); err != nil {
+		return fail(err)
+	}
+	err = bulk.Import(sm, job, in)
+	enc := json.NewEncoder(os.Stdout)
+	if jerr := enc.Encode(job); jerr != nil {
+		return fail(jerr)
+	}
+	switch {
+	case err != nil:
+		return fail(err)
+	case job.Failed > 0:
+		return 3
+	}
+	return 0
+}
+
+// exportAccounts runs the accounts export command and returns the exit status
+func exportAccounts(args []string) int {
+	fs := flag.NewFlagSet("accounts export", flag.ExitOnError)
+	directory := fs.String("directory", "", "id of the directory to export")
+	format := fs.String("format", "", "format of the output: csv or jsonl. Taken from the output file extension if not set, jsonl by default")
+	output := fs.String("output", "", "file to write the accounts to instead of the standard output")
+	fs.Parse(args)
+	if *directory == "" || fs.NArg() > 0 {
+		usage()
+	}
+	if *format == "" && *output != "" {
+		*format = formatFromName(*output)
+	}
+	if *format == "" {
+		*format = bulk.FormatJSONL
+	}
+	if *format != bulk.FormatCSV && *format != bulk.FormatJSONL {
+		return fail(fmt.Errorf("unknown format %q, use --format csv or --format jsonl", *format))
+	}
+
+	sm, err := dial()
+	if err != nil {
+		return fail(err)
+	}
+	defer sm.Close()
+	if _, err := sm.GetDirectoryByID(*directory); err != nil {
+		return fail(err)
+	}
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fail(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	n, err := bulk.Export(sm, *directory, out, *format)
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "%d accounts exported\n", n)
+	return 0
+}
+
+// dial connects to the store and configures the password hasher from the
+// environment
+func dial() (*store.DefaultStore, error) {
+	cost, _ := strconv.Atoi(os.Getenv("TRY6_HASH_COST"))
+	hasher, err := try6.NewHasher(os.Getenv("TRY6_HASH_ALGO"), cost)
+	if err != nil {
+		return nil, err
+	}
+	try6.DefaultHasher = hasher
+
+	port := 5432
+	if p, err := strconv.Atoi(os.Getenv("TRY6_STORE_PORT")); err == nil {
+		port = p
+	}
+	sm, err := store.NewDefaultStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := sm.Dial(store.Options{
+		"host":     os.Getenv("TRY6_STORE_HOST"),
+		"port":     port,
+		"name":     os.Getenv("TRY6_STORE_NAME"),
+		"user":     os.Getenv("TRY6_STORE_USER"),
+		"password": os.Getenv("TRY6_STORE_PASS"),
+	}); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+func formatFromName(name string) string {
+	switch filepath.Ext(name) {
+	case ".csv":
+		return bulk.FormatCSV
+	case ".jsonl", ".ndjson":
+		return bulk.FormatJSONL
+	}
+	return ""
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "try6ctl:", err)
+	return 1
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"os"
 	"os/signal"
 	"runtime"
@@ -11,8 +12,10 @@ import (
 
 	"bitbucket.org/jllopis/getconf"
 
+	"github.com/jllopis/try6"
 	"github.com/jllopis/try6/api"
 	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/mailer"
 	"github.com/jllopis/try6/store"
 	"github.com/labstack/echo"
 	mw "github.com/labstack/echo/middleware"
@@ -31,6 +34,18 @@ type Config struct {
 	StoreName string `getconf:"etcd app/try6/conf/storename, env TRY6_STORE_NAME, flag storename"`
 	StoreUser string `getconf:"etcd app/try6/conf/storeaccount, env TRY6_STORE_USER, flag storeuser"`
 	StorePass string `getconf:"etcd app/try6/conf/storepass, env TRY6_STORE_PASS, flag storepass"`
+	SmtpHost  string `getconf:"etcd app/try6/conf/smtphost, env TRY6_SMTP_HOST, flag smtphost"`
+	SmtpPort  int    `getconf:"etcd app/try6/conf/smtpport, env TRY6_SMTP_PORT, flag smtpport"`
+	SmtpUser  string `getconf:"etcd app/try6/conf/smtpuser, env TRY6_SMTP_USER, flag smtpuser"`
+	SmtpPass  string `getconf:"etcd app/try6/conf/smtppass, env TRY6_SMTP_PASS, flag smtppass"`
+	MailFrom  string `getconf:"etcd app/try6/conf/mailfrom, env TRY6_MAIL_FROM, flag mailfrom"`
+	MailDir   string `getconf:"etcd app/try6/conf/maildir, env TRY6_MAIL_DIR, flag maildir"`
+	MailTpls  string `getconf:"etcd app/try6/conf/mailtemplates, env TRY6_MAIL_TEMPLATES, flag mailtemplates"`
+	PublicURL string `getconf:"etcd app/try6/conf/publicurl, env TRY6_PUBLIC_URL, flag publicurl"`
+	MaxIPFail int    `getconf:"etcd app/try6/conf/maxipfail, env TRY6_MAX_IP_FAIL, flag maxipfail"`
+	SecretKey string `getconf:"etcd app/try6/conf/secretkey, env TRY6_SECRET_KEY, flag secretkey"`
+	HashAlgo  string `getconf:"etcd app/try6/conf/hashalgo, env TRY6_HASH_ALGO, flag hashalgo"`
+	HashCost  int    `getconf:"etcd app/try6/conf/hashcost, env TRY6_HASH_COST, flag hashcost"`
 }
 
 var (
@@ -45,14 +60,14 @@ var (
 	verbose bool
 )
 
-func init() {
+func main() {
+	// Parse the configuration here rather than in init so the tests of this
+	// package don't get their flags taken by getconf
 	//etcdURI := os.Getenv("TRY6_ETCD")
 	//config = getconf.New(&Config{}, "TRY6", true, etcdURI)
 	config = getconf.New(&Config{}, "TRY6", false, "")
 	config.Parse()
-}
 
-func main() {
 	// Setup log
 	debug := false
 	if v, err := config.GetBool("Verbose"); err == nil && v {
@@ -60,6 +75,24 @@ func main() {
 		debug = true
 		log.LogD("set log level to DebugLevel")
 	}
+	if v, err := config.GetInt("MaxIPFail"); err == nil && v != 0 {
+		try6.LoginIPThreshold = v
+	}
+	if k := config.GetString("SecretKey"); k != "" {
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(key) != 32 {
+			log.LogP("SecretKey must be a base64 encoded 32 bytes key")
+		}
+		try6.SecretKey = key
+	} else {
+		log.LogW("SecretKey not configured. MFA enrollment is disabled")
+	}
+	cost, _ := config.GetInt("HashCost")
+	hasher, err := try6.NewHasher(config.GetString("HashAlgo"), int(cost))
+	if err != nil {
+		log.LogP("Invalid password hashing configuration", "error", err.Error())
+	}
+	try6.DefaultHasher = hasher
 	// Setup storage
 	store, err := store.NewDefaultStore()
 	if err != nil {
@@ -70,6 +103,12 @@ func main() {
 	if err != nil {
 		log.LogP("Error dialing DefaultStore", "error", err.Error())
 	}
+	// the imports running when the server stopped lost their files
+	if n, err := store.FailInterruptedImportJobs(); err != nil {
+		log.LogE("Error failing interrupted import jobs", "error", err.Error())
+	} else if n > 0 {
+		log.LogW("Interrupted import jobs marked as failed", "count", n)
+	}
 	setupSignals(context.WithValue(context.Background(), "store", store.C.DB))
 
 	// Setup api port
@@ -100,33 +139,168 @@ func main() {
 		origins = []string{"*"}
 	}
 	log.LogD("setup cors", "allowed origins", origins)
-	apisrv.Use(cors.New(cors.Options{
+	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   origins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "OPTIONS", "DELETE"},
 		AllowCredentials: true,
 		Debug:            true,
-	}).Handler)
+	})
+	apisrv.Use(corsHandler.Handler)
 
-	setupAPIRoutes(apisrv, store)
+	setupAPIRoutes(apisrv, store, setupMailer())
+	// serve the OAuth 2.0 endpoints from /oauth2. Tokens are issued by the public URL.
+	if issuer := config.GetString("PublicURL"); issuer != "" {
+		try6.Issuer = issuer
+	}
+	// the token endpoints are called from the browser by the SPAs
+	oauth := server.Group("/oauth2")
+	oauth.Use(corsHandler.Handler)
+	setupOAuthRoutes(oauth, store)
+	// the discovery document is read by the SPAs too
+	wellKnown := server.Group("/.well-known")
+	wellKnown.Use(corsHandler.Handler)
+	setupWellKnownRoutes(wellKnown)
 	server.RunTLS(":"+port, config.GetString("SslCert"), config.GetString("SslKey"))
 }
 
 // setupAPIRoutes añade al router los puntos de acceso a los servicios ofrecidos
-func setupAPIRoutes(apisrv *echo.Group, storeManager store.Storer) {
+func setupAPIRoutes(apisrv *echo.Group, storeManager store.Storer, m *mailer.Mailer) {
 	// Tenants
 	log.LogD("seting up route", "path", "/tenants", "method", "POST")
-	apisrv.Post("/tenants", api.CreateTenant(storeManager))
+	apisrv.Post("/tenants", api.CreateTenant(storeManager, m))
 	log.LogD("seting up route", "path", "/tenants/:id/scopes", "method", "GET")
 	apisrv.Get("/tenants/:id/scopes", api.GetScopesByTenantID(storeManager))
+	log.LogD("seting up route", "path", "/tenants/:id/branding", "method", "GET")
+	apisrv.Get("/tenants/:id/branding", api.GetBranding(storeManager))
+	log.LogD("seting up route", "path", "/tenants/:id/branding", "method", "PUT")
+	apisrv.Put("/tenants/:id/branding", api.PutBranding(storeManager))
+	log.LogD("seting up route", "path", "/tenants/:id/registration_tokens", "method", "POST")
+	apisrv.Post("/tenants/:id/registration_tokens", api.CreateInitialAccessToken(storeManager))
+	log.LogD("seting up route", "path", "/tenants/:id/registration_tokens", "method", "GET")
+	apisrv.Get("/tenants/:id/registration_tokens", api.GetInitialAccessTokens(storeManager))
+	log.LogD("seting up route", "path", "/tenants/:id/registration_tokens/:token", "method", "DELETE")
+	apisrv.Delete("/tenants/:id/registration_tokens/:token", api.RevokeInitialAccessToken(storeManager))
+	// Status
+	for path, entity := range map[string]string{
+		"/accounts/:id/status":    try6.EntityAccount,
+		"/directories/:id/status": try6.EntityDirectory,
+		"/scopes/:id/status":      try6.EntityScope,
+		"/tenants/:id/status":     try6.EntityTenant,
+		"/keys/:id/status":        try6.EntityKey,
+		"/clients/:id/status":     try6.EntityClient,
+	} {
+		log.LogD("seting up route", "path", path, "method", "GET")
+		apisrv.Get(path, api.GetStatusChanges(storeManager, entity))
+		log.LogD("seting up route", "path", path, "method", "PUT")
+		apisrv.Put(path, api.ChangeStatus(storeManager, entity))
+	}
+	// Token revocation
+	for path, entity := range map[string]string{
+		"/accounts/:id/tokens": try6.EntityAccount,
+		"/scopes/:id/tokens":   try6.EntityScope,
+		"/tenants/:id/tokens":  try6.EntityTenant,
+	} {
+		log.LogD("seting up route", "path", path, "method", "DELETE")
+		apisrv.Delete(path, api.RevokeTokens(storeManager, entity))
+	}
+	// Scopes
+	log.LogD("seting up route", "path", "/scopes/:id/claims", "method", "GET")
+	apisrv.Get("/scopes/:id/claims", api.GetScopeClaims(storeManager))
+	log.LogD("seting up route", "path", "/scopes/:id/claims", "method", "PUT")
+	apisrv.Put("/scopes/:id/claims", api.PutScopeClaims(storeManager))
+	log.LogD("seting up route", "path", "/scopes/:id/exchanges", "method", "GET")
+	apisrv.Get("/scopes/:id/exchanges", api.GetScopeExchanges(storeManager))
+	log.LogD("seting up route", "path", "/scopes/:id/exchanges", "method", "PUT")
+	apisrv.Put("/scopes/:id/exchanges", api.PutScopeExchanges(storeManager))
+	log.LogD("seting up route", "path", "/scopes/:id/clients", "method", "POST")
+	apisrv.Post("/scopes/:id/clients", api.CreateClient(storeManager))
+	log.LogD("seting up route", "path", "/scopes/:id/clients", "method", "GET")
+	apisrv.Get("/scopes/:id/clients", api.GetClientsByScopeID(storeManager))
+	// Clients
+	log.LogD("seting up route", "path", "/clients/:id", "method", "GET")
+	apisrv.Get("/clients/:id", api.GetClient(storeManager))
+	log.LogD("seting up route", "path", "/clients/:id", "method", "PUT")
+	apisrv.Put("/clients/:id", api.UpdateClient(storeManager))
+	log.LogD("seting up route", "path", "/clients/:id/secret", "method", "POST")
+	apisrv.Post("/clients/:id/secret", api.RotateClientSecret(storeManager))
 	// Directory
 	//apisrv.Post("/directories", api.CreateDirectory(storeManager))
+	log.LogD("seting up route", "path", "/directories/:id", "method", "PUT")
+	apisrv.Put("/directories/:id", api.UpdateDirectory(storeManager))
+	log.LogD("seting up route", "path", "/directories/:id/accounts", "method", "POST")
+	apisrv.Post("/directories/:id/accounts", api.CreateAccount(storeManager, m))
+	log.LogD("seting up route", "path", "/directories/:id/accounts", "method", "GET")
+	apisrv.Get("/directories/:id/accounts", api.ListAccounts(storeManager))
+	// accounts:import and accounts:export, the router takes the suffix as the action
+	log.LogD("seting up route", "path", "/directories/:id/accounts:action", "method", "POST")
+	apisrv.Post("/directories/:id/accounts:action", api.AccountsAction(storeManager))
+	log.LogD("seting up route", "path", "/directories/:id/accounts:action", "method", "GET")
+	apisrv.Get("/directories/:id/accounts:action", api.AccountsAction(storeManager))
+	log.LogD("seting up route", "path", "/imports/:id", "method", "GET")
+	apisrv.Get("/imports/:id", api.GetImportJob(storeManager))
+	log.LogD("seting up route", "path", "/directories/:id/password-policy", "method", "GET")
+	apisrv.Get("/directories/:id/password-policy", api.GetPasswordPolicy(storeManager))
+	log.LogD("seting up route", "path", "/directories/:id/password-policy", "method", "PUT")
+	apisrv.Put("/directories/:id/password-policy", api.UpdatePasswordPolicy(storeManager))
 	// scopes
 	//apisrv.Post("/scopes", api.CreateScope(storeManager))
 	// accounts
-	//	apisrv.Get("/accounts", api.GetAllAccounts(mainManager))
-	//	apisrv.Get("/accounts/:uid", api.GetAccountByID(mainManager))
+	log.LogD("seting up route", "path", "/accounts", "method", "GET")
+	apisrv.Get("/accounts", api.ListAccounts(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id", "method", "GET")
+	apisrv.Get("/accounts/:id", api.GetAccount(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/profile", "method", "GET")
+	apisrv.Get("/accounts/:id/profile", api.GetAccountProfile(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/profile", "method", "PUT")
+	apisrv.Put("/accounts/:id/profile", api.UpdateAccountProfile(storeManager))
 	//	apisrv.Post("/accounts", api.New(mainManager))
 	//	apisrv.Put("/accounts/:uid", api.UpdateAccount(mainManager))
+	log.LogD("seting up route", "path", "/accounts/:id/password", "method", "PUT")
+	apisrv.Put("/accounts/:id/password", api.UpdateAccountPassword(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/api_keys", "method", "POST")
+	apisrv.Post("/accounts/:id/api_keys", api.CreateAPIKey(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/api_keys", "method", "GET")
+	apisrv.Get("/accounts/:id/api_keys", api.GetAPIKeys(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/api_keys/:key", "method", "DELETE")
+	apisrv.Delete("/accounts/:id/api_keys/:key", api.DeleteAPIKey(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/consents", "method", "GET")
+	apisrv.Get("/accounts/:id/consents", api.GetConsents(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/consents/:client", "method", "DELETE")
+	apisrv.Delete("/accounts/:id/consents/:client", api.RevokeConsent(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/unlock", "method", "POST")
+	apisrv.Post("/accounts/:id/unlock", api.UnlockAccount(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/mfa/totp", "method", "POST")
+	apisrv.Post("/accounts/:id/mfa/totp", api.EnrollTOTP(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/mfa/totp/confirm", "method", "POST")
+	apisrv.Post("/accounts/:id/mfa/totp/confirm", api.ConfirmTOTP(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/mfa/totp", "method", "DELETE")
+	apisrv.Delete("/accounts/:id/mfa/totp", api.DeleteTOTP(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/mfa/recovery-codes", "method", "GET")
+	apisrv.Get("/accounts/:id/mfa/recovery-codes", api.GetRecoveryCodes(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/mfa/recovery-codes", "method", "POST")
+	apisrv.Post("/accounts/:id/mfa/recovery-codes", api.RegenerateRecoveryCodes(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/customdata", "method", "GET")
+	apisrv.Get("/accounts/:id/customdata", api.GetCustomData(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/customdata", "method", "PUT")
+	apisrv.Put("/accounts/:id/customdata", api.PutCustomData(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/customdata", "method", "PATCH")
+	apisrv.Patch("/accounts/:id/customdata", api.PatchCustomData(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/customdata/:key", "method", "GET")
+	apisrv.Get("/accounts/:id/customdata/:key", api.GetCustomDataKey(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/customdata/:key", "method", "PUT")
+	apisrv.Put("/accounts/:id/customdata/:key", api.PutCustomDataKey(storeManager))
+	log.LogD("seting up route", "path", "/accounts/:id/customdata/:key", "method", "DELETE")
+	apisrv.Delete("/accounts/:id/customdata/:key", api.DeleteCustomDataKey(storeManager))
+	log.LogD("seting up route", "path", "/accounts/verify", "method", "GET")
+	apisrv.Get("/accounts/verify", api.VerifyEmailPage)
+	log.LogD("seting up route", "path", "/accounts/verify", "method", "POST")
+	apisrv.Post("/accounts/verify", api.VerifyAccount(storeManager))
+	log.LogD("seting up route", "path", "/accounts/password/reset", "method", "POST")
+	apisrv.Post("/accounts/password/reset", api.RequestPasswordReset(storeManager, m))
+	log.LogD("seting up route", "path", "/accounts/password/reset/confirm", "method", "GET")
+	apisrv.Get("/accounts/password/reset/confirm", api.PasswordResetPage)
+	log.LogD("seting up route", "path", "/accounts/password/reset/confirm", "method", "POST")
+	apisrv.Post("/accounts/password/reset/confirm", api.ConfirmPasswordReset(storeManager))
 	//	apisrv.Delete("/accounts/:uid", api.DeleteAccount(mainManager))
 	//	// Keys
 	//	apisrv.Get("/keys", api.GetAllKeys(mainManager))
@@ -136,8 +310,11 @@ func setupAPIRoutes(apisrv *echo.Group, storeManager store.Storer) {
 	//	// account jwt
 	//	//apisrv.Get("/accounts/:uid/tokens", http.HandlerFunc(apiCtx.GetAccountTokens))
 
-	//	// authentication
-	//	apisrv.Post("/authenticate", api.Authenticate(mainManager))
+	// authentication
+	log.LogD("seting up route", "path", "/authenticate", "method", "POST")
+	apisrv.Post("/authenticate", api.Authenticate(storeManager))
+	log.LogD("seting up route", "path", "/authenticate/mfa", "method", "POST")
+	apisrv.Post("/authenticate/mfa", api.AuthenticateMFA(storeManager))
 
 	//	// JWT
 	//	apisrv.Post("/jwt/token/:uid", api.NewJWTToken(mainManager))
@@ -146,6 +323,51 @@ func setupAPIRoutes(apisrv *echo.Group, storeManager store.Storer) {
 	//	apisrv.Get("/jwt/token/validate", api.ValidateToken(mainManager))
 }
 
+// setupOAuthRoutes añade al router los puntos de acceso OAuth 2.0
+func setupWellKnownRoutes(wellKnown *echo.Group) {
+	log.LogD("seting up route", "path", "/.well-known/openid-configuration", "method", "GET")
+	wellKnown.Get("/openid-configuration", api.OpenIDConfiguration)
+}
+
+func setupOAuthRoutes(oauth *echo.Group, storeManager store.Storer) {
+	log.LogD("seting up route", "path", "/oauth2/authorize", "method", "GET")
+	oauth.Get("/authorize", api.Authorize(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/authorize", "method", "POST")
+	oauth.Post("/authorize", api.AuthorizeLogin(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/token", "method", "POST")
+	oauth.Post("/token", api.Token(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/device_authorization", "method", "POST")
+	oauth.Post("/device_authorization", api.DeviceAuthorization(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/device", "method", "GET")
+	oauth.Get("/device", api.Device(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/device", "method", "POST")
+	oauth.Post("/device", api.DeviceLogin(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/tenants/:id/jwks", "method", "GET")
+	oauth.Get("/tenants/:id/jwks", api.JWKS(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/jwks", "method", "GET")
+	oauth.Get("/jwks", api.AllJWKS(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/register", "method", "POST")
+	oauth.Post("/register", api.Register(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/register/:id", "method", "GET")
+	oauth.Get("/register/:id", api.GetRegistration(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/register/:id", "method", "PUT")
+	oauth.Put("/register/:id", api.UpdateRegistration(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/register/:id", "method", "DELETE")
+	oauth.Delete("/register/:id", api.DeleteRegistration(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/userinfo", "method", "GET")
+	oauth.Get("/userinfo", api.UserInfo(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/userinfo", "method", "POST")
+	oauth.Post("/userinfo", api.UserInfo(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/consents", "method", "GET")
+	oauth.Get("/consents", api.AccountConsents(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/consents/:client", "method", "DELETE")
+	oauth.Delete("/consents/:client", api.RevokeAccountConsent(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/revoke", "method", "POST")
+	oauth.Post("/revoke", api.Revoke(storeManager))
+	log.LogD("seting up route", "path", "/oauth2/tenants/:id/revocations", "method", "GET")
+	oauth.Get("/tenants/:id/revocations", api.RevocationFeed(storeManager))
+}
+
 func defaultStoreOptions() store.Options {
 	dbPort := 5432
 	if p, err := config.GetInt("StorePort"); err == nil {
@@ -173,6 +395,31 @@ func defaultStoreOptions() store.Options {
 	return storeConfig
 }
 
+// setupMailer crea el servicio de envío de correo. Si se indica un maildir los
+// mensajes se guardan en él en lugar de enviarse por SMTP.
+func setupMailer() *mailer.Mailer {
+	var sender mailer.Sender
+	from := config.GetString("MailFrom")
+	switch {
+	case config.GetString("MailDir") != "":
+		s, err := mailer.NewMaildirSender(config.GetString("MailDir"), from)
+		if err != nil {
+			log.LogE("can't create maildir", "pkg", "main", "func", "setupMailer()", "error", err.Error())
+			break
+		}
+		sender = s
+	case config.GetString("SmtpHost") != "":
+		smtpPort := 25
+		if p, err := config.GetInt("SmtpPort"); err == nil && p != 0 {
+			smtpPort = int(p)
+		}
+		sender = mailer.NewSMTPSender(config.GetString("SmtpHost"), smtpPort, config.GetString("SmtpUser"), config.GetString("SmtpPass"), from)
+	default:
+		log.LogW("no mail sender configured. notifications will not be sent", "pkg", "main", "func", "setupMailer()")
+	}
+	return mailer.New(sender, &mailer.Templates{Dir: config.GetString("MailTpls")}, config.GetString("PublicURL"))
+}
+
 // setupSignals configura la captura de señales de sistema y actúa basándose en ellas
 func setupSignals(ctx context.Context) {
 	sc := make(chan os.Signal, 1)
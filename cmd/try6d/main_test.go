@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/api"
+	"github.com/jllopis/try6/mailer"
+)
+
+// TestMailedLinks checks that the links mailed to the accounts open a page of the
+// API routes, and that its form posts back to a route of the same path
+func TestMailedLinks(t *testing.T) {
+	server := echo.New()
+	m := mailer.New(nil, &mailer.Templates{}, "https://id.example.com")
+	setupAPIRoutes(server.Group("/api/v1"), nil, m)
+	for _, path := range []string{api.VerifyEmailPath, api.PasswordResetPath} {
+		u, err := url.Parse(m.Link(path, "secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest("GET", u.RequestURI(), nil)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `value="secret"`) {
+			t.Errorf("GET %s: got %d %s", u.RequestURI(), rec.Code, rec.Body)
+		}
+		req, _ = http.NewRequest("POST", u.Path, strings.NewReader("token="))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec = httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("POST %s without token: got %d %s", u.Path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// TestDiscovery checks that the discovery document is served and that every
+// endpoint it advertises is a route of the server
+func TestDiscovery(t *testing.T) {
+	defer func(issuer string) { try6.Issuer = issuer }(try6.Issuer)
+	try6.Issuer = "https://id.example.com"
+	server := echo.New()
+	setupWellKnownRoutes(server.Group("/.well-known"))
+	setupOAuthRoutes(server.Group("/oauth2"), nil)
+
+	req, _ := http.NewRequest("GET", "/.well-known/openid-configuration", nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d %s", rec.Code, rec.Body)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["issuer"] != try6.Issuer {
+		t.Errorf("issuer = %v", doc["issuer"])
+	}
+	routes := map[string]bool{}
+	for _, r := range server.Routes() {
+		routes[r.Method+" "+r.Path] = true
+	}
+	for field, method := range map[string]string{
+		"authorization_endpoint":        "GET",
+		"token_endpoint":                "POST",
+		"userinfo_endpoint":             "GET",
+		"jwks_uri":                      "GET",
+		"registration_endpoint":         "POST",
+		"revocation_endpoint":           "POST",
+		"device_authorization_endpoint": "POST",
+	} {
+		endpoint, _ := doc[field].(string)
+		if !strings.HasPrefix(endpoint, try6.Issuer+"/") {
+			t.Errorf("%s = %q, not under the issuer", field, endpoint)
+			continue
+		}
+		if path := strings.TrimPrefix(endpoint, try6.Issuer); !routes[method+" "+path] {
+			t.Errorf("%s: no route for %s %s", field, method, path)
+		}
+	}
+	grants, _ := doc["grant_types_supported"].([]interface{})
+	if len(grants) != len(try6.SupportedGrants) {
+		t.Errorf("grant_types_supported = %v", grants)
+	}
+}
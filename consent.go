@@ -0,0 +1,70 @@
+package try6
+
+import (
+	"strings"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+)
+
+const (
+	// TokenConsent is the kind of the tokens issued to an account that logged in
+	// with its password to ask for its consent to a third party client
+	TokenConsent = "consent"
+	// TokenConsentMFA is the kind of the consent tokens of the accounts that logged
+	// in with a second factor too
+	TokenConsentMFA = "consent_mfa"
+)
+
+// ConsentTTL is the time an account has to give its consent once logged in
+var ConsentTTL = 10 * time.Minute
+
+// NewConsent returns the consent of the account to the client for the scopes
+func NewConsent(accountID, clientID, scope string) *Consent {
+	now := time.Now().UTC()
+	return &Consent{
+		AccountID: accountID,
+		ClientID:  clientID,
+		Scope:     NormalizeScope(scope),
+		Created:   now,
+		Updated:   now,
+	}
+}
+
+// Covers tells if the consent has not been revoked and includes every scope given
+func (c *Consent) Covers(scope string) bool {
+	if c.Revoked.Valid {
+		return false
+	}
+	_, err := NarrowScope(c.Scope, scope)
+	return err == nil
+}
+
+// Grant adds the scopes to the consent. A revoked consent starts again with only
+// the scopes given.
+func (c *Consent) Grant(scope string) {
+	if c.Revoked.Valid {
+		c.Scope = ""
+		c.Revoked = dat.NullTime{}
+	}
+	c.Scope = NormalizeScope(strings.Join([]string{c.Scope, scope}, " "))
+	c.Updated = time.Now().UTC()
+}
+
+// ConsentTokenKind returns the kind of the consent token of an account that
+// authenticated with the methods given, so they can be recovered once it consents
+func ConsentTokenKind(amr []string) string {
+	if StringList(amr).Contains(AMRMFA) {
+		return TokenConsentMFA
+	}
+	return TokenConsent
+}
+
+// ConsentAMR returns the authentication methods of the account a consent token of
+// the kind given was issued to
+func ConsentAMR(kind string) []string {
+	if kind == TokenConsentMFA {
+		return []string{AMRPassword, AMROTP, AMRMFA}
+	}
+	return []string{AMRPassword}
+}
@@ -0,0 +1,60 @@
+package try6
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestConsentGrant(t *testing.T) {
+	c := NewConsent("account", "client", "openid  email")
+	if c.Scope != "openid email" {
+		t.Errorf("unexpected scope %q", c.Scope)
+	}
+	for scope, want := range map[string]bool{"": true, "email": true, "openid email": true, "profile": false, "openid profile": false} {
+		if got := c.Covers(scope); got != want {
+			t.Errorf("Covers(%q): got %v, want %v", scope, got, want)
+		}
+	}
+	c.Grant("profile email")
+	if c.Scope != "openid email profile" || !c.Covers("profile") {
+		t.Errorf("Grant: unexpected scope %q", c.Scope)
+	}
+
+	c.Revoked = dat.NullTimeFrom(time.Now())
+	if c.Covers("") {
+		t.Error("a revoked consent covers no scope")
+	}
+	c.Grant("openid")
+	if c.Revoked.Valid || c.Scope != "openid" || c.Covers("email") {
+		t.Errorf("Grant after revocation: got scope %q, revoked %v", c.Scope, c.Revoked.Valid)
+	}
+}
+
+func TestConsentTokenKind(t *testing.T) {
+	for _, amr := range [][]string{{AMRPassword}, {AMRPassword, AMROTP, AMRMFA}} {
+		if got := ConsentAMR(ConsentTokenKind(amr)); !reflect.DeepEqual(got, amr) {
+			t.Errorf("ConsentAMR(ConsentTokenKind(%v)): got %v", amr, got)
+		}
+	}
+}
+
+func TestDeviceCodeDeny(t *testing.T) {
+	c, _, err := NewDeviceCode("client", "openid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Deny("account"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Approve("account", []string{AMRPassword}, time.Now()); err != tryerr.ErrInvalidGrant {
+		t.Errorf("Approve after denial: got %v", err)
+	}
+	if err := c.Poll("client", time.Now().UTC()); err != tryerr.ErrConsentDenied {
+		t.Errorf("Poll after denial: got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package try6
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+
+	"github.com/lib/pq/hstore"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+var (
+	// CustomDataMaxKeys is the maximum number of keys of a custom data document
+	CustomDataMaxKeys = 100
+	// CustomDataMaxValueLen is the maximum length in bytes of a custom data value
+	CustomDataMaxValueLen = 4096
+	// CustomDataMaxSize is the maximum size in bytes of a custom data document,
+	// adding up keys and values
+	CustomDataMaxSize = 64 * 1024
+
+	// RegexpCustomDataKey matches the valid custom data keys
+	RegexpCustomDataKey = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+	// RegexpClaimName matches the valid claim names. Namespaced claims can be URIs.
+	RegexpClaimName = regexp.MustCompile(`^[A-Za-z0-9_.:/-]{1,256}$`)
+
+	// reservedClaims can not be set from custom data
+	reservedClaims = map[string]bool{
+		"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+		"azp": true, "scope": true, "client_id": true, "nonce": true, "auth_time": true, "acr": true,
+		"amr": true, "act": true, "may_act": true, "sid": true, "at_hash": true, "c_hash": true,
+		// profile claims of the account
+		"name": true, "given_name": true, "family_name": true, "middle_name": true,
+		"preferred_username": true, "email": true, "email_verified": true, "phone_number": true,
+		"phone_number_verified": true, "locale": true, "zoneinfo": true, "picture": true,
+		"updated_at": true,
+	}
+)
+
+// CustomData is a document of string keys and values. It is stored in a hstore
+// column.
+type CustomData map[string]string
+
+// Value implements the driver.Valuer interface
+func (d CustomData) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	h := hstore.Hstore{Map: make(map[string]sql.NullString, len(d))}
+	for k, v := range d {
+		h.Map[k] = sql.NullString{String: v, Valid: true}
+	}
+	// returned as a string as the query interpolation takes []byte as a list
+	v, err := h.Value()
+	if b, ok := v.([]byte); ok {
+		return string(b), err
+	}
+	return v, err
+}
+
+// Scan implements the sql.Scanner interface
+func (d *CustomData) Scan(src interface{}) error {
+	var h hstore.Hstore
+	if err := h.Scan(src); err != nil {
+		return err
+	}
+	if h.Map == nil {
+		*d = nil
+		return nil
+	}
+	*d = make(CustomData, len(h.Map))
+	for k, v := range h.Map {
+		if v.Valid {
+			(*d)[k] = v.String
+		}
+	}
+	return nil
+}
+
+// Validate checks the keys of the document and its size limits
+func (d CustomData) Validate() error {
+	if len(d) > CustomDataMaxKeys {
+		return tryerr.ErrCustomDataTooLarge
+	}
+	size := 0
+	for k, v := range d {
+		if !RegexpCustomDataKey.MatchString(k) {
+			return tryerr.ErrInvalidCustomDataKey
+		}
+		if len(v) > CustomDataMaxValueLen {
+			return tryerr.ErrCustomDataTooLarge
+		}
+		size += len(k) + len(v)
+	}
+	if size > CustomDataMaxSize {
+		return tryerr.ErrCustomDataTooLarge
+	}
+	return nil
+}
+
+// Patch applies the changes to the document. A nil value removes the key.
+func (d CustomData) Patch(changes map[string]*string) {
+	for k, v := range changes {
+		if v == nil {
+			delete(d, k)
+			continue
+		}
+		d[k] = *v
+	}
+}
+
+// ValidateClaims checks a claim mapping of a scope. Every custom data key must be
+// mapped to a valid claim name that is not one of the registered JWT and OpenID
+// Connect claims.
+func (d CustomData) ValidateClaims() error {
+	for k, claim := range d {
+		if !RegexpCustomDataKey.MatchString(k) || !RegexpClaimName.MatchString(claim) {
+			return tryerr.ErrInvalidCustomDataKey
+		}
+		if reservedClaims[claim] {
+			return tryerr.ErrReservedClaim
+		}
+	}
+	return nil
+}
+
+// Claims returns the values of the document exposed as token claims by the claim
+// mapping of a scope. Keys missing from the document are left out.
+func (d CustomData) Claims(mapping CustomData) map[string]interface{} {
+	claims := make(map[string]interface{}, len(mapping))
+	for k, claim := range mapping {
+		if v, ok := d[k]; ok && !reservedClaims[claim] {
+			claims[claim] = v
+		}
+	}
+	return claims
+}
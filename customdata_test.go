@@ -0,0 +1,54 @@
+package try6
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCustomDataValue(t *testing.T) {
+	d := CustomData{"plan": "pro", "quote": `a "b" \c`}
+	v, err := d.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(string); !ok {
+		t.Fatalf("Value returned %T, want string", v)
+	}
+	var got CustomData
+	if err := got.Scan([]byte(v.(string))); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["plan"] != "pro" || got["quote"] != d["quote"] {
+		t.Errorf("Scan = %v, want %v", got, d)
+	}
+}
+
+func TestCustomDataPatch(t *testing.T) {
+	plan := "team"
+	d := CustomData{"plan": "pro", "seats": "3"}
+	d.Patch(map[string]*string{"plan": &plan, "seats": nil})
+	if len(d) != 1 || d["plan"] != "team" {
+		t.Errorf("Patch = %v", d)
+	}
+	if err := (CustomData{"bad key": "x"}).Validate(); err == nil {
+		t.Error("Validate accepted an invalid key")
+	}
+	if err := (CustomData{"big": strings.Repeat("x", CustomDataMaxValueLen+1)}).Validate(); err == nil {
+		t.Error("Validate accepted a value too large")
+	}
+}
+
+func TestCustomDataClaims(t *testing.T) {
+	if err := (CustomData{"plan": "sub"}).ValidateClaims(); err == nil {
+		t.Error("ValidateClaims accepted a reserved claim")
+	}
+	mapping := CustomData{"plan": "https://example.com/plan", "missing": "m"}
+	if err := mapping.ValidateClaims(); err != nil {
+		t.Errorf("ValidateClaims: %v", err)
+	}
+	d := CustomData{"plan": "pro", "internal": "x"}
+	claims := d.Claims(mapping)
+	if len(claims) != 1 || claims["https://example.com/plan"] != "pro" {
+		t.Errorf("Claims = %v", claims)
+	}
+}
@@ -0,0 +1,173 @@
+package try6
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// GrantDeviceCode is the OAuth 2.0 grant of the clients that run on devices
+	// without a browser, such as kiosks and command line tools (RFC 8628)
+	GrantDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// DeviceCodePending is the status of a device code until the account approves it
+	DeviceCodePending = "pending"
+	// DeviceCodeApproved is the status of a device code approved by an account that
+	// has not been exchanged for tokens yet
+	DeviceCodeApproved = "approved"
+	// DeviceCodeUsed is the final status of a device code exchanged for tokens
+	DeviceCodeUsed = "used"
+	// DeviceCodeDenied is the final status of a device code the account did not
+	// consent to
+	DeviceCodeDenied = "denied"
+
+	// userCodeChars are the characters of the user codes: upper case consonants
+	// that can not be mistaken for one another (RFC 8628 section 6.1)
+	userCodeChars = "BCDFGHJKLMNPQRSTVWXZ"
+	// userCodeLen is the number of characters of a user code
+	userCodeLen = 8
+)
+
+var (
+	// DeviceCodeTTL is the time a device code can be approved and exchanged since
+	// it is issued
+	DeviceCodeTTL = 10 * time.Minute
+	// DevicePollInterval is the minimum number of seconds a device must wait between
+	// requests to the token endpoint
+	DevicePollInterval int64 = 5
+	// DeviceSlowDown is the number of seconds added to the interval of a device that
+	// polls too fast
+	DeviceSlowDown int64 = 5
+)
+
+func init() {
+	SupportedGrants = append(SupportedGrants, GrantDeviceCode)
+}
+
+// NewDeviceCode returns a new device code issued to the client for the scopes
+// requested, with its secret and the user code the account must enter in the
+// verification page. Only the hash of the secret is kept.
+func NewDeviceCode(clientID, scope string) (*DeviceCode, string, error) {
+	if clientID == "" {
+		return nil, "", tryerr.ErrNilUID
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	u, err := newUserCode()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC()
+	return &DeviceCode{
+		Hash:     HashToken(secret),
+		UserCode: u,
+		ClientID: clientID,
+		Scope:    NormalizeScope(scope),
+		Status:   DeviceCodePending,
+		Interval: DevicePollInterval,
+		Expires:  now.Add(DeviceCodeTTL),
+		Created:  now,
+	}, secret, nil
+}
+
+// newUserCode returns a random user code. Random bytes that would make some
+// characters more likely than others are discarded.
+func newUserCode() (string, error) {
+	limit := byte(256 / len(userCodeChars) * len(userCodeChars))
+	code := make([]byte, 0, userCodeLen)
+	b := make([]byte, userCodeLen)
+	for len(code) < userCodeLen {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		for _, c := range b {
+			if c < limit && len(code) < userCodeLen {
+				code = append(code, userCodeChars[int(c)%len(userCodeChars)])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// NormalizeUserCode returns the user code as it is kept: in upper case and without
+// the dashes and spaces the account may have typed
+func NormalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
+
+// FormatUserCode returns the user code split in two halves with a dash, as it is
+// shown to the account
+func FormatUserCode(code string) string {
+	if len(code) != userCodeLen {
+		return code
+	}
+	return code[:userCodeLen/2] + "-" + code[userCodeLen/2:]
+}
+
+// Approve marks the device code as approved by the account that authenticated at
+// authTime with the methods in amr. It returns tryerr.ErrInvalidGrant if the code
+// is no longer pending or has expired.
+func (c *DeviceCode) Approve(accountID string, amr []string, authTime time.Time) error {
+	if c.Status != DeviceCodePending || time.Now().UTC().After(c.Expires) {
+		return tryerr.ErrInvalidGrant
+	}
+	c.Status = DeviceCodeApproved
+	c.AccountID = dat.NullStringFrom(accountID)
+	c.AMR = amr
+	c.AuthTime = dat.NullTimeFrom(authTime.UTC())
+	return nil
+}
+
+// Deny marks the device code as denied by the account, that did not consent to
+// the client. It returns tryerr.ErrInvalidGrant if the code is no longer pending or
+// has expired.
+func (c *DeviceCode) Deny(accountID string) error {
+	if c.Status != DeviceCodePending || time.Now().UTC().After(c.Expires) {
+		return tryerr.ErrInvalidGrant
+	}
+	c.Status = DeviceCodeDenied
+	c.AccountID = dat.NullStringFrom(accountID)
+	return nil
+}
+
+// Poll records a request of the client to exchange the device code at now and
+// tells if the code can be exchanged. It returns tryerr.ErrInvalidGrant if the
+// code was issued to another client or has been used, tryerr.ErrExpiredToken if it
+// has expired, tryerr.ErrSlowDown if the client polls before its interval, that is
+// increased, tryerr.ErrAuthorizationPending until the account approves it and
+// tryerr.ErrConsentDenied if the account denied it.
+func (c *DeviceCode) Poll(clientID string, now time.Time) error {
+	if c.ClientID != clientID || c.Status == DeviceCodeUsed {
+		return tryerr.ErrInvalidGrant
+	}
+	if now.After(c.Expires) {
+		return tryerr.ErrExpiredToken
+	}
+	last := c.LastPoll
+	c.LastPoll = dat.NullTimeFrom(now)
+	if last.Valid && now.Sub(last.Time) < time.Duration(c.Interval)*time.Second {
+		c.Interval += DeviceSlowDown
+		return tryerr.ErrSlowDown
+	}
+	if c.Status == DeviceCodeDenied {
+		return tryerr.ErrConsentDenied
+	}
+	if c.Status != DeviceCodeApproved {
+		return tryerr.ErrAuthorizationPending
+	}
+	return nil
+}
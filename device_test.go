@@ -0,0 +1,53 @@
+package try6
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestDeviceCodePoll(t *testing.T) {
+	c, secret, err := NewDeviceCode("client", "openid  profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Hash != HashToken(secret) || c.Scope != "openid profile" || c.Status != DeviceCodePending || len(c.UserCode) != userCodeLen {
+		t.Errorf("unexpected device code %+v", c)
+	}
+	for _, r := range c.UserCode {
+		if !strings.ContainsRune(userCodeChars, r) {
+			t.Errorf("user code %q has character %q", c.UserCode, r)
+		}
+	}
+	if got := NormalizeUserCode(strings.ToLower(FormatUserCode(c.UserCode))); got != c.UserCode {
+		t.Errorf("NormalizeUserCode: got %q, want %q", got, c.UserCode)
+	}
+
+	now := time.Now().UTC()
+	if err := c.Poll("other", now); err != tryerr.ErrInvalidGrant {
+		t.Errorf("Poll by another client: got %v", err)
+	}
+	if err := c.Poll("client", now); err != tryerr.ErrAuthorizationPending {
+		t.Errorf("Poll: got %v", err)
+	}
+	if err := c.Poll("client", now.Add(time.Second)); err != tryerr.ErrSlowDown || c.Interval != DevicePollInterval+DeviceSlowDown {
+		t.Errorf("Poll too fast: got %v, interval %d", err, c.Interval)
+	}
+	if err := c.Approve("account", []string{AMRPassword}, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Approve("other", nil, now); err != tryerr.ErrInvalidGrant {
+		t.Errorf("Approve twice: got %v", err)
+	}
+	if err := c.Poll("client", now.Add(5*time.Second)); err != tryerr.ErrSlowDown {
+		t.Errorf("Poll before the new interval: got %v", err)
+	}
+	if err := c.Poll("client", now.Add(20*time.Second)); err != nil {
+		t.Errorf("Poll after approval: got %v", err)
+	}
+	if err := c.Poll("client", c.Expires.Add(time.Second)); err != tryerr.ErrExpiredToken {
+		t.Errorf("Poll after expiration: got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package try6
+
+import (
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+// MaxEmailLen is the maximum length of a normalized email address
+const MaxEmailLen = 254
+
+/*
+ParseEmail parses a bare RFC 5322 address, such as user@mail.example.co.uk, and
+returns it normalized. Addresses with a display name or comments are rejected.
+
+The domain is converted to its ASCII form, so internationalized domains are kept
+in punycode (user@xn--bcher-kva.example), and lowercased. The local part is kept
+as given; its case is folded by EmailKey when the directory policy says so.
+*/
+func ParseEmail(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	addr, err := mail.ParseAddress(address)
+	if err != nil || addr.Name != "" || strings.ContainsAny(address, "<>") {
+		return "", tryerr.ErrInvalidEmail
+	}
+	at := strings.LastIndex(addr.Address, "@")
+	if at <= 0 {
+		return "", tryerr.ErrInvalidEmail
+	}
+	local, domain := addr.Address[:at], addr.Address[at+1:]
+	if strings.HasPrefix(domain, "[") {
+		// domain literals are not accepted
+		return "", tryerr.ErrInvalidEmail
+	}
+	domain, err = idna.Lookup.ToASCII(domain)
+	if err != nil || !strings.Contains(domain, ".") {
+		return "", tryerr.ErrInvalidEmail
+	}
+	email := local + "@" + strings.ToLower(domain)
+	if len(email) > MaxEmailLen {
+		return "", tryerr.ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// EmailKey returns the form of a normalized email used to check that it is unique
+// and to find its account. The local part is lowercased unless the directory of the
+// account treats it as case sensitive.
+func EmailKey(email string, caseSensitive bool) string {
+	if caseSensitive {
+		return email
+	}
+	return strings.ToLower(email)
+}
+
+// NormalizeEmail replaces the account email with its normalized form and sets the
+// key used to look it up as for the case sensitivity of the account directory.
+func (account *Account) NormalizeEmail(caseSensitive bool) error {
+	email, err := ParseEmail(account.Email)
+	if err != nil {
+		return err
+	}
+	account.Email = email
+	account.EmailKey = EmailKey(email, caseSensitive)
+	return nil
+}
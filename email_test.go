@@ -0,0 +1,46 @@
+package try6
+
+import (
+	"testing"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestParseEmail(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      error
+	}{
+		{"user@mail.example.co.uk", "user@mail.example.co.uk", nil},
+		{" User.Name+tag@Example.COM ", "User.Name+tag@example.com", nil},
+		{"user@bücher.example", "user@xn--bcher-kva.example", nil},
+		{"user@BÜCHER.example", "user@xn--bcher-kva.example", nil},
+		{"user", "", tryerr.ErrInvalidEmail},
+		{"user@localhost", "", tryerr.ErrInvalidEmail},
+		{"User <user@example.com>", "", tryerr.ErrInvalidEmail},
+		{"user@[127.0.0.1]", "", tryerr.ErrInvalidEmail},
+		{"a@b@example.com", "", tryerr.ErrInvalidEmail},
+	}
+	for _, tt := range tests {
+		got, err := ParseEmail(tt.in)
+		if got != tt.want || err != tt.err {
+			t.Errorf("ParseEmail(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	a := &Account{Email: "Ana@Example.com"}
+	if err := a.NormalizeEmail(false); err != nil {
+		t.Fatal(err)
+	}
+	if a.Email != "Ana@example.com" || a.EmailKey != "ana@example.com" {
+		t.Errorf("case insensitive: got %q, %q", a.Email, a.EmailKey)
+	}
+	if err := a.NormalizeEmail(true); err != nil {
+		t.Fatal(err)
+	}
+	if a.EmailKey != "Ana@example.com" {
+		t.Errorf("case sensitive: got key %q", a.EmailKey)
+	}
+}
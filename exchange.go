@@ -0,0 +1,145 @@
+package try6
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// GrantTokenExchange is the OAuth 2.0 grant of the clients that exchange the
+	// access token of an account for a token to call another service on its behalf
+	// (RFC 8693)
+	GrantTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	// TokenTypeAccessToken identifies the access tokens in the token exchange
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	// TokenTypeJWT identifies the tokens in JWT format in the token exchange. Our
+	// access tokens are JWTs.
+	TokenTypeJWT = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+func init() {
+	SupportedGrants = append(SupportedGrants, GrantTokenExchange)
+}
+
+// ExchangeRule allows some clients to exchange the access tokens issued in a scope
+// for tokens for the audience. Clients lists the clients allowed, none if empty, and
+// Scopes the only scopes the exchanged tokens can have, any of the ones of the
+// exchanged token if empty.
+type ExchangeRule struct {
+	Audience string     `json:"audience"`
+	Clients  StringList `json:"clients,omitempty"`
+	Scopes   StringList `json:"scopes,omitempty"`
+}
+
+// ExchangeRules are the token exchanges allowed for the access tokens issued in a
+// scope, stored as JSON text
+type ExchangeRules []*ExchangeRule
+
+// Value implements the driver.Valuer interface
+func (rs ExchangeRules) Value() (driver.Value, error) {
+	if rs == nil {
+		rs = ExchangeRules{}
+	}
+	b, err := json.Marshal(rs)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (rs *ExchangeRules) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*rs = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, rs)
+	case string:
+		return json.Unmarshal([]byte(v), rs)
+	}
+	return fmt.Errorf("cannot scan %T into ExchangeRules", src)
+}
+
+// Validate checks that every rule has an audience, not repeated, at least one
+// client and that the clients and scopes are valid
+func (rs ExchangeRules) Validate() error {
+	seen := StringList{}
+	for _, r := range rs {
+		if r == nil || r.Audience == "" || seen.Contains(r.Audience) {
+			return tryerr.ErrInvalidAudience
+		}
+		seen = append(seen, r.Audience)
+		if len(r.Clients) == 0 {
+			return tryerr.ErrInvalidClient
+		}
+		for _, c := range r.Clients {
+			if !ValidUUID(c) {
+				return tryerr.ErrInvalidClient
+			}
+		}
+		for _, s := range r.Scopes {
+			if s == "" || strings.ContainsAny(s, " \t\n") {
+				return tryerr.ErrInvalidScope
+			}
+		}
+	}
+	return nil
+}
+
+// Allow checks that the client can exchange a token for one for the audience with
+// the scopes given. It returns tryerr.ErrInvalidAudience if no rule allows the
+// audience, tryerr.ErrInvalidClient if the rule does not list the client and
+// tryerr.ErrInvalidScope if it does not allow some of the scopes.
+func (rs ExchangeRules) Allow(clientID, audience, scope string) error {
+	for _, r := range rs {
+		if r.Audience != audience {
+			continue
+		}
+		if !r.Clients.Contains(clientID) {
+			return tryerr.ErrInvalidClient
+		}
+		if len(r.Scopes) > 0 {
+			for _, s := range splitScope(scope) {
+				if !r.Scopes.Contains(s) {
+					return tryerr.ErrInvalidScope
+				}
+			}
+		}
+		return nil
+	}
+	return tryerr.ErrInvalidAudience
+}
+
+// NewExchangedToken signs an access token for the audience that the client gets in
+// exchange for the subject token, whose claims are given, and returns it along with
+// its record. The token is for the subject of the exchanged one and records the
+// client in the act claim, on top of the delegation chain of the subject token. It
+// never outlives the subject token.
+func NewExchangedToken(key *Key, client *Client, subject jwt.MapClaims, audience string, extra map[string]interface{}) (string, *JWT, error) {
+	sub, _ := subject["sub"].(string)
+	if sub == "" {
+		return "", nil, tryerr.ErrInvalidToken
+	}
+	act := map[string]interface{}{"sub": client.ID}
+	if prev, ok := subject["act"]; ok {
+		act["act"] = prev
+	}
+	claims := map[string]interface{}{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["act"] = act
+	expires := time.Now().UTC().Add(AccessTokenTTL)
+	if exp, ok := subject["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(expires) {
+		expires = time.Unix(int64(exp), 0)
+	}
+	return newAccessToken(key, client, sub, []string{audience}, claims, expires)
+}
@@ -0,0 +1,72 @@
+package try6
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestExchangeRules(t *testing.T) {
+	client := NewUUID()
+	rules := ExchangeRules{
+		{Audience: "billing", Clients: StringList{client}, Scopes: StringList{"invoices:read"}},
+		{Audience: "search", Clients: StringList{client}},
+	}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		client, audience, scope string
+		err                     error
+	}{
+		{client, "billing", "invoices:read", nil},
+		{client, "billing", "invoices:read invoices:write", tryerr.ErrInvalidScope},
+		{NewUUID(), "billing", "invoices:read", tryerr.ErrInvalidClient},
+		{client, "search", "openid profile", nil},
+		{NewUUID(), "search", "openid profile", tryerr.ErrInvalidClient},
+		{client, "other", "", tryerr.ErrInvalidAudience},
+	} {
+		if err := rules.Allow(tt.client, tt.audience, tt.scope); err != tt.err {
+			t.Errorf("Allow(%q, %q): got %v, want %v", tt.audience, tt.scope, err, tt.err)
+		}
+	}
+	if err := (ExchangeRules{{Audience: "search"}}).Allow(client, "search", ""); err != tryerr.ErrInvalidClient {
+		t.Errorf("rule with no clients: got %v", err)
+	}
+	if err := (ExchangeRules{{Audience: "search"}}).Validate(); err != tryerr.ErrInvalidClient {
+		t.Errorf("no clients: got %v", err)
+	}
+	if err := append(rules, &ExchangeRule{Audience: "search", Clients: StringList{client}}).Validate(); err != tryerr.ErrInvalidAudience {
+		t.Errorf("repeated audience: got %v", err)
+	}
+	if err := (ExchangeRules{{Audience: "a", Clients: StringList{"x"}}}).Validate(); err != tryerr.ErrInvalidClient {
+		t.Errorf("invalid client: got %v", err)
+	}
+}
+
+func TestExchangedToken(t *testing.T) {
+	key := NewKey("account")
+	key.ID = NewUUID()
+	gateway := &Client{ID: NewUUID()}
+	exp := time.Now().Add(10 * time.Minute).Unix()
+	subject := jwt.MapClaims{"sub": "account", "exp": float64(exp), "act": map[string]interface{}{"sub": "edge"}}
+	token, rec, err := NewExchangedToken(key, gateway, subject, "billing", map[string]interface{}{"scope": "invoices:read", "act": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.AccountID.String != "account" || rec.Expires.Time.Unix() != exp {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	claims, err := ParseToken(token, func(string) (*Key, error) { return key, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	act, _ := claims["act"].(map[string]interface{})
+	prev, _ := act["act"].(map[string]interface{})
+	if claims["aud"] != "billing" || claims["sub"] != "account" || act["sub"] != gateway.ID || prev["sub"] != "edge" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+}
@@ -0,0 +1,395 @@
+package try6
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// HashBcrypt identifies the bcrypt password hasher
+	HashBcrypt = "bcrypt"
+	// HashScrypt identifies the scrypt password hasher
+	HashScrypt = "scrypt"
+	// HashArgon2id identifies the argon2id password hasher
+	HashArgon2id = "argon2id"
+
+	hashSaltLen = 16
+	hashKeyLen  = 32
+
+	// Limits of the hashes accepted so checking a stored or imported hash can not
+	// take too much memory or time. They are above the defaults of the known
+	// hashing libraries.
+	maxHashLen       = 255
+	maxHashSaltLen   = 64
+	maxHashKeyLen    = 64
+	maxHashMemory    = 256 << 20
+	maxBcryptCost    = 16
+	maxScryptLogN    = 20
+	maxScryptP       = 16
+	maxArgon2Time    = 16
+	maxArgon2Threads = 16
+	maxPBKDF2Rounds  = 2000000
+)
+
+/*
+Hasher hashes the secrets provided by the account owners (passwords and recovery
+codes) and checks them back. Every hasher encodes its algorithm and parameters in
+the hash, so the hasher of a stored hash is identified by its prefix and hashes
+made with different algorithms or parameters can live together in the store.
+*/
+type Hasher interface {
+	// Name returns the name of the algorithm
+	Name() string
+	// Identify reports whether the hash was made by this algorithm
+	Identify(hash string) bool
+	// Hash returns the encoded hash of the secret
+	Hash(secret []byte) (string, error)
+	// Compare checks the secret against the hash. It returns
+	// tryerr.ErrInvalidPassword if they do not match.
+	Compare(hash string, secret []byte) error
+	// Validate checks the hash is well formed and its parameters within the
+	// limits, without checking any secret. It returns tryerr.ErrUnknownHash or
+	// tryerr.ErrHashTooCostly otherwise.
+	Validate(hash string) error
+	// NeedsRehash reports whether the hash uses weaker parameters than the hasher
+	NeedsRehash(hash string) bool
+}
+
+var (
+	// DefaultHasher is the hasher used to hash new secrets. Stored hashes made with
+	// another algorithm or weaker parameters are upgraded on the next successful
+	// login.
+	DefaultHasher Hasher = &BcryptHasher{Cost: bcrypt.DefaultCost}
+
+	// hashers holds the hashers that can check stored hashes
+	hashers = []Hasher{&BcryptHasher{}, &ScryptHasher{}, &Argon2idHasher{}}
+)
+
+// NewHasher returns the hasher for the named algorithm with the given cost. A cost
+// of 0 selects the default parameters of the algorithm. For bcrypt the cost is the
+// bcrypt cost, for scrypt it is log2 of N and for argon2id it is the number of
+// passes over the memory. Costs whose hashes would exceed the limits accepted are
+// rejected.
+func NewHasher(name string, cost int) (Hasher, error) {
+	switch name {
+	case HashBcrypt, "":
+		if cost == 0 {
+			cost = bcrypt.DefaultCost
+		}
+		if cost < bcrypt.MinCost || cost > maxBcryptCost {
+			return nil, fmt.Errorf("invalid bcrypt cost %d", cost)
+		}
+		return &BcryptHasher{Cost: cost}, nil
+	case HashScrypt:
+		if cost == 0 {
+			cost = 15
+		}
+		h := &ScryptHasher{LogN: cost, R: 8, P: 1}
+		if cost < 10 || cost > maxScryptLogN || h.R > maxHashMemory>>7>>uint(cost) {
+			return nil, fmt.Errorf("invalid scrypt cost %d", cost)
+		}
+		return h, nil
+	case HashArgon2id:
+		if cost == 0 {
+			cost = 3
+		}
+		if cost < 1 || cost > maxArgon2Time {
+			return nil, fmt.Errorf("invalid argon2id cost %d", cost)
+		}
+		return &Argon2idHasher{Time: uint32(cost), Memory: 64 * 1024, Threads: 4}, nil
+	}
+	return nil, tryerr.ErrUnknownHash
+}
+
+// RegisterHasher adds a hasher to the ones used to check stored hashes. Hashers
+// registered later take precedence.
+func RegisterHasher(h Hasher) {
+	hashers = append([]Hasher{h}, hashers...)
+}
+
+// hasherFor returns the hasher that made the hash
+func hasherFor(hash string) (Hasher, error) {
+	for _, h := range hashers {
+		if h.Identify(hash) {
+			return h, nil
+		}
+	}
+	return nil, tryerr.ErrUnknownHash
+}
+
+// hashSecret returns the hash of a secret provided by the account owner made
+// with the DefaultHasher
+func hashSecret(secret []byte) (string, error) {
+	return DefaultHasher.Hash(secret)
+}
+
+// compareSecret checks the secret against a hash made by any known hasher
+func compareSecret(hash string, secret []byte) error {
+	h, err := hasherFor(hash)
+	if err != nil {
+		return err
+	}
+	return h.Compare(hash, secret)
+}
+
+// NeedsRehash reports whether the hash must be replaced by a new one made with the
+// DefaultHasher, either because it was made by another algorithm or because its
+// parameters are weaker.
+func NeedsRehash(hash string) bool {
+	if !DefaultHasher.Identify(hash) {
+		return true
+	}
+	return DefaultHasher.NeedsRehash(hash)
+}
+
+// BcryptHasher hashes secrets with bcrypt. Hashes look like $2a$10$...
+type BcryptHasher struct {
+	Cost int
+}
+
+// Name returns the name of the algorithm
+func (b *BcryptHasher) Name() string { return HashBcrypt }
+
+// Identify reports whether the hash is a bcrypt hash
+func (b *BcryptHasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// Hash returns the bcrypt hash of the secret
+func (b *BcryptHasher) Hash(secret []byte) (string, error) {
+	h, err := bcrypt.GenerateFromPassword(secret, b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// Compare checks the secret against the bcrypt hash
+func (b *BcryptHasher) Compare(hash string, secret []byte) error {
+	if err := b.Validate(hash); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), secret); err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return tryerr.ErrInvalidPassword
+		}
+		return err
+	}
+	return nil
+}
+
+// Validate checks the bcrypt hash and its cost
+func (b *BcryptHasher) Validate(hash string) error {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return tryerr.ErrUnknownHash
+	}
+	if cost > maxBcryptCost {
+		return tryerr.ErrHashTooCostly
+	}
+	return nil
+}
+
+// NeedsRehash reports whether the hash cost is lower than the hasher one
+func (b *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	want := b.Cost
+	if want == 0 {
+		want = bcrypt.DefaultCost
+	}
+	return cost < want
+}
+
+// ScryptHasher hashes secrets with scrypt. Hashes look like
+// $scrypt$ln=15,r=8,p=1$<salt>$<key> with salt and key in unpadded base64.
+type ScryptHasher struct {
+	LogN int
+	R    int
+	P    int
+}
+
+// Name returns the name of the algorithm
+func (s *ScryptHasher) Name() string { return HashScrypt }
+
+// Identify reports whether the hash is a scrypt hash
+func (s *ScryptHasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$scrypt$")
+}
+
+// Hash returns the scrypt hash of the secret
+func (s *ScryptHasher) Hash(secret []byte) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key(secret, salt, 1<<uint(s.LogN), s.R, s.P, hashKeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", s.LogN, s.R, s.P, b64(salt), b64(key)), nil
+}
+
+// Compare checks the secret against the scrypt hash
+func (s *ScryptHasher) Compare(hash string, secret []byte) error {
+	p, salt, key, err := s.decode(hash)
+	if err != nil {
+		return err
+	}
+	k, err := scrypt.Key(secret, salt, 1<<uint(p.LogN), p.R, p.P, len(key))
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(k, key) != 1 {
+		return tryerr.ErrInvalidPassword
+	}
+	return nil
+}
+
+// Validate checks the scrypt hash and its parameters
+func (s *ScryptHasher) Validate(hash string) error {
+	_, _, _, err := s.decode(hash)
+	return err
+}
+
+// NeedsRehash reports whether any of the hash parameters is lower than the hasher ones
+func (s *ScryptHasher) NeedsRehash(hash string) bool {
+	p, _, _, err := s.decode(hash)
+	if err != nil {
+		return true
+	}
+	return p.LogN < s.LogN || p.R < s.R || p.P < s.P
+}
+
+func (s *ScryptHasher) decode(hash string) (*ScryptHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[1] != HashScrypt {
+		return nil, nil, nil, tryerr.ErrUnknownHash
+	}
+	p := &ScryptHasher{}
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &p.LogN, &p.R, &p.P); err != nil || p.LogN < 1 || p.R < 1 || p.P < 1 {
+		return nil, nil, nil, tryerr.ErrUnknownHash
+	}
+	// scrypt needs 128 * N * r bytes of memory
+	if p.LogN > maxScryptLogN || p.P > maxScryptP || p.R > maxHashMemory>>7>>uint(p.LogN) {
+		return nil, nil, nil, tryerr.ErrHashTooCostly
+	}
+	salt, key, err := decodeSaltKey(parts[3], parts[4])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return p, salt, key, nil
+}
+
+// Argon2idHasher hashes secrets with argon2id. Hashes use the PHC string format
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key> with salt and key in unpadded base64.
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// Name returns the name of the algorithm
+func (a *Argon2idHasher) Name() string { return HashArgon2id }
+
+// Identify reports whether the hash is an argon2id hash
+func (a *Argon2idHasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// Hash returns the argon2id hash of the secret
+func (a *Argon2idHasher) Hash(secret []byte) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(secret, salt, a.Time, a.Memory, a.Threads, hashKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Time, a.Threads, b64(salt), b64(key)), nil
+}
+
+// Compare checks the secret against the argon2id hash
+func (a *Argon2idHasher) Compare(hash string, secret []byte) error {
+	p, salt, key, err := a.decode(hash)
+	if err != nil {
+		return err
+	}
+	k := argon2.IDKey(secret, salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(k, key) != 1 {
+		return tryerr.ErrInvalidPassword
+	}
+	return nil
+}
+
+// Validate checks the argon2id hash and its parameters
+func (a *Argon2idHasher) Validate(hash string) error {
+	_, _, _, err := a.decode(hash)
+	return err
+}
+
+// NeedsRehash reports whether any of the hash parameters is lower than the hasher ones
+func (a *Argon2idHasher) NeedsRehash(hash string) bool {
+	p, _, _, err := a.decode(hash)
+	if err != nil {
+		return true
+	}
+	return p.Time < a.Time || p.Memory < a.Memory || p.Threads < a.Threads
+}
+
+func (a *Argon2idHasher) decode(hash string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return nil, nil, nil, tryerr.ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, tryerr.ErrUnknownHash
+	}
+	p := &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil || p.Memory < 1 || p.Time < 1 || p.Threads < 1 {
+		return nil, nil, nil, tryerr.ErrUnknownHash
+	}
+	// the memory is given in KiB
+	if p.Memory > maxHashMemory>>10 || p.Time > maxArgon2Time || p.Threads > maxArgon2Threads {
+		return nil, nil, nil, tryerr.ErrHashTooCostly
+	}
+	salt, key, err := decodeSaltKey(parts[4], parts[5])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return p, salt, key, nil
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, hashSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func b64(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+func decodeSaltKey(s, k string) ([]byte, []byte, error) {
+	salt, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, nil, tryerr.ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(k)
+	if err != nil || len(key) == 0 || len(salt) > maxHashSaltLen || len(key) > maxHashKeyLen {
+		return nil, nil, tryerr.ErrUnknownHash
+	}
+	return salt, key, nil
+}
@@ -0,0 +1,51 @@
+package try6
+
+import "testing"
+
+func TestHashers(t *testing.T) {
+	for _, h := range []Hasher{
+		&BcryptHasher{Cost: 4},
+		&ScryptHasher{LogN: 10, R: 8, P: 1},
+		&Argon2idHasher{Time: 1, Memory: 1024, Threads: 1},
+	} {
+		hash, err := h.Hash([]byte("firstpassword"))
+		if err != nil {
+			t.Fatalf("%s: Hash: %v", h.Name(), err)
+		}
+		if !h.Identify(hash) {
+			t.Errorf("%s: hash %q not identified", h.Name(), hash)
+		}
+		if err := compareSecret(hash, []byte("firstpassword")); err != nil {
+			t.Errorf("%s: compareSecret: %v", h.Name(), err)
+		}
+		if err := compareSecret(hash, []byte("wrongpassword")); err == nil {
+			t.Errorf("%s: compareSecret accepted a wrong password", h.Name())
+		}
+		if h.NeedsRehash(hash) {
+			t.Errorf("%s: NeedsRehash of its own hash", h.Name())
+		}
+	}
+}
+
+func TestRehashPassword(t *testing.T) {
+	defer func(h Hasher) { DefaultHasher = h }(DefaultHasher)
+	DefaultHasher = &BcryptHasher{Cost: 4}
+	a, err := NewAccount("test@example.com", "test", "firstpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := a.PasswordChanged
+	if ok, _ := a.RehashPassword("firstpassword"); ok {
+		t.Error("RehashPassword with unchanged parameters")
+	}
+	DefaultHasher = &Argon2idHasher{Time: 1, Memory: 1024, Threads: 1}
+	if ok, err := a.RehashPassword("firstpassword"); !ok || err != nil {
+		t.Fatalf("RehashPassword: %v %v", ok, err)
+	}
+	if !DefaultHasher.Identify(a.Password) || a.PasswordChanged != changed {
+		t.Errorf("unexpected rehash result %q", a.Password)
+	}
+	if err := a.MatchPassword("firstpassword"); err != nil {
+		t.Errorf("MatchPassword: %v", err)
+	}
+}
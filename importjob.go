@@ -0,0 +1,90 @@
+package try6
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+)
+
+const (
+	// ImportPending is the status of an import job waiting to be run
+	ImportPending = "pending"
+	// ImportRunning is the status of an import job in progress
+	ImportRunning = "running"
+	// ImportDone is the status of a finished import job. Some rows may have failed.
+	ImportDone = "done"
+	// ImportFailed is the status of an import job that could not be finished
+	ImportFailed = "failed"
+)
+
+var (
+	// ImportErrorsLimit is the maximum number of failed rows recorded in an import
+	// job. Rows failed after it are only counted.
+	ImportErrorsLimit = 1000
+)
+
+// ImportError describes a row that could not be imported. Line is the line
+// number of the row in the imported file.
+type ImportError struct {
+	Line  int64  `json:"line"`
+	Email string `json:"email,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportErrors is the list of rows that failed in an import job. It is stored as
+// JSON text.
+type ImportErrors []ImportError
+
+// Value implements the driver.Valuer interface
+func (e ImportErrors) Value() (driver.Value, error) {
+	if len(e) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (e *ImportErrors) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, e)
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	}
+	return fmt.Errorf("cannot scan %T into ImportErrors", src)
+}
+
+// NewImportJob returns a pending import job for the directory
+func NewImportJob(directoryID, format string) *ImportJob {
+	now := time.Now().UTC()
+	return &ImportJob{DirectoryID: directoryID, Format: format, Status: ImportPending, Created: now, Updated: now}
+}
+
+// AddError records a failed row in the job
+func (j *ImportJob) AddError(line int64, email string, err error) {
+	j.Failed++
+	if len(j.Errors) < ImportErrorsLimit {
+		j.Errors = append(j.Errors, ImportError{Line: line, Email: email, Error: err.Error()})
+	}
+}
+
+// Finish marks the job as finished. If err is not nil the job is marked as
+// failed and err is recorded with line 0.
+func (j *ImportJob) Finish(err error) {
+	j.Status = ImportDone
+	if err != nil {
+		j.Status = ImportFailed
+		j.Errors = append(j.Errors, ImportError{Error: err.Error()})
+	}
+	j.Finished = dat.NullTimeFrom(time.Now().UTC())
+}
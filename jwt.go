@@ -0,0 +1,118 @@
+package try6
+
+import (
+	"encoding/base64"
+	"math/big"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+var (
+	// Issuer is the iss claim of the tokens issued. It is the public URL of the
+	// service.
+	Issuer = "try6"
+	// AccessTokenTTL is the time an access token is valid since it is issued
+	AccessTokenTTL = time.Hour
+)
+
+// NewAccessToken signs an access token for the client with the key and returns it
+// along with its record. subject is the client itself for the client credentials
+// grant or the account the client acts for. Extra claims can not replace the
+// registered ones.
+func NewAccessToken(key *Key, client *Client, subject string, audiences []string, extra map[string]interface{}) (string, *JWT, error) {
+	return newAccessToken(key, client, subject, audiences, extra, time.Now().UTC().Add(AccessTokenTTL))
+}
+
+// newAccessToken signs an access token that expires at the time given
+func newAccessToken(key *Key, client *Client, subject string, audiences []string, extra map[string]interface{}, expires time.Time) (string, *JWT, error) {
+	now := time.Now().UTC()
+	t := &JWT{
+		ID:            NewUUID(),
+		SigningMethod: jwt.SigningMethodRS256.Alg(),
+		ClientID:      dat.NullStringFrom(client.ID),
+		TenantID:      key.TenantID,
+		Expires:       dat.NullTimeFrom(expires.UTC()),
+		Status:        StatusActive,
+		Created:       now,
+	}
+	if subject != client.ID {
+		t.AccountID = dat.NullStringFrom(subject)
+	}
+	claims := jwt.MapClaims{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["iss"] = Issuer
+	claims["sub"] = subject
+	claims["iat"] = now.Unix()
+	claims["exp"] = t.Expires.Time.Unix()
+	claims["jti"] = t.ID
+	claims["client_id"] = client.ID
+	claims["tid"] = key.TenantID
+	switch len(audiences) {
+	case 0:
+	case 1:
+		claims["aud"] = audiences[0]
+	default:
+		claims["aud"] = audiences
+	}
+	signed, err := key.Sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, t, nil
+}
+
+// Sign returns the claims signed with the private key using RS256. The key id is
+// set in the kid header.
+func (k *Key) Sign(claims jwt.MapClaims) (string, error) {
+	priv, err := jwt.ParseRSAPrivateKeyFromPEM(k.PrivKey)
+	if err != nil {
+		return "", err
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = k.ID
+	return t.SignedString(priv)
+}
+
+// JWK returns the public key as a JSON Web Key
+func (k *Key) JWK() (map[string]interface{}, error) {
+	pub, err := jwt.ParseRSAPublicKeyFromPEM(k.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": jwt.SigningMethodRS256.Alg(),
+		"kid": k.ID,
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}, nil
+}
+
+// ParseToken verifies the signature, expiration and issuer of a token signed by
+// one of our keys and returns its claims. key returns the key with the given id.
+// Any failure is returned as tryerr.ErrInvalidToken.
+func ParseToken(token string, key func(kid string) (*Key, error)) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, tryerr.ErrInvalidToken
+		}
+		kid, _ := t.Header["kid"].(string)
+		k, err := key(kid)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.ParseRSAPublicKeyFromPEM(k.PubKey)
+	})
+	if err != nil || !claims.VerifyIssuer(Issuer, true) {
+		return nil, tryerr.ErrInvalidToken
+	}
+	return claims, nil
+}
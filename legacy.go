@@ -0,0 +1,332 @@
+package try6
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+/*
+Legacy hashers check the password hashes of accounts imported from other systems.
+The hash is stored as is in Account.Password and identified by its tag:
+
+- Salted SHA-256: {SSHA256}<base64(sha256(password + salt) + salt)>
+
+- PBKDF2 in passlib format: $pbkdf2-sha256$<rounds>$<salt>$<key> with salt and key
+in adapted base64 ('.' instead of '+', no padding). The sha1 and sha512 variants
+are also accepted.
+
+- PBKDF2 in Django format: pbkdf2_sha256$<rounds>$<salt>$<base64 key>
+
+- MD5-crypt: $1$<salt>$<checksum>
+
+Legacy hashes always need a rehash, so they are replaced by a hash of the
+DefaultHasher on the first successful login of the account.
+*/
+
+const (
+	// HashSSHA256 identifies the salted SHA-256 legacy hasher
+	HashSSHA256 = "ssha256"
+	// HashPBKDF2 identifies the PBKDF2 legacy hasher
+	HashPBKDF2 = "pbkdf2"
+	// HashMD5Crypt identifies the MD5-crypt legacy hasher
+	HashMD5Crypt = "md5-crypt"
+
+	ssha256Tag  = "{SSHA256}"
+	md5CryptTag = "$1$"
+	itoa64      = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+func init() {
+	hashers = append(hashers, &SSHA256Hasher{}, &PBKDF2Hasher{}, &MD5CryptHasher{})
+}
+
+// SetPasswordHash sets a hash made by another system as the account password. It
+// must be in one of the formats of the known hashers, otherwise
+// tryerr.ErrUnknownHash is returned and the account is left untouched. Hashes with
+// parameters that exceed the limits get tryerr.ErrHashTooCostly.
+func (account *Account) SetPasswordHash(hash string) error {
+	if len(hash) > maxHashLen {
+		return tryerr.ErrUnknownHash
+	}
+	h, err := hasherFor(hash)
+	if err != nil {
+		return err
+	}
+	if err := h.Validate(hash); err != nil {
+		return err
+	}
+	account.Password = hash
+	return nil
+}
+
+// SSHA256Hasher checks salted SHA-256 hashes
+type SSHA256Hasher struct{}
+
+// Name returns the name of the algorithm
+func (s *SSHA256Hasher) Name() string { return HashSSHA256 }
+
+// Identify reports whether the hash is a salted SHA-256 hash
+func (s *SSHA256Hasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, ssha256Tag)
+}
+
+// Hash returns the salted SHA-256 hash of the secret
+func (s *SSHA256Hasher) Hash(secret []byte) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append(append([]byte{}, secret...), salt...))
+	return ssha256Tag + base64.StdEncoding.EncodeToString(append(sum[:], salt...)), nil
+}
+
+// Compare checks the secret against the salted SHA-256 hash
+func (s *SSHA256Hasher) Compare(hash string, secret []byte) error {
+	b, err := s.decode(hash)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(append(append([]byte{}, secret...), b[sha256.Size:]...))
+	if subtle.ConstantTimeCompare(sum[:], b[:sha256.Size]) != 1 {
+		return tryerr.ErrInvalidPassword
+	}
+	return nil
+}
+
+// Validate checks the salted SHA-256 hash
+func (s *SSHA256Hasher) Validate(hash string) error {
+	_, err := s.decode(hash)
+	return err
+}
+
+// NeedsRehash always returns true
+func (s *SSHA256Hasher) NeedsRehash(hash string) bool { return true }
+
+func (s *SSHA256Hasher) decode(hash string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hash, ssha256Tag))
+	if err != nil || len(b) <= sha256.Size || len(b) > sha256.Size+maxHashSaltLen {
+		return nil, tryerr.ErrUnknownHash
+	}
+	return b, nil
+}
+
+// PBKDF2Hasher checks PBKDF2 hashes in passlib and Django formats
+type PBKDF2Hasher struct{}
+
+// Name returns the name of the algorithm
+func (p *PBKDF2Hasher) Name() string { return HashPBKDF2 }
+
+// Identify reports whether the hash is a PBKDF2 hash
+func (p *PBKDF2Hasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, "$pbkdf2-") || strings.HasPrefix(hash, "pbkdf2_")
+}
+
+// Hash returns the PBKDF2-SHA256 hash of the secret in passlib format
+func (p *PBKDF2Hasher) Hash(secret []byte) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	key := pbkdf2.Key(secret, salt, 29000, sha256.Size, sha256.New)
+	return fmt.Sprintf("$pbkdf2-sha256$%d$%s$%s", 29000, ab64(salt), ab64(key)), nil
+}
+
+// Compare checks the secret against the PBKDF2 hash
+func (p *PBKDF2Hasher) Compare(encoded string, secret []byte) error {
+	h, rounds, salt, key, err := p.decode(encoded)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(pbkdf2.Key(secret, salt, rounds, len(key), h), key) != 1 {
+		return tryerr.ErrInvalidPassword
+	}
+	return nil
+}
+
+// Validate checks the PBKDF2 hash and its rounds
+func (p *PBKDF2Hasher) Validate(hash string) error {
+	_, _, _, _, err := p.decode(hash)
+	return err
+}
+
+func (p *PBKDF2Hasher) decode(hash string) (h func() hash.Hash, rounds int, salt, key []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(hash, "$"), "$")
+	if len(parts) != 4 {
+		return nil, 0, nil, nil, tryerr.ErrUnknownHash
+	}
+	var digest string
+	if strings.HasPrefix(hash, "$") {
+		// passlib
+		digest = strings.TrimPrefix(parts[0], "pbkdf2-")
+		if salt, err = unab64(parts[2]); err == nil {
+			key, err = unab64(parts[3])
+		}
+	} else {
+		// Django
+		digest = strings.TrimPrefix(parts[0], "pbkdf2_")
+		salt = []byte(parts[2])
+		key, err = base64.StdEncoding.DecodeString(parts[3])
+	}
+	if err != nil || len(key) == 0 || len(salt) > maxHashSaltLen || len(key) > maxHashKeyLen {
+		return nil, 0, nil, nil, tryerr.ErrUnknownHash
+	}
+	switch digest {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha512":
+		h = sha512.New
+	default:
+		return nil, 0, nil, nil, tryerr.ErrUnknownHash
+	}
+	if rounds, err = strconv.Atoi(parts[1]); err != nil || rounds <= 0 {
+		return nil, 0, nil, nil, tryerr.ErrUnknownHash
+	}
+	if rounds > maxPBKDF2Rounds {
+		return nil, 0, nil, nil, tryerr.ErrHashTooCostly
+	}
+	return h, rounds, salt, key, nil
+}
+
+// NeedsRehash always returns true
+func (p *PBKDF2Hasher) NeedsRehash(hash string) bool { return true }
+
+// MD5CryptHasher checks MD5-crypt hashes
+type MD5CryptHasher struct{}
+
+// Name returns the name of the algorithm
+func (m *MD5CryptHasher) Name() string { return HashMD5Crypt }
+
+// Identify reports whether the hash is a MD5-crypt hash
+func (m *MD5CryptHasher) Identify(hash string) bool {
+	return strings.HasPrefix(hash, md5CryptTag)
+}
+
+// Hash returns the MD5-crypt hash of the secret
+func (m *MD5CryptHasher) Hash(secret []byte) (string, error) {
+	b, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, 8)
+	for i := range salt {
+		salt[i] = itoa64[b[i]&0x3f]
+	}
+	return md5Crypt(secret, salt), nil
+}
+
+// Compare checks the secret against the MD5-crypt hash
+func (m *MD5CryptHasher) Compare(hash string, secret []byte) error {
+	if err := m.Validate(hash); err != nil {
+		return err
+	}
+	salt := strings.Split(hash, "$")[2]
+	if subtle.ConstantTimeCompare([]byte(md5Crypt(secret, []byte(salt))), []byte(hash)) != 1 {
+		return tryerr.ErrInvalidPassword
+	}
+	return nil
+}
+
+// Validate checks the MD5-crypt hash. Its salt has at most 8 characters.
+func (m *MD5CryptHasher) Validate(hash string) error {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || len(parts[2]) > 8 || parts[3] == "" {
+		return tryerr.ErrUnknownHash
+	}
+	return nil
+}
+
+// NeedsRehash always returns true
+func (m *MD5CryptHasher) NeedsRehash(hash string) bool { return true }
+
+// md5Crypt implements the FreeBSD MD5-crypt algorithm
+func md5Crypt(password, salt []byte) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	d := md5.New()
+	d.Write(password)
+	d.Write([]byte(md5CryptTag))
+	d.Write(salt)
+
+	a := md5.New()
+	a.Write(password)
+	a.Write(salt)
+	a.Write(password)
+	final := a.Sum(nil)
+	for i := len(password); i > 0; i -= 16 {
+		if i > 16 {
+			d.Write(final)
+		} else {
+			d.Write(final[:i])
+		}
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(password[:1])
+		}
+	}
+	final = d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		r := md5.New()
+		if i&1 != 0 {
+			r.Write(password)
+		} else {
+			r.Write(final)
+		}
+		if i%3 != 0 {
+			r.Write(salt)
+		}
+		if i%7 != 0 {
+			r.Write(password)
+		}
+		if i&1 != 0 {
+			r.Write(final)
+		} else {
+			r.Write(password)
+		}
+		final = r.Sum(nil)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(md5CryptTag)
+	out.Write(salt)
+	out.WriteByte('$')
+	to64 := func(v uint, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint(final[g[0]])<<16|uint(final[g[1]])<<8|uint(final[g[2]]), 4)
+	}
+	to64(uint(final[11]), 2)
+	return out.String()
+}
+
+// ab64 encodes in the adapted base64 used by passlib
+func ab64(b []byte) string {
+	return strings.Replace(base64.RawStdEncoding.EncodeToString(b), "+", ".", -1)
+}
+
+func unab64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.Replace(s, ".", "+", -1))
+}
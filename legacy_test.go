@@ -0,0 +1,76 @@
+package try6
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestLegacyHashes(t *testing.T) {
+	for _, hash := range []string{
+		"{SSHA256}ZqbcWj6+KqD5BBm617QPtrpLWEgXUSAWm8MErrSqRq5zYWx0MTIzNA==",
+		"$pbkdf2-sha256$1000$c2FsdHNhbHRzYWx0$sYIePhT5IXESDKvnouJXtE5pTJ6Znbmef4vViYmc9Uc",
+		"pbkdf2_sha256$1000$saltsaltsalt$sYIePhT5IXESDKvnouJXtE5pTJ6Znbmef4vViYmc9Uc=",
+		"$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/",
+	} {
+		a := &Account{Email: "test@example.com"}
+		if err := a.SetPasswordHash(hash); err != nil {
+			t.Fatalf("SetPasswordHash(%q): %v", hash, err)
+		}
+		if err := a.MatchPassword("password"); err != nil {
+			t.Errorf("MatchPassword(%q): %v", hash, err)
+		}
+		if err := a.MatchPassword("Password"); err == nil {
+			t.Errorf("MatchPassword(%q) accepted a wrong password", hash)
+		}
+		if ok, err := a.RehashPassword("password"); !ok || err != nil {
+			t.Errorf("RehashPassword(%q): %v %v", hash, ok, err)
+		}
+		if !DefaultHasher.Identify(a.Password) {
+			t.Errorf("%q not rehashed with the default hasher", hash)
+		}
+	}
+	if err := (&Account{}).SetPasswordHash("plainpassword"); err == nil {
+		t.Error("SetPasswordHash accepted an unknown hash")
+	}
+}
+
+func TestHashLimits(t *testing.T) {
+	for _, c := range []struct {
+		hash string
+		want error
+	}{
+		{"$2a$17$" + strings.Repeat("a", 53), tryerr.ErrHashTooCostly},
+		{"$scrypt$ln=21,r=1,p=1$c2FsdA$a2V5", tryerr.ErrHashTooCostly},
+		{"$scrypt$ln=19,r=8,p=1$c2FsdA$a2V5", tryerr.ErrHashTooCostly},
+		{"$scrypt$ln=15,r=8,p=17$c2FsdA$a2V5", tryerr.ErrHashTooCostly},
+		{"$scrypt$ln=0,r=8,p=1$c2FsdA$a2V5", tryerr.ErrUnknownHash},
+		{"$argon2id$v=19$m=4194304,t=3,p=4$c2FsdA$a2V5", tryerr.ErrHashTooCostly},
+		{"$argon2id$v=19$m=65536,t=100,p=4$c2FsdA$a2V5", tryerr.ErrHashTooCostly},
+		{"$argon2id$v=19$m=65536,t=3,p=0$c2FsdA$a2V5", tryerr.ErrUnknownHash},
+		{"$pbkdf2-sha256$2000001$c2FsdA$a2V5", tryerr.ErrHashTooCostly},
+		{"pbkdf2_sha256$99999999$salt$a2V5", tryerr.ErrHashTooCostly},
+		{"$1$saltsaltsalt$qjXMvbEw8oaL.CzflDtaK/", tryerr.ErrUnknownHash},
+		{"{SSHA256}" + strings.Repeat("A", 300), tryerr.ErrUnknownHash},
+	} {
+		if err := (&Account{}).SetPasswordHash(c.hash); err != c.want {
+			t.Errorf("SetPasswordHash(%q): got %v, want %v", c.hash, err, c.want)
+		}
+		if err := compareSecret(c.hash, []byte("password")); err != c.want {
+			t.Errorf("compareSecret(%q): got %v, want %v", c.hash, err, c.want)
+		}
+	}
+	for _, c := range []struct {
+		name string
+		cost int
+	}{
+		{HashBcrypt, 17},
+		{HashScrypt, 19},
+		{HashArgon2id, 17},
+	} {
+		if _, err := NewHasher(c.name, c.cost); err == nil {
+			t.Errorf("NewHasher(%s, %d) accepted a cost above the limits", c.name, c.cost)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package try6
+
+import (
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+)
+
+const (
+	// FailureUnknownEmail is recorded when the email does not belong to any account
+	FailureUnknownEmail = "unknown_email"
+	// FailureBadPassword is recorded when the password does not match
+	FailureBadPassword = "bad_password"
+	// FailureLocked is recorded when the account is locked
+	FailureLocked = "locked"
+	// FailureBadMFACode is recorded when the second factor code does not match
+	FailureBadMFACode = "bad_mfa_code"
+	// FailureBadRecoveryCode is recorded when the recovery code does not match
+	FailureBadRecoveryCode = "bad_recovery_code"
+)
+
+var (
+	// MaxLockoutDuration is the maximum time an account can be locked
+	MaxLockoutDuration = 24 * time.Hour
+	// LoginIPThreshold is the number of failed logins allowed from the same address
+	// in LoginIPWindow before its requests are rejected. 0 disables the check.
+	LoginIPThreshold int64 = 20
+	// LoginIPWindow is the period of time the failed logins of an address are counted
+	LoginIPWindow = 15 * time.Minute
+)
+
+// LockoutDuration returns the time an account is locked the nth time it reaches
+// the failed logins threshold. It doubles with every lock up to MaxLockoutDuration.
+func (p *PasswordPolicy) LockoutDuration(n int64) time.Duration {
+	d := time.Duration(p.LockoutMinutes) * time.Minute
+	for i := int64(1); i < n && d < MaxLockoutDuration; i++ {
+		d *= 2
+	}
+	if d > MaxLockoutDuration {
+		d = MaxLockoutDuration
+	}
+	return d
+}
+
+// Locked reports whether the account is locked at this moment. Locked accounts
+// with no expiry stay locked until they are unlocked, whatever their status.
+func (account *Account) Locked() bool {
+	if !account.LockedUntil.Valid {
+		return account.LockCount > 0 || account.Status == StatusLocked
+	}
+	return time.Now().UTC().Before(account.LockedUntil.Time)
+}
+
+// LockoutReached reports whether the failed logins of the account have reached the
+// threshold of the policy
+func (account *Account) LockoutReached(policy *PasswordPolicy) bool {
+	return policy != nil && policy.LockoutThreshold > 0 && account.FailedLogins >= policy.LockoutThreshold
+}
+
+// Lock locks the account for the time set by the policy, doubling it on every
+// consecutive lock. Policies with no lockout minutes lock the account until it is
+// unlocked. Active accounts change its status to locked.
+func (account *Account) Lock(policy *PasswordPolicy) {
+	account.LockCount++
+	account.FailedLogins = 0
+	account.LockedUntil = dat.NullTime{}
+	if policy.LockoutMinutes > 0 {
+		account.LockedUntil = dat.NullTimeFrom(time.Now().UTC().Add(policy.LockoutDuration(account.LockCount)))
+	}
+	if account.Status == StatusActive {
+		account.Status = StatusLocked
+	}
+}
+
+// Unlock removes the lock and resets the failed logins of the account
+func (account *Account) Unlock() {
+	account.FailedLogins = 0
+	account.LockCount = 0
+	account.LockedUntil = dat.NullTime{}
+	if account.Status == StatusLocked {
+		account.Status = StatusActive
+	}
+}
+
+// RegisterLogin resets the lockout state of the account after a successful login.
+// It returns true if the account has been modified and must be saved.
+func (account *Account) RegisterLogin() bool {
+	if account.FailedLogins == 0 && account.LockCount == 0 && !account.LockedUntil.Valid && account.Status != StatusLocked {
+		return false
+	}
+	account.Unlock()
+	return true
+}
@@ -0,0 +1,69 @@
+package mailer
+
+// builtin holds the default text and HTML templates by language and name
+var builtin = map[string]map[string][2]string{
+	"en": {
+		TemplateVerifyEmail: {
+			`{{define "subject"}}Verify your email address{{end}}Hello {{.Name}},
+
+Please confirm your email address using the following link:
+
+{{.URL}}
+
+The link is valid for {{.Hours}}h. If you did not create this account you can ignore this message.
+`,
+			`<p>Hello {{.Name}},</p>
+<p>Please confirm your email address using the following link:</p>
+<p><a href="{{.URL}}">Verify my email</a></p>
+<p>The link is valid for {{.Hours}}h. If you did not create this account you can ignore this message.</p>
+`,
+		},
+		TemplatePasswordReset: {
+			`{{define "subject"}}Reset your password{{end}}Hello {{.Name}},
+
+We received a request to reset your password. Use the following link to choose a new one:
+
+{{.URL}}
+
+The link is valid for {{.Hours}}h and can only be used once. If you did not request it you can ignore this message.
+`,
+			`<p>Hello {{.Name}},</p>
+<p>We received a request to reset your password. Use the following link to choose a new one:</p>
+<p><a href="{{.URL}}">Reset my password</a></p>
+<p>The link is valid for {{.Hours}}h and can only be used once. If you did not request it you can ignore this message.</p>
+`,
+		},
+	},
+	"es": {
+		TemplateVerifyEmail: {
+			`{{define "subject"}}Verifica tu dirección de correo{{end}}Hola {{.Name}},
+
+Por favor, confirma tu dirección de correo mediante el siguiente enlace:
+
+{{.URL}}
+
+El enlace es válido durante {{.Hours}}h. Si no has creado esta cuenta puedes ignorar este mensaje.
+`,
+			`<p>Hola {{.Name}},</p>
+<p>Por favor, confirma tu dirección de correo mediante el siguiente enlace:</p>
+<p><a href="{{.URL}}">Verificar mi correo</a></p>
+<p>El enlace es válido durante {{.Hours}}h. Si no has creado esta cuenta puedes ignorar este mensaje.</p>
+`,
+		},
+		TemplatePasswordReset: {
+			`{{define "subject"}}Restablece tu contraseña{{end}}Hola {{.Name}},
+
+Hemos recibido una solicitud para restablecer tu contraseña. Utiliza el siguiente enlace para elegir una nueva:
+
+{{.URL}}
+
+El enlace es válido durante {{.Hours}}h y solo puede usarse una vez. Si no lo has solicitado puedes ignorar este mensaje.
+`,
+			`<p>Hola {{.Name}},</p>
+<p>Hemos recibido una solicitud para restablecer tu contraseña. Utiliza el siguiente enlace para elegir una nueva:</p>
+<p><a href="{{.URL}}">Restablecer mi contraseña</a></p>
+<p>El enlace es válido durante {{.Hours}}h y solo puede usarse una vez. Si no lo has solicitado puedes ignorar este mensaje.</p>
+`,
+		},
+	},
+}
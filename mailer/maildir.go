@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+var deliveries uint64
+
+// MaildirSender writes the messages to a maildir instead of sending them. It is
+// meant for development and tests.
+type MaildirSender struct {
+	Dir  string
+	From string
+}
+
+// NewMaildirSender returns a Sender that stores the messages in the maildir at dir,
+// creating it if needed
+func NewMaildirSender(dir, from string) (*MaildirSender, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &MaildirSender{Dir: dir, From: from}, nil
+}
+
+// Send writes the message to the tmp folder of the maildir and moves it to new
+// once it is complete
+func (s *MaildirSender) Send(m *Message) error {
+	if m.From == "" {
+		m.From = s.From
+	}
+	name := fmt.Sprintf("%d.%d_%d.try6", time.Now().Unix(), os.Getpid(), atomic.AddUint64(&deliveries, 1))
+	tmp := filepath.Join(s.Dir, "tmp", name)
+	if err := ioutil.WriteFile(tmp, m.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.Dir, "new", name))
+}
@@ -0,0 +1,113 @@
+/*
+Package mailer sends the email notifications of try6.
+
+A Sender delivers a Message. Two implementations are provided: SMTPSender, that
+relays the messages through an SMTP server, and MaildirSender, that writes them to
+a maildir so they can be inspected during development and tests.
+
+Messages are built from Templates, that can be customized per tenant and language.
+*/
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Sender is the interface implemented by the mail delivery backends
+type Sender interface {
+	Send(m *Message) error
+}
+
+// Message is an email with a text body and an optional HTML alternative
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Bytes returns the message encoded as a MIME multipart/alternative email ready to be delivered
+func (m *Message) Bytes() []byte {
+	var buf bytes.Buffer
+	boundary := newBoundary()
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	if m.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeQuotedPrintable(&buf, m.Text)
+		return buf.Bytes()
+	}
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	for _, part := range []struct{ ctype, body string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.ctype)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		writeQuotedPrintable(&buf, part.body)
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes()
+}
+
+// writeQuotedPrintable writes s to buf using the quoted-printable encoding
+func writeQuotedPrintable(buf *bytes.Buffer, s string) {
+	w := quotedprintable.NewWriter(buf)
+	w.Write([]byte(s))
+	w.Close()
+}
+
+// newBoundary returns a random MIME boundary
+func newBoundary() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Mailer renders the templates and delivers the resulting messages through Sender.
+// BaseURL is the public URL of the service used to build the links in the messages.
+type Mailer struct {
+	Sender    Sender
+	Templates *Templates
+	BaseURL   string
+}
+
+// New returns a Mailer that delivers the messages through s
+func New(s Sender, t *Templates, baseURL string) *Mailer {
+	return &Mailer{Sender: s, Templates: t, BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// SendTemplate renders the template name for the tenant and language with data
+// and sends it to the given address
+func (m *Mailer) SendTemplate(to, tenantID, lang, name string, data map[string]interface{}) error {
+	if m == nil || m.Sender == nil {
+		return tryerr.ErrNoMailer
+	}
+	subject, text, html, err := m.Templates.Render(tenantID, lang, name, data)
+	if err != nil {
+		return err
+	}
+	return m.Sender.Send(&Message{To: []string{to}, Subject: subject, Text: text, HTML: html})
+}
+
+// Link returns the public URL of path with the token as query parameter
+func (m *Mailer) Link(path, token string) string {
+	if m == nil {
+		return ""
+	}
+	return m.BaseURL + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLang(t *testing.T) {
+	tests := map[string]string{
+		"":                        "en",
+		"es-ES,es;q=0.9,en;q=0.8": "es",
+		"fr-FR, en-US;q=0.5":      "en",
+		"de":                      "en",
+	}
+	for in, want := range tests {
+		if got := Lang(in); got != want {
+			t.Errorf("Lang(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRenderBuiltin(t *testing.T) {
+	tpl := &Templates{}
+	data := map[string]interface{}{"Name": "Ana", "URL": "https://example.com/x?token=abc", "Hours": 1}
+	subject, text, html, err := tpl.Render("", "es", TemplatePasswordReset, data)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if subject != "Restablece tu contraseña" {
+		t.Errorf("subject = %q", subject)
+	}
+	if !strings.Contains(text, "Hola Ana") || !strings.Contains(text, "token=abc") {
+		t.Errorf("unexpected text body: %q", text)
+	}
+	if !strings.Contains(html, `href="https://example.com/x?token=abc"`) {
+		t.Errorf("unexpected html body: %q", html)
+	}
+}
+
+func TestRenderTenantOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "try6-tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tdir := filepath.Join(dir, "tenant1", "en")
+	os.MkdirAll(tdir, 0700)
+	ioutil.WriteFile(filepath.Join(tdir, TemplateVerifyEmail+".txt"), []byte(`{{define "subject"}}Welcome to Acme{{end}}Hi {{.Name}}`), 0600)
+
+	tpl := &Templates{Dir: dir}
+	subject, text, html, err := tpl.Render("tenant1", "en", TemplateVerifyEmail, map[string]interface{}{"Name": "Bob"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if subject != "Welcome to Acme" || text != "Hi Bob\n" || html != "" {
+		t.Errorf("got %q %q %q", subject, text, html)
+	}
+	// other tenants fall back to the builtin templates
+	if subject, _, _, _ = tpl.Render("tenant2", "en", TemplateVerifyEmail, map[string]interface{}{}); subject != "Verify your email address" {
+		t.Errorf("fallback subject = %q", subject)
+	}
+}
+
+func TestMaildirSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "try6-maildir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewMaildirSender(dir, "noreply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(&Message{To: []string{"user@example.com"}, Subject: "Contraseña", Text: "hola", HTML: "<p>hola</p>"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "new"))
+	if len(files) != 1 {
+		t.Fatalf("got %d messages in maildir, want 1", len(files))
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+	msg := string(b)
+	for _, want := range []string{"From: noreply@example.com", "To: user@example.com", "Subject: =?utf-8?q?Contrase=C3=B1a?=", "multipart/alternative"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message does not contain %q:\n%s", want, msg)
+		}
+	}
+}
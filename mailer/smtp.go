@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+	"strconv"
+
+	"github.com/jllopis/try6/log"
+)
+
+// SMTPSender delivers the messages through an SMTP server. If User is empty no
+// authentication is performed.
+type SMTPSender struct {
+	Host string
+	Port int
+	User string
+	Pass string
+	From string
+}
+
+// NewSMTPSender returns a Sender that relays the messages to the SMTP server at
+// host:port using from as the default sender address
+func NewSMTPSender(host string, port int, user, pass, from string) *SMTPSender {
+	if port == 0 {
+		port = 25
+	}
+	return &SMTPSender{Host: host, Port: port, User: user, Pass: pass, From: from}
+}
+
+// Send delivers the message to the SMTP server
+func (s *SMTPSender) Send(m *Message) error {
+	if m.From == "" {
+		m.From = s.From
+	}
+	var auth smtp.Auth
+	if s.User != "" {
+		auth = smtp.PlainAuth("", s.User, s.Pass, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	if err := smtp.SendMail(addr, auth, m.From, m.To, m.Bytes()); err != nil {
+		log.LogE("error sending mail", "pkg", "mailer", "func", "(*SMTPSender) Send(*Message)", "server", addr, "error", err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package mailer
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// TemplateVerifyEmail is the name of the template sent to verify an account email
+	TemplateVerifyEmail = "verify_email"
+	// TemplatePasswordReset is the name of the template sent to reset an account password
+	TemplatePasswordReset = "password_reset"
+)
+
+var (
+	// DefaultLang is the language used when the requested one is not supported
+	DefaultLang = "en"
+	// Langs holds the languages the templates are available in
+	Langs = []string{"en", "es"}
+)
+
+/*
+Templates renders the email templates. Each template is made of a text file
+(name.txt), that must define a "subject" template, and an optional HTML file
+(name.html).
+
+If Dir is set, templates are looked up first in Dir/<tenant>/<lang>, then in
+Dir/default/<lang>. When not found there, the builtin templates are used.
+*/
+type Templates struct {
+	Dir string
+}
+
+// Render executes the template name for the tenant and language with data. It
+// returns the subject, the text body and the HTML body, that can be empty.
+func (t *Templates) Render(tenantID, lang, name string, data interface{}) (subject, text, html string, err error) {
+	lang = Lang(lang)
+	txtSrc, htmlSrc, err := t.lookup(tenantID, lang, name)
+	if err != nil {
+		return "", "", "", err
+	}
+	txt, err := template.New(name).Parse(txtSrc)
+	if err != nil {
+		return "", "", "", err
+	}
+	var buf bytes.Buffer
+	if err := txt.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", "", err
+	}
+	subject = strings.TrimSpace(buf.String())
+	buf.Reset()
+	if err := txt.Execute(&buf, data); err != nil {
+		return "", "", "", err
+	}
+	text = strings.TrimSpace(buf.String()) + "\n"
+	if htmlSrc == "" {
+		return subject, text, "", nil
+	}
+	h, err := htmltemplate.New(name).Parse(htmlSrc)
+	if err != nil {
+		return "", "", "", err
+	}
+	buf.Reset()
+	if err := h.Execute(&buf, data); err != nil {
+		return "", "", "", err
+	}
+	return subject, text, buf.String(), nil
+}
+
+// lookup returns the source of the text and HTML templates
+func (t *Templates) lookup(tenantID, lang, name string) (string, string, error) {
+	if t != nil && t.Dir != "" {
+		for _, dir := range []string{tenantID, "default"} {
+			if dir == "" {
+				continue
+			}
+			base := filepath.Join(t.Dir, filepath.Base(dir), lang, name)
+			txt, err := ioutil.ReadFile(base + ".txt")
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return "", "", err
+			}
+			html, err := ioutil.ReadFile(base + ".html")
+			if err != nil && !os.IsNotExist(err) {
+				return "", "", err
+			}
+			return string(txt), string(html), nil
+		}
+	}
+	tpl, ok := builtin[lang][name]
+	if !ok {
+		return "", "", tryerr.ErrTemplateNotFound
+	}
+	return tpl[0], tpl[1], nil
+}
+
+// Lang returns the first supported language found in an Accept-Language like
+// list, or DefaultLang if there is none
+func Lang(accept string) string {
+	for _, l := range strings.Split(accept, ",") {
+		l = strings.ToLower(strings.TrimSpace(strings.SplitN(l, ";", 2)[0]))
+		l = strings.SplitN(l, "-", 2)[0]
+		for _, s := range Langs {
+			if l == s {
+				return s
+			}
+		}
+	}
+	return DefaultLang
+}
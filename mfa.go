@@ -0,0 +1,85 @@
+package try6
+
+import (
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/totp"
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// MFATotp is the kind of the RFC 6238 TOTP authenticators
+	MFATotp = "totp"
+	// TokenMFAChallenge is the kind of the tokens issued after a successful password
+	// check to complete the authentication with a second factor
+	TokenMFAChallenge = "mfa_challenge"
+	// TokenMFAEnrollment is the kind of the tokens issued after a successful password
+	// check to the accounts that must enroll a second factor before they can log in
+	TokenMFAEnrollment = "mfa_enrollment"
+)
+
+var (
+	// MFAIssuer is the issuer shown by the authenticator applications
+	MFAIssuer = "try6"
+	// MFAChallengeTTL is the time the client has to provide the second factor
+	MFAChallengeTTL = 5 * time.Minute
+	// MFAEnrollmentTTL is the time the account has to enroll and confirm the
+	// second factor its directory requires
+	MFAEnrollmentTTL = 15 * time.Minute
+	// MFASkew is the number of TOTP steps of clock drift accepted
+	MFASkew int64 = 1
+)
+
+// NewTOTP generates a new TOTP secret for the account. The secret is stored encrypted
+// and returned in clear along with the otpauth:// URI to enroll it. The
+// authenticator is not active until it is confirmed with a first code.
+func NewTOTP(account *Account) (*AccountMFA, string, string, error) {
+	if account.ID == "" {
+		return nil, "", "", tryerr.ErrNilUID
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, "", "", err
+	}
+	sealed, err := SealSecret([]byte(secret))
+	if err != nil {
+		return nil, "", "", err
+	}
+	m := &AccountMFA{
+		AccountID: account.ID,
+		Kind:      MFATotp,
+		Secret:    sealed,
+	}
+	return m, secret, totp.URI(MFAIssuer, account.Email, secret), nil
+}
+
+// Active reports whether the authenticator has been confirmed and can be used
+func (m *AccountMFA) Active() bool {
+	return m.Confirmed.Valid
+}
+
+// Verify checks the TOTP code. A code can not be used twice, so the step of the
+// last accepted code is kept and older codes are rejected.
+func (m *AccountMFA) Verify(code string) error {
+	secret, err := OpenSecret(m.Secret)
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Validate(string(secret), code, time.Now().UTC(), MFASkew)
+	if !ok || step <= m.LastStep {
+		return tryerr.ErrInvalidMFACode
+	}
+	m.LastStep = step
+	return nil
+}
+
+// Confirm verifies the first code generated by the authenticator and activates it
+func (m *AccountMFA) Confirm(code string) error {
+	if err := m.Verify(code); err != nil {
+		return err
+	}
+	m.Confirmed = dat.NullTimeFrom(time.Now().UTC())
+	return nil
+}
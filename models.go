@@ -28,30 +28,87 @@ type CreateTenantData struct {
 	Scope *Scope     `json:"scope"`
 }
 
-// Directory holds the items related to a directory. A directory group auth data together
+// Directory holds the items related to a directory. A directory group auth data together.
+// AllowUnverifiedLogin lets accounts authenticate before verifying their email and
+// RequireMFA forces its accounts to authenticate with a second factor.
+// CaseSensitiveEmail makes the local part of the email of the accounts created in
+// the directory case sensitive, so Ana@example.com and ana@example.com are
+// different accounts.
 type Directory struct {
-	ID          string       `json:"id" db:"id"`
-	TenantUID   string       `json:"tenant_uid" db:"tenant_uid"`
-	Label       string       `json:"label" db:"label"`
-	Description string       `json:"description" db:"description"`
-	Status      string       `json:"status" db:"status"`
-	Created     time.Time    `json:"created" db:"created"`
-	Updated     time.Time    `json:"updated" db:"updated"`
-	Deleted     dat.NullTime `json:"deleted,omitempty" db:"deleted"`
+	ID                   string       `json:"id" db:"id"`
+	TenantUID            string       `json:"tenant_uid" db:"tenant_uid"`
+	Label                string       `json:"label" db:"label"`
+	Description          string       `json:"description" db:"description"`
+	Status               string       `json:"status" db:"status"`
+	AllowUnverifiedLogin bool         `json:"allow_unverified_login" db:"allow_unverified_login"`
+	RequireMFA           bool         `json:"require_mfa" db:"require_mfa"`
+	CaseSensitiveEmail   bool         `json:"case_sensitive_email" db:"case_sensitive_email"`
+	Admin                bool         `json:"admin" db:"admin"`
+	Created              time.Time    `json:"created" db:"created"`
+	Updated              time.Time    `json:"updated" db:"updated"`
+	Deleted              dat.NullTime `json:"deleted,omitempty" db:"deleted"`
 }
 
 // Account hold the information of an Account type. Variables are of type pointer
 // to easily identify null variables when persist/read to/from database storage.
+// The profile fields are described in Profile.
 type Account struct {
-	ID       string       `json:"id" db:"id"`
-	Email    string       `json:"email" db:"email"`
-	Name     string       `json:"name,omitempty" db:"name"`
-	Password string       `json:"password,omitempty" db:"password"`
-	Status   string       `json:"status" db:"status"`
-	Created  time.Time    `json:"created" db:"created"`
-	Updated  time.Time    `json:"updated" db:"updated"`
-	Deleted  dat.NullTime `json:"deleted,omitempty" db:"deleted"`
-	//	Gravatar *string    `json:"gravatar,omitempty" db:"gravatar"`
+	ID              string       `json:"id" db:"id"`
+	Email           string       `json:"email" db:"email"`
+	EmailKey        string       `json:"-" db:"email_key"`
+	Name            string       `json:"name,omitempty" db:"name"`
+	GivenName       string       `json:"given_name,omitempty" db:"given_name"`
+	FamilyName      string       `json:"family_name,omitempty" db:"family_name"`
+	MiddleName      string       `json:"middle_name,omitempty" db:"middle_name"`
+	Username        string       `json:"username,omitempty" db:"username"`
+	Phone           string       `json:"phone,omitempty" db:"phone"`
+	Locale          string       `json:"locale,omitempty" db:"locale"`
+	Timezone        string       `json:"timezone,omitempty" db:"timezone"`
+	Picture         string       `json:"picture,omitempty" db:"picture"`
+	Password        string       `json:"password,omitempty" db:"password"`
+	PasswordChanged dat.NullTime `json:"password_changed,omitempty" db:"password_changed"`
+	FailedLogins    int64        `json:"failed_logins" db:"failed_logins"`
+	LockCount       int64        `json:"lock_count" db:"lock_count"`
+	LockedUntil     dat.NullTime `json:"locked_until,omitempty" db:"locked_until"`
+	Status          string       `json:"status" db:"status"`
+	Created         time.Time    `json:"created" db:"created"`
+	Updated         time.Time    `json:"updated" db:"updated"`
+	Deleted         dat.NullTime `json:"deleted,omitempty" db:"deleted"`
+}
+
+// PasswordPolicy holds the password rules that apply to the accounts of a directory.
+// HistoryCount is the number of previous passwords that can not be reused and
+// MaxAgeDays the number of days a password is valid before it must be changed.
+// After LockoutThreshold consecutive failed logins the account is locked for
+// LockoutMinutes, doubled on every new lock, or until unlocked if LockoutMinutes is
+// zero. A zero value disables the other checks.
+type PasswordPolicy struct {
+	ID               string       `json:"id" db:"id"`
+	DirectoryID      string       `json:"directory_id" db:"directory_id"`
+	MinPassLen       int64        `json:"min_pass_len" db:"min_pass_len"`
+	MaxPassLen       int64        `json:"max_pass_len" db:"max_pass_len"`
+	MinReqLCase      int64        `json:"min_req_lcase" db:"min_req_lcase"`
+	MinReqUCase      int64        `json:"min_req_ucase" db:"min_req_ucase"`
+	MinReqNum        int64        `json:"min_req_num" db:"min_req_num"`
+	MinReqSym        int64        `json:"min_req_sym" db:"min_req_sym"`
+	MinReqDia        int64        `json:"min_req_dia" db:"min_req_dia"`
+	HistoryCount     int64        `json:"history_count" db:"history_count"`
+	MaxAgeDays       int64        `json:"max_age_days" db:"max_age_days"`
+	LockoutThreshold int64        `json:"lockout_threshold" db:"lockout_threshold"`
+	LockoutMinutes   int64        `json:"lockout_minutes" db:"lockout_minutes"`
+	Created          time.Time    `json:"created" db:"created"`
+	Updated          time.Time    `json:"updated" db:"updated"`
+	Deleted          dat.NullTime `json:"deleted,omitempty" db:"deleted"`
+}
+
+// LoginFailure records a failed authentication attempt for audit purposes
+type LoginFailure struct {
+	ID        string         `json:"id" db:"id"`
+	AccountID dat.NullString `json:"account_id,omitempty" db:"account_id"`
+	Email     string         `json:"email" db:"email"`
+	IP        string         `json:"ip" db:"ip"`
+	Reason    string         `json:"reason" db:"reason"`
+	Created   time.Time      `json:"created" db:"created"`
 }
 
 // DirectoryAccount hold the grouping of accounts into directories
@@ -63,10 +120,86 @@ type DirectoryAccount struct {
 	Deleted     dat.NullTime `json:"deleted,omitempty" db:"deleted"`
 }
 
-// Key is the default RSA key associated to an account
+// AccountToken is a single use, time limited token issued to an account owner to
+// confirm an action out of band. Only the hash of the token is stored.
+type AccountToken struct {
+	ID        string       `json:"id" db:"id"`
+	AccountID string       `json:"account_id" db:"account_id"`
+	Kind      string       `json:"kind" db:"kind"`
+	Hash      string       `json:"-" db:"hash"`
+	Expires   time.Time    `json:"expires" db:"expires"`
+	Used      dat.NullTime `json:"used,omitempty" db:"used"`
+	Created   time.Time    `json:"created" db:"created"`
+}
+
+// APIKey is a long lived key an account uses to authenticate its machines. The id
+// starts with APIKeyPrefix and only the hash of the secret is kept. Scope restricts
+// the scopes of the requests made with the key, none if empty.
+type APIKey struct {
+	ID        string       `json:"id" db:"id"`
+	AccountID string       `json:"account_id" db:"account_id"`
+	Name      string       `json:"name" db:"name"`
+	Hash      string       `json:"-" db:"hash"`
+	Scope     string       `json:"scope" db:"scope"`
+	Expires   dat.NullTime `json:"expires,omitempty" db:"expires"`
+	LastUsed  dat.NullTime `json:"last_used,omitempty" db:"last_used"`
+	Created   time.Time    `json:"created" db:"created"`
+	Deleted   dat.NullTime `json:"deleted,omitempty" db:"deleted"`
+}
+
+// AccountMFA is a second authentication factor enrolled by an account. The secret
+// is stored encrypted with SecretKey.
+type AccountMFA struct {
+	ID        string       `json:"id" db:"id"`
+	AccountID string       `json:"account_id" db:"account_id"`
+	Kind      string       `json:"kind" db:"kind"`
+	Secret    string       `json:"-" db:"secret"`
+	LastStep  int64        `json:"-" db:"last_step"`
+	Confirmed dat.NullTime `json:"confirmed,omitempty" db:"confirmed"`
+	Created   time.Time    `json:"created" db:"created"`
+	Updated   time.Time    `json:"updated" db:"updated"`
+	Deleted   dat.NullTime `json:"deleted,omitempty" db:"deleted"`
+}
+
+// RecoveryCode is a one time code that can be used in place of a second factor
+// code. Only its hash is stored.
+type RecoveryCode struct {
+	ID        string       `json:"id" db:"id"`
+	AccountID string       `json:"account_id" db:"account_id"`
+	Hash      string       `json:"-" db:"hash"`
+	Used      dat.NullTime `json:"used,omitempty" db:"used"`
+	Created   time.Time    `json:"created" db:"created"`
+}
+
+// AccountCustomData holds the custom data document of an account
+type AccountCustomData struct {
+	ID        string     `json:"id" db:"id"`
+	AccountID string     `json:"account_id" db:"account_id"`
+	Data      CustomData `json:"data" db:"data"`
+}
+
+// ImportJob tracks a bulk import of accounts into a directory. Errors holds the
+// rows that could not be imported.
+type ImportJob struct {
+	ID          string       `json:"id" db:"id"`
+	DirectoryID string       `json:"directory_id" db:"directory_id"`
+	Format      string       `json:"format" db:"format"`
+	Status      string       `json:"status" db:"status"`
+	Total       int64        `json:"total" db:"total"`
+	Imported    int64        `json:"imported" db:"imported"`
+	Failed      int64        `json:"failed" db:"failed"`
+	Errors      ImportErrors `json:"errors" db:"errors"`
+	Created     time.Time    `json:"created" db:"created"`
+	Updated     time.Time    `json:"updated" db:"updated"`
+	Finished    dat.NullTime `json:"finished,omitempty" db:"finished"`
+}
+
+// Key is the default RSA key associated to an account. The keys of a tenant sign
+// the tokens issued for its scopes.
 type Key struct {
 	ID        string       `json:"id" db:"id"`
 	AccountID string       `json:"account_id" db:"account_id"`
+	TenantID  string       `json:"tenant_id,omitempty" db:"tenant_id"`
 	PubKey    []byte       `json:"pubkey" db:"pub_key"`
 	PrivKey   []byte       `json:"privkey" db:"priv_key"`
 	Status    string       `json:"status" db:"status"`
@@ -75,16 +208,165 @@ type Key struct {
 	Deleted   dat.NullTime `json:"deleted,omitempty" db:"deleted"`
 }
 
-// Scope holds the items related to a scope. A scope can be thougth of as an application
+// Scope holds the items related to a scope. A scope can be thougth of as an application.
+// Claims maps custom data keys of the accounts to the token claims they are exposed as.
+// Exchanges are the token exchanges its clients are allowed to make.
 type Scope struct {
+	ID          string        `json:"id" db:"id"`
+	TenantID    string        `json:"tenant_id" db:"tenant_id"`
+	Label       string        `json:"label" db:"label"`
+	Description string        `json:"description" db:"description"`
+	Claims      CustomData    `json:"claims,omitempty" db:"claims"`
+	Exchanges   ExchangeRules `json:"exchanges,omitempty" db:"exchanges"`
+	Status      string        `json:"status" db:"status"`
+	Created     time.Time     `json:"created" db:"created"`
+	Updated     time.Time     `json:"updated" db:"updated"`
+	Deleted     dat.NullTime  `json:"deleted,omitempty" db:"deleted"`
+}
+
+// Client is an OAuth 2.0 client of a scope. Only the hash of its secret is stored.
+// Public clients, such as SPAs and mobile apps, have no secret. Grants are the
+// grant types it can use, RedirectURIs the exact URIs it can be redirected to and
+// Audiences the audiences of the tokens it can request. Clients registered
+// dynamically keep the hash of their registration access token. The accounts must
+// consent to the scopes requested by the clients that are not first party.
+type Client struct {
+	ID               string       `json:"client_id" db:"id"`
+	ScopeID          string       `json:"scope_id" db:"scope_id"`
+	Name             string       `json:"name" db:"name"`
+	SecretHash       string       `json:"-" db:"secret_hash"`
+	RegistrationHash string       `json:"-" db:"registration_hash"`
+	Public           bool         `json:"public" db:"public"`
+	FirstParty       bool         `json:"first_party" db:"first_party"`
+	Grants           StringList   `json:"grant_types" db:"grants"`
+	RedirectURIs     StringList   `json:"redirect_uris" db:"redirect_uris"`
+	Audiences        StringList   `json:"audiences" db:"audiences"`
+	Status           string       `json:"status" db:"status"`
+	Created          time.Time    `json:"created" db:"created"`
+	Updated          time.Time    `json:"updated" db:"updated"`
+	Deleted          dat.NullTime `json:"deleted,omitempty" db:"deleted"`
+}
+
+// Consent holds the scopes an account granted to a third party client. ClientName
+// is only loaded when the consents of an account are listed.
+type Consent struct {
+	ID         string       `json:"id" db:"id"`
+	AccountID  string       `json:"account_id" db:"account_id"`
+	ClientID   string       `json:"client_id" db:"client_id"`
+	ClientName string       `json:"client_name,omitempty" db:"client_name"`
+	Scope      string       `json:"scope" db:"scope"`
+	Created    time.Time    `json:"created" db:"created"`
+	Updated    time.Time    `json:"updated" db:"updated"`
+	Revoked    dat.NullTime `json:"revoked,omitempty" db:"revoked"`
+}
+
+// InitialAccessToken lets a tenant register OAuth clients in one of its scopes
+// with the dynamic client registration protocol (RFC 7591) until it expires or is
+// revoked. Only the hash of the token is kept. Grants are the grants the clients
+// registered with it can use besides RegistrationGrants.
+type InitialAccessToken struct {
+	ID       string       `json:"id" db:"id"`
+	Hash     string       `json:"-" db:"hash"`
+	TenantID string       `json:"tenant_id" db:"tenant_id"`
+	ScopeID  string       `json:"scope_id" db:"scope_id"`
+	Grants   StringList   `json:"grant_types" db:"grants"`
+	Expires  time.Time    `json:"expires" db:"expires"`
+	Revoked  dat.NullTime `json:"revoked,omitempty" db:"revoked"`
+	Created  time.Time    `json:"created" db:"created"`
+}
+
+// JWT is the record of a token issued. ID is the jti claim of the token and
+// FamilyID the family of the refresh token it was issued with, if any.
+type JWT struct {
+	ID            string         `json:"id" db:"id"`
+	SigningMethod string         `json:"signing_method" db:"signing_method"`
+	ClientID      dat.NullString `json:"client_id,omitempty" db:"client_id"`
+	AccountID     dat.NullString `json:"account_id,omitempty" db:"account_id"`
+	TenantID      string         `json:"tenant_id" db:"tenant_id"`
+	FamilyID      dat.NullString `json:"family_id,omitempty" db:"family_id"`
+	Expires       dat.NullTime   `json:"expires,omitempty" db:"expires"`
+	Status        string         `json:"status" db:"status"`
+	Created       time.Time      `json:"created" db:"created"`
+	Updated       dat.NullTime   `json:"updated,omitempty" db:"updated"`
+	Deleted       dat.NullTime   `json:"deleted,omitempty" db:"deleted"`
+}
+
+// AuthCode is an authorization code issued to a client for an account. Only the
+// hash of the code is stored. It can be exchanged once, before it expires.
+type AuthCode struct {
+	ID            string       `json:"id" db:"id"`
+	Hash          string       `json:"-" db:"hash"`
+	ClientID      string       `json:"client_id" db:"client_id"`
+	AccountID     string       `json:"account_id" db:"account_id"`
+	RedirectURI   string       `json:"redirect_uri" db:"redirect_uri"`
+	Scope         string       `json:"scope" db:"scope"`
+	Nonce         string       `json:"nonce" db:"nonce"`
+	CodeChallenge string       `json:"-" db:"code_challenge"`
+	AMR           StringList   `json:"amr" db:"amr"`
+	AuthTime      time.Time    `json:"auth_time" db:"auth_time"`
+	Expires       time.Time    `json:"expires" db:"expires"`
+	Used          dat.NullTime `json:"used,omitempty" db:"used"`
+	Created       time.Time    `json:"created" db:"created"`
+}
+
+// DeviceCode is a device authorization issued to a client that runs without a
+// browser. The device polls the token endpoint with the device code while the
+// account enters the user code in the verification page and logs in. Only the hash
+// of the device code is kept.
+type DeviceCode struct {
+	ID        string         `json:"id" db:"id"`
+	Hash      string         `json:"-" db:"hash"`
+	UserCode  string         `json:"-" db:"user_code"`
+	ClientID  string         `json:"client_id" db:"client_id"`
+	Scope     string         `json:"scope" db:"scope"`
+	Status    string         `json:"status" db:"status"`
+	AccountID dat.NullString `json:"account_id,omitempty" db:"account_id"`
+	AMR       StringList     `json:"amr" db:"amr"`
+	AuthTime  dat.NullTime   `json:"auth_time,omitempty" db:"auth_time"`
+	Interval  int64          `json:"interval" db:"interval"`
+	LastPoll  dat.NullTime   `json:"last_poll,omitempty" db:"last_poll"`
+	Expires   time.Time      `json:"expires" db:"expires"`
+	Created   time.Time      `json:"created" db:"created"`
+}
+
+// RefreshToken is an opaque refresh token issued to a client for an account. Only
+// the hash of the token is stored. Every use rotates the token: it is marked as
+// rotated and a new one of the same family is issued. The family expires at
+// Expires and every token at IdleExpires if it is not used before.
+type RefreshToken struct {
 	ID          string       `json:"id" db:"id"`
-	TenantID    string       `json:"tenant_id" db:"tenant_id"`
-	Label       string       `json:"label" db:"label"`
-	Description string       `json:"description" db:"description"`
-	Status      string       `json:"status" db:"status"`
+	Hash        string       `json:"-" db:"hash"`
+	FamilyID    string       `json:"family_id" db:"family_id"`
+	ClientID    string       `json:"client_id" db:"client_id"`
+	AccountID   string       `json:"account_id" db:"account_id"`
+	Scope       string       `json:"scope" db:"scope"`
+	AMR         StringList   `json:"amr" db:"amr"`
+	AuthTime    time.Time    `json:"auth_time" db:"auth_time"`
+	Expires     time.Time    `json:"expires" db:"expires"`
+	IdleExpires time.Time    `json:"idle_expires" db:"idle_expires"`
+	Rotated     dat.NullTime `json:"rotated,omitempty" db:"rotated"`
+	Revoked     dat.NullTime `json:"revoked,omitempty" db:"revoked"`
 	Created     time.Time    `json:"created" db:"created"`
-	Updated     time.Time    `json:"updated" db:"updated"`
-	Deleted     dat.NullTime `json:"deleted,omitempty" db:"deleted"`
+}
+
+// Revocation is an entry of the revocation feed of a tenant: an access token
+// revoked before it expires. ID is the position of the entry in the feed.
+type Revocation struct {
+	ID       int64     `json:"id" db:"id"`
+	JTI      string    `json:"jti" db:"jti"`
+	TenantID string    `json:"tenant_id" db:"tenant_id"`
+	Expires  time.Time `json:"expires" db:"expires"`
+	Created  time.Time `json:"created" db:"created"`
+}
+
+// Branding holds the look of the login page of a tenant
+type Branding struct {
+	TenantID        string    `json:"tenant_id" db:"tenant_id"`
+	DisplayName     string    `json:"display_name" db:"display_name"`
+	LogoURL         string    `json:"logo_url,omitempty" db:"logo_url"`
+	PrimaryColor    string    `json:"primary_color" db:"primary_color"`
+	BackgroundColor string    `json:"background_color" db:"background_color"`
+	Updated         time.Time `json:"updated" db:"updated"`
 }
 
 // DirectoryScope hold the grouping of accounts into directories
@@ -0,0 +1,101 @@
+package try6
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// ScopeOpenID is the scope of the OpenID Connect requests. Only the grants with
+	// this scope get an ID token.
+	ScopeOpenID = "openid"
+	// ScopeProfile grants the profile claims of the account
+	ScopeProfile = "profile"
+	// ScopeEmail grants the email claims of the account
+	ScopeEmail = "email"
+	// ScopePhone grants the phone number claims of the account
+	ScopePhone = "phone"
+	// ScopeGroups grants the groups claim, with the directories of the account
+	ScopeGroups = "groups"
+
+	// ACRSingleFactor is the authentication context class of the accounts that
+	// logged in with their password only
+	ACRSingleFactor = "urn:try6:acr:sfa"
+	// ACRMultiFactor is the authentication context class of the accounts that
+	// logged in with a second factor too
+	ACRMultiFactor = "urn:try6:acr:mfa"
+)
+
+// IDTokenTTL is the time an ID token is valid since it is issued
+var IDTokenTTL = time.Hour
+
+// ACR returns the authentication context class of a login with the authentication
+// methods given
+func ACR(amr []string) string {
+	if StringList(amr).Contains(AMRMFA) || StringList(amr).Contains(AMROTP) {
+		return ACRMultiFactor
+	}
+	return ACRSingleFactor
+}
+
+// HasScope tells if the scope is in the space separated list of scopes
+func HasScope(scopes, scope string) bool {
+	return StringList(splitScope(scopes)).Contains(scope)
+}
+
+// UserInfoClaims returns the claims of the account that the scopes grant: the
+// profile claims with profile, the email ones with email, the phone ones with
+// phone and the groups given with groups. The sub claim is always set.
+func (account *Account) UserInfoClaims(scope string, groups []string) map[string]interface{} {
+	claims := map[string]interface{}{}
+	add := func(c map[string]interface{}) {
+		for k, v := range c {
+			claims[k] = v
+		}
+	}
+	if HasScope(scope, ScopeProfile) {
+		add(account.ProfileClaims())
+	}
+	if HasScope(scope, ScopeEmail) {
+		add(account.EmailClaims())
+	}
+	if HasScope(scope, ScopePhone) {
+		add(account.PhoneClaims())
+	}
+	if HasScope(scope, ScopeGroups) {
+		if groups == nil {
+			groups = []string{}
+		}
+		claims["groups"] = groups
+	}
+	claims["sub"] = account.ID
+	return claims
+}
+
+// NewIDToken signs an OpenID Connect ID token for the client about the account
+// that authenticated at authTime with the methods in amr. The nonce of the
+// authentication request is set if not empty. Extra claims, usually the user info
+// claims, can not replace the registered ones.
+func NewIDToken(key *Key, client *Client, subject, nonce string, authTime time.Time, amr []string, extra map[string]interface{}) (string, error) {
+	now := time.Now().UTC()
+	claims := jwt.MapClaims{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["iss"] = Issuer
+	claims["sub"] = subject
+	claims["aud"] = client.ID
+	claims["azp"] = client.ID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(IDTokenTTL).Unix()
+	claims["auth_time"] = authTime.Unix()
+	claims["acr"] = ACR(amr)
+	if len(amr) > 0 {
+		claims["amr"] = amr
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return key.Sign(claims)
+}
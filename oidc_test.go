@@ -0,0 +1,47 @@
+package try6
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserInfoClaims(t *testing.T) {
+	a := &Account{ID: "id", Email: "ana@example.com", Name: "Ana", Phone: "+34600000000", Status: StatusActive}
+	claims := a.UserInfoClaims("openid email", []string{"staff"})
+	if claims["sub"] != "id" || claims["email"] != a.Email || claims["email_verified"] != true {
+		t.Errorf("unexpected claims %v", claims)
+	}
+	for _, c := range []string{"name", "phone_number", "groups"} {
+		if _, ok := claims[c]; ok {
+			t.Errorf("claim %s not granted by the scope", c)
+		}
+	}
+	claims = a.UserInfoClaims("openid profile phone groups", nil)
+	if claims["name"] != "Ana" || claims["phone_number"] != a.Phone || len(claims["groups"].([]string)) != 0 {
+		t.Errorf("unexpected claims %v", claims)
+	}
+	if _, ok := claims["email"]; ok {
+		t.Error("email not granted by the scope")
+	}
+}
+
+func TestIDToken(t *testing.T) {
+	key := NewKey("account")
+	key.ID = NewUUID()
+	c := &Client{ID: NewUUID()}
+	auth := time.Now().Add(-time.Minute)
+	token, err := NewIDToken(key, c, "account", "n-0S6_WzA2Mj", auth, []string{AMRPassword, AMROTP, AMRMFA}, map[string]interface{}{"email": "ana@example.com", "aud": "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseToken(token, func(string) (*Key, error) { return key, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["aud"] != c.ID || claims["nonce"] != "n-0S6_WzA2Mj" || claims["acr"] != ACRMultiFactor || claims["auth_time"] != float64(auth.Unix()) || claims["email"] != "ana@example.com" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+	if ACR([]string{AMRPassword}) != ACRSingleFactor {
+		t.Error("password logins are single factor")
+	}
+}
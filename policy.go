@@ -0,0 +1,56 @@
+package try6
+
+import (
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+// NewPasswordPolicy returns the default password policy for the given directory.
+// It does not keep password history nor expire passwords and locks the accounts
+// for 15 minutes after 5 failed logins.
+func NewPasswordPolicy(directoryID string) *PasswordPolicy {
+	return &PasswordPolicy{
+		DirectoryID:      directoryID,
+		MinPassLen:       8,
+		MaxPassLen:       256,
+		LockoutThreshold: 5,
+		LockoutMinutes:   15,
+	}
+}
+
+// MaxAge returns the maximum age of a password as a time.Duration
+func (p *PasswordPolicy) MaxAge() time.Duration {
+	return time.Duration(p.MaxAgeDays) * 24 * time.Hour
+}
+
+// CheckPassword checks the password length and the minimum number of lower case,
+// upper case, numeric, symbol and diacritic characters required by the policy.
+// Limits set to 0 are not checked. tryerr.ErrInvalidPassword is returned if the
+// password does not comply.
+func (p *PasswordPolicy) CheckPassword(password string) error {
+	if n := int64(utf8.RuneCountInString(password)); n < p.MinPassLen || (p.MaxPassLen > 0 && n > p.MaxPassLen) {
+		return tryerr.ErrInvalidPassword
+	}
+	var lower, upper, num, sym, dia int64
+	for _, r := range password {
+		switch {
+		case r > unicode.MaxASCII && unicode.IsLetter(r):
+			dia++
+		case unicode.IsLower(r):
+			lower++
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsDigit(r):
+			num++
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			sym++
+		}
+	}
+	if lower < p.MinReqLCase || upper < p.MinReqUCase || num < p.MinReqNum || sym < p.MinReqSym || dia < p.MinReqDia {
+		return tryerr.ErrInvalidPassword
+	}
+	return nil
+}
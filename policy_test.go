@@ -0,0 +1,28 @@
+package try6
+
+import "testing"
+
+func TestCheckPassword(t *testing.T) {
+	policy := &PasswordPolicy{MinPassLen: 8, MaxPassLen: 16, MinReqUCase: 1, MinReqNum: 2, MinReqSym: 1}
+	for _, c := range []struct {
+		password string
+		valid    bool
+	}{
+		{"Passw0rd!1", true},
+		{"Pw0!1", false},
+		{"Passw0rd!1Passw0rd!1", false},
+		{"passw0rd!1", false},
+		{"Password!1", false},
+		{"Passw0rd11", false},
+	} {
+		if err := policy.CheckPassword(c.password); (err == nil) != c.valid {
+			t.Errorf("%q: got %v", c.password, err)
+		}
+	}
+	if err := (&PasswordPolicy{MinReqDia: 1}).CheckPassword("contraseña"); err != nil {
+		t.Errorf("diacritic: %v", err)
+	}
+	if err := NewPasswordPolicy("").CheckPassword("short"); err == nil {
+		t.Error("default policy accepted a short password")
+	}
+}
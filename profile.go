@@ -0,0 +1,160 @@
+package try6
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+var (
+	// RegexpUsername checks that the username only has letters, digits, dots,
+	// dashes and underscores
+	RegexpUsername = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+	// RegexpPhone checks that the phone number is in E.164 format
+	RegexpPhone = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	// RegexpLocale checks that the locale looks like a BCP 47 language tag, such as
+	// es or en-US
+	RegexpLocale = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+)
+
+// Profile holds the personal data of an account that can be changed by its owner.
+// Every field but Name is optional. Phone is in E.164 format (+34600000000),
+// Locale is a BCP 47 language tag and Timezone an IANA time zone name such as
+// Europe/Madrid.
+type Profile struct {
+	Name       string `json:"name"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+	MiddleName string `json:"middle_name,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Phone      string `json:"phone,omitempty"`
+	Locale     string `json:"locale,omitempty"`
+	Timezone   string `json:"timezone,omitempty"`
+	Picture    string `json:"picture,omitempty"`
+}
+
+// Validate checks the profile fields
+func (p *Profile) Validate() error {
+	if p.Name == "" {
+		return tryerr.ErrInvalidName
+	}
+	for _, name := range []string{p.Name, p.GivenName, p.FamilyName, p.MiddleName} {
+		if utf8.RuneCountInString(name) > 200 {
+			return tryerr.ErrInvalidName
+		}
+	}
+	if p.Username != "" && !RegexpUsername.MatchString(p.Username) {
+		return tryerr.ErrInvalidUsername
+	}
+	if p.Phone != "" && !RegexpPhone.MatchString(p.Phone) {
+		return tryerr.ErrInvalidPhone
+	}
+	if p.Locale != "" && (len(p.Locale) > 35 || !RegexpLocale.MatchString(p.Locale)) {
+		return tryerr.ErrInvalidLocale
+	}
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" {
+			return tryerr.ErrInvalidTimezone
+		}
+	}
+	if p.Picture != "" {
+		u, err := url.Parse(p.Picture)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(p.Picture) > 2048 {
+			return tryerr.ErrInvalidPicture
+		}
+	}
+	return nil
+}
+
+// Profile returns the profile of the account
+func (account *Account) Profile() *Profile {
+	return &Profile{
+		Name:       account.Name,
+		GivenName:  account.GivenName,
+		FamilyName: account.FamilyName,
+		MiddleName: account.MiddleName,
+		Username:   account.Username,
+		Phone:      account.Phone,
+		Locale:     account.Locale,
+		Timezone:   account.Timezone,
+		Picture:    account.Picture,
+	}
+}
+
+// SetProfile validates the profile and replaces the one of the account with it.
+// The account is left untouched if the profile is not valid.
+func (account *Account) SetProfile(p *Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	account.Name = p.Name
+	account.GivenName = p.GivenName
+	account.FamilyName = p.FamilyName
+	account.MiddleName = p.MiddleName
+	account.Username = p.Username
+	account.Phone = p.Phone
+	account.Locale = p.Locale
+	account.Timezone = p.Timezone
+	account.Picture = p.Picture
+	return nil
+}
+
+// GravatarURL returns the URL of the gravatar of the account email
+func (account *Account) GravatarURL() string {
+	sum := md5.Sum([]byte(strings.ToLower(strings.TrimSpace(account.Email))))
+	return fmt.Sprintf(GravatarURI, hex.EncodeToString(sum[:]), GravatarSize)
+}
+
+// ProfileClaims returns the account profile as standard OpenID Connect claims.
+// Empty fields are left out and the gravatar is used when the account has no
+// picture.
+func (account *Account) ProfileClaims() map[string]interface{} {
+	claims := map[string]interface{}{
+		"updated_at": account.Updated.Unix(),
+	}
+	for claim, v := range map[string]string{
+		"name":               account.Name,
+		"given_name":         account.GivenName,
+		"family_name":        account.FamilyName,
+		"middle_name":        account.MiddleName,
+		"preferred_username": account.Username,
+		"locale":             account.Locale,
+		"zoneinfo":           account.Timezone,
+		"picture":            account.Picture,
+	} {
+		if v != "" {
+			claims[claim] = v
+		}
+	}
+	if _, ok := claims["picture"]; !ok && account.Email != "" {
+		claims["picture"] = account.GravatarURL()
+	}
+	return claims
+}
+
+// EmailClaims returns the email of the account as standard OpenID Connect claims
+func (account *Account) EmailClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"email":          account.Email,
+		"email_verified": account.Status != StatusUnverified,
+	}
+}
+
+// PhoneClaims returns the phone number of the account as standard OpenID Connect
+// claims. It is empty if the account has no phone number.
+func (account *Account) PhoneClaims() map[string]interface{} {
+	if account.Phone == "" {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"phone_number":          account.Phone,
+		"phone_number_verified": false,
+	}
+}
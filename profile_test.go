@@ -0,0 +1,47 @@
+package try6
+
+import (
+	"testing"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		p   Profile
+		err error
+	}{
+		{Profile{Name: "Ana", Phone: "+34600000000", Locale: "es-ES", Timezone: "Europe/Madrid", Picture: "https://example.com/ana.png"}, nil},
+		{Profile{}, tryerr.ErrInvalidName},
+		{Profile{Name: "Ana", Username: "ana garcía"}, tryerr.ErrInvalidUsername},
+		{Profile{Name: "Ana", Phone: "600 000 000"}, tryerr.ErrInvalidPhone},
+		{Profile{Name: "Ana", Phone: "+0600000000"}, tryerr.ErrInvalidPhone},
+		{Profile{Name: "Ana", Locale: "spanish!"}, tryerr.ErrInvalidLocale},
+		{Profile{Name: "Ana", Timezone: "Europe/Nowhere"}, tryerr.ErrInvalidTimezone},
+		{Profile{Name: "Ana", Picture: "javascript:alert(1)"}, tryerr.ErrInvalidPicture},
+	}
+	for _, tt := range tests {
+		if err := tt.p.Validate(); err != tt.err {
+			t.Errorf("%+v: got %v, want %v", tt.p, err, tt.err)
+		}
+	}
+}
+
+func TestProfileClaims(t *testing.T) {
+	a := &Account{Email: " Ana@Example.com", Name: "Ana", Username: "ana", Timezone: "Europe/Madrid"}
+	want := "https://gravatar.com/avatar/cdb9d6a1dddc375a09cc83e3001598dc?s=80"
+	if got := a.GravatarURL(); got != want {
+		t.Errorf("GravatarURL: got %q, want %q", got, want)
+	}
+	claims := a.ProfileClaims()
+	if claims["preferred_username"] != "ana" || claims["zoneinfo"] != "Europe/Madrid" || claims["picture"] != a.GravatarURL() {
+		t.Errorf("unexpected claims %v", claims)
+	}
+	if _, ok := claims["given_name"]; ok {
+		t.Error("empty fields should be left out")
+	}
+	a.Picture = "https://example.com/ana.png"
+	if a.ProfileClaims()["picture"] != a.Picture {
+		t.Error("picture should take precedence over the gravatar")
+	}
+}
@@ -0,0 +1,57 @@
+package try6
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+var (
+	// RecoveryCodesCount is the number of recovery codes generated for an account
+	RecoveryCodesCount = 10
+)
+
+// NewRecoveryCodes generates a new set of recovery codes for the account. The codes
+// are returned in clear to be shown once to the account owner and hashed with
+// the DefaultHasher in the RecoveryCode slice to be stored.
+func NewRecoveryCodes(accountID string) ([]*RecoveryCode, []string, error) {
+	if accountID == "" {
+		return nil, nil, tryerr.ErrNilUID
+	}
+	now := time.Now().UTC()
+	hashed := make([]*RecoveryCode, 0, RecoveryCodesCount)
+	codes := make([]string, 0, RecoveryCodesCount)
+	for i := 0; i < RecoveryCodesCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		code := s[:4] + "-" + s[4:]
+		h, err := hashSecret([]byte(code))
+		if err != nil {
+			return nil, nil, err
+		}
+		hashed = append(hashed, &RecoveryCode{AccountID: accountID, Hash: h, Created: now})
+		codes = append(codes, code)
+	}
+	return hashed, codes, nil
+}
+
+// MatchRecoveryCode returns the unused recovery code that matches code or
+// tryerr.ErrInvalidMFACode if none does. Spaces and case are ignored.
+func MatchRecoveryCode(codes []*RecoveryCode, code string) (*RecoveryCode, error) {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), " ", "", -1))
+	for _, c := range codes {
+		if c.Used.Valid {
+			continue
+		}
+		if compareSecret(c.Hash, []byte(code)) == nil {
+			return c, nil
+		}
+	}
+	return nil, tryerr.ErrInvalidMFACode
+}
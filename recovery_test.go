@@ -0,0 +1,56 @@
+package try6
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	defer func(h Hasher) { DefaultHasher = h }(DefaultHasher)
+	DefaultHasher = &BcryptHasher{Cost: 4}
+	if _, _, err := NewRecoveryCodes(""); err != tryerr.ErrNilUID {
+		t.Errorf("codes without account: got %v, want %v", err, tryerr.ErrNilUID)
+	}
+	hashed, codes, err := NewRecoveryCodes("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashed) != RecoveryCodesCount || len(codes) != RecoveryCodesCount {
+		t.Fatalf("got %d hashes and %d codes, want %d", len(hashed), len(codes), RecoveryCodesCount)
+	}
+	seen := map[string]bool{}
+	for i, c := range hashed {
+		if c.AccountID != "account" || !strings.HasPrefix(c.Hash, "$2a$") || strings.Contains(c.Hash, codes[i]) {
+			t.Errorf("unexpected recovery code %+v", c)
+		}
+		if seen[codes[i]] {
+			t.Errorf("repeated code %q", codes[i])
+		}
+		seen[codes[i]] = true
+	}
+}
+
+func TestMatchRecoveryCode(t *testing.T) {
+	defer func(h Hasher) { DefaultHasher = h }(DefaultHasher)
+	DefaultHasher = &BcryptHasher{Cost: 4}
+	hashed, codes, err := NewRecoveryCodes("account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := MatchRecoveryCode(hashed, " "+strings.ToUpper(codes[3])+" ")
+	if err != nil || c != hashed[3] {
+		t.Fatalf("match: got %v %v, want code 3", c, err)
+	}
+	c.Used = dat.NullTimeFrom(time.Now())
+	if _, err := MatchRecoveryCode(hashed, codes[3]); err != tryerr.ErrInvalidMFACode {
+		t.Errorf("used code: got %v, want %v", err, tryerr.ErrInvalidMFACode)
+	}
+	if _, err := MatchRecoveryCode(hashed, "aaaa-aaaa"); err != tryerr.ErrInvalidMFACode {
+		t.Errorf("wrong code: got %v, want %v", err, tryerr.ErrInvalidMFACode)
+	}
+}
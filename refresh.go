@@ -0,0 +1,109 @@
+package try6
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+// GrantRefreshToken is the OAuth 2.0 grant used to get new tokens with a refresh token
+const GrantRefreshToken = "refresh_token"
+
+var (
+	// RefreshAbsoluteTTL is the time a family of refresh tokens is valid since the
+	// account authenticated, however often it is rotated
+	RefreshAbsoluteTTL = 30 * 24 * time.Hour
+	// RefreshIdleTTL is the time a refresh token is valid if it is not used
+	RefreshIdleTTL = 7 * 24 * time.Hour
+)
+
+func init() {
+	SupportedGrants = append(SupportedGrants, GrantRefreshToken)
+}
+
+// NewRefreshToken returns the first refresh token of a new family issued to the
+// client for the account and its secret. Only the hash of the secret is kept. The
+// family expires RefreshAbsoluteTTL after it is created.
+func NewRefreshToken(clientID, accountID, scope string, amr []string, authTime time.Time) (*RefreshToken, string, error) {
+	if clientID == "" || accountID == "" {
+		return nil, "", tryerr.ErrNilUID
+	}
+	now := time.Now().UTC()
+	t := &RefreshToken{
+		FamilyID:  NewUUID(),
+		ClientID:  clientID,
+		AccountID: accountID,
+		Scope:     scope,
+		AMR:       amr,
+		AuthTime:  authTime.UTC(),
+		Expires:   now.Add(RefreshAbsoluteTTL),
+	}
+	return t.issue(now)
+}
+
+// Rotate returns the refresh token that replaces t in its family and its secret.
+// It keeps the expiration of the family.
+func (t *RefreshToken) Rotate() (*RefreshToken, string, error) {
+	n := &RefreshToken{
+		FamilyID:  t.FamilyID,
+		ClientID:  t.ClientID,
+		AccountID: t.AccountID,
+		Scope:     t.Scope,
+		AMR:       t.AMR,
+		AuthTime:  t.AuthTime,
+		Expires:   t.Expires,
+	}
+	return n.issue(time.Now().UTC())
+}
+
+// issue sets a new secret and the idle expiration of the token
+func (t *RefreshToken) issue(now time.Time) (*RefreshToken, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	t.Hash = HashToken(secret)
+	t.IdleExpires = now.Add(RefreshIdleTTL)
+	if t.IdleExpires.After(t.Expires) {
+		t.IdleExpires = t.Expires
+	}
+	t.Created = now
+	return t, secret, nil
+}
+
+// Valid checks that the token can be used by the client. It returns
+// tryerr.ErrTokenReused if the token was already rotated, so its family must be
+// revoked, and tryerr.ErrInvalidGrant if it was issued to another client, has been
+// revoked or has expired.
+func (t *RefreshToken) Valid(clientID string) error {
+	now := time.Now().UTC()
+	switch {
+	case t.ClientID != clientID || t.Revoked.Valid:
+		return tryerr.ErrInvalidGrant
+	case t.Rotated.Valid:
+		return tryerr.ErrTokenReused
+	case now.After(t.Expires) || now.After(t.IdleExpires):
+		return tryerr.ErrInvalidGrant
+	}
+	return nil
+}
+
+// NarrowScope returns the scopes requested if they are a subset of the granted
+// ones, or all of them if none is requested. It returns tryerr.ErrInvalidScope
+// otherwise.
+func NarrowScope(granted, requested string) (string, error) {
+	requested = NormalizeScope(requested)
+	if requested == "" {
+		return granted, nil
+	}
+	have := StringList(splitScope(granted))
+	for _, s := range splitScope(requested) {
+		if !have.Contains(s) {
+			return "", tryerr.ErrInvalidScope
+		}
+	}
+	return requested, nil
+}
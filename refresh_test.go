@@ -0,0 +1,53 @@
+package try6
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestRefreshTokenRotate(t *testing.T) {
+	old, secret, err := NewRefreshToken("client", "account", "openid profile", []string{AMRPassword}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Hash != HashToken(secret) || old.FamilyID == "" || old.IdleExpires.After(old.Expires) {
+		t.Errorf("unexpected token %+v", old)
+	}
+	if err := old.Valid("client"); err != nil {
+		t.Errorf("Valid: %v", err)
+	}
+	if err := old.Valid("other"); err != tryerr.ErrInvalidGrant {
+		t.Errorf("Valid for another client: got %v", err)
+	}
+	n, nsecret, err := old.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.FamilyID != old.FamilyID || !n.Expires.Equal(old.Expires) || nsecret == secret {
+		t.Errorf("rotated token %+v does not continue %+v", n, old)
+	}
+	old.Rotated = dat.NullTimeFrom(time.Now())
+	if err := old.Valid("client"); err != tryerr.ErrTokenReused {
+		t.Errorf("Valid after rotation: got %v", err)
+	}
+	n.IdleExpires = time.Now().Add(-time.Second)
+	if err := n.Valid("client"); err != tryerr.ErrInvalidGrant {
+		t.Errorf("Valid after idle expiration: got %v", err)
+	}
+}
+
+func TestNarrowScope(t *testing.T) {
+	if s, err := NarrowScope("openid profile", ""); err != nil || s != "openid profile" {
+		t.Errorf("NarrowScope() = %q, %v", s, err)
+	}
+	if s, err := NarrowScope("openid profile", "profile"); err != nil || s != "profile" {
+		t.Errorf("NarrowScope(profile) = %q, %v", s, err)
+	}
+	if _, err := NarrowScope("openid", "email"); err != tryerr.ErrInvalidScope {
+		t.Errorf("NarrowScope(email): got %v", err)
+	}
+}
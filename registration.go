@@ -0,0 +1,108 @@
+package try6
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+var (
+	// InitialAccessTokenTTL is the time an initial access token is valid when no
+	// other is requested
+	InitialAccessTokenTTL = 24 * time.Hour
+	// RegistrationGrants are the grants any client registered dynamically can use.
+	// The rest must be allowed by the initial access token it is registered with.
+	RegistrationGrants = []string{GrantAuthorizationCode, GrantRefreshToken}
+)
+
+// NewInitialAccessToken returns a new initial access token of the tenant, that
+// registers clients in the scope until it expires, and its secret. Only the hash of
+// the secret is kept. The clients registered with it can use the grants given on
+// top of RegistrationGrants.
+func NewInitialAccessToken(tenantID, scopeID string, grants []string, ttl time.Duration) (*InitialAccessToken, string, error) {
+	if tenantID == "" || scopeID == "" {
+		return nil, "", tryerr.ErrNilUID
+	}
+	for _, g := range grants {
+		if !StringList(SupportedGrants).Contains(g) {
+			return nil, "", tryerr.ErrUnsupportedGrant
+		}
+	}
+	if ttl <= 0 {
+		ttl = InitialAccessTokenTTL
+	}
+	secret, err := newRegistrationSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC()
+	return &InitialAccessToken{
+		Hash:     HashToken(secret),
+		TenantID: tenantID,
+		ScopeID:  scopeID,
+		Grants:   grants,
+		Expires:  now.Add(ttl),
+		Created:  now,
+	}, secret, nil
+}
+
+// Valid checks that the initial access token has not been revoked and has not
+// expired
+func (t *InitialAccessToken) Valid() error {
+	if t.Revoked.Valid || time.Now().UTC().After(t.Expires) {
+		return tryerr.ErrInvalidToken
+	}
+	return nil
+}
+
+// AllowedGrants returns the grants the clients registered with the initial access
+// token can use
+func (t *InitialAccessToken) AllowedGrants() []string {
+	return RegisteredGrants(t.Grants)
+}
+
+// RegisteredGrants returns RegistrationGrants along with the extra grants given
+func RegisteredGrants(extra []string) []string {
+	grants := append([]string{}, RegistrationGrants...)
+	for _, g := range extra {
+		if !StringList(grants).Contains(g) {
+			grants = append(grants, g)
+		}
+	}
+	return grants
+}
+
+// NewRegistrationToken replaces the registration access token of the client, that
+// lets its owner read, update and delete it with the client registration management
+// protocol (RFC 7592), and returns it. Only its hash is kept.
+func (c *Client) NewRegistrationToken() (string, error) {
+	secret, err := newRegistrationSecret()
+	if err != nil {
+		return "", err
+	}
+	c.RegistrationHash = HashToken(secret)
+	return secret, nil
+}
+
+// MatchRegistrationToken checks the registration access token against the one of
+// the client. It returns tryerr.ErrInvalidToken if they do not match or the client
+// was not registered dynamically.
+func (c *Client) MatchRegistrationToken(token string) error {
+	if c.RegistrationHash == "" || subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(c.RegistrationHash)) != 1 {
+		return tryerr.ErrInvalidToken
+	}
+	return nil
+}
+
+// newRegistrationSecret returns a random secret for the tokens of the client
+// registration
+func newRegistrationSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,57 @@
+package try6
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestInitialAccessToken(t *testing.T) {
+	if _, _, err := NewInitialAccessToken("tenant", "", nil, 0); err != tryerr.ErrNilUID {
+		t.Errorf("token without scope: got %v", err)
+	}
+	if _, _, err := NewInitialAccessToken("tenant", "scope", []string{"password"}, 0); err != tryerr.ErrUnsupportedGrant {
+		t.Errorf("unsupported grant: got %v", err)
+	}
+	tok, secret, err := NewInitialAccessToken("tenant", "scope", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Hash != HashToken(secret) || tok.Expires.Sub(tok.Created) != InitialAccessTokenTTL {
+		t.Errorf("unexpected token %+v", tok)
+	}
+	if err := tok.Valid(); err != nil {
+		t.Errorf("Valid: %v", err)
+	}
+	if grants := StringList(tok.AllowedGrants()); len(grants) != 2 || !grants.Contains(GrantAuthorizationCode) || !grants.Contains(GrantRefreshToken) {
+		t.Errorf("default grants = %v", grants)
+	}
+	tok.Grants = StringList{GrantClientCredentials, GrantRefreshToken}
+	if grants := StringList(tok.AllowedGrants()); len(grants) != 3 || !grants.Contains(GrantClientCredentials) {
+		t.Errorf("extra grants = %v", grants)
+	}
+	tok.Revoked = dat.NullTimeFrom(time.Now())
+	if err := tok.Valid(); err != tryerr.ErrInvalidToken {
+		t.Errorf("Valid after revocation: got %v", err)
+	}
+}
+
+func TestRegistrationToken(t *testing.T) {
+	c := &Client{ID: NewUUID()}
+	if err := c.MatchRegistrationToken(""); err != tryerr.ErrInvalidToken {
+		t.Errorf("client not registered dynamically: got %v", err)
+	}
+	token, err := c.NewRegistrationToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MatchRegistrationToken(token); err != nil {
+		t.Errorf("MatchRegistrationToken: %v", err)
+	}
+	if err := c.MatchRegistrationToken(token + "x"); err != tryerr.ErrInvalidToken {
+		t.Errorf("wrong token: got %v", err)
+	}
+}
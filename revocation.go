@@ -0,0 +1,57 @@
+package try6
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	// RevocationFeedLimit is the maximum number of revocations in a page of the feed
+	RevocationFeedLimit uint64 = 1000
+	// RevocationFeedTTL is the time a page of the revocation feed is valid since it
+	// is signed. Resource servers should not accept older pages.
+	RevocationFeedTTL = 5 * time.Minute
+)
+
+/*
+RevocationFeed returns the claims of a page of the revocation feed of the tenant,
+with the revocations made after the position since. The page is meant to be signed
+with a key of the tenant, so resource servers can check where it comes from.
+
+	{
+	  "iss": "https://auth.example.com",
+	  "tid": "<tenant id>",
+	  "iat": 1500000000,
+	  "exp": 1500000300,
+	  "since": 41,
+	  "next": 43,
+	  "more": false,
+	  "revoked": [{"jti": "<token id>", "exp": 1500003600}, ...]
+	}
+
+next is the position to poll from the next time and more is set when there are
+more revocations than fit in a page. Entries are only returned while the token
+they revoke has not expired.
+*/
+func RevocationFeed(tenantID string, since int64, revs []*Revocation, more bool) jwt.MapClaims {
+	now := time.Now().UTC()
+	next := since
+	revoked := make([]map[string]interface{}, 0, len(revs))
+	for _, r := range revs {
+		revoked = append(revoked, map[string]interface{}{"jti": r.JTI, "exp": r.Expires.Unix()})
+		if r.ID > next {
+			next = r.ID
+		}
+	}
+	return jwt.MapClaims{
+		"iss":     Issuer,
+		"tid":     tenantID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(RevocationFeedTTL).Unix(),
+		"since":   since,
+		"next":    next,
+		"more":    more,
+		"revoked": revoked,
+	}
+}
@@ -0,0 +1,30 @@
+package try6
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevocationFeed(t *testing.T) {
+	exp := time.Now().Add(time.Hour)
+	revs := []*Revocation{
+		{ID: 42, JTI: "a", TenantID: "tenant", Expires: exp},
+		{ID: 45, JTI: "b", TenantID: "tenant", Expires: exp},
+	}
+	feed := RevocationFeed("tenant", 41, revs, true)
+	if feed["tid"] != "tenant" || feed["since"] != int64(41) || feed["next"] != int64(45) || feed["more"] != true {
+		t.Errorf("unexpected feed %v", feed)
+	}
+	revoked := feed["revoked"].([]map[string]interface{})
+	if len(revoked) != 2 || revoked[1]["jti"] != "b" || revoked[1]["exp"] != exp.Unix() {
+		t.Errorf("unexpected revocations %v", revoked)
+	}
+	if err := feed.Valid(); err != nil {
+		t.Errorf("feed not valid: %v", err)
+	}
+
+	empty := RevocationFeed("tenant", 45, nil, false)
+	if empty["next"] != int64(45) || len(empty["revoked"].([]map[string]interface{})) != 0 {
+		t.Errorf("unexpected empty feed %v", empty)
+	}
+}
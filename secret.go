@@ -0,0 +1,66 @@
+package try6
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+// SecretKey is the AES-256 key used to encrypt the secrets stored in the database.
+// It must be set at startup and be kept between restarts.
+var SecretKey []byte
+
+// SecretKeyConfigured tells if SecretKey is valid to encrypt the secrets, such as
+// the TOTP ones
+func SecretKeyConfigured() bool {
+	return len(SecretKey) == 32
+}
+
+// SealSecret encrypts the secret with SecretKey using AES-GCM and returns it base64 encoded
+func SealSecret(secret []byte) (string, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, secret, nil)), nil
+}
+
+// OpenSecret decrypts a secret encrypted with SealSecret
+func OpenSecret(sealed string) ([]byte, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < gcm.NonceSize() {
+		return nil, tryerr.ErrInvalidSecret
+	}
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, tryerr.ErrInvalidSecret
+	}
+	return plain, nil
+}
+
+// secretCipher returns the AES-GCM cipher for SecretKey
+func secretCipher() (cipher.AEAD, error) {
+	if !SecretKeyConfigured() {
+		return nil, tryerr.ErrNoSecretKey
+	}
+	block, err := aes.NewCipher(SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,142 @@
+package try6
+
+import (
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// StatusUnverified is the status of a new account until its email is verified
+	StatusUnverified = "unverified"
+	// StatusActive is the status of an item that can be used
+	StatusActive = "active"
+	// StatusLocked is the status of an active account locked after too many failed logins
+	StatusLocked = "locked"
+	// StatusDisabled is the status of an item disabled by an administrator. It is
+	// kept but can not be used until it is activated again.
+	StatusDisabled = "disabled"
+	// StatusDeleted is the final status of a deleted item
+	StatusDeleted = "deleted"
+	// StatusRevoked is the status of a token revoked before it expires
+	StatusRevoked = "revoked"
+
+	// EntityAccount identifies the accounts in the status changes
+	EntityAccount = "account"
+	// EntityDirectory identifies the directories in the status changes
+	EntityDirectory = "directory"
+	// EntityScope identifies the scopes in the status changes
+	EntityScope = "scope"
+	// EntityTenant identifies the tenants in the status changes
+	EntityTenant = "tenant"
+	// EntityKey identifies the keys in the status changes
+	EntityKey = "key"
+	// EntityClient identifies the OAuth clients in the status changes
+	EntityClient = "client"
+
+	// ActorSystem is the actor of the status changes made by try6 itself, such as
+	// the lock of an account after too many failed logins
+	ActorSystem = "system"
+)
+
+/*
+transitions holds the state machine of every entity: the statuses an item can
+move to from each status. Accounts are created unverified, or active if their
+email needs no verification, and the rest of the entities are created active.
+
+	account:   unverified -> active, disabled, deleted
+	           active     -> locked, disabled, deleted
+	           locked     -> active, disabled, deleted
+	           disabled   -> active, deleted
+	others:    active     -> disabled, deleted
+	           disabled   -> active, deleted
+
+Deleted is final.
+*/
+var transitions = map[string]map[string][]string{
+	EntityAccount: {
+		StatusUnverified: {StatusActive, StatusDisabled, StatusDeleted},
+		StatusActive:     {StatusLocked, StatusDisabled, StatusDeleted},
+		StatusLocked:     {StatusActive, StatusDisabled, StatusDeleted},
+		StatusDisabled:   {StatusActive, StatusDeleted},
+		StatusDeleted:    {},
+	},
+	EntityDirectory: defaultTransitions,
+	EntityScope:     defaultTransitions,
+	EntityTenant:    defaultTransitions,
+	EntityKey:       defaultTransitions,
+	EntityClient:    defaultTransitions,
+}
+
+var defaultTransitions = map[string][]string{
+	StatusActive:   {StatusDisabled, StatusDeleted},
+	StatusDisabled: {StatusActive, StatusDeleted},
+	StatusDeleted:  {},
+}
+
+// StatusChange records a transition of the status of an item, who made it and why
+type StatusChange struct {
+	ID       string    `json:"id" db:"id"`
+	Entity   string    `json:"entity" db:"entity"`
+	EntityID string    `json:"entity_id" db:"entity_id"`
+	From     string    `json:"from" db:"from_status"`
+	To       string    `json:"to" db:"to_status"`
+	Actor    string    `json:"actor" db:"actor"`
+	Reason   string    `json:"reason,omitempty" db:"reason"`
+	Created  time.Time `json:"created" db:"created"`
+}
+
+// ValidStatus reports whether status is one of the statuses of the entity
+func ValidStatus(entity, status string) bool {
+	_, ok := transitions[entity][status]
+	return ok
+}
+
+// CanTransition reports whether an item of the entity can move from one status to
+// the other
+func CanTransition(entity, from, to string) bool {
+	for _, s := range transitions[entity][from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// NewStatusChange checks the transition of the item and returns its record. An
+// actor must be given. If the transition is not allowed by the state machine of
+// the entity tryerr.ErrInvalidTransition is returned, or tryerr.ErrInvalidStatus
+// if to is not a status of the entity.
+func NewStatusChange(entity, id, from, to, actor, reason string) (*StatusChange, error) {
+	switch {
+	case id == "":
+		return nil, tryerr.ErrNilUID
+	case actor == "":
+		return nil, tryerr.ErrActorNotProvided
+	case !ValidStatus(entity, to):
+		return nil, tryerr.ErrInvalidStatus
+	case !CanTransition(entity, from, to):
+		return nil, tryerr.ErrInvalidTransition
+	}
+	return &StatusChange{
+		Entity:   entity,
+		EntityID: id,
+		From:     from,
+		To:       to,
+		Actor:    actor,
+		Reason:   reason,
+		Created:  time.Now().UTC(),
+	}, nil
+}
+
+// Usable returns nil if an item with the status can be used, or the error that
+// explains why it can not be used
+func Usable(status string) error {
+	switch status {
+	case StatusDisabled:
+		return tryerr.ErrDisabled
+	case StatusDeleted:
+		return tryerr.ErrDeleted
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package try6
+
+import (
+	"testing"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestStatusTransitions(t *testing.T) {
+	tests := []struct {
+		entity, from, to string
+		err              error
+	}{
+		{EntityAccount, StatusUnverified, StatusActive, nil},
+		{EntityAccount, StatusActive, StatusLocked, nil},
+		{EntityAccount, StatusLocked, StatusDisabled, nil},
+		{EntityAccount, StatusDisabled, StatusActive, nil},
+		{EntityAccount, StatusDisabled, StatusLocked, tryerr.ErrInvalidTransition},
+		{EntityAccount, StatusDeleted, StatusActive, tryerr.ErrInvalidTransition},
+		{EntityAccount, StatusActive, "archived", tryerr.ErrInvalidStatus},
+		{EntityDirectory, StatusActive, StatusDisabled, nil},
+		{EntityDirectory, StatusActive, StatusLocked, tryerr.ErrInvalidStatus},
+		{EntityKey, StatusDisabled, StatusDeleted, nil},
+		{EntityTenant, StatusDeleted, StatusDisabled, tryerr.ErrInvalidTransition},
+	}
+	for _, tt := range tests {
+		c, err := NewStatusChange(tt.entity, "id", tt.from, tt.to, "admin", "test")
+		if err != tt.err {
+			t.Errorf("%s %s -> %s: got %v, want %v", tt.entity, tt.from, tt.to, err, tt.err)
+		}
+		if err == nil && (c.From != tt.from || c.To != tt.to || c.Actor != "admin") {
+			t.Errorf("%s %s -> %s: unexpected change %+v", tt.entity, tt.from, tt.to, c)
+		}
+	}
+	if _, err := NewStatusChange(EntityAccount, "id", StatusActive, StatusDisabled, "", ""); err != tryerr.ErrActorNotProvided {
+		t.Errorf("change without actor: got %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	a := &Account{ID: "id", Status: StatusUnverified}
+	c, err := a.Verify()
+	if err != nil || c == nil || a.Status != StatusActive || c.Actor != ActorSystem {
+		t.Fatalf("Verify: %+v, %v, status %q", c, err, a.Status)
+	}
+	if c, err := a.Verify(); c != nil || err != nil {
+		t.Errorf("verifying an active account should do nothing, got %+v, %v", c, err)
+	}
+}
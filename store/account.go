@@ -1,43 +1,138 @@
 package store
 
 import (
+	"database/sql"
 	"time"
 
+	"gopkg.in/mgutz/dat.v1/sqlx-runner"
+
 	"github.com/jllopis/try6"
 	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
 )
 
 // Accounter interface defines the method to be implemented for account storage managers
 type Accounter interface {
 	//	LoadAllAccounts() ([]*account.Account, error)
-	//	LoadAccount(tuuid string) (*account.Account, error)
+	GetAccountByID(id string) (*try6.Account, error)
 	SaveAccount(directory string, a *try6.Account) error
+	SaveAccountPassword(a *try6.Account, keep int64) error
+	ResetAccountPassword(t *try6.AccountToken, a *try6.Account, keep int64) error
+	SaveAccountPasswordHash(a *try6.Account) error
+	SaveAccountProfile(a *try6.Account) error
+	GetPasswordHistory(accountID string, n int64) ([]string, error)
 	//	DeleteAccount(uuid string) error
-	//	GetAccountByEmail(email string) (*account.Account, error)
+	GetAccountByEmail(email string) (*try6.Account, error)
+	EmailInUse(key string, caseSensitive bool) (bool, error)
+	ListAccounts(q *ListQuery) ([]*try6.Account, string, error)
 	//	ExistAccount(uuid string) bool
 }
 
-// SaveAccount persist the account data to the database
+// GetAccountByID returns the account with the given id or tryerr.ErrAccountNotFound
+// if it does not exist
+func (d *DefaultStore) GetAccountByID(id string) (*try6.Account, error) {
+	log.LogD("Loading Account", "pkg", "store", "func", "GetAccountByID(string)", "id", id)
+	var a try6.Account
+	if err := d.C.Select("*").From("accounts").Where("id=$1 AND deleted IS NULL", id).QueryStruct(&a); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrAccountNotFound
+		}
+		log.LogE("error loading account", "pkg", "store", "func", "GetAccountByID(string)", "error", err.Error())
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetAccountByEmail returns the account with the given email or tryerr.ErrEmailNotFound
+// if no account has it. The email is normalized and its local part matched
+// regardless of case unless a directory of the account is case sensitive.
+func (d *DefaultStore) GetAccountByEmail(email string) (*try6.Account, error) {
+	log.LogD("Loading Account", "pkg", "store", "func", "GetAccountByEmail(string)", "email", email)
+	email, err := try6.ParseEmail(email)
+	if err != nil {
+		return nil, tryerr.ErrEmailNotFound
+	}
+	var a try6.Account
+	if err := d.C.SQL(`SELECT a.* FROM accounts a WHERE a.deleted IS NULL AND (a.email_key=$1 OR (a.email_key=$2 AND NOT EXISTS (
+		SELECT 1 FROM directory_account da JOIN directories d ON d.id = da.directory_id
+		WHERE da.account_id = a.id AND da.deleted IS NULL AND d.case_sensitive_email)))`,
+		try6.EmailKey(email, true), try6.EmailKey(email, false)).QueryStruct(&a); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrEmailNotFound
+		}
+		log.LogE("error loading account", "pkg", "store", "func", "GetAccountByEmail(string)", "error", err.Error())
+		return nil, err
+	}
+	return &a, nil
+}
+
+// EmailInUse tells if an account already has the email key, as given by
+// try6.EmailKey, in a directory with the case sensitivity given. Emails of case
+// insensitive directories collide with the ones of any account that only differ
+// in case, and emails of case sensitive directories with the same email or the
+// lowercased email of an account of a case insensitive directory, so
+// GetAccountByEmail always finds a single account.
+func (d *DefaultStore) EmailInUse(key string, caseSensitive bool) (bool, error) {
+	log.LogD("Checking Email", "pkg", "store", "func", "EmailInUse(string, bool)", "key", key, "caseSensitive", caseSensitive)
+	var inUse bool
+	var err error
+	if caseSensitive {
+		err = d.C.SQL(`SELECT EXISTS (SELECT 1 FROM accounts a WHERE a.deleted IS NULL AND (a.email_key=$1 OR (a.email_key=$2 AND NOT EXISTS (
+			SELECT 1 FROM directory_account da JOIN directories d ON d.id = da.directory_id
+			WHERE da.account_id = a.id AND da.deleted IS NULL AND d.case_sensitive_email))))`,
+			key, try6.EmailKey(key, false)).QueryScalar(&inUse)
+	} else {
+		err = d.C.SQL("SELECT EXISTS (SELECT 1 FROM accounts WHERE lower(email_key)=$1 AND deleted IS NULL)", key).QueryScalar(&inUse)
+	}
+	if err != nil {
+		log.LogE("error checking email", "pkg", "store", "func", "EmailInUse(string, bool)", "error", err.Error())
+		return false, err
+	}
+	return inUse, nil
+}
+
+// SaveAccount persist the account data to the database. If directory is not empty
+// the account is added to it, and the password of new accounts to their history as
+// the policy of the directory says. New accounts without status are created unverified
+// and the status of existing ones is only changed by ChangeStatus.
 func (d *DefaultStore) SaveAccount(directory string, t *try6.Account) error {
 	log.LogD("Saving Account", "pkg", "store", "func", "SaveAccount(*try6.Account)", "directory", directory, "data", t)
 	now := time.Now().UTC()
 	t.Updated = now
-	if t.ID == "" {
+	isNew := t.ID == ""
+	if isNew {
 		// New Account
 		t.Created = now
-		t.Status = "active"
+		if t.Status == "" {
+			t.Status = try6.StatusUnverified
+		}
+		if t.EmailKey == "" {
+			t.EmailKey = try6.EmailKey(t.Email, false)
+		}
 		if err := d.C.InsertInto("accounts").Blacklist("id", "deleted").Record(t).Returning("*").QueryStruct(t); err != nil {
 			log.LogE("error saving account", "pkg", "store", "func", "SaveAccount(*try6.Account)", "error", err.Error())
 			return err
 		}
 	} else {
-		if err := d.C.Update("accounts").SetBlacklist(t, "id", "created").Where("id=$1", t.ID).Returning("*").QueryStruct(t); err != nil {
+		if err := d.C.Update("accounts").SetBlacklist(t, "id", "status", "created").Where("id=$1", t.ID).Returning("*").QueryStruct(t); err != nil {
 			log.LogE("error updating account", "pkg", "store", "func", "SaveAccount(*try6.Account)", "error", err.Error())
 			return err
 		}
 	}
 
 	log.LogD("account inserted", "pkg", "store", "func", "SaveAccount(*try6.Account)", "data", t)
+	if directory == "" {
+		return nil
+	}
+	if isNew && t.Password != "" {
+		policy, err := d.GetPasswordPolicy(directory)
+		if err != nil {
+			return err
+		}
+		if err := addPasswordHistory(d.C, t.ID, t.Password, policy.HistoryCount); err != nil {
+			return err
+		}
+	}
 	// add to directory
 	if _, err := d.C.Upsert("directory_account").Columns("directory_id", "account_id", "created", "updated").Record(&try6.DirectoryAccount{
 		DirectoryID: directory,
@@ -50,3 +145,195 @@ func (d *DefaultStore) SaveAccount(directory string, t *try6.Account) error {
 	}
 	return nil
 }
+
+// SaveAccountPassword persist the password hash of an existing account and adds
+// it to the account password history. Only the last keep hashes are retained in
+// the history, none if keep is 0.
+func (d *DefaultStore) SaveAccountPassword(a *try6.Account, keep int64) error {
+	log.LogD("Saving Account Password", "pkg", "store", "func", "SaveAccountPassword(*try6.Account, int64)", "id", a.ID)
+	if a.ID == "" {
+		return tryerr.ErrAccountNotProvided
+	}
+	tx, err := d.C.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+	if err := savePassword(tx, a, keep); err != nil {
+		log.LogE("error updating account password", "pkg", "store", "func", "SaveAccountPassword(*try6.Account, int64)", "error", err.Error())
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetAccountPassword uses the password reset token and saves the password of its
+// account, as SaveAccountPassword does, in the same transaction. Nothing is saved
+// if the token has already been used and tryerr.ErrInvalidToken is returned.
+func (d *DefaultStore) ResetAccountPassword(t *try6.AccountToken, a *try6.Account, keep int64) error {
+	log.LogD("Resetting Account Password", "pkg", "store", "func", "ResetAccountPassword(*try6.AccountToken, *try6.Account, int64)", "id", a.ID)
+	if a.ID == "" || a.ID != t.AccountID {
+		return tryerr.ErrAccountNotProvided
+	}
+	tx, err := d.C.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+	now := time.Now().UTC()
+	res, err := tx.Update("account_tokens").Set("used", now).Where("id=$1 AND used IS NULL", t.ID).Exec()
+	if err != nil {
+		log.LogE("error using account token", "pkg", "store", "func", "ResetAccountPassword(*try6.AccountToken, *try6.Account, int64)", "error", err.Error())
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return tryerr.ErrInvalidToken
+	}
+	if err := savePassword(tx, a, keep); err != nil {
+		log.LogE("error updating account password", "pkg", "store", "func", "ResetAccountPassword(*try6.AccountToken, *try6.Account, int64)", "error", err.Error())
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	t.Used.Time, t.Used.Valid = now, true
+	return nil
+}
+
+// savePassword updates the password hash of the account and its history
+func savePassword(c runner.Connection, a *try6.Account, keep int64) error {
+	a.Updated = time.Now().UTC()
+	if _, err := c.Update("accounts").
+		Set("password", a.Password).
+		Set("password_changed", a.PasswordChanged).
+		Set("updated", a.Updated).
+		Where("id=$1", a.ID).Exec(); err != nil {
+		return err
+	}
+	return addPasswordHistory(c, a.ID, a.Password, keep)
+}
+
+// SaveAccountPasswordHash updates the password hash of the account after it has
+// been rehashed. Neither the password change date nor the history are modified.
+func (d *DefaultStore) SaveAccountPasswordHash(a *try6.Account) error {
+	log.LogD("Saving Account Password Hash", "pkg", "store", "func", "SaveAccountPasswordHash(*try6.Account)", "id", a.ID)
+	if a.ID == "" {
+		return tryerr.ErrAccountNotProvided
+	}
+	if _, err := d.C.Update("accounts").Set("password", a.Password).Where("id=$1", a.ID).Exec(); err != nil {
+		log.LogE("error updating account password hash", "pkg", "store", "func", "SaveAccountPasswordHash(*try6.Account)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// SaveAccountProfile updates the profile fields of an existing account
+func (d *DefaultStore) SaveAccountProfile(a *try6.Account) error {
+	log.LogD("Saving Account Profile", "pkg", "store", "func", "SaveAccountProfile(*try6.Account)", "id", a.ID)
+	if a.ID == "" {
+		return tryerr.ErrAccountNotProvided
+	}
+	a.Updated = time.Now().UTC()
+	if _, err := d.C.Update("accounts").SetMap(map[string]interface{}{
+		"name":        a.Name,
+		"given_name":  a.GivenName,
+		"family_name": a.FamilyName,
+		"middle_name": a.MiddleName,
+		"username":    a.Username,
+		"phone":       a.Phone,
+		"locale":      a.Locale,
+		"timezone":    a.Timezone,
+		"picture":     a.Picture,
+		"updated":     a.Updated,
+	}).Where("id=$1", a.ID).Exec(); err != nil {
+		log.LogE("error updating account profile", "pkg", "store", "func", "SaveAccountProfile(*try6.Account)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetPasswordHistory returns the last n password hashes of the account, newest first
+func (d *DefaultStore) GetPasswordHistory(accountID string, n int64) ([]string, error) {
+	log.LogD("Loading Password History", "pkg", "store", "func", "GetPasswordHistory(string, int64)", "id", accountID, "n", n)
+	var hashes []string
+	if n <= 0 {
+		return hashes, nil
+	}
+	if err := d.C.Select("password").From("password_history").Where("account_id=$1", accountID).OrderBy("created DESC").Limit(uint64(n)).QuerySlice(&hashes); err != nil {
+		log.LogE("error loading password history", "pkg", "store", "func", "GetPasswordHistory(string, int64)", "error", err.Error())
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// addPasswordHistory records the hash in the account password history and removes
+// the entries older than the last keep ones. If keep is 0 the hash is not recorded
+// and the whole history of the account is removed.
+func addPasswordHistory(c runner.Connection, accountID, hash string, keep int64) error {
+	if keep <= 0 {
+		if _, err := c.DeleteFrom("password_history").Where("account_id=$1", accountID).Exec(); err != nil {
+			log.LogE("error pruning password history", "pkg", "store", "func", "addPasswordHistory(runner.Connection, string, string, int64)", "error", err.Error())
+			return err
+		}
+		return nil
+	}
+	if _, err := c.InsertInto("password_history").Columns("account_id", "password", "created").Values(accountID, hash, time.Now().UTC()).Exec(); err != nil {
+		log.LogE("error saving password history", "pkg", "store", "func", "addPasswordHistory(runner.Connection, string, string, int64)", "error", err.Error())
+		return err
+	}
+	if _, err := c.SQL(`DELETE FROM password_history WHERE account_id=$1 AND id NOT IN (
+		SELECT id FROM password_history WHERE account_id=$1 ORDER BY created DESC LIMIT $2)`, accountID, keep).Exec(); err != nil {
+		log.LogE("error pruning password history", "pkg", "store", "func", "addPasswordHistory(runner.Connection, string, string, int64)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// ListAccounts returns a page of the accounts that match the query and the cursor
+// of the next page, empty if it is the last one
+func (d *DefaultStore) ListAccounts(q *ListQuery) ([]*try6.Account, string, error) {
+	log.LogD("Listing Accounts", "pkg", "store", "func", "ListAccounts(*ListQuery)", "query", q)
+	from := "accounts a"
+	if q.DirectoryID != "" {
+		from += " JOIN directory_account da ON da.account_id = a.id AND da.deleted IS NULL"
+	}
+	if len(q.CustomData) > 0 {
+		from += " JOIN account_custom_data cd ON cd.account_id = a.id"
+	}
+	b := d.C.Select("a.*").From(from).Where("a.deleted IS NULL")
+	if q.DirectoryID != "" {
+		b = b.Where("da.directory_id=$1", q.DirectoryID)
+	}
+	for k, v := range q.CustomData {
+		if v == "" {
+			b = b.Where("exist(cd.data, $1)", k)
+		} else {
+			b = b.Where("cd.data -> $1 = $2", k, v)
+		}
+	}
+	b, err := q.apply(b, accountListing)
+	if err != nil {
+		return nil, "", err
+	}
+	var accounts []*try6.Account
+	if err := b.QueryStructs(&accounts); err != nil {
+		log.LogE("error listing accounts", "pkg", "store", "func", "ListAccounts(*ListQuery)", "error", err.Error())
+		return nil, "", err
+	}
+	next, err := q.next(accountListing, len(accounts), func(i int, sort string) (string, string) {
+		a := accounts[i]
+		switch sort {
+		case "email":
+			return a.Email, a.ID
+		case "name":
+			return a.Name, a.ID
+		}
+		return timeValue(a.Created), a.ID
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if next != "" {
+		accounts = accounts[:q.limit()]
+	}
+	return accounts, next, nil
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// APIKeyer mandates the methods to manage the API keys of the accounts
+type APIKeyer interface {
+	SaveAPIKey(k *try6.APIKey) error
+	GetAPIKey(id string) (*try6.APIKey, error)
+	GetAPIKeysByAccountID(accountID string) ([]*try6.APIKey, error)
+	DeleteAPIKey(accountID, id string) error
+	TouchAPIKey(id string) error
+}
+
+// SaveAPIKey persist a new API key
+func (d *DefaultStore) SaveAPIKey(k *try6.APIKey) error {
+	log.LogD("Saving API Key", "pkg", "store", "func", "SaveAPIKey(*try6.APIKey)", "id", k.ID, "account", k.AccountID)
+	if _, err := d.C.InsertInto("api_keys").Blacklist("last_used", "deleted").Record(k).Exec(); err != nil {
+		log.LogE("error saving api key", "pkg", "store", "func", "SaveAPIKey(*try6.APIKey)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetAPIKey returns the API key with the given id or tryerr.ErrAPIKeyNotFound
+func (d *DefaultStore) GetAPIKey(id string) (*try6.APIKey, error) {
+	log.LogD("Loading API Key", "pkg", "store", "func", "GetAPIKey(string)", "id", id)
+	var k try6.APIKey
+	if err := d.C.Select("*").From("api_keys").Where("id=$1 AND deleted IS NULL", id).QueryStruct(&k); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrAPIKeyNotFound
+		}
+		log.LogE("error loading api key", "pkg", "store", "func", "GetAPIKey(string)", "error", err.Error())
+		return nil, err
+	}
+	return &k, nil
+}
+
+// GetAPIKeysByAccountID returns the API keys of the account, newest first
+func (d *DefaultStore) GetAPIKeysByAccountID(accountID string) ([]*try6.APIKey, error) {
+	log.LogD("Listing API Keys", "pkg", "store", "func", "GetAPIKeysByAccountID(string)", "accountID", accountID)
+	var ks []*try6.APIKey
+	if err := d.C.Select("*").From("api_keys").Where("account_id=$1 AND deleted IS NULL", accountID).OrderBy("created DESC").QueryStructs(&ks); err != nil {
+		log.LogE("error listing api keys", "pkg", "store", "func", "GetAPIKeysByAccountID(string)", "error", err.Error())
+		return nil, err
+	}
+	return ks, nil
+}
+
+// DeleteAPIKey marks the API key of the account as deleted, so it can no longer
+// authenticate. It returns tryerr.ErrAPIKeyNotFound if the account has no such key.
+func (d *DefaultStore) DeleteAPIKey(accountID, id string) error {
+	log.LogD("Deleting API Key", "pkg", "store", "func", "DeleteAPIKey(string, string)", "accountID", accountID, "id", id)
+	res, err := d.C.Update("api_keys").Set("deleted", time.Now().UTC()).Where("id=$1 AND account_id=$2 AND deleted IS NULL", id, accountID).Exec()
+	if err != nil {
+		log.LogE("error deleting api key", "pkg", "store", "func", "DeleteAPIKey(string, string)", "error", err.Error())
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return tryerr.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey sets the last use of the API key to now. It is only updated once
+// every try6.APIKeyTouchInterval to save writes on busy keys.
+func (d *DefaultStore) TouchAPIKey(id string) error {
+	now := time.Now().UTC()
+	if _, err := d.C.Update("api_keys").Set("last_used", now).Where("id=$1 AND (last_used IS NULL OR last_used < $2)", id, now.Add(-try6.APIKeyTouchInterval)).Exec(); err != nil {
+		log.LogE("error touching api key", "pkg", "store", "func", "TouchAPIKey(string)", "error", err.Error())
+		return err
+	}
+	return nil
+}
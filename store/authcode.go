@@ -0,0 +1,42 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// AuthCoder mandates the methods to keep the authorization codes issued
+type AuthCoder interface {
+	SaveAuthCode(c *try6.AuthCode) error
+	UseAuthCode(hash string) (*try6.AuthCode, error)
+}
+
+// SaveAuthCode persist a new authorization code
+func (d *DefaultStore) SaveAuthCode(c *try6.AuthCode) error {
+	log.LogD("Saving Authorization Code", "pkg", "store", "func", "SaveAuthCode(*try6.AuthCode)", "client", c.ClientID, "account", c.AccountID)
+	if err := d.C.InsertInto("authorization_codes").Blacklist("id", "used").Record(c).Returning("id").QueryScalar(&c.ID); err != nil {
+		log.LogE("error saving authorization code", "pkg", "store", "func", "SaveAuthCode(*try6.AuthCode)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// UseAuthCode marks the authorization code with the given hash as used and returns
+// it. A code can only be used once, tryerr.ErrInvalidGrant is returned if it does
+// not exist or has already been used.
+func (d *DefaultStore) UseAuthCode(hash string) (*try6.AuthCode, error) {
+	log.LogD("Using Authorization Code", "pkg", "store", "func", "UseAuthCode(string)")
+	var c try6.AuthCode
+	if err := d.C.Update("authorization_codes").Set("used", time.Now().UTC()).Where("hash=$1 AND used IS NULL", hash).Returning("*").QueryStruct(&c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrInvalidGrant
+		}
+		log.LogE("error using authorization code", "pkg", "store", "func", "UseAuthCode(string)", "error", err.Error())
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+)
+
+// Brander mandates the methods to manage the look of the login page of the tenants
+type Brander interface {
+	GetBranding(tenantID string) (*try6.Branding, error)
+	SaveBranding(b *try6.Branding) error
+}
+
+// GetBranding returns the branding of the tenant or the default one if it has not
+// set its own
+func (d *DefaultStore) GetBranding(tenantID string) (*try6.Branding, error) {
+	log.LogD("Loading Branding", "pkg", "store", "func", "GetBranding(string)", "tenantID", tenantID)
+	var b try6.Branding
+	if err := d.C.Select("*").From("tenant_branding").Where("tenant_id=$1", tenantID).QueryStruct(&b); err != nil {
+		if err == sql.ErrNoRows {
+			return try6.DefaultBranding(tenantID), nil
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+// SaveBranding creates or replaces the branding of the tenant
+func (d *DefaultStore) SaveBranding(b *try6.Branding) error {
+	log.LogD("Saving Branding", "pkg", "store", "func", "SaveBranding(*try6.Branding)", "data", b)
+	b.Updated = time.Now().UTC()
+	if _, err := d.C.Upsert("tenant_branding").Columns("tenant_id", "display_name", "logo_url", "primary_color", "background_color", "updated").Record(b).Where("tenant_id=$1", b.TenantID).Exec(); err != nil {
+		log.LogE("error saving branding", "pkg", "store", "func", "SaveBranding(*try6.Branding)", "error", err.Error())
+		return err
+	}
+	return nil
+}
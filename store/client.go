@@ -0,0 +1,68 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Clienter mandates the methods to manage the OAuth clients of the scopes
+type Clienter interface {
+	SaveClient(c *try6.Client) error
+	GetClientByID(id string) (*try6.Client, error)
+	GetClientsByScopeID(scopeID string) ([]*try6.Client, error)
+}
+
+// SaveClient persist the client data to the database. New clients are created
+// active and the status of existing ones is only changed by ChangeStatus. The scope
+// of a client can not be changed.
+func (d *DefaultStore) SaveClient(c *try6.Client) error {
+	log.LogD("Saving Client", "pkg", "store", "func", "SaveClient(*try6.Client)", "id", c.ID, "scope", c.ScopeID)
+	now := time.Now().UTC()
+	c.Updated = now
+	if c.ID == "" {
+		// New Client
+		c.Created = now
+		c.Status = try6.StatusActive
+		if err := d.C.InsertInto("clients").Blacklist("id", "deleted").Record(c).Returning("id").QueryScalar(&c.ID); err != nil {
+			log.LogE("error saving client", "pkg", "store", "func", "SaveClient(*try6.Client)", "error", err.Error())
+			return err
+		}
+		return nil
+	}
+	if err := d.C.Update("clients").SetBlacklist(c, "id", "scope_id", "status", "created", "deleted").Where("id=$1 AND deleted IS NULL", c.ID).Returning("*").QueryStruct(c); err != nil {
+		if err == sql.ErrNoRows {
+			return tryerr.ErrClientNotFound
+		}
+		log.LogE("error updating client", "pkg", "store", "func", "SaveClient(*try6.Client)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetClientByID returns the client with the given id or tryerr.ErrClientNotFound
+func (d *DefaultStore) GetClientByID(id string) (*try6.Client, error) {
+	log.LogD("Loading Client", "pkg", "store", "func", "GetClientByID(string)", "id", id)
+	var c try6.Client
+	if err := d.C.Select("*").From("clients").Where("id=$1 AND deleted IS NULL", id).QueryStruct(&c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrClientNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetClientsByScopeID returns the clients of the scope
+func (d *DefaultStore) GetClientsByScopeID(scopeID string) ([]*try6.Client, error) {
+	log.LogD("Listing Clients", "pkg", "store", "func", "GetClientsByScopeID(string)", "scopeID", scopeID)
+	var clients []*try6.Client
+	if err := d.C.Select("*").From("clients").Where("scope_id=$1 AND deleted IS NULL", scopeID).OrderBy("created, id").QueryStructs(&clients); err != nil {
+		log.LogE("error listing clients", "pkg", "store", "func", "GetClientsByScopeID(string)", "error", err.Error())
+		return nil, err
+	}
+	return clients, nil
+}
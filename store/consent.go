@@ -0,0 +1,91 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Consenter mandates the methods to keep the scopes the accounts granted to third
+// party clients
+type Consenter interface {
+	SaveConsent(c *try6.Consent) error
+	GetConsent(accountID, clientID string) (*try6.Consent, error)
+	GetConsentsByAccountID(accountID string) ([]*try6.Consent, error)
+	RevokeConsent(accountID, clientID string) error
+}
+
+// SaveConsent persist the consent of the account to the client, replacing the one
+// it had
+func (d *DefaultStore) SaveConsent(c *try6.Consent) error {
+	log.LogD("Saving Consent", "pkg", "store", "func", "SaveConsent(*try6.Consent)", "account", c.AccountID, "client", c.ClientID)
+	if err := d.C.Upsert("consents").Columns("account_id", "client_id", "scope", "updated", "revoked").Record(c).Where("account_id=$1 AND client_id=$2", c.AccountID, c.ClientID).Returning("id").QueryScalar(&c.ID); err != nil {
+		log.LogE("error saving consent", "pkg", "store", "func", "SaveConsent(*try6.Consent)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetConsent returns the consent of the account to the client, even if it has been
+// revoked, or tryerr.ErrConsentNotFound if it never consented
+func (d *DefaultStore) GetConsent(accountID, clientID string) (*try6.Consent, error) {
+	log.LogD("Loading Consent", "pkg", "store", "func", "GetConsent(string, string)", "accountID", accountID, "clientID", clientID)
+	var c try6.Consent
+	if err := d.C.Select("id", "account_id", "client_id", "scope", "created", "updated", "revoked").From("consents").Where("account_id=$1 AND client_id=$2", accountID, clientID).QueryStruct(&c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrConsentNotFound
+		}
+		log.LogE("error loading consent", "pkg", "store", "func", "GetConsent(string, string)", "error", err.Error())
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetConsentsByAccountID returns the consents of the account that have not been
+// revoked, with the name of their clients, latest updated first
+func (d *DefaultStore) GetConsentsByAccountID(accountID string) ([]*try6.Consent, error) {
+	log.LogD("Listing Consents", "pkg", "store", "func", "GetConsentsByAccountID(string)", "accountID", accountID)
+	var cs []*try6.Consent
+	if err := d.C.Select("c.id", "c.account_id", "c.client_id", "cl.name AS client_name", "c.scope", "c.created", "c.updated", "c.revoked").
+		From("consents c JOIN clients cl ON cl.id = c.client_id").
+		Where("c.account_id=$1 AND c.revoked IS NULL", accountID).
+		OrderBy("c.updated DESC").QueryStructs(&cs); err != nil {
+		log.LogE("error listing consents", "pkg", "store", "func", "GetConsentsByAccountID(string)", "error", err.Error())
+		return nil, err
+	}
+	return cs, nil
+}
+
+// RevokeConsent marks the consent of the account to the client as revoked and
+// revokes the access tokens and the live refresh tokens the client holds on behalf
+// of the account. It returns tryerr.ErrConsentNotFound if there is no consent to
+// revoke.
+func (d *DefaultStore) RevokeConsent(accountID, clientID string) error {
+	log.LogD("Revoking Consent", "pkg", "store", "func", "RevokeConsent(string, string)", "accountID", accountID, "clientID", clientID)
+	tx, err := d.C.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+	now := time.Now().UTC()
+	res, err := tx.Update("consents").Set("revoked", now).Set("updated", now).Where("account_id=$1 AND client_id=$2 AND revoked IS NULL", accountID, clientID).Exec()
+	if err != nil {
+		log.LogE("error revoking consent", "pkg", "store", "func", "RevokeConsent(string, string)", "error", err.Error())
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return tryerr.ErrConsentNotFound
+	}
+	if _, err := revokeJWTs(tx, "account_id=$4 AND client_id=$5", accountID, clientID); err != nil {
+		log.LogE("error revoking jwt", "pkg", "store", "func", "RevokeConsent(string, string)", "error", err.Error())
+		return err
+	}
+	if _, err := tx.Update("refresh_tokens").Set("revoked", now).Where("revoked IS NULL AND rotated IS NULL AND expires > $1 AND idle_expires > $2 AND account_id=$3 AND client_id=$4", now, now, accountID, clientID).Exec(); err != nil {
+		log.LogE("error revoking refresh tokens", "pkg", "store", "func", "RevokeConsent(string, string)", "error", err.Error())
+		return err
+	}
+	return tx.Commit()
+}
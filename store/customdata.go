@@ -0,0 +1,84 @@
+package store
+
+import (
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+)
+
+// CustomDataer defines the methods needed to manage the custom data of the accounts
+type CustomDataer interface {
+	GetAccountCustomData(accountID string) (try6.CustomData, error)
+	SaveAccountCustomData(accountID string, data try6.CustomData) error
+	PatchAccountCustomData(accountID string, changes map[string]*string) (try6.CustomData, error)
+}
+
+// GetAccountCustomData returns the custom data document of the account. It is
+// empty if the account has none.
+func (d *DefaultStore) GetAccountCustomData(accountID string) (try6.CustomData, error) {
+	data := try6.CustomData{}
+	err := d.C.Select("data").From("account_custom_data").Where("account_id=$1", accountID).QueryScalar(&data)
+	switch {
+	case err == dat.ErrNotFound:
+		return try6.CustomData{}, nil
+	case err != nil:
+		log.LogE("error loading custom data", "pkg", "store", "func", "GetAccountCustomData(string)", "error", err.Error())
+		return nil, err
+	}
+	if data == nil {
+		data = try6.CustomData{}
+	}
+	return data, nil
+}
+
+// SaveAccountCustomData replaces the custom data document of the account
+func (d *DefaultStore) SaveAccountCustomData(accountID string, data try6.CustomData) error {
+	log.LogD("Saving Account Custom Data", "pkg", "store", "func", "SaveAccountCustomData(string, try6.CustomData)", "account", accountID)
+	if err := data.Validate(); err != nil {
+		return err
+	}
+	if data == nil {
+		data = try6.CustomData{}
+	}
+	if _, err := d.C.SQL("INSERT INTO account_custom_data (account_id, data) VALUES ($1, $2) ON CONFLICT (account_id) DO UPDATE SET data = EXCLUDED.data", accountID, data).Exec(); err != nil {
+		log.LogE("error saving custom data", "pkg", "store", "func", "SaveAccountCustomData(string, try6.CustomData)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// PatchAccountCustomData applies the changes to the custom data document of the
+// account and returns the resulting document. A nil value removes the key.
+func (d *DefaultStore) PatchAccountCustomData(accountID string, changes map[string]*string) (try6.CustomData, error) {
+	log.LogD("Patching Account Custom Data", "pkg", "store", "func", "PatchAccountCustomData(string, map[string]*string)", "account", accountID)
+	tx, err := d.C.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.AutoRollback()
+	// the row is created first so that concurrent patches of an account with no
+	// custom data wait for each other in the lock below
+	if _, err := tx.SQL("INSERT INTO account_custom_data (account_id, data) VALUES ($1, ''::hstore) ON CONFLICT (account_id) DO NOTHING", accountID).Exec(); err != nil {
+		log.LogE("error creating custom data", "pkg", "store", "func", "PatchAccountCustomData(string, map[string]*string)", "error", err.Error())
+		return nil, err
+	}
+	data := try6.CustomData{}
+	err = tx.SQL("SELECT data FROM account_custom_data WHERE account_id=$1 FOR UPDATE", accountID).QueryScalar(&data)
+	if err != nil && err != dat.ErrNotFound {
+		log.LogE("error loading custom data", "pkg", "store", "func", "PatchAccountCustomData(string, map[string]*string)", "error", err.Error())
+		return nil, err
+	}
+	if data == nil {
+		data = try6.CustomData{}
+	}
+	data.Patch(changes)
+	if err := data.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Update("account_custom_data").Set("data", data).Where("account_id=$1", accountID).Exec(); err != nil {
+		log.LogE("error saving custom data", "pkg", "store", "func", "PatchAccountCustomData(string, map[string]*string)", "error", err.Error())
+		return nil, err
+	}
+	return data, tx.Commit()
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// DeviceCoder mandates the methods to keep the device codes issued
+type DeviceCoder interface {
+	SaveDeviceCode(c *try6.DeviceCode) error
+	GetDeviceCode(hash string) (*try6.DeviceCode, error)
+	GetDeviceCodeByUserCode(userCode string) (*try6.DeviceCode, error)
+	SaveDevicePoll(c *try6.DeviceCode) error
+	ApproveDeviceCode(c *try6.DeviceCode) error
+	UseDeviceCode(id string) error
+}
+
+// SaveDeviceCode persist a new device code
+func (d *DefaultStore) SaveDeviceCode(c *try6.DeviceCode) error {
+	log.LogD("Saving Device Code", "pkg", "store", "func", "SaveDeviceCode(*try6.DeviceCode)", "client", c.ClientID)
+	if err := d.C.InsertInto("device_codes").Blacklist("id", "account_id", "auth_time", "last_poll").Record(c).Returning("id").QueryScalar(&c.ID); err != nil {
+		log.LogE("error saving device code", "pkg", "store", "func", "SaveDeviceCode(*try6.DeviceCode)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetDeviceCode returns the device code with the given hash or
+// tryerr.ErrInvalidGrant if it does not exist
+func (d *DefaultStore) GetDeviceCode(hash string) (*try6.DeviceCode, error) {
+	log.LogD("Loading Device Code", "pkg", "store", "func", "GetDeviceCode(string)")
+	var c try6.DeviceCode
+	if err := d.C.Select("*").From("device_codes").Where("hash=$1", hash).QueryStruct(&c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrInvalidGrant
+		}
+		log.LogE("error loading device code", "pkg", "store", "func", "GetDeviceCode(string)", "error", err.Error())
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetDeviceCodeByUserCode returns the pending device code with the given user code
+// or tryerr.ErrInvalidUserCode if there is none or it has expired
+func (d *DefaultStore) GetDeviceCodeByUserCode(userCode string) (*try6.DeviceCode, error) {
+	log.LogD("Loading Device Code", "pkg", "store", "func", "GetDeviceCodeByUserCode(string)")
+	var c try6.DeviceCode
+	if err := d.C.Select("*").From("device_codes").Where("user_code=$1 AND status=$2 AND expires > $3", userCode, try6.DeviceCodePending, time.Now().UTC()).Limit(1).QueryStruct(&c); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrInvalidUserCode
+		}
+		log.LogE("error loading device code", "pkg", "store", "func", "GetDeviceCodeByUserCode(string)", "error", err.Error())
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveDevicePoll updates the time the device polled for tokens and its interval
+func (d *DefaultStore) SaveDevicePoll(c *try6.DeviceCode) error {
+	log.LogD("Saving Device Poll", "pkg", "store", "func", "SaveDevicePoll(*try6.DeviceCode)", "id", c.ID)
+	if _, err := d.C.Update("device_codes").SetMap(map[string]interface{}{"last_poll": c.LastPoll, "interval": c.Interval}).Where("id=$1", c.ID).Exec(); err != nil {
+		log.LogE("error saving device poll", "pkg", "store", "func", "SaveDevicePoll(*try6.DeviceCode)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// ApproveDeviceCode saves the account that approved, or denied, the device code.
+// The code must still be pending, otherwise tryerr.ErrInvalidUserCode is returned.
+func (d *DefaultStore) ApproveDeviceCode(c *try6.DeviceCode) error {
+	log.LogD("Approving Device Code", "pkg", "store", "func", "ApproveDeviceCode(*try6.DeviceCode)", "id", c.ID, "account", c.AccountID.String)
+	res, err := d.C.Update("device_codes").SetMap(map[string]interface{}{
+		"status":     c.Status,
+		"account_id": c.AccountID,
+		"amr":        c.AMR,
+		"auth_time":  c.AuthTime,
+	}).Where("id=$1 AND status=$2", c.ID, try6.DeviceCodePending).Exec()
+	if err != nil {
+		log.LogE("error approving device code", "pkg", "store", "func", "ApproveDeviceCode(*try6.DeviceCode)", "error", err.Error())
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return tryerr.ErrInvalidUserCode
+	}
+	return nil
+}
+
+// UseDeviceCode marks the approved device code as used. A code can only be
+// exchanged for tokens once, tryerr.ErrInvalidGrant is returned if it is not
+// approved.
+func (d *DefaultStore) UseDeviceCode(id string) error {
+	log.LogD("Using Device Code", "pkg", "store", "func", "UseDeviceCode(string)", "id", id)
+	res, err := d.C.Update("device_codes").Set("status", try6.DeviceCodeUsed).Where("id=$1 AND status=$2", id, try6.DeviceCodeApproved).Exec()
+	if err != nil {
+		log.LogE("error using device code", "pkg", "store", "func", "UseDeviceCode(string)", "error", err.Error())
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return tryerr.ErrInvalidGrant
+	}
+	return nil
+}
@@ -1,18 +1,25 @@
 package store
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/jllopis/try6"
 	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
 )
 
 // Directer defines the methods needed to manage Tenants
 type Directer interface {
 	SaveDirectory(d *try6.Directory) error
+	GetDirectoryByID(id string) (*try6.Directory, error)
+	GetDirectoriesByAccountID(id string) ([]*try6.Directory, error)
+	GetDirectoriesByScopeID(id string) ([]*try6.Directory, error)
+	CountDirectoryAccounts(id string) (int64, error)
 }
 
-// SaveDirectory persist the directory data to the database
+// SaveDirectory persist the directory data to the database. New directories are
+// created active and the status of existing ones is only changed by ChangeStatus.
 func (d *DefaultStore) SaveDirectory(t *try6.Directory) error {
 	log.LogD("Saving Directory", "pkg", "store", "func", "SaveDirectory(*try6.Directory)", "data", t)
 	now := time.Now().UTC()
@@ -20,7 +27,68 @@ func (d *DefaultStore) SaveDirectory(t *try6.Directory) error {
 	if t.ID == "" {
 		// New Directory
 		t.Created = now
+		if t.Status == "" {
+			t.Status = try6.StatusActive
+		}
 		return d.C.InsertInto("directories").Blacklist("id", "deleted").Record(t).Returning("id").QueryScalar(&t.ID)
 	}
-	return d.C.Update("directories").SetBlacklist(t, "id", "tenant_uid", "created").Where("id=$1", t.ID).Returning("*").QueryStruct(t)
+	return d.C.Update("directories").SetBlacklist(t, "id", "tenant_uid", "status", "admin", "created", "deleted").Where("id=$1", t.ID).Returning("*").QueryStruct(t)
+}
+
+// GetDirectoryByID returns the directory with the given id or tryerr.ErrDirectoryNotFound
+// if it does not exist
+func (d *DefaultStore) GetDirectoryByID(id string) (*try6.Directory, error) {
+	log.LogD("Loading Directory", "pkg", "store", "func", "GetDirectoryByID(string)", "id", id)
+	var dir try6.Directory
+	if err := d.C.Select("*").From("directories").Where("id=$1 AND deleted IS NULL", id).QueryStruct(&dir); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrDirectoryNotFound
+		}
+		return nil, err
+	}
+	return &dir, nil
+}
+
+// GetDirectoriesByAccountID returns the list of directories the account belongs to
+func (d *DefaultStore) GetDirectoriesByAccountID(id string) ([]*try6.Directory, error) {
+	log.LogD("Listing Directories", "pkg", "store", "func", "GetDirectoriesByAccountID(id string)", "accountID", id)
+	var dirs []*try6.Directory
+	err := d.C.Select("d.*").
+		From("directories d JOIN directory_account da ON da.directory_id = d.id").
+		Where("da.account_id=$1 AND da.deleted IS NULL AND d.deleted IS NULL", id).
+		QueryStructs(&dirs)
+	if err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// GetDirectoriesByScopeID returns the list of directories mapped to the scope, in
+// order of priority
+func (d *DefaultStore) GetDirectoriesByScopeID(id string) ([]*try6.Directory, error) {
+	log.LogD("Listing Directories", "pkg", "store", "func", "GetDirectoriesByScopeID(id string)", "scopeID", id)
+	var dirs []*try6.Directory
+	err := d.C.Select("d.*").
+		From("directories d JOIN directory_scope ds ON ds.directory_id = d.id").
+		Where("ds.scope_id=$1 AND ds.deleted IS NULL AND d.deleted IS NULL", id).
+		OrderBy("ds.priority").
+		QueryStructs(&dirs)
+	if err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// CountDirectoryAccounts returns the number of accounts of the directory that have
+// not been deleted
+func (d *DefaultStore) CountDirectoryAccounts(id string) (int64, error) {
+	var n int64
+	if err := d.C.Select("count(*)").
+		From("directory_account da JOIN accounts a ON a.id = da.account_id").
+		Where("da.directory_id=$1 AND da.deleted IS NULL AND a.deleted IS NULL", id).
+		QueryScalar(&n); err != nil {
+		log.LogE("error counting directory accounts", "pkg", "store", "func", "CountDirectoryAccounts(string)", "error", err.Error())
+		return 0, err
+	}
+	return n, nil
 }
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// ImportJober defines the methods needed to track the bulk imports of accounts
+type ImportJober interface {
+	SaveImportJob(j *try6.ImportJob) error
+	GetImportJob(id string) (*try6.ImportJob, error)
+	FailInterruptedImportJobs() (int64, error)
+}
+
+// SaveImportJob persist the import job and its progress to the database
+func (d *DefaultStore) SaveImportJob(j *try6.ImportJob) error {
+	log.LogD("Saving Import Job", "pkg", "store", "func", "SaveImportJob(*try6.ImportJob)", "id", j.ID, "status", j.Status)
+	now := time.Now().UTC()
+	j.Updated = now
+	if j.ID == "" {
+		j.Created = now
+		return d.C.InsertInto("import_jobs").Blacklist("id").Record(j).Returning("id").QueryScalar(&j.ID)
+	}
+	if _, err := d.C.Update("import_jobs").SetBlacklist(j, "id", "directory_id", "format", "created").Where("id=$1", j.ID).Exec(); err != nil {
+		log.LogE("error updating import job", "pkg", "store", "func", "SaveImportJob(*try6.ImportJob)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetImportJob returns the import job with the given id
+func (d *DefaultStore) GetImportJob(id string) (*try6.ImportJob, error) {
+	var j try6.ImportJob
+	if err := d.C.Select("*").From("import_jobs").Where("id=$1", id).QueryStruct(&j); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrImportJobNotFound
+		}
+		log.LogE("error loading import job", "pkg", "store", "func", "GetImportJob(string)", "error", err.Error())
+		return nil, err
+	}
+	return &j, nil
+}
+
+// FailInterruptedImportJobs marks as failed the pending and running import jobs.
+// The imported files are spooled to temporary files that do not outlive the server
+// so these jobs cannot be resumed. It must be called at startup, before any import
+// is started, and returns the number of jobs failed.
+func (d *DefaultStore) FailInterruptedImportJobs() (int64, error) {
+	var jobs []*try6.ImportJob
+	if err := d.C.Select("*").From("import_jobs").Where("status=$1 OR status=$2", try6.ImportPending, try6.ImportRunning).QueryStructs(&jobs); err != nil {
+		log.LogE("error loading interrupted import jobs", "pkg", "store", "func", "FailInterruptedImportJobs()", "error", err.Error())
+		return 0, err
+	}
+	for _, j := range jobs {
+		j.Finish(tryerr.ErrImportInterrupted)
+		if err := d.SaveImportJob(j); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(jobs)), nil
+}
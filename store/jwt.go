@@ -0,0 +1,38 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// JWTer mandates the methods to keep the record of the tokens issued
+type JWTer interface {
+	SaveJWT(t *try6.JWT) error
+	GetJWT(id string) (*try6.JWT, error)
+}
+
+// SaveJWT records a token issued. The id of the record is the jti of the token.
+func (d *DefaultStore) SaveJWT(t *try6.JWT) error {
+	log.LogD("Saving JWT", "pkg", "store", "func", "SaveJWT(*try6.JWT)", "id", t.ID)
+	if _, err := d.C.InsertInto("jwt").Blacklist("updated", "deleted").Record(t).Exec(); err != nil {
+		log.LogE("error saving jwt", "pkg", "store", "func", "SaveJWT(*try6.JWT)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetJWT returns the record of the token with the given jti or tryerr.ErrTokenNotFound
+func (d *DefaultStore) GetJWT(id string) (*try6.JWT, error) {
+	log.LogD("Loading JWT", "pkg", "store", "func", "GetJWT(string)", "id", id)
+	var t try6.JWT
+	if err := d.C.Select("*").From("jwt").Where("id=$1 AND deleted IS NULL", id).QueryStruct(&t); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrTokenNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
@@ -1,10 +1,12 @@
 package store
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/jllopis/try6"
 	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
 )
 
 // Keyer mandates the methods to implement when dealing with keys
@@ -12,13 +14,18 @@ type Keyer interface {
 	//	LoadAllKeys() ([]*keys.Key, error)
 	//	LoadKey(kid string) (*keys.Key, error)
 	SaveKey(key *try6.Key) error
+	GetKeyByID(id string) (*try6.Key, error)
+	GetSigningKey(tenantID string) (*try6.Key, error)
+	GetKeysByTenantID(tenantID string) ([]*try6.Key, error)
+	GetActiveKeys() ([]*try6.Key, error)
 	//	DeleteKey(kid string) error
 	//	GetKeyByAccountID(uid string) (*keys.Key, error)
 	//	GetKeyByEmail(email string) (*keys.Key, error)
 	//	GetKeyByPub(pubkey []byte) (*keys.Key, error)
 }
 
-// SaveKey persist the key data to the database
+// SaveKey persist the key data to the database. New keys are created active and
+// the status of existing ones is only changed by ChangeStatus.
 func (d *DefaultStore) SaveKey(key *try6.Key) error {
 	log.LogD("Saving Key", "pkg", "store", "func", "SaveKey(*try6.Key)", "data", key)
 	now := time.Now().UTC()
@@ -26,13 +33,13 @@ func (d *DefaultStore) SaveKey(key *try6.Key) error {
 	if key.ID == "" {
 		// New Key
 		key.Created = now
-		key.Status = "active"
+		key.Status = try6.StatusActive
 		if err := d.C.InsertInto("keys").Blacklist("id", "deleted").Record(key).Returning("*").QueryStruct(key); err != nil {
 			log.LogE("error saving key", "pkg", "store", "func", "SaveKey(*try6.Key)", "error", err.Error())
 			return err
 		}
 	} else {
-		if err := d.C.Update("keys").SetBlacklist(key, "id", "created").Where("id=$1", key.ID).Returning("*").QueryStruct(key); err != nil {
+		if err := d.C.Update("keys").SetBlacklist(key, "id", "status", "created").Where("id=$1", key.ID).Returning("*").QueryStruct(key); err != nil {
 			log.LogE("error updating key", "pkg", "store", "func", "SaveKey(*try6.Key)", "error", err.Error())
 			return err
 		}
@@ -41,3 +48,51 @@ func (d *DefaultStore) SaveKey(key *try6.Key) error {
 	log.LogD("key inserted", "pkg", "store", "func", "SaveKey(*try6.Key)", "data", key)
 	return nil
 }
+
+// GetKeyByID returns the key of a tenant with the given id or tryerr.ErrKeyNotFound.
+// Keys of no tenant do not sign tokens and are not found.
+func (d *DefaultStore) GetKeyByID(id string) (*try6.Key, error) {
+	log.LogD("Loading Key", "pkg", "store", "func", "GetKeyByID(string)", "id", id)
+	var k try6.Key
+	if err := d.C.Select("*").From("keys").Where("id=$1 AND tenant_id IS NOT NULL AND deleted IS NULL", id).QueryStruct(&k); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return &k, nil
+}
+
+// GetSigningKey returns the newest active key of the tenant, the one its tokens are
+// signed with, or tryerr.ErrKeyNotFound
+func (d *DefaultStore) GetSigningKey(tenantID string) (*try6.Key, error) {
+	log.LogD("Loading Signing Key", "pkg", "store", "func", "GetSigningKey(string)", "tenantID", tenantID)
+	var k try6.Key
+	if err := d.C.Select("*").From("keys").Where("tenant_id=$1 AND status=$2 AND deleted IS NULL", tenantID, try6.StatusActive).OrderBy("created DESC").Limit(1).QueryStruct(&k); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return &k, nil
+}
+
+// GetKeysByTenantID returns the active keys of the tenant, newest first
+func (d *DefaultStore) GetKeysByTenantID(tenantID string) ([]*try6.Key, error) {
+	log.LogD("Loading Keys", "pkg", "store", "func", "GetKeysByTenantID(string)", "tenantID", tenantID)
+	var keys []*try6.Key
+	if err := d.C.Select("*").From("keys").Where("tenant_id=$1 AND status=$2 AND deleted IS NULL", tenantID, try6.StatusActive).OrderBy("created DESC").QueryStructs(&keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetActiveKeys returns the active keys of all the tenants, newest first
+func (d *DefaultStore) GetActiveKeys() ([]*try6.Key, error) {
+	log.LogD("Loading Active Keys", "pkg", "store", "func", "GetActiveKeys()")
+	var keys []*try6.Key
+	if err := d.C.Select("*").From("keys").Where("tenant_id IS NOT NULL AND status=$1 AND deleted IS NULL", try6.StatusActive).OrderBy("created DESC").QueryStructs(&keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
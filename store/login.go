@@ -0,0 +1,69 @@
+package store
+
+import (
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// LoginAuditer defines the methods needed to record and query failed logins
+type LoginAuditer interface {
+	SaveLoginFailure(f *try6.LoginFailure) error
+	CountLoginFailuresByIP(ip string, since time.Time) (int64, error)
+	IncFailedLogins(accountID string) (int64, error)
+	SaveAccountLockout(a *try6.Account, from string) error
+}
+
+// SaveLoginFailure persist the failed login to the database
+func (d *DefaultStore) SaveLoginFailure(f *try6.LoginFailure) error {
+	log.LogD("Saving Login Failure", "pkg", "store", "func", "SaveLoginFailure(*try6.LoginFailure)", "data", f)
+	if f.Created.IsZero() {
+		f.Created = time.Now().UTC()
+	}
+	return d.C.InsertInto("login_failures").Blacklist("id").Record(f).Returning("id").QueryScalar(&f.ID)
+}
+
+// CountLoginFailuresByIP returns the number of failed logins from the address since the given time
+func (d *DefaultStore) CountLoginFailuresByIP(ip string, since time.Time) (int64, error) {
+	var n int64
+	if err := d.C.Select("count(*)").From("login_failures").Where("ip=$1 AND created >= $2", ip, since).QueryScalar(&n); err != nil {
+		log.LogE("error counting login failures", "pkg", "store", "func", "CountLoginFailuresByIP(string, time.Time)", "error", err.Error())
+		return 0, err
+	}
+	return n, nil
+}
+
+// IncFailedLogins atomically increments the failed logins counter of the account
+// and returns its new value
+func (d *DefaultStore) IncFailedLogins(accountID string) (int64, error) {
+	var n int64
+	if err := d.C.SQL("UPDATE accounts SET failed_logins = failed_logins + 1 WHERE id=$1 RETURNING failed_logins", accountID).QueryScalar(&n); err != nil {
+		log.LogE("error incrementing failed logins", "pkg", "store", "func", "IncFailedLogins(string)", "error", err.Error())
+		return 0, err
+	}
+	return n, nil
+}
+
+// SaveAccountLockout persist the lockout state and status of the account. The
+// account must still be in the status from, otherwise tryerr.ErrInvalidTransition
+// is returned and nothing is saved.
+func (d *DefaultStore) SaveAccountLockout(a *try6.Account, from string) error {
+	a.Updated = time.Now().UTC()
+	res, err := d.C.Update("accounts").
+		Set("failed_logins", a.FailedLogins).
+		Set("lock_count", a.LockCount).
+		Set("locked_until", a.LockedUntil).
+		Set("status", a.Status).
+		Set("updated", a.Updated).
+		Where("id=$1 AND status=$2 AND deleted IS NULL", a.ID, from).Exec()
+	if err != nil {
+		log.LogE("error saving account lockout", "pkg", "store", "func", "SaveAccountLockout(*try6.Account, string)", "error", err.Error())
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return tryerr.ErrInvalidTransition
+	}
+	return nil
+}
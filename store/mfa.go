@@ -0,0 +1,77 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// MFAer defines the methods needed to manage the second factors of the accounts
+type MFAer interface {
+	SaveAccountMFA(m *try6.AccountMFA) error
+	GetAccountMFA(accountID, kind string) (*try6.AccountMFA, error)
+	DeleteAccountMFA(accountID, kind string) error
+	UseMFAStep(m *try6.AccountMFA) error
+}
+
+// SaveAccountMFA persist the second factor to the database. A new one replaces any
+// other of the same kind the account had.
+func (d *DefaultStore) SaveAccountMFA(m *try6.AccountMFA) error {
+	log.LogD("Saving Account MFA", "pkg", "store", "func", "SaveAccountMFA(*try6.AccountMFA)", "account", m.AccountID, "kind", m.Kind)
+	now := time.Now().UTC()
+	m.Updated = now
+	if m.ID == "" {
+		// New MFA
+		if err := d.DeleteAccountMFA(m.AccountID, m.Kind); err != nil {
+			return err
+		}
+		m.Created = now
+		return d.C.InsertInto("account_mfa").Blacklist("id", "deleted").Record(m).Returning("id").QueryScalar(&m.ID)
+	}
+	return d.C.Update("account_mfa").SetBlacklist(m, "id", "account_id", "created").Where("id=$1", m.ID).Returning("*").QueryStruct(m)
+}
+
+// GetAccountMFA returns the second factor of the given kind of the account or
+// tryerr.ErrMFANotFound if it has none
+func (d *DefaultStore) GetAccountMFA(accountID, kind string) (*try6.AccountMFA, error) {
+	var m try6.AccountMFA
+	if err := d.C.Select("*").From("account_mfa").Where("account_id=$1 AND kind=$2 AND deleted IS NULL", accountID, kind).OrderBy("created DESC").Limit(1).QueryStruct(&m); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrMFANotFound
+		}
+		log.LogE("error loading account mfa", "pkg", "store", "func", "GetAccountMFA(string, string)", "error", err.Error())
+		return nil, err
+	}
+	return &m, nil
+}
+
+// DeleteAccountMFA marks as deleted the second factors of the given kind of the account
+func (d *DefaultStore) DeleteAccountMFA(accountID, kind string) error {
+	if _, err := d.C.Update("account_mfa").Set("deleted", time.Now().UTC()).Where("account_id=$1 AND kind=$2 AND deleted IS NULL", accountID, kind).Exec(); err != nil {
+		log.LogE("error deleting account mfa", "pkg", "store", "func", "DeleteAccountMFA(string, string)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// UseMFAStep persist the step of the last code accepted. It fails with
+// tryerr.ErrInvalidMFACode if a code of the same or a later step was already used,
+// so concurrent requests can not reuse a code.
+func (d *DefaultStore) UseMFAStep(m *try6.AccountMFA) error {
+	var id string
+	err := d.C.Update("account_mfa").Set("last_step", m.LastStep).Set("confirmed", m.Confirmed).Set("updated", time.Now().UTC()).
+		Where("id=$1 AND last_step < $2", m.ID, m.LastStep).Returning("id").QueryScalar(&id)
+	switch {
+	case err == dat.ErrNotFound:
+		return tryerr.ErrInvalidMFACode
+	case err != nil:
+		log.LogE("error updating account mfa", "pkg", "store", "func", "UseMFAStep(*try6.AccountMFA)", "error", err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+)
+
+// Policier defines the methods needed to manage directory password policies
+type Policier interface {
+	SavePasswordPolicy(p *try6.PasswordPolicy) error
+	GetPasswordPolicy(directoryID string) (*try6.PasswordPolicy, error)
+	GetPasswordPolicyByAccountID(accountID string) (*try6.PasswordPolicy, error)
+}
+
+// SavePasswordPolicy persist the password policy data to the database
+func (d *DefaultStore) SavePasswordPolicy(p *try6.PasswordPolicy) error {
+	log.LogD("Saving Password Policy", "pkg", "store", "func", "SavePasswordPolicy(*try6.PasswordPolicy)", "data", p)
+	now := time.Now().UTC()
+	p.Updated = now
+	if p.ID == "" {
+		// New Policy
+		p.Created = now
+		return d.C.InsertInto("password_creation_policies").Blacklist("id", "deleted").Record(p).Returning("id").QueryScalar(&p.ID)
+	}
+	return d.C.Update("password_creation_policies").SetBlacklist(p, "id", "directory_id", "created").Where("id=$1", p.ID).Returning("*").QueryStruct(p)
+}
+
+// GetPasswordPolicy returns the password policy of the directory. If the directory
+// has no policy defined, the default one is returned.
+func (d *DefaultStore) GetPasswordPolicy(directoryID string) (*try6.PasswordPolicy, error) {
+	log.LogD("Loading Password Policy", "pkg", "store", "func", "GetPasswordPolicy(string)", "directoryID", directoryID)
+	var p try6.PasswordPolicy
+	err := d.C.Select("*").From("password_creation_policies").Where("directory_id=$1 AND deleted IS NULL", directoryID).OrderBy("created DESC").Limit(1).QueryStruct(&p)
+	switch {
+	case err == sql.ErrNoRows:
+		return try6.NewPasswordPolicy(directoryID), nil
+	case err != nil:
+		log.LogE("error loading password policy", "pkg", "store", "func", "GetPasswordPolicy(string)", "error", err.Error())
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPasswordPolicyByAccountID returns the password policy that applies to the
+// account. When the account belongs to several directories, the strictest history,
+// maximum age and lockout values are used. Directories with no policy defined
+// apply the default one.
+func (d *DefaultStore) GetPasswordPolicyByAccountID(accountID string) (*try6.PasswordPolicy, error) {
+	log.LogD("Loading Password Policy", "pkg", "store", "func", "GetPasswordPolicyByAccountID(string)", "accountID", accountID)
+	var policies []*try6.PasswordPolicy
+	err := d.C.Select("p.*").
+		From("password_creation_policies p JOIN directory_account da ON da.directory_id = p.directory_id").
+		Where("da.account_id=$1 AND da.deleted IS NULL AND p.deleted IS NULL", accountID).
+		QueryStructs(&policies)
+	if err != nil {
+		log.LogE("error loading password policy", "pkg", "store", "func", "GetPasswordPolicyByAccountID(string)", "error", err.Error())
+		return nil, err
+	}
+	var directories []string
+	if err := d.C.Select("directory_id").From("directory_account").Where("account_id=$1 AND deleted IS NULL", accountID).QuerySlice(&directories); err != nil {
+		log.LogE("error loading account directories", "pkg", "store", "func", "GetPasswordPolicyByAccountID(string)", "error", err.Error())
+		return nil, err
+	}
+	defined := map[string]bool{}
+	for _, p := range policies {
+		defined[p.DirectoryID] = true
+	}
+	for _, dir := range directories {
+		if !defined[dir] {
+			policies = append(policies, try6.NewPasswordPolicy(dir))
+		}
+	}
+	if len(policies) == 0 {
+		return try6.NewPasswordPolicy(""), nil
+	}
+	return mergePolicies(policies), nil
+}
+
+// mergePolicies returns the strictest history, maximum age and lockout values of
+// the policies. The first policy is modified and returned.
+func mergePolicies(policies []*try6.PasswordPolicy) *try6.PasswordPolicy {
+	policy := policies[0]
+	for _, p := range policies[1:] {
+		if p.HistoryCount > policy.HistoryCount {
+			policy.HistoryCount = p.HistoryCount
+		}
+		if p.MaxAgeDays > 0 && (policy.MaxAgeDays == 0 || p.MaxAgeDays < policy.MaxAgeDays) {
+			policy.MaxAgeDays = p.MaxAgeDays
+		}
+		// a lockout with no minutes lasts until the account is unlocked
+		untilUnlocked := policy.LockoutThreshold > 0 && policy.LockoutMinutes == 0
+		if p.LockoutThreshold > 0 && !untilUnlocked && (p.LockoutMinutes == 0 || p.LockoutMinutes > policy.LockoutMinutes) {
+			policy.LockoutMinutes = p.LockoutMinutes
+		}
+		if p.LockoutThreshold > 0 && (policy.LockoutThreshold == 0 || p.LockoutThreshold < policy.LockoutThreshold) {
+			policy.LockoutThreshold = p.LockoutThreshold
+		}
+	}
+	return policy
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// DefaultListLimit is the page size of the list methods when none is given
+	DefaultListLimit uint64 = 50
+	// MaxListLimit is the maximum page size of the list methods
+	MaxListLimit uint64 = 500
+)
+
+/*
+ListQuery holds the filters, sort order and page of the list methods of the store.
+Filters that do not apply to the listed items are ignored.
+
+Sort is the name of a sortable field, prefixed with "-" for descending order. The
+items are paged with keyset pagination: Cursor is the opaque value returned along
+with the previous page, so pages stay consistent while items are added and deep
+pages are as cheap as the first one.
+*/
+type ListQuery struct {
+	Status        string
+	EmailPrefix   string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	DirectoryID   string
+	CustomData    try6.CustomData
+	Sort          string
+	Cursor        string
+	Limit         uint64
+}
+
+// cursor is the position after the last item of a page
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"i"`
+}
+
+// sortField is a sortable column and the SQL type of the cursor values
+type sortField struct {
+	column string
+	cast   string
+}
+
+// listing describes how the items of a table are listed
+type listing struct {
+	alias       string
+	email       bool
+	sorts       map[string]sortField
+	defaultSort string
+}
+
+var (
+	accountListing = &listing{
+		alias: "a",
+		email: true,
+		sorts: map[string]sortField{
+			"created": {"a.created", "timestamp"},
+			"email":   {"a.email", "text"},
+			"name":    {"a.name", "text"},
+		},
+		defaultSort: "created",
+	}
+	scopeListing = &listing{
+		alias: "s",
+		sorts: map[string]sortField{
+			"created": {"s.created", "timestamp"},
+			"label":   {"s.label", "text"},
+		},
+		defaultSort: "created",
+	}
+)
+
+// sort returns the name and field of the sort order of the query and whether it
+// is descending
+func (q *ListQuery) sort(l *listing) (string, sortField, bool, error) {
+	name := q.Sort
+	if name == "" {
+		name = l.defaultSort
+	}
+	desc := strings.HasPrefix(name, "-")
+	f, ok := l.sorts[strings.TrimPrefix(name, "-")]
+	if !ok {
+		return "", sortField{}, false, tryerr.ErrInvalidSort
+	}
+	return name, f, desc, nil
+}
+
+// limit returns the page size of the query
+func (q *ListQuery) limit() uint64 {
+	switch {
+	case q.Limit == 0:
+		return DefaultListLimit
+	case q.Limit > MaxListLimit:
+		return MaxListLimit
+	}
+	return q.Limit
+}
+
+// apply adds the filters, order and limit of the query to the select. One more
+// item than the page size is requested to know if there is a next page.
+func (q *ListQuery) apply(b *dat.SelectBuilder, l *listing) (*dat.SelectBuilder, error) {
+	col := func(c string) string { return l.alias + "." + c }
+	if q.Status != "" {
+		b = b.Where(col("status")+"=$1", q.Status)
+	}
+	if q.EmailPrefix != "" && l.email {
+		b = b.Where(col("email")+" LIKE $1", escapeLike(q.EmailPrefix)+"%")
+	}
+	if !q.CreatedAfter.IsZero() {
+		b = b.Where(col("created")+">=$1", q.CreatedAfter.UTC())
+	}
+	if !q.CreatedBefore.IsZero() {
+		b = b.Where(col("created")+"<$1", q.CreatedBefore.UTC())
+	}
+	name, f, desc, err := q.sort(l)
+	if err != nil {
+		return nil, err
+	}
+	dir, op := "ASC", ">"
+	if desc {
+		dir, op = "DESC", "<"
+	}
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil || c.Sort != name {
+			return nil, tryerr.ErrInvalidCursor
+		}
+		b = b.Where(fmt.Sprintf("(%s, %s) %s ($1::%s, $2::uuid)", f.column, col("id"), op, f.cast), c.Value, c.ID)
+	}
+	return b.OrderBy(fmt.Sprintf("%s %s, %s %s", f.column, dir, col("id"), dir)).Limit(q.limit() + 1), nil
+}
+
+// next returns the cursor of the page after the n items loaded with the query, or
+// "" if there are no more items. value returns the sort value and the id of the
+// i-th item.
+func (q *ListQuery) next(l *listing, n int, value func(i int, sort string) (string, string)) (string, error) {
+	if uint64(n) <= q.limit() {
+		return "", nil
+	}
+	name, _, _, err := q.sort(l)
+	if err != nil {
+		return "", err
+	}
+	v, id := value(int(q.limit())-1, strings.TrimPrefix(name, "-"))
+	return encodeCursor(&cursor{Sort: name, Value: v, ID: id})
+}
+
+func encodeCursor(c *cursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// timeValue formats a time as a cursor value
+func timeValue(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// RecoveryCoder defines the methods needed to manage the MFA recovery codes
+type RecoveryCoder interface {
+	ReplaceRecoveryCodes(accountID string, codes []*try6.RecoveryCode) error
+	GetRecoveryCodes(accountID string) ([]*try6.RecoveryCode, error)
+	UseRecoveryCode(c *try6.RecoveryCode, ip string) error
+	DeleteRecoveryCodes(accountID string) error
+}
+
+// ReplaceRecoveryCodes removes the recovery codes of the account and stores the new ones
+func (d *DefaultStore) ReplaceRecoveryCodes(accountID string, codes []*try6.RecoveryCode) error {
+	log.LogD("Replacing Recovery Codes", "pkg", "store", "func", "ReplaceRecoveryCodes(string, []*try6.RecoveryCode)", "account", accountID)
+	tx, err := d.C.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+	if _, err := tx.DeleteFrom("recovery_codes").Where("account_id=$1", accountID).Exec(); err != nil {
+		log.LogE("error deleting recovery codes", "pkg", "store", "func", "ReplaceRecoveryCodes(string, []*try6.RecoveryCode)", "error", err.Error())
+		return err
+	}
+	for _, c := range codes {
+		c.AccountID = accountID
+		if err := tx.InsertInto("recovery_codes").Blacklist("id", "used").Record(c).Returning("id").QueryScalar(&c.ID); err != nil {
+			log.LogE("error saving recovery code", "pkg", "store", "func", "ReplaceRecoveryCodes(string, []*try6.RecoveryCode)", "error", err.Error())
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRecoveryCodes returns the unused recovery codes of the account
+func (d *DefaultStore) GetRecoveryCodes(accountID string) ([]*try6.RecoveryCode, error) {
+	var codes []*try6.RecoveryCode
+	if err := d.C.Select("*").From("recovery_codes").Where("account_id=$1 AND used IS NULL", accountID).QueryStructs(&codes); err != nil {
+		log.LogE("error loading recovery codes", "pkg", "store", "func", "GetRecoveryCodes(string)", "error", err.Error())
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode marks the recovery code as used and records its use from the ip
+// address for audit. It fails with tryerr.ErrInvalidMFACode if it was already used.
+func (d *DefaultStore) UseRecoveryCode(c *try6.RecoveryCode, ip string) error {
+	tx, err := d.C.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+	var used time.Time
+	err = tx.Update("recovery_codes").Set("used", time.Now().UTC()).Where("id=$1 AND used IS NULL", c.ID).Returning("used").QueryScalar(&used)
+	switch {
+	case err == dat.ErrNotFound:
+		return tryerr.ErrInvalidMFACode
+	case err != nil:
+		log.LogE("error using recovery code", "pkg", "store", "func", "UseRecoveryCode(*try6.RecoveryCode, string)", "error", err.Error())
+		return err
+	}
+	if _, err := tx.InsertInto("recovery_code_uses").Columns("account_id", "code_id", "ip", "created").Values(c.AccountID, c.ID, ip, used).Exec(); err != nil {
+		log.LogE("error recording recovery code use", "pkg", "store", "func", "UseRecoveryCode(*try6.RecoveryCode, string)", "error", err.Error())
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	c.Used = dat.NullTimeFrom(used)
+	return nil
+}
+
+// DeleteRecoveryCodes removes every recovery code of the account
+func (d *DefaultStore) DeleteRecoveryCodes(accountID string) error {
+	if _, err := d.C.DeleteFrom("recovery_codes").Where("account_id=$1", accountID).Exec(); err != nil {
+		log.LogE("error deleting recovery codes", "pkg", "store", "func", "DeleteRecoveryCodes(string)", "error", err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// RefreshTokener mandates the methods to keep the refresh tokens issued and their
+// families
+type RefreshTokener interface {
+	SaveRefreshToken(t *try6.RefreshToken) error
+	GetRefreshToken(hash string) (*try6.RefreshToken, error)
+	RotateRefreshToken(old, t *try6.RefreshToken) error
+	RevokeRefreshFamily(familyID string) error
+}
+
+// SaveRefreshToken persist a new refresh token
+func (d *DefaultStore) SaveRefreshToken(t *try6.RefreshToken) error {
+	log.LogD("Saving Refresh Token", "pkg", "store", "func", "SaveRefreshToken(*try6.RefreshToken)", "family", t.FamilyID, "client", t.ClientID)
+	if err := d.C.InsertInto("refresh_tokens").Blacklist("id", "rotated", "revoked").Record(t).Returning("id").QueryScalar(&t.ID); err != nil {
+		log.LogE("error saving refresh token", "pkg", "store", "func", "SaveRefreshToken(*try6.RefreshToken)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetRefreshToken returns the refresh token with the given hash, even if it has
+// been rotated or revoked, or tryerr.ErrInvalidGrant if it does not exist
+func (d *DefaultStore) GetRefreshToken(hash string) (*try6.RefreshToken, error) {
+	log.LogD("Loading Refresh Token", "pkg", "store", "func", "GetRefreshToken(string)")
+	var t try6.RefreshToken
+	if err := d.C.Select("*").From("refresh_tokens").Where("hash=$1", hash).QueryStruct(&t); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrInvalidGrant
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// RotateRefreshToken marks the old token as rotated and saves the new one of its
+// family. If the old token has already been rotated or revoked nothing is saved
+// and tryerr.ErrTokenReused is returned.
+func (d *DefaultStore) RotateRefreshToken(old, t *try6.RefreshToken) error {
+	log.LogD("Rotating Refresh Token", "pkg", "store", "func", "RotateRefreshToken(*try6.RefreshToken, *try6.RefreshToken)", "family", old.FamilyID)
+	tx, err := d.C.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+	res, err := tx.Update("refresh_tokens").Set("rotated", time.Now().UTC()).Where("id=$1 AND rotated IS NULL AND revoked IS NULL", old.ID).Exec()
+	if err != nil {
+		log.LogE("error rotating refresh token", "pkg", "store", "func", "RotateRefreshToken(*try6.RefreshToken, *try6.RefreshToken)", "error", err.Error())
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return tryerr.ErrTokenReused
+	}
+	if err := tx.InsertInto("refresh_tokens").Blacklist("id", "rotated", "revoked").Record(t).Returning("id").QueryScalar(&t.ID); err != nil {
+		log.LogE("error saving refresh token", "pkg", "store", "func", "RotateRefreshToken(*try6.RefreshToken, *try6.RefreshToken)", "error", err.Error())
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeRefreshFamily revokes every refresh token of the family and the access
+// tokens issued with them, that are added to the revocation feed
+func (d *DefaultStore) RevokeRefreshFamily(familyID string) error {
+	log.LogD("Revoking Refresh Family", "pkg", "store", "func", "RevokeRefreshFamily(string)", "family", familyID)
+	now := time.Now().UTC()
+	tx, err := d.C.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+	if _, err := tx.Update("refresh_tokens").Set("revoked", now).Where("family_id=$1 AND revoked IS NULL", familyID).Exec(); err != nil {
+		log.LogE("error revoking refresh tokens", "pkg", "store", "func", "RevokeRefreshFamily(string)", "error", err.Error())
+		return err
+	}
+	if _, err := revokeJWTs(tx, "family_id=$4", familyID); err != nil {
+		log.LogE("error revoking access tokens", "pkg", "store", "func", "RevokeRefreshFamily(string)", "error", err.Error())
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// InitialAccessTokener mandates the methods to keep the initial access tokens of
+// the dynamic client registration
+type InitialAccessTokener interface {
+	SaveInitialAccessToken(t *try6.InitialAccessToken) error
+	GetInitialAccessToken(hash string) (*try6.InitialAccessToken, error)
+	GetInitialAccessTokensByTenantID(tenantID string) ([]*try6.InitialAccessToken, error)
+	RevokeInitialAccessToken(tenantID, id string) error
+}
+
+// SaveInitialAccessToken persist a new initial access token
+func (d *DefaultStore) SaveInitialAccessToken(t *try6.InitialAccessToken) error {
+	log.LogD("Saving Initial Access Token", "pkg", "store", "func", "SaveInitialAccessToken(*try6.InitialAccessToken)", "tenant", t.TenantID, "scope", t.ScopeID)
+	if err := d.C.InsertInto("initial_access_tokens").Blacklist("id", "revoked").Record(t).Returning("id").QueryScalar(&t.ID); err != nil {
+		log.LogE("error saving initial access token", "pkg", "store", "func", "SaveInitialAccessToken(*try6.InitialAccessToken)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetInitialAccessToken returns the initial access token with the given hash or
+// tryerr.ErrInvalidToken if it does not exist
+func (d *DefaultStore) GetInitialAccessToken(hash string) (*try6.InitialAccessToken, error) {
+	log.LogD("Loading Initial Access Token", "pkg", "store", "func", "GetInitialAccessToken(string)")
+	var t try6.InitialAccessToken
+	if err := d.C.Select("*").From("initial_access_tokens").Where("hash=$1", hash).QueryStruct(&t); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrInvalidToken
+		}
+		log.LogE("error loading initial access token", "pkg", "store", "func", "GetInitialAccessToken(string)", "error", err.Error())
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetInitialAccessTokensByTenantID returns the initial access tokens of the tenant
+// that have not been revoked nor expired, newest first
+func (d *DefaultStore) GetInitialAccessTokensByTenantID(tenantID string) ([]*try6.InitialAccessToken, error) {
+	log.LogD("Listing Initial Access Tokens", "pkg", "store", "func", "GetInitialAccessTokensByTenantID(string)", "tenantID", tenantID)
+	var ts []*try6.InitialAccessToken
+	if err := d.C.Select("*").From("initial_access_tokens").Where("tenant_id=$1 AND revoked IS NULL AND expires > $2", tenantID, time.Now().UTC()).OrderBy("created DESC").QueryStructs(&ts); err != nil {
+		log.LogE("error listing initial access tokens", "pkg", "store", "func", "GetInitialAccessTokensByTenantID(string)", "error", err.Error())
+		return nil, err
+	}
+	return ts, nil
+}
+
+// RevokeInitialAccessToken revokes the initial access token of the tenant. It
+// returns tryerr.ErrTokenNotFound if the tenant has no such token not revoked yet.
+func (d *DefaultStore) RevokeInitialAccessToken(tenantID, id string) error {
+	log.LogD("Revoking Initial Access Token", "pkg", "store", "func", "RevokeInitialAccessToken(string, string)", "tenantID", tenantID, "id", id)
+	res, err := d.C.Update("initial_access_tokens").Set("revoked", time.Now().UTC()).Where("id=$1 AND tenant_id=$2 AND revoked IS NULL", id, tenantID).Exec()
+	if err != nil {
+		log.LogE("error revoking initial access token", "pkg", "store", "func", "RevokeInitialAccessToken(string, string)", "error", err.Error())
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return tryerr.ErrTokenNotFound
+	}
+	return nil
+}
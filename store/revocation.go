@@ -0,0 +1,106 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1/sqlx-runner"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// Revoker mandates the methods to revoke tokens before they expire and publish
+// the revocations
+type Revoker interface {
+	RevokeJWT(id string) error
+	RevokeTokens(entity, id string) (int64, int64, error)
+	GetRevocations(tenantID string, since int64, limit uint64) ([]*try6.Revocation, error)
+}
+
+// revokeConditions holds, for every entity whose tokens can be revoked in bulk, the
+// condition of the access tokens and of the refresh tokens of its items
+var revokeConditions = map[string]struct {
+	jwt     string
+	refresh string
+}{
+	try6.EntityAccount: {"account_id=$4", "account_id=$3"},
+	try6.EntityScope:   {"client_id IN (SELECT id FROM clients WHERE scope_id=$4)", "client_id IN (SELECT id FROM clients WHERE scope_id=$3)"},
+	try6.EntityTenant:  {"tenant_id=$4", "client_id IN (SELECT c.id FROM clients c JOIN scopes s ON s.id = c.scope_id WHERE s.tenant_id=$3)"},
+	try6.EntityClient:  {"client_id=$4", "client_id=$3"},
+}
+
+// RevokeJWT revokes the access token with the given jti and adds it to the
+// revocation feed of its tenant. Tokens already revoked or expired are left as
+// they are.
+func (d *DefaultStore) RevokeJWT(id string) error {
+	log.LogD("Revoking JWT", "pkg", "store", "func", "RevokeJWT(string)", "id", id)
+	tx, err := d.C.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+	if _, err := revokeJWTs(tx, "id=$4", id); err != nil {
+		log.LogE("error revoking jwt", "pkg", "store", "func", "RevokeJWT(string)", "error", err.Error())
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeTokens revokes the access tokens and the live refresh tokens issued for
+// the item of the entity: an account, a scope, a tenant or a client. It returns the
+// number of access and refresh tokens revoked.
+func (d *DefaultStore) RevokeTokens(entity, id string) (int64, int64, error) {
+	log.LogD("Revoking Tokens", "pkg", "store", "func", "RevokeTokens(string, string)", "entity", entity, "id", id)
+	cond, ok := revokeConditions[entity]
+	if !ok {
+		return 0, 0, tryerr.ErrInvalidEntity
+	}
+	tx, err := d.C.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.AutoRollback()
+	access, err := revokeJWTs(tx, cond.jwt, id)
+	if err != nil {
+		log.LogE("error revoking jwt", "pkg", "store", "func", "RevokeTokens(string, string)", "error", err.Error())
+		return 0, 0, err
+	}
+	now := time.Now().UTC()
+	res, err := tx.Update("refresh_tokens").Set("revoked", now).Where("revoked IS NULL AND rotated IS NULL AND expires > $1 AND idle_expires > $2 AND "+cond.refresh, now, now, id).Exec()
+	if err != nil {
+		log.LogE("error revoking refresh tokens", "pkg", "store", "func", "RevokeTokens(string, string)", "error", err.Error())
+		return 0, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return access, res.RowsAffected, nil
+}
+
+// GetRevocations returns up to limit revocations of the tenant made after the
+// position since, in order, whose tokens have not expired yet
+func (d *DefaultStore) GetRevocations(tenantID string, since int64, limit uint64) ([]*try6.Revocation, error) {
+	log.LogD("Listing Revocations", "pkg", "store", "func", "GetRevocations(string, int64, uint64)", "tenantID", tenantID, "since", since)
+	var revs []*try6.Revocation
+	if err := d.C.Select("*").From("revocations").Where("tenant_id=$1 AND id > $2 AND expires > $3", tenantID, since, time.Now().UTC()).OrderBy("id").Limit(limit).QueryStructs(&revs); err != nil {
+		log.LogE("error listing revocations", "pkg", "store", "func", "GetRevocations(string, int64, uint64)", "error", err.Error())
+		return nil, err
+	}
+	return revs, nil
+}
+
+// revokeJWTs marks as revoked the active, not expired, access tokens that match the
+// condition and adds them to the revocation feed. The condition arguments start at
+// $4. It returns the number of tokens revoked.
+func revokeJWTs(tx *runner.Tx, cond string, args ...interface{}) (int64, error) {
+	q := fmt.Sprintf(`WITH revoked AS (
+		UPDATE jwt SET status=$1, updated=$2 WHERE status=$3 AND expires > $2 AND tenant_id IS NOT NULL AND %s RETURNING id, tenant_id, expires
+	) INSERT INTO revocations (jti, tenant_id, expires, created) SELECT id, tenant_id, expires, $2 FROM revoked`, cond)
+	res, err := tx.SQL(q, append([]interface{}{try6.StatusRevoked, time.Now().UTC(), try6.StatusActive}, args...)...).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected, nil
+}
@@ -1,19 +1,23 @@
 package store
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/jllopis/try6"
 	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
 )
 
 // Scoper defines the methods needed to manage Tenants
 type Scoper interface {
 	SaveScope(s *try6.Scope) error
-	GetScopesByTenantID(id string) ([]*try6.Scope, error)
+	GetScopesByTenantID(id string, q *ListQuery) ([]*try6.Scope, string, error)
+	GetScopeByID(id string) (*try6.Scope, error)
 }
 
-// SaveScope persist the scope data to the database
+// SaveScope persist the scope data to the database. New scopes are created active
+// and the status of existing ones is only changed by ChangeStatus.
 func (d *DefaultStore) SaveScope(s *try6.Scope) error {
 	log.LogD("Saving Scope", "pkg", "store", "func", "SaveScope(*try6.Scope)", "data", s)
 	now := time.Now().UTC()
@@ -21,19 +25,50 @@ func (d *DefaultStore) SaveScope(s *try6.Scope) error {
 	if s.ID == "" {
 		// New Scope
 		s.Created = now
+		if s.Status == "" {
+			s.Status = try6.StatusActive
+		}
 		return d.C.InsertInto("scopes").Blacklist("id", "deleted").Record(s).Returning("id").QueryScalar(&s.ID)
 	}
-	return d.C.Update("scopes").SetBlacklist(s, "id", "tenant_uid", "created").Where("id=$1", s.ID).Returning("*").QueryStruct(s)
+	return d.C.Update("scopes").SetBlacklist(s, "id", "tenant_id", "status", "created").Where("id=$1", s.ID).Returning("*").QueryStruct(s)
 }
 
-// GetScopesByTenantID returns a list of scopes owned by the tenant or an error
-// if something goes wrong
-func (d *DefaultStore) GetScopesByTenantID(id string) ([]*try6.Scope, error) {
-	log.LogD("Listing Scopes", "pkg", "store", "func", "GetScopesByTenantID(id string)", "tenantID", id)
+// GetScopesByTenantID returns a page of the scopes owned by the tenant that match
+// the query and the cursor of the next page, empty if it is the last one
+func (d *DefaultStore) GetScopesByTenantID(id string, q *ListQuery) ([]*try6.Scope, string, error) {
+	log.LogD("Listing Scopes", "pkg", "store", "func", "GetScopesByTenantID(string, *ListQuery)", "tenantID", id, "query", q)
+	b, err := q.apply(d.C.Select("s.*").From("scopes s").Where("s.tenant_id=$1 AND s.deleted IS NULL", id), scopeListing)
+	if err != nil {
+		return nil, "", err
+	}
 	var scopes []*try6.Scope
-	err := d.C.Select("*").From("scopes").Where("tenant_id=$1 AND deleted IS NULL", id).QueryStructs(&scopes)
+	if err := b.QueryStructs(&scopes); err != nil {
+		return nil, "", err
+	}
+	next, err := q.next(scopeListing, len(scopes), func(i int, sort string) (string, string) {
+		if sort == "label" {
+			return scopes[i].Label, scopes[i].ID
+		}
+		return timeValue(scopes[i].Created), scopes[i].ID
+	})
 	if err != nil {
+		return nil, "", err
+	}
+	if next != "" {
+		scopes = scopes[:q.limit()]
+	}
+	return scopes, next, nil
+}
+
+// GetScopeByID returns the scope with the given id or tryerr.ErrScopeNotFound
+func (d *DefaultStore) GetScopeByID(id string) (*try6.Scope, error) {
+	log.LogD("Loading Scope", "pkg", "store", "func", "GetScopeByID(string)", "id", id)
+	var s try6.Scope
+	if err := d.C.Select("*").From("scopes").Where("id=$1 AND deleted IS NULL", id).QueryStruct(&s); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrScopeNotFound
+		}
 		return nil, err
 	}
-	return scopes, nil
+	return &s, nil
 }
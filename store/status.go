@@ -0,0 +1,115 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// StatusChanger mandates the methods to change the status of the items and keep
+// the record of the changes
+type StatusChanger interface {
+	GetStatus(entity, id string) (string, error)
+	ChangeStatus(c *try6.StatusChange) error
+	RecordStatusChange(c *try6.StatusChange) error
+	GetStatusChanges(entity, id string) ([]*try6.StatusChange, error)
+}
+
+// statusTables holds the table of every entity and the error returned when an
+// item is not found
+var statusTables = map[string]struct {
+	table    string
+	notFound error
+}{
+	try6.EntityAccount:   {"accounts", tryerr.ErrAccountNotFound},
+	try6.EntityDirectory: {"directories", tryerr.ErrDirectoryNotFound},
+	try6.EntityScope:     {"scopes", tryerr.ErrScopeNotFound},
+	try6.EntityTenant:    {"tenants", tryerr.ErrTenantNotFound},
+	try6.EntityKey:       {"keys", tryerr.ErrKeyNotFound},
+	try6.EntityClient:    {"clients", tryerr.ErrClientNotFound},
+}
+
+// GetStatus returns the status of the item of the entity. Deleted items are not found.
+func (d *DefaultStore) GetStatus(entity, id string) (string, error) {
+	log.LogD("Loading Status", "pkg", "store", "func", "GetStatus(string, string)", "entity", entity, "id", id)
+	t, ok := statusTables[entity]
+	if !ok {
+		return "", tryerr.ErrInvalidEntity
+	}
+	var status string
+	if err := d.C.Select("status").From(t.table).Where("id=$1 AND deleted IS NULL", id).QueryScalar(&status); err != nil {
+		if err == sql.ErrNoRows || err == dat.ErrNotFound {
+			return "", t.notFound
+		}
+		log.LogE("error loading status", "pkg", "store", "func", "GetStatus(string, string)", "error", err.Error())
+		return "", err
+	}
+	return status, nil
+}
+
+// ChangeStatus applies the status change to its item and records it. The item must
+// still be in the status the change starts from, otherwise
+// tryerr.ErrInvalidTransition is returned. Deleted items are marked as deleted and
+// unlocked accounts get their lockout state reset.
+func (d *DefaultStore) ChangeStatus(c *try6.StatusChange) error {
+	log.LogD("Changing Status", "pkg", "store", "func", "ChangeStatus(*try6.StatusChange)", "entity", c.Entity, "id", c.EntityID, "from", c.From, "to", c.To)
+	t, ok := statusTables[c.Entity]
+	if !ok {
+		return tryerr.ErrInvalidEntity
+	}
+	now := time.Now().UTC()
+	set := map[string]interface{}{"status": c.To, "updated": now}
+	if c.To == try6.StatusDeleted {
+		set["deleted"] = now
+	}
+	if c.Entity == try6.EntityAccount && c.From == try6.StatusLocked && c.To == try6.StatusActive {
+		set["failed_logins"] = 0
+		set["lock_count"] = 0
+		set["locked_until"] = nil
+	}
+	tx, err := d.C.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+	res, err := tx.Update(t.table).SetMap(set).Where("id=$1 AND status=$2 AND deleted IS NULL", c.EntityID, c.From).Exec()
+	if err != nil {
+		log.LogE("error changing status", "pkg", "store", "func", "ChangeStatus(*try6.StatusChange)", "error", err.Error())
+		return err
+	}
+	if res.RowsAffected == 0 {
+		return tryerr.ErrInvalidTransition
+	}
+	if err := tx.InsertInto("status_changes").Blacklist("id").Record(c).Returning("id").QueryScalar(&c.ID); err != nil {
+		log.LogE("error recording status change", "pkg", "store", "func", "ChangeStatus(*try6.StatusChange)", "error", err.Error())
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordStatusChange records a status change already saved with its item, such as
+// the lock of an account
+func (d *DefaultStore) RecordStatusChange(c *try6.StatusChange) error {
+	log.LogD("Recording Status Change", "pkg", "store", "func", "RecordStatusChange(*try6.StatusChange)", "entity", c.Entity, "id", c.EntityID, "from", c.From, "to", c.To)
+	if err := d.C.InsertInto("status_changes").Blacklist("id").Record(c).Returning("id").QueryScalar(&c.ID); err != nil {
+		log.LogE("error recording status change", "pkg", "store", "func", "RecordStatusChange(*try6.StatusChange)", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetStatusChanges returns the status changes of the item, newest first
+func (d *DefaultStore) GetStatusChanges(entity, id string) ([]*try6.StatusChange, error) {
+	log.LogD("Listing Status Changes", "pkg", "store", "func", "GetStatusChanges(string, string)", "entity", entity, "id", id)
+	var changes []*try6.StatusChange
+	if err := d.C.Select("*").From("status_changes").Where("entity=$1 AND entity_id=$2", entity, id).OrderBy("created DESC").QueryStructs(&changes); err != nil {
+		log.LogE("error listing status changes", "pkg", "store", "func", "GetStatusChanges(string, string)", "error", err.Error())
+		return nil, err
+	}
+	return changes, nil
+}
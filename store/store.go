@@ -25,6 +25,24 @@ type Storer interface {
 	Keyer
 	Directer
 	Scoper
+	Policier
+	AccountTokener
+	LoginAuditer
+	MFAer
+	RecoveryCoder
+	ImportJober
+	CustomDataer
+	StatusChanger
+	Clienter
+	JWTer
+	AuthCoder
+	Brander
+	RefreshTokener
+	Revoker
+	DeviceCoder
+	InitialAccessTokener
+	APIKeyer
+	Consenter
 }
 
 /*
@@ -14,7 +14,8 @@ type Tenanter interface {
 	SaveTenant(tenant *try6.Tenant) error
 }
 
-// SaveTenant persist the tenant data to the database
+// SaveTenant persist the tenant data to the database. New tenants are created
+// active and the status of existing ones is only changed by ChangeStatus.
 func (d *DefaultStore) SaveTenant(t *try6.Tenant) error {
 	log.LogD("Saving Tenant", "pkg", "store", "func", "SaveTenant(*try6.Tenant)", "data", t)
 	now := time.Now().UTC()
@@ -22,17 +23,20 @@ func (d *DefaultStore) SaveTenant(t *try6.Tenant) error {
 	if t.ID == "" {
 		// New Tenant
 		t.Created = now
+		if t.Status == "" {
+			t.Status = try6.StatusActive
+		}
 		return d.C.InsertInto("tenants").Blacklist("id", "deleted").Record(t).Returning("id").QueryScalar(&t.ID)
 	}
-	return d.C.Update("tenants").SetBlacklist(t, "id", "label", "created").Where("id=$1", t.ID).Returning("*").QueryStruct(t)
+	return d.C.Update("tenants").SetBlacklist(t, "id", "label", "status", "created").Where("id=$1", t.ID).Returning("*").QueryStruct(t)
 }
 
 // CreateTenant creates a new tenant with the data provided in try6.CreateTenantData.
 // The steps are:
 //   1. Create a new tenant in the database
-//   2. Create the admin directory for the tenant where the tenant admin accounts will live
+//   2. Create the admin directory for the tenant where the tenant admin accounts will live. New directories require MFA
 //   3. If an account is provided (it is created in a previous step), it will be assigned as default admin account
-//      If no account is provide, a new one is created and made the default admin account. In this case an RSA Key pair is created for the account
+//      If no account is provide, a new one is created and made the default admin account. An RSA Key pair owned by the account is created to sign the tokens of the tenant
 //   4. A default scope is created for admin purposes. As the account, it can be created prior to the call to NewTenant and be used here
 //   5. Maps the admin scope to the admin directory so the tenant can modify it
 //
@@ -63,6 +67,8 @@ func (d *DefaultStore) CreateTenant(data *try6.CreateTenantData) error {
 	}
 
 	data.Dir.TenantUID = data.TData.ID
+	// its accounts administer the tenant
+	data.Dir.Admin = true
 
 	if data.Dir.Label == "" {
 		data.Dir.Label = "Default Admin Directory"
@@ -71,7 +77,15 @@ func (d *DefaultStore) CreateTenant(data *try6.CreateTenantData) error {
 		data.Dir.Description = "Default directory to hold administrative accounts for this tenant"
 	}
 	if data.Dir.Status == "" {
-		data.Dir.Status = "active"
+		data.Dir.Status = try6.StatusActive
+	}
+	if data.Dir.ID == "" {
+		// admin accounts must use a second factor unless changed afterwards. It can
+		// only be enrolled when the TOTP secrets can be encrypted.
+		data.Dir.RequireMFA = try6.SecretKeyConfigured()
+		if !data.Dir.RequireMFA {
+			log.LogW("SecretKey not configured. The admin directory does not require MFA", "pkg", "store", "func", "CreateTenant(*try6.CreateTenantData)")
+		}
 	}
 
 	if err := d.SaveDirectory(data.Dir); err != nil {
@@ -85,20 +99,18 @@ func (d *DefaultStore) CreateTenant(data *try6.CreateTenantData) error {
 	}
 	if data.Acc.ID == "" {
 		// New account
+		if err := data.Acc.NormalizeEmail(data.Dir.CaseSensitiveEmail); err != nil {
+			log.LogE("Invalid email for admin account", "pkg", "store", "func", "CreateTenant(*try6.CreateTenantData)", "error", err)
+			return err
+		}
 		if err := data.Acc.UpdatePassword(data.Acc.Password); err != nil {
-			log.LogW("Could not update password for admin account", "pkg", "store", "func", "CreateTenant(*try6.CreateTenantData)", "error", err)
+			log.LogE("Could not update password for admin account", "pkg", "store", "func", "CreateTenant(*try6.CreateTenantData)", "error", err)
+			return err
 		}
 		if err := d.SaveAccount(data.Dir.ID, data.Acc); err != nil {
 			log.LogE("Could not create admin account", "pkg", "store", "func", "CreateTenant(*try6.CreateTenantData)", "error", err)
 			return err
 		}
-
-		// 4. Create RSA Keys for acc as it is new
-		k := try6.NewKey(data.Acc.ID)
-		if err := d.SaveKey(k); err != nil {
-			log.LogE("Could not create rsa key for admin account", "pkg", "store", "func", "CreateTenant(*try6.CreateTenantData)", "error", err)
-			return err
-		}
 	} else {
 		// account exists. Must add it to the admin directory
 		if _, err := d.C.Upsert("directory_account").Columns("directory_id", "account_id", "created", "updated").Record(&try6.DirectoryAccount{
@@ -112,6 +124,18 @@ func (d *DefaultStore) CreateTenant(data *try6.CreateTenantData) error {
 		}
 	}
 
+	// 4. Create the RSA Keys of the tenant, owned by the admin account. They sign the
+	// tokens issued for the tenant scopes.
+	k := try6.NewKey(data.Acc.ID)
+	if k == nil {
+		return tryerr.ErrNilKey
+	}
+	k.TenantID = data.TData.ID
+	if err := d.SaveKey(k); err != nil {
+		log.LogE("Could not create rsa key for tenant", "pkg", "store", "func", "CreateTenant(*try6.CreateTenantData)", "error", err)
+		return err
+	}
+
 	var aki []string
 	if err := d.C.Select("id").From("keys").Where("account_id=$1 AND deleted IS NULL", data.Acc.ID).QuerySlice(&aki); err != nil {
 		log.LogW("account has no rsa keys", "pkg", "store", "func", "CreateTenant(*try6.CreateTenantData)", "error", err.Error())
@@ -135,7 +159,7 @@ func (d *DefaultStore) CreateTenant(data *try6.CreateTenantData) error {
 		data.Scope.Description = "Default scope to administer this tenant"
 	}
 	if data.Scope.Status == "" {
-		data.Scope.Status = "active"
+		data.Scope.Status = try6.StatusActive
 	}
 	if err := d.SaveScope(data.Scope); err != nil {
 		log.LogE("Could not create admin Scope", "pkg", "store", "func", "CreateTenant(*try6.CreateTenantData)", "error", err)
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6"
+	"github.com/jllopis/try6/log"
+	"github.com/jllopis/try6/tryerr"
+)
+
+// AccountTokener defines the methods needed to manage single use account tokens
+type AccountTokener interface {
+	SaveAccountToken(t *try6.AccountToken) error
+	GetAccountToken(kind, hash string) (*try6.AccountToken, error)
+	UseAccountToken(t *try6.AccountToken) error
+	RevokeAccountTokens(accountID, kind string) error
+}
+
+// SaveAccountToken persist a new account token to the database
+func (d *DefaultStore) SaveAccountToken(t *try6.AccountToken) error {
+	log.LogD("Saving Account Token", "pkg", "store", "func", "SaveAccountToken(*try6.AccountToken)", "account", t.AccountID, "kind", t.Kind)
+	if t.ID != "" {
+		return tryerr.ErrIDNotNull
+	}
+	if t.Created.IsZero() {
+		t.Created = time.Now().UTC()
+	}
+	return d.C.InsertInto("account_tokens").Blacklist("id", "used").Record(t).Returning("id").QueryScalar(&t.ID)
+}
+
+// GetAccountToken returns the token of the given kind that matches the hash or
+// tryerr.ErrTokenNotFound if none does
+func (d *DefaultStore) GetAccountToken(kind, hash string) (*try6.AccountToken, error) {
+	var t try6.AccountToken
+	if err := d.C.Select("*").From("account_tokens").Where("kind=$1 AND hash=$2", kind, hash).QueryStruct(&t); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tryerr.ErrTokenNotFound
+		}
+		log.LogE("error loading account token", "pkg", "store", "func", "GetAccountToken(string, string)", "error", err.Error())
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UseAccountToken marks the token as used. It fails with tryerr.ErrInvalidToken if
+// the token was already used, so only one caller can consume it.
+func (d *DefaultStore) UseAccountToken(t *try6.AccountToken) error {
+	var used time.Time
+	err := d.C.Update("account_tokens").Set("used", time.Now().UTC()).Where("id=$1 AND used IS NULL", t.ID).Returning("used").QueryScalar(&used)
+	switch {
+	case err == dat.ErrNotFound:
+		return tryerr.ErrInvalidToken
+	case err != nil:
+		log.LogE("error using account token", "pkg", "store", "func", "UseAccountToken(*try6.AccountToken)", "error", err.Error())
+		return err
+	}
+	t.Used.Time, t.Used.Valid = used, true
+	return nil
+}
+
+// RevokeAccountTokens marks as used every pending token of the given kind for the account
+func (d *DefaultStore) RevokeAccountTokens(accountID, kind string) error {
+	if _, err := d.C.Update("account_tokens").Set("used", time.Now().UTC()).Where("account_id=$1 AND kind=$2 AND used IS NULL", accountID, kind).Exec(); err != nil {
+		log.LogE("error revoking account tokens", "pkg", "store", "func", "RevokeAccountTokens(string, string)", "error", err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package try6
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+const (
+	// TokenPasswordReset is the kind of the tokens used to reset an account password
+	TokenPasswordReset = "password_reset"
+	// TokenEmailVerification is the kind of the tokens used to verify an account email
+	TokenEmailVerification = "email_verification"
+)
+
+var (
+	// PasswordResetTTL is the time a password reset token is valid since its creation
+	PasswordResetTTL = time.Hour
+	// EmailVerificationTTL is the time an email verification token is valid since its creation
+	EmailVerificationTTL = 72 * time.Hour
+)
+
+// NewAccountToken creates a single use token of the given kind for the account that
+// expires after ttl. The token returned holds only the hash of the secret, so the
+// secret returned must be handed to the account owner as it can not be recovered.
+func NewAccountToken(accountID, kind string, ttl time.Duration) (*AccountToken, string, error) {
+	if accountID == "" {
+		return nil, "", tryerr.ErrNilUID
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now().UTC()
+	return &AccountToken{
+		AccountID: accountID,
+		Kind:      kind,
+		Hash:      HashToken(secret),
+		Expires:   now.Add(ttl),
+		Created:   now,
+	}, secret, nil
+}
+
+// HashToken returns the hex encoded SHA-256 of the token secret as it is stored
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Valid checks that the token has not been used and has not expired
+func (t *AccountToken) Valid() error {
+	switch {
+	case t.Used.Valid:
+		return tryerr.ErrInvalidToken
+	case time.Now().UTC().After(t.Expires):
+		return tryerr.ErrTokenExpired
+	default:
+		return nil
+	}
+}
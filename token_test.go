@@ -0,0 +1,49 @@
+package try6
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgutz/dat.v1"
+
+	"github.com/jllopis/try6/tryerr"
+)
+
+func TestNewAccountToken(t *testing.T) {
+	if _, _, err := NewAccountToken("", TokenPasswordReset, time.Hour); err != tryerr.ErrNilUID {
+		t.Errorf("token without account: got %v, want %v", err, tryerr.ErrNilUID)
+	}
+	tok, secret, err := NewAccountToken("account", TokenPasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccountID != "account" || tok.Kind != TokenPasswordReset || tok.Hash != HashToken(secret) || tok.Hash == secret {
+		t.Errorf("unexpected token %+v", tok)
+	}
+	other, secret2, err := NewAccountToken("account", TokenPasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == secret2 || tok.Hash == other.Hash {
+		t.Error("tokens must be random")
+	}
+}
+
+func TestAccountTokenValid(t *testing.T) {
+	tok, _, err := NewAccountToken("account", TokenEmailVerification, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tok.Valid(); err != nil {
+		t.Errorf("new token: got %v", err)
+	}
+	tok.Used = dat.NullTimeFrom(time.Now())
+	if err := tok.Valid(); err != tryerr.ErrInvalidToken {
+		t.Errorf("used token: got %v, want %v", err, tryerr.ErrInvalidToken)
+	}
+	tok.Used = dat.NullTime{}
+	tok.Expires = time.Now().UTC().Add(-time.Second)
+	if err := tok.Valid(); err != tryerr.ErrTokenExpired {
+		t.Errorf("expired token: got %v, want %v", err, tryerr.ErrTokenExpired)
+	}
+}
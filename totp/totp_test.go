@@ -0,0 +1,58 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for SHA1, truncated to 6 digits
+var vectors = []struct {
+	t    int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+}
+
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for _, v := range vectors {
+		code, err := Code(secret, Step(time.Unix(v.t, 0)))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		if code != v.code {
+			t.Errorf("Code at %d = %s, want %s", v.t, code, v.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	prev, _ := Code(secret, Step(now)-1)
+	if step, ok := Validate(secret, prev, now, 1); !ok || step != Step(now)-1 {
+		t.Errorf("code of previous step not accepted with skew 1")
+	}
+	if _, ok := Validate(secret, prev, now, 0); ok {
+		t.Errorf("code of previous step accepted without skew")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Errorf("short code accepted")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("try6", "user@example.com", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/try6:user@example.com?") || !strings.Contains(uri, "secret=ABC") {
+		t.Errorf("unexpected uri %s", uri)
+	}
+}
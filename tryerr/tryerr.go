@@ -19,6 +19,10 @@ var (
 	ErrAccountNotProvided = errors.New("account not provided")
 	// ErrAccountNotFound is returned when the required account was not found in the store
 	ErrAccountNotFound = errors.New("account not found")
+	// ErrDirectoryNotFound is returned when the required directory was not found in the store
+	ErrDirectoryNotFound = errors.New("directory not found")
+	// ErrDirectoryNotEmpty is returned when a setting of a directory can only be changed while it has no accounts
+	ErrDirectoryNotEmpty = errors.New("directory has accounts")
 	// ErrEmailNotFound is returned when no account is found in the store with the given email
 	ErrEmailNotFound = errors.New("email not found")
 	// ErrDupEmail is returned when the provided email is already found in the store
@@ -27,6 +31,18 @@ var (
 	ErrInvalidName = errors.New("invalid name")
 	// ErrInvalidPassword alert about an invalid password
 	ErrInvalidPassword = errors.New("invalid password")
+	// ErrPasswordReused is returned when the new password matches one of the previous passwords of the account
+	ErrPasswordReused = errors.New("password has been used recently")
+	// ErrPasswordExpired is returned when the account password is older than allowed by the directory policy
+	ErrPasswordExpired = errors.New("password change required")
+	// ErrInvalidCredentials is returned when the email or password provided do not match any account
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrEmailUnverified is returned when an account that has not verified its email tries to authenticate
+	ErrEmailUnverified = errors.New("email not verified")
+	// ErrAccountLocked is returned when the account is locked after too many failed logins
+	ErrAccountLocked = errors.New("account locked")
+	// ErrTooManyAttempts is returned when too many failed logins have been made from the same address
+	ErrTooManyAttempts = errors.New("too many failed attempts")
 	// ErrInvalidEmail notifies than the provided email is no valid
 	ErrInvalidEmail = errors.New("invalid email address")
 	// ErrKeyExists is returned when the provided key already exists in the store
@@ -43,6 +59,8 @@ var (
 	ErrTokenNotFound = errors.New("token not found")
 	// ErrInvalidToken  is returned when the token is not a JWT valid token
 	ErrInvalidToken = errors.New("token not valid")
+	// ErrTokenExpired is returned when the token is past its expiration time
+	ErrTokenExpired = errors.New("token expired")
 	// ErrNilToken is returned when the provided token is nil
 	ErrNilToken = errors.New("token is nil")
 	// ErrUnauthorized is returned if the provided token is not authorized to access the resource
@@ -53,6 +71,114 @@ var (
 	ErrRbacPermissionNotFound = errors.New("RBAC permission not found")
 	// ErrRbacUserNotProvided is returned when the affected user id is not provided
 	ErrRbacUserNotProvided = errors.New("RBAC user not found")
+	// ErrNoMailer is returned when an email must be sent and no mail sender is configured
+	ErrNoMailer = errors.New("mail sender not configured")
+	// ErrTemplateNotFound is returned when the requested email template does not exist
+	ErrTemplateNotFound = errors.New("template not found")
+	// ErrHashTooCostly is returned when the parameters of a password hash exceed the limits accepted
+	ErrHashTooCostly = errors.New("hash parameters exceed the limits")
+	// ErrNoSecretKey is returned when a secret must be encrypted and no valid key is configured
+	ErrNoSecretKey = errors.New("secret key not configured")
+	// ErrInvalidSecret is returned when an encrypted secret can not be decrypted
+	ErrInvalidSecret = errors.New("invalid secret")
+	// ErrMFANotFound is returned when the account has no second factor enrolled
+	ErrMFANotFound = errors.New("mfa not found")
+	// ErrInvalidMFACode is returned when the second factor code is not valid
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+	// ErrMFARequired is returned when the account must enroll a second factor to authenticate
+	ErrMFARequired = errors.New("mfa enrollment required")
+	// ErrMFACodeRequired is returned when a code of the active authenticator of the account is needed to change it
+	ErrMFACodeRequired = errors.New("mfa code required")
+	// ErrUnknownHash is returned when the algorithm of a stored hash is not known
+	ErrUnknownHash = errors.New("unknown hash algorithm")
+	// ErrInvalidStatus is returned when the status is not valid for the item
+	ErrInvalidStatus = errors.New("invalid status")
+	// ErrImportJobNotFound is returned when the import job does not exist
+	ErrImportJobNotFound = errors.New("import job not found")
+	// ErrImportInterrupted is recorded in the import jobs that were not finished when the server stopped
+	ErrImportInterrupted = errors.New("import interrupted by a server restart")
+	// ErrInvalidFormat is returned when the format of an import or export is not supported
+	ErrInvalidFormat = errors.New("invalid format")
+	// ErrCustomDataTooLarge is returned when a custom data document exceeds the size limits
+	ErrCustomDataTooLarge = errors.New("custom data too large")
+	// ErrInvalidCustomDataKey is returned when a custom data key or claim name is not valid
+	ErrInvalidCustomDataKey = errors.New("invalid custom data key")
+	// ErrCustomDataKeyNotFound is returned when the key is not in the custom data document
+	ErrCustomDataKeyNotFound = errors.New("custom data key not found")
+	// ErrReservedClaim is returned when a custom data key is mapped to a registered token claim
+	ErrReservedClaim = errors.New("reserved claim")
+	// ErrScopeNotFound is returned when the scope does not exist
+	ErrScopeNotFound = errors.New("scope not found")
+	// ErrInvalidSort is returned when the items can not be sorted by the requested field
+	ErrInvalidSort = errors.New("invalid sort field")
+	// ErrInvalidCursor is returned when the page cursor is not valid for the query
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidUsername is returned when the username has characters not allowed or is too long
+	ErrInvalidUsername = errors.New("invalid username")
+	// ErrInvalidPhone is returned when the phone number is not in E.164 format
+	ErrInvalidPhone = errors.New("invalid phone number")
+	// ErrInvalidLocale is returned when the locale is not a BCP 47 language tag
+	ErrInvalidLocale = errors.New("invalid locale")
+	// ErrInvalidTimezone is returned when the timezone is not an IANA time zone name
+	ErrInvalidTimezone = errors.New("invalid timezone")
+	// ErrInvalidPicture is returned when the picture is not an absolute http or https URL
+	ErrInvalidPicture = errors.New("invalid picture url")
+	// ErrTenantNotFound is returned when the tenant does not exist
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrInvalidTransition is returned when the status of an item can not change to the requested one
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrInvalidEntity is returned when the entity type is not known
+	ErrInvalidEntity = errors.New("invalid entity")
+	// ErrActorNotProvided is returned when a status change does not say who makes it
+	ErrActorNotProvided = errors.New("actor not provided")
+	// ErrDisabled is returned when the item, or the one it belongs to, has been disabled
+	ErrDisabled = errors.New("disabled")
+	// ErrDeleted is returned when the item, or the one it belongs to, has been deleted
+	ErrDeleted = errors.New("deleted")
+	// ErrClientNotFound is returned when the OAuth client does not exist
+	ErrClientNotFound = errors.New("client not found")
+	// ErrInvalidClient is returned when the OAuth client can not be authenticated
+	ErrInvalidClient = errors.New("invalid client")
+	// ErrUnsupportedGrant is returned when the grant type is not supported or not allowed to the client
+	ErrUnsupportedGrant = errors.New("unsupported grant type")
+	// ErrInvalidRedirectURI is returned when a redirect URI is not an absolute URI without fragment
+	ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+	// ErrInvalidAudience is returned when the client can not request a token for the audience
+	ErrInvalidAudience = errors.New("invalid audience")
+	// ErrInvalidGrant is returned when an authorization code or other grant is not valid, has expired or was issued to another client
+	ErrInvalidGrant = errors.New("invalid grant")
+	// ErrInvalidCodeChallenge is returned when the PKCE code challenge is missing or is not a S256 challenge
+	ErrInvalidCodeChallenge = errors.New("invalid code challenge")
+	// ErrInvalidCodeVerifier is returned when the PKCE code verifier does not match the code challenge
+	ErrInvalidCodeVerifier = errors.New("invalid code verifier")
+	// ErrPublicClient is returned when an operation needs a client secret and the client is public
+	ErrPublicClient = errors.New("public client")
+	// ErrInvalidColor is returned when a color is not in #rrggbb form
+	ErrInvalidColor = errors.New("invalid color")
+	// ErrTokenReused is returned when a refresh token that has already been rotated is used again
+	ErrTokenReused = errors.New("refresh token reused")
+	// ErrInvalidScope is returned when the scopes requested are not valid or exceed the ones granted
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrAuthorizationPending is returned when a device polls for tokens before the account approves its device code
+	ErrAuthorizationPending = errors.New("authorization pending")
+	// ErrSlowDown is returned when a device polls for tokens before its interval has passed
+	ErrSlowDown = errors.New("slow down")
+	// ErrExpiredToken is returned when a device code has expired before it was exchanged for tokens
+	ErrExpiredToken = errors.New("device code expired")
+	// ErrInvalidUserCode is returned when the user code of a device does not exist, has expired or has been used
+	ErrInvalidUserCode = errors.New("invalid user code")
+	// ErrInvalidExpiration is returned when an expiration time is already past
+	ErrInvalidExpiration = errors.New("invalid expiration")
+	// ErrAPIKeyNotFound is returned when the API key does not exist or has been deleted
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrConsentDenied is returned when the account does not consent to the scopes requested by a client
+	ErrConsentDenied = errors.New("consent denied")
+	// ErrConsentNotFound is returned when the account has not consented to the client or revoked its consent
+	ErrConsentNotFound = errors.New("consent not found")
+	// ErrFirstPartyRequired is returned when a third party client acts on something only first party clients can
+	ErrFirstPartyRequired = errors.New("only first party clients are allowed")
+	// ErrAccountAccessDenied is returned when the request is not made by the account nor by an administrator of its tenant
+	ErrAccountAccessDenied = errors.New("not allowed to manage the account")
 	// ErrNotImplemented is returned when the functionality required is not implemented
 	ErrNotImplemented = errors.New("function not implemented")
 )
@@ -0,0 +1,27 @@
+package try6
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+)
+
+// RegexpUUID matches the text form of an UUID
+var RegexpUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// NewUUID returns a random (version 4) UUID
+func NewUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// ValidUUID reports whether s is an UUID. Ids provided by the clients should be
+// checked before they are looked up.
+func ValidUUID(s string) bool {
+	return RegexpUUID.MatchString(s)
+}